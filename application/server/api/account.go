@@ -1,10 +1,14 @@
 package api
 
 import (
+	"application/config"
 	"application/model"
+	"application/pkg/fabric"
 	"application/service"
 	"application/utils"
+	"errors"
 	"fmt"
+	"net/http"
 	"path/filepath"
 	"strconv"
 
@@ -16,16 +20,25 @@ import (
 
 type AccountHandler struct {
 	accountService *service.AccountService
+	sessionService *service.SessionService
+	emailService   *service.EmailService
 }
 
-func NewAccountHandler() *AccountHandler {
-	accountService, err := service.NewAccountService()
+func NewAccountHandler(ledger fabric.LedgerClient) *AccountHandler {
+	accountService, err := service.NewAccountService(ledger)
 	if err != nil {
 		panic("初始化账号服务失败：" + err.Error())
 	}
 
+	emailService, err := service.NewEmailService()
+	if err != nil {
+		panic("初始化邮件服务失败：" + err.Error())
+	}
+
 	return &AccountHandler{
 		accountService: accountService,
+		sessionService: service.NewSessionService(),
+		emailService:   emailService,
 	}
 }
 
@@ -54,19 +67,67 @@ func (h *AccountHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, user, err := h.accountService.Login(&req)
+	pair, user, challenge, err := h.accountService.Login(&req, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		utils.ServerError(c, "登录失败："+err.Error())
 		return
 	}
+	// 开启了两步验证，客户端带着挑战令牌和验证码调用 /account/login/2fa
+	if challenge != nil {
+		utils.SuccessWithMessage(c, "请输入两步验证码", challenge)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "登录成功", loginResponse(pair, user))
+}
+
+// 登录第二步，提交两步验证码或恢复码
+func (h *AccountHandler) LoginTwoFactor(c *gin.Context) {
+	var req model.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChallengeToken == "" {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
 
-	// 返回用户信息（不包含密码）和令牌
-	response := map[string]interface{}{
-		"token": token,
-		"user":  user,
+	pair, user, err := h.accountService.LoginTwoFactor(&req, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		utils.ServerError(c, "登录失败："+err.Error())
+		return
 	}
 
-	utils.SuccessWithMessage(c, "登录成功", response)
+	utils.SuccessWithMessage(c, "登录成功", loginResponse(pair, user))
+}
+
+// 返回用户信息（不包含密码）和令牌
+func loginResponse(pair *model.TokenPair, user *model.User) map[string]interface{} {
+	return map[string]interface{}{
+		"token":            pair.AccessToken,
+		"expiresAt":        pair.AccessExpiresAt,
+		"refreshToken":     pair.RefreshToken,
+		"refreshExpiresAt": pair.RefreshExpiresAt,
+		"user":             user,
+	}
+}
+
+// 用刷新令牌换发访问令牌，刷新令牌同时轮换，客户端需要保存新的刷新令牌
+func (h *AccountHandler) Refresh(c *gin.Context) {
+	var req model.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+
+	pair, err := h.sessionService.Refresh(req.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, service.ErrRefreshTokenInvalid) || errors.Is(err, service.ErrRefreshTokenExpired) ||
+			errors.Is(err, service.ErrRefreshTokenReused) {
+			utils.Fail(c, http.StatusUnauthorized, "刷新令牌失败："+err.Error())
+			return
+		}
+		utils.ServerError(c, "刷新令牌失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "刷新成功", pair)
 }
 
 func (h *AccountHandler) Logout(c *gin.Context) {
@@ -84,7 +145,7 @@ func (h *AccountHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	err := h.accountService.Logout(token)
+	err := h.sessionService.Logout(token)
 	if err != nil {
 		utils.ServerError(c, "登出失败："+err.Error())
 		return
@@ -93,6 +154,51 @@ func (h *AccountHandler) Logout(c *gin.Context) {
 	utils.SuccessWithMessage(c, "登出成功", nil)
 }
 
+// 当前用户的有效会话，包含设备和 IP
+func (h *AccountHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	sessions, err := h.sessionService.ListActive(userID.(int), c.GetString("sessionID"))
+	if err != nil {
+		utils.ServerError(c, "查询会话失败："+err.Error())
+		return
+	}
+	utils.Success(c, sessions)
+}
+
+// 注销自己的某个会话，被注销设备的刷新令牌立即失效
+func (h *AccountHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	sessionID := c.Param("id")
+	if err := h.sessionService.Revoke(userID.(int), sessionID); err != nil {
+		utils.ServerError(c, "注销会话失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "注销会话成功", nil)
+}
+
+// 注销除当前会话以外的全部会话
+func (h *AccountHandler) RevokeOtherSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	count, err := h.sessionService.RevokeOthers(userID.(int), c.GetString("sessionID"), model.SessionRevoked)
+	if err != nil {
+		utils.ServerError(c, "注销会话失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, fmt.Sprintf("已注销 %d 个会话", count), nil)
+}
+
 func (h *AccountHandler) GetProfile(c *gin.Context) {
 	// 从上下文中获取用户ID（由中间件设置）
 	userID, exists := c.Get("userID")
@@ -147,6 +253,14 @@ func (h *AccountHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	// 修改密码后注销其他设备上的会话
+	if _, ok := updates["password"]; ok {
+		if _, err := h.sessionService.RevokeOthers(userID.(int), c.GetString("sessionID"), model.SessionPasswordChanged); err != nil {
+			utils.ServerError(c, "密码已修改，但注销其他会话失败："+err.Error())
+			return
+		}
+	}
+
 	utils.SuccessWithMessage(c, "更新成功", nil)
 }
 
@@ -180,7 +294,7 @@ func (h *AccountHandler) UpdateAvatar(c *gin.Context) {
 
 	// 为图片添加 uid，避免名称冲突
 	newFileName := uuid.New().String() + file.Filename
-	dst := filepath.Join("public", "images", newFileName)
+	dst := filepath.Join(config.GlobalConfig.Storage.ImageDir, newFileName)
 
 	// 保存图片到 pulic/images
 	if err := c.SaveUploadedFile(file, dst); err != nil {
@@ -197,41 +311,74 @@ func (h *AccountHandler) UpdateAvatar(c *gin.Context) {
 	utils.SuccessWithMessage(c, "更新成功", avatarURL)
 }
 
-func (h *AccountHandler) UpdateOrg(c *gin.Context) {
-	// 从上下文获取用户组织
-	org, exists := c.Get("org")
+func (h *AccountHandler) GetUserNameById(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	userName, err := h.accountService.GetUserNameById(userID)
+	if err != nil {
+		utils.ServerError(c, "获取用户名失败："+err.Error())
+		return
+	}
+	utils.Success(c, userName)
+}
+
+// 重新发送验证邮件
+func (h *AccountHandler) SendVerificationEmail(c *gin.Context) {
+	userID, exists := c.Get("userID")
 	if !exists {
-		utils.ServerError(c, "用户组织获取失败")
+		utils.ServerError(c, "用户信息获取失败")
 		return
 	}
-	if org.(int) != 1 {
-		utils.ServerError(c, "只有平台管理员可以更新用户组织")
+	user, err := h.accountService.GetUserByID(userID.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
 		return
 	}
-	var req model.UpdateOrgRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := h.emailService.SendVerification(user); err != nil {
+		utils.ServerError(c, "发送验证邮件失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "验证邮件已发送", nil)
+}
+
+// 验证邮箱，令牌来自验证邮件中的链接
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req model.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
 		utils.BadRequest(c, "请求参数格式错误")
 		return
 	}
+	if err := h.emailService.Verify(req.Token); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "邮箱验证成功", nil)
+}
 
-	err := h.accountService.UpdateOrg(req.UserID, req.Org)
-	if err != nil {
-		utils.ServerError(c, "更新组织失败："+err.Error())
+// 忘记密码，邮件在后台发送，邮箱是否注册过、发送是否成功都返回成功
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req model.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		utils.BadRequest(c, "请求参数格式错误")
 		return
 	}
-	utils.SuccessWithMessage(c, "更新成功", nil)
+	h.emailService.RequestPasswordReset(req.Email)
+	utils.SuccessWithMessage(c, "如果该邮箱已注册，重置链接已发送到邮箱", nil)
 }
 
-func (h *AccountHandler) GetUserNameById(c *gin.Context) {
-	userID, err := strconv.Atoi(c.Query("id"))
-	if err != nil {
+// 用重置链接设置新密码，成功后需要重新登录
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req model.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
 		utils.BadRequest(c, "请求参数格式错误")
 		return
 	}
-	userName, err := h.accountService.GetUserNameById(userID)
-	if err != nil {
-		utils.ServerError(c, "获取用户名失败："+err.Error())
+	if err := h.emailService.ResetPassword(req.Token, req.Password); err != nil {
+		utils.BadRequest(c, err.Error())
 		return
 	}
-	utils.Success(c, userName)
+	utils.SuccessWithMessage(c, "密码已重置，请重新登录", nil)
 }
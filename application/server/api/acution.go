@@ -2,11 +2,10 @@ package api
 
 import (
 	"application/model"
+	"application/pkg/fabric"
 	"application/service"
 	"application/utils"
-	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,8 +14,8 @@ type AuctionHandler struct {
 	service *service.AuctionService
 }
 
-func NewAuctionHandler() *AuctionHandler {
-	return &AuctionHandler{service: service.NewAuctionService(model.DB)}
+func NewAuctionHandler(ledger fabric.LedgerClient) *AuctionHandler {
+	return &AuctionHandler{service: service.NewAuctionService(model.DB, ledger)}
 }
 
 // 创建拍卖品
@@ -39,15 +38,7 @@ func (h *AuctionHandler) CreateLot(c *gin.Context) {
 		utils.ServerError(c, err.Error())
 		return
 	}
-	lot, err := h.service.GetLotByAssetID(lotRequest.AssetID)
-	if err != nil {
-		utils.ServerError(c, err.Error())
-		return
-	}
-	time.AfterFunc(time.Until(lotRequest.Deadline), func() {
-		h.service.FinishAuction(lot.ID)
-		fmt.Printf("定时器任务执行，当前时间为%s\n", time.Now().Format("2006-01-02 15:04:05"))
-	})
+	// 到期结算由后台调度器（finishExpiredLots）负责，服务重启后也不会丢失
 	utils.SuccessWithMessage(c, "创建拍卖品成功", nil)
 }
 
@@ -118,16 +109,21 @@ func (h *AuctionHandler) GetBidPrice(c *gin.Context) {
 	utils.SuccessWithMessage(c, "查询出价成功", bidPrice)
 }
 
-// 结束拍卖不需要被前端调用，因为我们会在后端创建一个定时器任务
-// 当拍卖到达结束时间时自动选择最高价
-// 但是这里加这个接口用于调试
+// 结束拍卖不需要被前端调用，后台调度器会定期扫描到期拍品
+// 并自动选择最高价
+// 这个接口只允许卖家在截止后立即结算自己的拍品
 func (h *AuctionHandler) FinishAuction(c *gin.Context) {
 	lotID, err := strconv.Atoi(c.Query("lotID"))
 	if err != nil {
 		utils.ServerError(c, "拍卖品ID不能为空")
 		return
 	}
-	err = h.service.FinishAuction(lotID)
+	sellerID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	err = h.service.FinishAuctionBySeller(lotID, sellerID.(int))
 	if err != nil {
 		utils.ServerError(c, err.Error())
 		return
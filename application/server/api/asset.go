@@ -1,7 +1,9 @@
 package api
 
 import (
+	"application/config"
 	"application/model"
+	"application/pkg/fabric"
 	"application/service"
 	"application/utils"
 	"fmt"
@@ -15,9 +17,9 @@ type AssetHandler struct {
 	assetService *service.AssetService
 }
 
-func NewAssetHandler() *AssetHandler {
+func NewAssetHandler(ledger fabric.LedgerClient) *AssetHandler {
 	return &AssetHandler{
-		assetService: service.NewAssetService(model.GetDB()),
+		assetService: service.NewAssetService(model.GetDB(), ledger),
 	}
 }
 
@@ -32,10 +34,6 @@ func (h *AssetHandler) CreateAsset(c *gin.Context) {
 		utils.ServerError(c, "组织信息获取失败")
 		return
 	}
-	if org.(int) != 2 {
-		utils.ServerError(c, "只有属于NFT创建者组织的用户可以上传NFT")
-		return
-	}
 	// 为了保证原子性，图片必须与资产信息一起提交
 	// 所以这里使用表单(form-data)提交
 	// 参数就使用 PostForm 获取
@@ -54,7 +52,7 @@ func (h *AssetHandler) CreateAsset(c *gin.Context) {
 		return
 	}
 	imageName := uuid.New().String() + image.Filename
-	dst := filepath.Join(model.DefaultImageFolder, imageName)
+	dst := filepath.Join(config.GlobalConfig.Storage.ImageDir, imageName)
 	if err := c.SaveUploadedFile(image, dst); err != nil {
 		utils.ServerError(c, fmt.Sprintf("保存图片失败：%s", err.Error()))
 		return
@@ -145,6 +143,128 @@ func (h *AssetHandler) TransferAsset(c *gin.Context) {
 	utils.Success(c, nil)
 }
 
+func (h *AssetHandler) UpdateAssetMetadata(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "组织信息获取失败")
+		return
+	}
+	var req model.UpdateAssetMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	if req.ID == "" || req.Name == "" {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	if req.Description == "" {
+		req.Description = "暂无描述"
+	}
+	asset, err := h.assetService.UpdateAssetMetadata(req.ID, req.Name, req.Description, userID.(int), org.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, asset)
+}
+
+func (h *AssetHandler) GetAssetHistory(c *gin.Context) {
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "组织信息获取失败")
+		return
+	}
+	id := c.Query("id")
+	versions, err := h.assetService.GetAssetHistory(id, org.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, versions)
+}
+
+// 创建限量系列（form-data：name、description、supply、image）
+func (h *AssetHandler) CreateEditionSeries(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "组织信息获取失败")
+		return
+	}
+	name := c.PostForm("name")
+	if name == "" {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	supply, err := strconv.Atoi(c.PostForm("supply"))
+	// 发行量上限由链码校验
+	if err != nil || supply <= 0 {
+		utils.BadRequest(c, "发行量必须大于 0")
+		return
+	}
+	description := c.PostForm("description")
+	if description == "" {
+		description = "暂无描述"
+	}
+	image, err := c.FormFile("image")
+	if err != nil {
+		utils.ServerError(c, "获取请求参数失败")
+		return
+	}
+	imageName := uuid.New().String() + image.Filename
+	dst := filepath.Join(config.GlobalConfig.Storage.ImageDir, imageName)
+	if err := c.SaveUploadedFile(image, dst); err != nil {
+		utils.ServerError(c, fmt.Sprintf("保存图片失败：%s", err.Error()))
+		return
+	}
+	series, err := h.assetService.CreateEditionSeries(name, imageName, userID.(int), description, supply, org.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, series)
+}
+
+func (h *AssetHandler) GetEditionSeries(c *gin.Context) {
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "组织信息获取失败")
+		return
+	}
+	id := c.Query("id")
+	series, err := h.assetService.GetEditionSeries(id, org.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, series)
+}
+
+func (h *AssetHandler) GetEditionsBySeriesID(c *gin.Context) {
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "组织信息获取失败")
+		return
+	}
+	id := c.Query("seriesId")
+	assets, err := h.assetService.GetEditionsBySeriesID(id, org.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, assets)
+}
+
 func (h *AssetHandler) GetAssetStatus(c *gin.Context) {
 	id := c.Query("id")
 	status, err := h.assetService.GetAssetStatus(id)
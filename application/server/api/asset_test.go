@@ -0,0 +1,62 @@
+package api_test
+
+import (
+	"application/model"
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func (e *testEnv) createEdition(u testUser, name string, supply int) model.EditionSeries {
+	e.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("name", name)
+	form.WriteField("supply", strconv.Itoa(supply))
+	part, err := form.CreateFormFile("image", "image.png")
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	part.Write([]byte("png"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/asset/createEdition", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	var series model.EditionSeries
+	if code, msg := e.send(req, u.token, &series); code != http.StatusOK {
+		e.t.Fatalf("创建限量系列返回 %d：%s", code, msg)
+	}
+	return series
+}
+
+// 发行 100 份的限量系列，拷贝可以单独转移
+func TestEditionSeries(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.register("alice")
+	bob := e.register("bob")
+
+	series := e.createEdition(alice, "群星", 100)
+	var editions []model.Asset
+	e.mustCall(http.MethodGet, "/api/asset/getEditions?seriesId="+series.ID, alice.token, nil, &editions)
+	if len(editions) != 100 {
+		t.Fatalf("系列有 %d 份拷贝，期望 100", len(editions))
+	}
+	last := editions[99]
+	if last.EditionNumber != 100 || last.EditionSupply != 100 || last.OwnerId != alice.id {
+		t.Fatalf("第 100 份拷贝为 %+v", last)
+	}
+
+	e.mustCall(http.MethodPost, "/api/asset/transfer", alice.token, model.TransferAssetRequest{ID: last.ID, NewOwnerId: bob.id}, nil)
+	if got := e.owner(alice, last.ID); got != bob.id {
+		t.Fatalf("拷贝持有人为 %d，期望 bob(%d)", got, bob.id)
+	}
+	var owned []model.Asset
+	e.mustCall(http.MethodGet, fmt.Sprintf("/api/asset/getAssetByOwnerID?ownerId=%d", alice.id), alice.token, nil, &owned)
+	if len(owned) != 99 {
+		t.Fatalf("alice 持有 %d 份拷贝，期望 99", len(owned))
+	}
+}
@@ -0,0 +1,217 @@
+package api_test
+
+import (
+	"application/model"
+	"application/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// createLot 创建拍品并把开始时间改到过去，创建接口要求开始时间晚于当前时间
+func (e *testEnv) createLot(u testUser, assetID string, reservePrice int) model.Lot {
+	e.t.Helper()
+	e.mustCall(http.MethodPost, "/api/auction/create", u.token, model.CreateLotRequest{
+		AssetID: assetID, Title: "拍卖 " + assetID, ReservePrice: reservePrice,
+		StartTime: time.Now().Add(time.Minute), Deadline: time.Now().Add(time.Hour),
+	}, nil)
+	var lot model.Lot
+	if err := e.db.Where("asset_id = ?", assetID).First(&lot).Error; err != nil {
+		e.t.Fatal(err)
+	}
+	if err := e.db.Model(&lot).Update("start_time", time.Now().Add(-time.Minute)).Error; err != nil {
+		e.t.Fatal(err)
+	}
+	return lot
+}
+
+func (e *testEnv) bid(u testUser, lotID int, price int) (int, string) {
+	e.t.Helper()
+	return e.call(http.MethodPost, "/api/auction/bid", u.token, model.BidRequest{ID: lotID, BidPrice: price}, nil)
+}
+
+// 出价时冻结资金，加价只冻结差额；结算退还落选出价，NFT 过户后把赢家的冻结资金付给卖家
+func TestAuctionEscrow(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{"alice": e.register("alice"), "bob": e.register("bob"), "carol": e.register("carol")}
+	alice, bob, carol := users["alice"], users["bob"], users["carol"]
+
+	asset := e.createAsset(alice, "暮色")
+	lot := e.createLot(alice, asset.ID, 20)
+	for _, b := range []struct {
+		u     testUser
+		price int
+	}{{bob, 30}, {carol, 40}, {bob, 50}} {
+		if code, msg := e.bid(b.u, lot.ID, b.price); code != http.StatusOK {
+			t.Fatalf("出价 %d 返回 %d：%s", b.price, code, msg)
+		}
+	}
+	e.expectBalances(map[string]int{"alice": 100, "bob": 50, "carol": 60}, users)
+	if code, _ := e.bid(carol, lot.ID, 50); code == http.StatusOK {
+		t.Fatal("不高于当前价的出价应当失败")
+	}
+
+	// 链上冻结失败时恢复原出价和当前价
+	e.ledger.FailOn("WithHoldAccount", func(args []any) error { return errors.New("节点不可用") })
+	if code, _ := e.bid(carol, lot.ID, 70); code == http.StatusOK {
+		t.Fatal("冻结失败时出价应当失败")
+	}
+	e.ledger.FailOn("WithHoldAccount", nil)
+	var current model.Lot
+	if err := e.db.First(&current, lot.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var carolBid model.Bid
+	if err := e.db.Where("lot_id = ? and bidder_id = ?", lot.ID, carol.id).First(&carolBid).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current.CurrentPrice != 50 || carolBid.BidPrice != 40 || carolBid.HoldPending {
+		t.Fatalf("冻结失败后当前价为 %d，carol 的出价为 %+v", current.CurrentPrice, carolBid)
+	}
+	e.expectBalances(map[string]int{"carol": 60}, users)
+
+	// 过户失败时不付款也不记录结果，落选出价已经退还，重试时不会重复退款
+	if err := e.db.Model(&lot).Update("deadline", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewAuctionService(e.db, e.ledger)
+	e.ledger.FailOn("TransferAsset", func(args []any) error { return errors.New("节点不可用") })
+	if err := svc.FinishExpiredLots(); err == nil {
+		t.Fatal("过户失败时结算应返回错误")
+	}
+	e.expectBalances(map[string]int{"alice": 100, "bob": 50, "carol": 100}, users)
+	e.ledger.FailOn("TransferAsset", nil)
+	if err := svc.FinishExpiredLots(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := e.owner(alice, asset.ID); got != bob.id {
+		t.Fatalf("NFT 持有人为 %d，期望 bob(%d)", got, bob.id)
+	}
+	e.expectBalances(map[string]int{"alice": 150, "bob": 50, "carol": 100}, users)
+	holdings, err := e.ledger.GetWithHoldingsByListing("org2", fmt.Sprintf("lot-%d", lot.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 0 {
+		t.Errorf("结算后仍有冻结：%+v", holdings)
+	}
+	var result model.AuctionResult
+	e.mustCall(http.MethodGet, fmt.Sprintf("/api/auction/result?lotID=%d", lot.ID), bob.token, nil, &result)
+	if result.BidderID != bob.id || result.BidPrice != 50 {
+		t.Errorf("拍卖结果为 %+v", result)
+	}
+
+	// 重复结算失败，余额不变
+	if err := svc.FinishAuction(lot.ID); err == nil {
+		t.Fatal("重复结算应当失败")
+	}
+	e.expectBalances(map[string]int{"alice": 150, "bob": 50, "carol": 100}, users)
+}
+
+// 截止前不能结算，只有卖家可以手动结算；开始结算后不再接受出价
+func TestFinishAuctionGuards(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{"alice": e.register("alice"), "bob": e.register("bob"), "carol": e.register("carol")}
+	alice, bob, carol := users["alice"], users["bob"], users["carol"]
+
+	asset := e.createAsset(alice, "晨曦")
+	lot := e.createLot(alice, asset.ID, 20)
+	if code, msg := e.bid(bob, lot.ID, 30); code != http.StatusOK {
+		t.Fatalf("出价返回 %d：%s", code, msg)
+	}
+	finish := fmt.Sprintf("/api/auction/finish?lotID=%d", lot.ID)
+	if code, _ := e.call(http.MethodPost, finish, alice.token, nil, nil); code == http.StatusOK {
+		t.Fatal("截止前结算应当失败")
+	}
+	if code, _ := e.bid(carol, lot.ID, 40); code != http.StatusOK {
+		t.Fatal("截止前结算失败后应当仍可出价")
+	}
+
+	if err := e.db.Model(&lot).Update("deadline", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := e.call(http.MethodPost, finish, bob.token, nil, nil); code == http.StatusOK {
+		t.Fatal("非卖家结算应当失败")
+	}
+	// 过户失败时拍品保持结算中，即使截止时间被延后也不能再出价
+	e.ledger.FailOn("TransferAsset", func(args []any) error { return errors.New("节点不可用") })
+	if code, _ := e.call(http.MethodPost, finish, alice.token, nil, nil); code == http.StatusOK {
+		t.Fatal("过户失败时结算应当失败")
+	}
+	e.ledger.FailOn("TransferAsset", nil)
+	if err := e.db.Model(&lot).Update("deadline", time.Now().Add(time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := e.bid(bob, lot.ID, 60); code == http.StatusOK {
+		t.Fatal("结算中的拍品不应接受出价")
+	}
+	if err := e.db.Model(&lot).Update("deadline", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	e.mustCall(http.MethodPost, finish, alice.token, nil, nil)
+	if got := e.owner(alice, asset.ID); got != carol.id {
+		t.Fatalf("NFT 持有人为 %d，期望 carol(%d)", got, carol.id)
+	}
+	e.expectBalances(map[string]int{"alice": 140, "bob": 100, "carol": 60}, users)
+}
+
+// 对账核对拍品下的预扣款：孤立冻结退款，链上没有冻结的出价改为直接付款，金额不一致只报告
+func TestReconcileLotHolds(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{
+		"alice": e.register("alice"), "bob": e.register("bob"), "carol": e.register("carol"), "dave": e.register("dave"),
+	}
+	alice, bob, carol, dave := users["alice"], users["bob"], users["carol"], users["dave"]
+
+	asset := e.createAsset(alice, "远山")
+	lot := e.createLot(alice, asset.ID, 20)
+	for _, b := range []struct {
+		u     testUser
+		price int
+	}{{bob, 30}, {carol, 40}} {
+		if code, msg := e.bid(b.u, lot.ID, b.price); code != http.StatusOK {
+			t.Fatalf("出价 %d 返回 %d：%s", b.price, code, msg)
+		}
+	}
+	lotKey := fmt.Sprintf("lot-%d", lot.ID)
+	// dave 没有出价却有冻结；carol 的冻结丢失；bob 的出价与冻结金额不一致
+	if err := e.ledger.WithHoldAccount("org2", "orphan", dave.id, lotKey, 10, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ledger.RefundHolding("org2", "lost", lotKey, carol.id, 40, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.db.Model(&model.Bid{}).Where("lot_id = ? AND bidder_id = ?", lot.ID, bob.id).Update("bid_price", 35).Error; err != nil {
+		t.Fatal(err)
+	}
+	e.expectBalances(map[string]int{"bob": 70, "carol": 100, "dave": 90}, users)
+
+	svc := service.NewReconcileService(e.ledger)
+	run, err := svc.Reconcile(model.ReconcileManual, alice.id, true, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.IssueCount != 3 || run.RepairedCount != 2 {
+		t.Fatalf("对账结果为 %+v", run)
+	}
+	e.expectBalances(map[string]int{"bob": 70, "carol": 100, "dave": 100}, users)
+	var carolBid model.Bid
+	if err := e.db.Where("lot_id = ? AND bidder_id = ?", lot.ID, carol.id).First(&carolBid).Error; err != nil {
+		t.Fatal(err)
+	}
+	if carolBid.Escrowed {
+		t.Fatal("链上没有冻结的出价应改为未冻结")
+	}
+
+	// 再次对账只剩下需要人工处理的金额不一致
+	run, err = svc.Reconcile(model.ReconcileManual, alice.id, true, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.IssueCount != 1 || run.RepairedCount != 0 {
+		t.Fatalf("重复对账结果为 %+v", run)
+	}
+}
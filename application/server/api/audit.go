@@ -0,0 +1,66 @@
+package api
+
+import (
+	"application/pkg/fabric"
+	"application/service"
+	"application/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	svc *service.AuditService
+}
+
+func NewAuditHandler(ledger fabric.LedgerClient) *AuditHandler {
+	return &AuditHandler{svc: service.NewAuditService(ledger)}
+}
+
+// 执行账本审计（需要 audit:manage 权限）
+func (h *AuditHandler) RunAudit(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "用户组织获取失败")
+		return
+	}
+	record, err := h.svc.RunAudit(userID.(int), org.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "审计完成", record)
+}
+
+// 查询审计历史（需要 audit:manage 权限）
+func (h *AuditHandler) ListRecords(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	items, total, err := h.svc.ListRecords(page, size)
+	if err != nil {
+		utils.ServerError(c, "查询失败："+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{"items": items, "total": total})
+}
+
+// 查询单次审计报告（需要 audit:manage 权限）
+func (h *AuditHandler) GetRecord(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.BadRequest(c, "审计记录ID非法")
+		return
+	}
+	record, err := h.svc.GetRecord(id)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, record)
+}
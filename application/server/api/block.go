@@ -0,0 +1,85 @@
+package api
+
+import (
+	"application/service"
+	"application/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BlockHandler struct {
+	svc *service.BlockService
+}
+
+func NewBlockHandler() *BlockHandler {
+	return &BlockHandler{svc: service.NewBlockService()}
+}
+
+// 分页查询区块列表，org 为空时查询通道数据，指定组织时查询升级前按组织保存的数据
+func (h *BlockHandler) ListBlocks(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	result, err := h.svc.ListBlocks(c.Query("org"), page, size)
+	if err != nil {
+		utils.ServerError(c, "查询区块失败："+err.Error())
+		return
+	}
+	utils.Success(c, result)
+}
+
+// 按区块号或区块哈希查询区块详情
+func (h *BlockHandler) GetBlock(c *gin.Context) {
+	block, err := h.svc.GetBlock(c.Query("org"), c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "查询区块失败："+err.Error())
+		return
+	}
+	utils.Success(c, block)
+}
+
+// 查询交易详情，id 可以是链上交易 ID，也可以是出价、转账记录中的业务 ID
+func (h *BlockHandler) GetTransaction(c *gin.Context) {
+	tx, err := h.svc.GetTransaction(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "查询交易失败："+err.Error())
+		return
+	}
+	utils.Success(c, tx)
+}
+
+// 查询通道（及升级前各组织）的最新区块高度
+func (h *BlockHandler) GetLatestBlocks(c *gin.Context) {
+	latest, err := h.svc.GetLatestBlocks()
+	if err != nil {
+		utils.ServerError(c, "查询最新区块失败："+err.Error())
+		return
+	}
+	utils.Success(c, latest)
+}
+
+// 校验区块哈希链（需要 blocks:verify 权限）
+// refetch=true 时在后台重新拉取问题区块，完成后的结果通过 GET /admin/blocks/verify 查询
+func (h *BlockHandler) VerifyChain(c *gin.Context) {
+	result, err := h.svc.VerifyChain(c.Query("org"), c.Query("refetch") == "true")
+	if err != nil {
+		utils.ServerError(c, "校验区块失败："+err.Error())
+		return
+	}
+	if result.Refetching {
+		utils.SuccessWithMessage(c, "校验完成，正在后台重新拉取问题区块", result)
+		return
+	}
+	utils.SuccessWithMessage(c, "校验完成", result)
+}
+
+// 查询最近一次的哈希链校验结果（需要 blocks:verify 权限）
+func (h *BlockHandler) GetVerifyResults(c *gin.Context) {
+	results, err := h.svc.GetVerifyResults()
+	if err != nil {
+		utils.ServerError(c, "查询校验结果失败："+err.Error())
+		return
+	}
+	utils.Success(c, results)
+}
@@ -29,12 +29,14 @@ func NewChatHandler() (*ChatHandler, error) {
 // 发送消息，使用 websocket 发送消息
 // 如果对方在线，则直接推送
 // 如果对方不在线，则将消息先存入数据库
+// 连接绑定到握手时令牌中的用户，见 JWTMiddleware.WebSocketAuth
 func (h *ChatHandler) SendMessage(c *gin.Context) {
-	userID, err := strconv.Atoi(c.Query("userId"))
-	if err != nil {
-		utils.BadRequest(c, "用户ID不能为空")
+	value, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
 		return
 	}
+	userID := value.(int)
 	// 升级HTTP连接到WebSocket
 	conn, err := model.Upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -0,0 +1,71 @@
+package api_test
+
+import (
+	"application/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialChat(t *testing.T, server *httptest.Server, protocols ...string) (*websocket.Conn, int) {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: protocols}
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat/ws"
+	conn, resp, err := dialer.Dial(url, nil)
+	if err != nil {
+		if resp == nil {
+			t.Fatalf("连接 WebSocket 失败：%v", err)
+		}
+		return nil, resp.StatusCode
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, resp.StatusCode
+}
+
+// 聊天连接绑定到握手令牌中的用户，不能冒充他人收发消息
+func TestChatWebSocketAuth(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.register("alice")
+	bob := e.register("bob")
+	server := httptest.NewServer(e.router)
+	defer server.Close()
+
+	if _, code := dialChat(t, server); code != http.StatusUnauthorized {
+		t.Fatalf("没有令牌的握手返回 %d", code)
+	}
+	if _, code := dialChat(t, server, model.WebSocketAuthProtocol, "forged"); code != http.StatusUnauthorized {
+		t.Fatalf("伪造令牌的握手返回 %d", code)
+	}
+
+	aliceConn, _ := dialChat(t, server, model.WebSocketAuthProtocol, alice.token)
+	if aliceConn.Subprotocol() != model.WebSocketAuthProtocol {
+		t.Fatalf("服务端确认的子协议为 %q", aliceConn.Subprotocol())
+	}
+	bobConn, _ := dialChat(t, server, model.WebSocketAuthProtocol, bob.token)
+
+	// alice 冒充 bob 发送消息被拒绝
+	if err := aliceConn.WriteJSON(model.Message{SenderID: bob.id, RecipientID: alice.id, Content: "冒充"}); err != nil {
+		t.Fatal(err)
+	}
+	aliceConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var reply map[string]any
+	if err := aliceConn.ReadJSON(&reply); err != nil || reply["error"] == nil {
+		t.Fatalf("冒充发送者应当返回错误，实际：%v %v", reply, err)
+	}
+
+	if err := aliceConn.WriteJSON(model.Message{SenderID: alice.id, RecipientID: bob.id, Content: "你好"}); err != nil {
+		t.Fatal(err)
+	}
+	bobConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var received model.Message
+	if err := bobConn.ReadJSON(&received); err != nil {
+		t.Fatal(err)
+	}
+	if received.SenderID != alice.id || received.Content != "你好" {
+		t.Fatalf("bob 收到的消息为 %+v", received)
+	}
+}
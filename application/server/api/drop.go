@@ -0,0 +1,116 @@
+package api
+
+import (
+	"application/model"
+	"application/service"
+	"application/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DropHandler struct {
+	svc *service.DropService
+}
+
+func NewDropHandler() *DropHandler {
+	return &DropHandler{svc: service.NewDropService()}
+}
+
+// 创作者创建发售
+func (h *DropHandler) CreateDrop(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	var req model.CreateDropRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	drop, err := h.svc.CreateDrop(userID.(int), &req)
+	if err != nil {
+		utils.ServerError(c, "创建发售失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "创建发售成功", drop)
+}
+
+// 查询未结束的发售
+func (h *DropHandler) ListDrops(c *gin.Context) {
+	drops, err := h.svc.ListDrops()
+	if err != nil {
+		utils.ServerError(c, "查询失败："+err.Error())
+		return
+	}
+	utils.Success(c, drops)
+}
+
+// 查询发售详情
+func (h *DropHandler) GetDrop(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	dropID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || dropID <= 0 {
+		utils.BadRequest(c, "发售 ID 非法")
+		return
+	}
+	drop, listings, allowlisted, err := h.svc.GetDrop(dropID, userID.(int))
+	if err != nil {
+		utils.ServerError(c, "查询失败："+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{"drop": drop, "listings": listings, "allowlisted": allowlisted})
+}
+
+// 追加白名单
+func (h *DropHandler) AddAllowlist(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	dropID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || dropID <= 0 {
+		utils.BadRequest(c, "发售 ID 非法")
+		return
+	}
+	var req model.DropAllowlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	if err := h.svc.AddAllowlist(userID.(int), dropID, req.UserIDs); err != nil {
+		utils.ServerError(c, "更新白名单失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "更新白名单成功", nil)
+}
+
+// 移除白名单
+func (h *DropHandler) RemoveAllowlist(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	dropID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || dropID <= 0 {
+		utils.BadRequest(c, "发售 ID 非法")
+		return
+	}
+	var req model.DropAllowlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	if err := h.svc.RemoveAllowlist(userID.(int), dropID, req.UserIDs); err != nil {
+		utils.ServerError(c, "更新白名单失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "更新白名单成功", nil)
+}
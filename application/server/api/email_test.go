@@ -0,0 +1,177 @@
+package api_test
+
+import (
+	"application/config"
+	"application/model"
+	"application/service"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var mailToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// lastMailToken 发给 to 的最后一封邮件中链接的令牌
+func (e *testEnv) lastMailToken(to string) string {
+	e.t.Helper()
+	token := e.findMailToken(to)
+	if token == "" {
+		e.t.Fatalf("没有发给 %s 的邮件", to)
+	}
+	return token
+}
+
+// waitMailToken 等待后台发送的邮件，返回发给 to 的最后一封邮件中与 previous 不同的令牌
+func (e *testEnv) waitMailToken(to string, previous string) string {
+	e.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if token := e.findMailToken(to); token != "" && token != previous {
+			return token
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	e.t.Fatalf("没有等到发给 %s 的新邮件", to)
+	return ""
+}
+
+// findMailToken 发给 to 的最后一封邮件中链接的令牌，没有邮件时返回空
+func (e *testEnv) findMailToken(to string) string {
+	e.t.Helper()
+	files, err := filepath.Glob(filepath.Join(config.GlobalConfig.Mail.Dir, "*.eml"))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	sort.Strings(files)
+	for i := len(files) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			e.t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "To: "+to+"\r\n") {
+			continue
+		}
+		match := mailToken.FindStringSubmatch(string(data))
+		if match == nil {
+			e.t.Fatalf("邮件中没有链接：%s", data)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			e.t.Fatal(err)
+		}
+		return token
+	}
+	return ""
+}
+
+func TestEmailVerification(t *testing.T) {
+	e := newTestEnv(t)
+	bob := e.register("bob")
+
+	if code, _ := e.call(http.MethodPost, "/api/account/register", "", model.RegisterRequest{
+		Username: "dave", Email: "不是邮箱", Password: "password", Org: 2,
+	}, nil); code == http.StatusOK {
+		t.Fatal("邮箱格式错误时注册应当失败")
+	}
+	e.mustCall(http.MethodPost, "/api/account/register", "", model.RegisterRequest{
+		Username: "dave", Email: "dave@example.com", Password: "password", Org: 2,
+	}, nil)
+	dave := e.login("dave").AccessToken
+
+	// 未验证邮箱不能交易
+	transfer := model.TransferRequest{RecipientID: bob.id, Amount: 1}
+	if code, _ := e.call(http.MethodPost, "/api/wallet/transfer", dave, transfer, nil); code != http.StatusForbidden {
+		t.Fatalf("未验证邮箱转账返回 %d", code)
+	}
+	// 访问令牌与验证令牌共用签名密钥，不能互相冒用
+	if code, _ := e.call(http.MethodPost, "/api/account/email/verify", "", model.VerifyEmailRequest{Token: dave}, nil); code == http.StatusOK {
+		t.Fatal("访问令牌不能用于验证邮箱")
+	}
+	token := e.lastMailToken("dave@example.com")
+	if code, _ := e.call(http.MethodGet, "/api/account/profile", token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("验证令牌用作访问令牌返回 %d", code)
+	}
+	e.mustCall(http.MethodPost, "/api/account/email/verify", "", model.VerifyEmailRequest{Token: token}, nil)
+	if code, _ := e.call(http.MethodPost, "/api/wallet/transfer", dave, transfer, nil); code == http.StatusForbidden {
+		t.Fatal("验证邮箱后仍然不能交易")
+	}
+
+	// 修改邮箱后需要重新验证，旧链接失效
+	e.mustCall(http.MethodPut, "/api/account/profile", dave, map[string]any{"email": "dave@example.org"}, nil)
+	if code, _ := e.call(http.MethodPost, "/api/wallet/transfer", dave, transfer, nil); code != http.StatusForbidden {
+		t.Fatalf("修改邮箱后转账返回 %d", code)
+	}
+	if code, _ := e.call(http.MethodPost, "/api/account/email/verify", "", model.VerifyEmailRequest{Token: token}, nil); code == http.StatusOK {
+		t.Fatal("修改邮箱后旧的验证链接应当失效")
+	}
+	e.mustCall(http.MethodPost, "/api/account/email/verify", "", model.VerifyEmailRequest{Token: e.lastMailToken("dave@example.org")}, nil)
+}
+
+func TestPasswordReset(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.register("alice")
+
+	// 未注册的邮箱同样返回成功
+	e.mustCall(http.MethodPost, "/api/account/password/forgot", "", model.ForgotPasswordRequest{Email: "nobody@example.com"}, nil)
+
+	// 邮件在后台发送
+	e.mustCall(http.MethodPost, "/api/account/password/forgot", "", model.ForgotPasswordRequest{Email: "alice@example.com"}, nil)
+	first := e.waitMailToken("alice@example.com", "")
+	// 冷却时间过后申请新的重置链接，旧链接作废
+	if err := e.db.Model(&model.PasswordResetToken{}).Where("user_id = ?", alice.id).
+		Update("create_time", time.Now().Add(-2*time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	e.mustCall(http.MethodPost, "/api/account/password/forgot", "", model.ForgotPasswordRequest{Email: "ALICE@example.com"}, nil)
+	token := e.waitMailToken("alice@example.com", first)
+	if code, _ := e.call(http.MethodPost, "/api/account/password/reset", "",
+		model.ResetPasswordRequest{Token: first, Password: "newpassword"}, nil); code == http.StatusOK {
+		t.Fatal("旧的重置链接应当失效")
+	}
+
+	e.mustCall(http.MethodPost, "/api/account/password/reset", "", model.ResetPasswordRequest{Token: token, Password: "newpassword"}, nil)
+	if code, _ := e.call(http.MethodPost, "/api/account/password/reset", "",
+		model.ResetPasswordRequest{Token: token, Password: "another"}, nil); code == http.StatusOK {
+		t.Fatal("重置链接只能使用一次")
+	}
+	// 重置后全部会话注销，旧密码不能再登录
+	if code, _ := e.call(http.MethodGet, "/api/account/profile", alice.token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("重置密码后旧令牌返回 %d", code)
+	}
+	if code, _ := e.call(http.MethodPost, "/api/account/login", "", model.LoginRequest{Username: "alice", Password: "password"}, nil); code == http.StatusOK {
+		t.Fatal("重置后旧密码仍然可以登录")
+	}
+	e.mustCall(http.MethodPost, "/api/account/login", "", model.LoginRequest{Username: "alice", Password: "newpassword"}, nil)
+}
+
+// 一分钟内重复申请重置链接时不再发送，已发出的链接仍然有效
+func TestPasswordResetCooldown(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.register("alice")
+	svc, err := service.NewEmailService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SendPasswordReset("alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := e.lastMailToken("alice@example.com")
+	if err := svc.SendPasswordReset("alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.lastMailToken("alice@example.com"); got != token {
+		t.Fatal("冷却时间内不应发送新的重置链接")
+	}
+	var count int64
+	e.db.Model(&model.PasswordResetToken{}).Where("user_id = ?", alice.id).Count(&count)
+	if count != 1 {
+		t.Fatalf("重置令牌有 %d 个", count)
+	}
+	e.mustCall(http.MethodPost, "/api/account/password/reset", "", model.ResetPasswordRequest{Token: token, Password: "newpassword"}, nil)
+}
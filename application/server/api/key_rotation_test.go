@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"application/config"
+	"application/model"
+	"application/service"
+	"net/http"
+	"testing"
+)
+
+// 更换 walletKey：配置旧密钥期间旧密文仍可解密，rotate-keys 重新加密后只用新密钥即可
+func TestRotateWalletKey(t *testing.T) {
+	e := newTestEnv(t)
+	creator := e.register("creator")
+	buyer := e.register("buyer")
+	e.createVoucher(creator, "v1", 10)
+	var before model.SignerKey
+	if err := e.db.Where("user_id = ?", creator.id).First(&before).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	old := config.GlobalConfig.Fabric.WalletKey
+	config.GlobalConfig.Fabric.WalletKey = "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	config.GlobalConfig.Fabric.PreviousWalletKey = old
+	e.createVoucher(creator, "v2", 10)
+
+	svc := service.NewKeyRotationService()
+	if n, err := svc.Rotate(); err != nil || n != 1 {
+		t.Fatalf("重新加密了 %d 条记录：%v", n, err)
+	}
+	if n, err := svc.Rotate(); err != nil || n != 0 {
+		t.Fatalf("重复执行时重新加密了 %d 条记录：%v", n, err)
+	}
+	var after model.SignerKey
+	if err := e.db.Where("user_id = ?", creator.id).First(&after).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.PrivateKey == before.PrivateKey || after.PublicKeyPEM != before.PublicKeyPEM {
+		t.Fatal("签名私钥没有用新密钥重新加密")
+	}
+
+	// 删除旧密钥后仍然可以签名
+	config.GlobalConfig.Fabric.PreviousWalletKey = ""
+	v := e.createVoucher(creator, "v3", 10)
+	e.mustCall(http.MethodPost, "/api/market/voucher/"+v.ID+"/redeem", buyer.token, nil, nil)
+}
+
+// 更换 twoFactorKey：已开启的两步验证在重新加密前后都能继续使用
+func TestRotateTwoFactorKey(t *testing.T) {
+	e := newTestEnv(t)
+	u := e.register("alice")
+	a, _ := e.enableTwoFactor(u.token)
+	var before model.TwoFactor
+	if err := e.db.Where("user_id = ?", u.id).First(&before).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	old := config.GlobalConfig.Auth.TwoFactorKey
+	config.GlobalConfig.Auth.TwoFactorKey = "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	config.GlobalConfig.Auth.PreviousTwoFactorKey = old
+	e.stepUp(u.token, a)
+
+	if n, err := service.NewKeyRotationService().Rotate(); err != nil || n != 1 {
+		t.Fatalf("重新加密了 %d 条记录：%v", n, err)
+	}
+	var after model.TwoFactor
+	if err := e.db.Where("user_id = ?", u.id).First(&after).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Secret == before.Secret {
+		t.Fatal("TOTP 密钥没有用新密钥重新加密")
+	}
+
+	config.GlobalConfig.Auth.PreviousTwoFactorKey = ""
+	e.stepUp(u.token, a)
+}
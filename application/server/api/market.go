@@ -1,6 +1,8 @@
 package api
 
 import (
+	"application/model"
+	"application/pkg/fabric"
 	"application/service"
 	"application/utils"
 	"strconv"
@@ -10,14 +12,15 @@ import (
 )
 
 type MarketHandler struct {
-	svc *service.MarketService
+	svc        *service.MarketService
+	voucherSvc *service.VoucherService
 }
 
-func NewMarketHandler() *MarketHandler {
-	return &MarketHandler{svc: service.NewMarketService()}
+func NewMarketHandler(ledger fabric.LedgerClient) *MarketHandler {
+	return &MarketHandler{svc: service.NewMarketService(ledger), voucherSvc: service.NewVoucherService(ledger)}
 }
 
-// 1) 公开：查询挂牌
+// 1) 公开：查询挂牌（同时返回可兑换的铸造凭证）
 func (h *MarketHandler) ListListings(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	size, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
@@ -27,15 +30,23 @@ func (h *MarketHandler) ListListings(c *gin.Context) {
 		utils.ServerError(c, "查询失败："+err.Error())
 		return
 	}
-	utils.Success(c, gin.H{"items": items, "total": total})
+	vouchers, voucherTotal, err := h.voucherSvc.ListVouchers(page, size)
+	if err != nil {
+		utils.ServerError(c, "查询凭证失败："+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{"items": items, "total": total, "vouchers": vouchers, "voucherTotal": voucherTotal})
 }
 
 // 2) 卖家创建挂牌（需要 JWT）
+// 限量版可以直接传 assetId，也可以传 seriesId + editionNumber 指定某一个编号
 type createListingReq struct {
-	AssetID  string  `json:"assetId" binding:"required"`
-	Title    string  `json:"title" binding:"required"`
-	Price    int64   `json:"price" binding:"required"`
-	Deadline *string `json:"deadline"` // RFC3339
+	AssetID       string  `json:"assetId"`
+	SeriesID      string  `json:"seriesId"`
+	EditionNumber int     `json:"editionNumber"`
+	Title         string  `json:"title" binding:"required"`
+	Price         int64   `json:"price" binding:"required"`
+	Deadline      *string `json:"deadline"` // RFC3339
 }
 
 func (h *MarketHandler) CreateListing(c *gin.Context) {
@@ -56,6 +67,14 @@ func (h *MarketHandler) CreateListing(c *gin.Context) {
 		return
 	}
 
+	if req.AssetID == "" {
+		if req.SeriesID == "" || req.EditionNumber <= 0 {
+			utils.BadRequest(c, "请指定 assetId 或 seriesId + editionNumber")
+			return
+		}
+		req.AssetID = model.EditionAssetID(req.SeriesID, req.EditionNumber)
+	}
+
 	var ddl *time.Time
 	if req.Deadline != nil && *req.Deadline != "" {
 		t, err := time.Parse(time.RFC3339, *req.Deadline)
@@ -76,7 +95,7 @@ func (h *MarketHandler) CreateListing(c *gin.Context) {
 
 // 3) 买家出价（需要 JWT）
 type createOfferReq struct {
-	ListingID  uint  `json:"listingId" binding:"required"`
+	ListingID  int   `json:"listingId" binding:"required"`
 	OfferPrice int64 `json:"offerPrice" binding:"required"`
 }
 
@@ -125,7 +144,7 @@ func (h *MarketHandler) AcceptOffer(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.AcceptOffer(userID, uint(offerID)); err != nil {
+	if err := h.svc.AcceptOffer(userID, offerID); err != nil {
 		utils.ServerError(c, "接受出价失败："+err.Error())
 		return
 	}
@@ -173,7 +192,7 @@ func (h *MarketHandler) CancelOffer(c *gin.Context) {
 		utils.BadRequest(c, "出价 ID 非法")
 		return
 	}
-	if err := h.svc.CancelOffer(userID, uint(oid)); err != nil {
+	if err := h.svc.CancelOffer(userID, oid); err != nil {
 		utils.ServerError(c, "撤回失败："+err.Error())
 		return
 	}
@@ -183,7 +202,7 @@ func (h *MarketHandler) CancelOffer(c *gin.Context) {
 // 一口价直购 BuyNow：如果 listing.BuyNowPrice 不为空
 // 一口价直购 BuyNow：买家点击立即购买就成交
 type BuyNowReq struct {
-	ListingID uint `json:"listingId" binding:"required"`
+	ListingID int `json:"listingId" binding:"required"`
 }
 
 func (h *MarketHandler) BuyNow(c *gin.Context) {
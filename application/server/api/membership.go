@@ -0,0 +1,156 @@
+package api
+
+import (
+	"application/model"
+	"application/service"
+	"application/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MembershipHandler struct {
+	svc *service.MembershipService
+}
+
+func NewMembershipHandler() *MembershipHandler {
+	return &MembershipHandler{svc: service.NewMembershipService()}
+}
+
+// 提交加入其他组织的申请
+func (h *MembershipHandler) Apply(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	var req model.OrgApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	application, err := h.svc.Apply(userID.(int), &req)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "申请已提交，请等待审核", application)
+}
+
+// 撤回自己待审核的申请
+func (h *MembershipHandler) Cancel(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "申请ID非法")
+		return
+	}
+	if err := h.svc.Cancel(userID.(int), id); err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "申请已撤回", nil)
+}
+
+// 当前用户提交的申请
+func (h *MembershipHandler) ListMine(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	applications, err := h.svc.ListMine(userID.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, applications)
+}
+
+// 待审核或已处理的申请，可按 status 筛选（需要 membership:review 权限）
+func (h *MembershipHandler) ListForReview(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "组织信息获取失败")
+		return
+	}
+	applications, err := h.svc.ListForReview(userID.(int), org.(int), c.Query("status"))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, applications)
+}
+
+// 审核申请，通过后用户加入目标组织并需要重新登录（需要 membership:review 权限）
+func (h *MembershipHandler) Review(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "组织信息获取失败")
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "申请ID非法")
+		return
+	}
+	var req model.OrgReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	application, err := h.svc.Review(userID.(int), org.(int), id, &req)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "审核完成", application)
+}
+
+// 直接修改用户组织（需要 account:manage-org 权限）
+func (h *MembershipHandler) UpdateOrg(c *gin.Context) {
+	adminID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	var req model.UpdateOrgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	if err := h.svc.SetOrg(adminID.(int), req.UserID, req.Org); err != nil {
+		utils.ServerError(c, "更新组织失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "更新成功", nil)
+}
+
+// 用户的组织变更记录（需要 account:manage-org 权限）
+func (h *MembershipHandler) ListEvents(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("userId"))
+	if err != nil {
+		utils.BadRequest(c, "用户ID非法")
+		return
+	}
+	events, err := h.svc.ListEvents(userID)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, events)
+}
@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"application/model"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// 申请加入组织：目标组织的管理员审核，通过后修改组织并注销会话，每一步都有审计记录
+func TestOrgApplication(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.register("alice")
+	bob := e.register("bob")
+	e.register("carol")
+	e.register("admin")
+	e.db.Model(&model.User{}).Where("username = ?", "admin").Update("org", 1)
+	e.db.Model(&model.User{}).Where("username = ?", "carol").Update("org", 3)
+	admin := e.login("admin").AccessToken
+
+	var application model.OrgApplication
+	e.mustCall(http.MethodPost, "/api/account/org/application", alice.token,
+		model.OrgApplicationRequest{TargetOrg: 3, Reason: "金融机构员工"}, &application)
+	if code, _ := e.call(http.MethodPost, "/api/account/org/application", alice.token,
+		model.OrgApplicationRequest{TargetOrg: 1, Reason: "再申请一次"}, nil); code == http.StatusOK {
+		t.Fatal("已有待审核的申请时不能再次提交")
+	}
+	if code, _ := e.call(http.MethodPost, "/api/account/org/application", bob.token,
+		model.OrgApplicationRequest{TargetOrg: 9, Reason: "不存在的组织"}, nil); code == http.StatusOK {
+		t.Fatal("申请加入不存在的组织应当失败")
+	}
+
+	// 没有审核权限的创作者，以及不是组织管理员的金融机构成员都不能审核
+	review := fmt.Sprintf("/api/admin/org/application/%d/review", application.ID)
+	if code, _ := e.call(http.MethodPost, review, bob.token, model.OrgReviewRequest{Approve: true}, nil); code != http.StatusForbidden {
+		t.Fatalf("创作者审核返回 %d", code)
+	}
+	carol := e.login("carol").AccessToken
+	if code, _ := e.call(http.MethodPost, review, carol, model.OrgReviewRequest{Approve: true}, nil); code != http.StatusForbidden {
+		t.Fatalf("普通金融机构成员审核返回 %d", code)
+	}
+
+	// 平台运营方授予组织管理员角色后，只能审核加入本组织的申请
+	var carolUser model.User
+	e.db.Where("username = ?", "carol").First(&carolUser)
+	e.mustCall(http.MethodPost, "/api/admin/role", admin, model.UserRoleRequest{UserID: carolUser.ID, Role: model.RoleOrgAdmin}, nil)
+	var bobApplication model.OrgApplication
+	e.mustCall(http.MethodPost, "/api/account/org/application", bob.token,
+		model.OrgApplicationRequest{TargetOrg: 1, Reason: "平台运营"}, &bobApplication)
+	var reviewable []model.OrgApplication
+	e.mustCall(http.MethodGet, "/api/admin/org/applications?status=PENDING", carol, nil, &reviewable)
+	if len(reviewable) != 1 || reviewable[0].ID != application.ID {
+		t.Fatalf("组织管理员看到的申请为 %+v", reviewable)
+	}
+	if code, _ := e.call(http.MethodPost, fmt.Sprintf("/api/admin/org/application/%d/review", bobApplication.ID), carol,
+		model.OrgReviewRequest{Approve: true}, nil); code == http.StatusOK {
+		t.Fatal("组织管理员不能审核加入其他组织的申请")
+	}
+
+	e.mustCall(http.MethodPost, review, carol, model.OrgReviewRequest{Approve: true, Comment: "已核实"}, nil)
+	var user model.User
+	e.db.First(&user, alice.id)
+	if user.Org != 3 {
+		t.Fatalf("审核通过后组织为 %d", user.Org)
+	}
+	if code, _ := e.call(http.MethodPost, review, carol, model.OrgReviewRequest{Approve: false}, nil); code == http.StatusOK {
+		t.Fatal("已处理的申请不能再次审核")
+	}
+	// 旧令牌中的组织已经过期，会话被注销
+	if code, _ := e.call(http.MethodGet, "/api/account/profile", alice.token, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("组织变更后旧令牌返回 %d", code)
+	}
+	var perms []model.Permission
+	e.mustCall(http.MethodGet, "/api/account/permissions", e.login("alice").AccessToken, nil, &perms)
+	if len(perms) != 1 || perms[0] != model.PermWalletMint {
+		t.Fatalf("加入金融机构后的权限为 %v", perms)
+	}
+
+	// 平台运营方拒绝 bob 的申请，管理员直接修改组织同样校验组织并记录审计
+	e.mustCall(http.MethodPost, fmt.Sprintf("/api/admin/org/application/%d/review", bobApplication.ID), admin,
+		model.OrgReviewRequest{Approve: false, Comment: "不符合条件"}, nil)
+	// 直接修改组织需要二次验证
+	if code, _ := e.call(http.MethodPut, "/api/account/org", admin, model.UpdateOrgRequest{UserID: bob.id, Org: 3}, nil); code != http.StatusForbidden {
+		t.Fatalf("未开启两步验证时修改组织返回 %d", code)
+	}
+	authenticator, _ := e.enableTwoFactor(admin)
+	e.stepUp(admin, authenticator)
+	if code, _ := e.call(http.MethodPut, "/api/account/org", admin, model.UpdateOrgRequest{UserID: bob.id, Org: 9}, nil); code == http.StatusOK {
+		t.Fatal("修改为不存在的组织应当失败")
+	}
+	e.mustCall(http.MethodPut, "/api/account/org", admin, model.UpdateOrgRequest{UserID: bob.id, Org: 3}, nil)
+
+	var events []model.OrgChangeEvent
+	e.mustCall(http.MethodGet, fmt.Sprintf("/api/admin/org/events?userId=%d", alice.id), admin, nil, &events)
+	if len(events) != 2 || events[0].Action != model.OrgEventApprove || events[0].ActorID != carolUser.ID ||
+		events[1].Action != model.OrgEventSubmit {
+		t.Fatalf("alice 的组织变更记录为 %+v", events)
+	}
+	e.mustCall(http.MethodGet, fmt.Sprintf("/api/admin/org/events?userId=%d", bob.id), admin, nil, &events)
+	if len(events) != 3 || events[0].Action != model.OrgEventAdminSet || events[1].Action != model.OrgEventReject {
+		t.Fatalf("bob 的组织变更记录为 %+v", events)
+	}
+}
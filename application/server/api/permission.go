@@ -0,0 +1,86 @@
+package api
+
+import (
+	"application/model"
+	"application/service"
+	"application/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PermissionHandler struct {
+	svc *service.PermissionService
+}
+
+func NewPermissionHandler() *PermissionHandler {
+	return &PermissionHandler{svc: service.NewPermissionService()}
+}
+
+// 当前用户拥有的权限，前端据此显示可用的功能
+func (h *PermissionHandler) ListMyPermissions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	org, exists := c.Get("org")
+	if !exists {
+		utils.ServerError(c, "组织信息获取失败")
+		return
+	}
+	perms, err := h.svc.List(userID.(int), org.(int))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, perms)
+}
+
+// 查询用户被授予的角色（需要 account:manage-roles 权限）
+func (h *PermissionHandler) ListRoles(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("userId"))
+	if err != nil {
+		utils.BadRequest(c, "用户ID非法")
+		return
+	}
+	roles, err := h.svc.ListRoles(userID)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, roles)
+}
+
+// 授予角色（需要 account:manage-roles 权限）
+func (h *PermissionHandler) GrantRole(c *gin.Context) {
+	adminID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	var req model.UserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	if err := h.svc.GrantRole(req.UserID, req.Role, adminID.(int)); err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "授予角色成功", nil)
+}
+
+// 撤销角色（需要 account:manage-roles 权限）
+func (h *PermissionHandler) RevokeRole(c *gin.Context) {
+	var req model.UserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	if err := h.svc.RevokeRole(req.UserID, req.Role); err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "撤销角色成功", nil)
+}
@@ -0,0 +1,57 @@
+package api_test
+
+import (
+	"application/model"
+	"net/http"
+	"testing"
+)
+
+func TestRequirePermission(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.register("alice")
+	e.register("admin")
+	if err := e.db.Model(&model.User{}).Where("username = ?", "admin").Update("org", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 组织写在令牌中，修改后重新登录
+	admin := e.login("admin").AccessToken
+
+	forbidden := map[string]string{
+		"/api/admin/workflows":     alice.token,
+		"/api/admin/audit/records": alice.token,
+	}
+	for path, token := range forbidden {
+		if code, _ := e.call(http.MethodGet, path, token, nil, nil); code != http.StatusForbidden {
+			t.Errorf("创作者访问 %s 返回 %d", path, code)
+		}
+	}
+	if code, _ := e.call(http.MethodPost, "/api/wallet/mintToken", alice.token,
+		model.MintTokenRequest{AccountID: alice.id, Amount: 100}, nil); code != http.StatusForbidden {
+		t.Errorf("创作者铸币返回 %d", code)
+	}
+	if code, _ := e.call(http.MethodPost, "/api/admin/role", alice.token,
+		model.UserRoleRequest{UserID: alice.id, Role: model.RoleOperator}, nil); code != http.StatusForbidden {
+		t.Errorf("创作者给自己授予角色返回 %d", code)
+	}
+
+	// 角色在组织权限之外附加权限，立即生效
+	e.mustCall(http.MethodPost, "/api/admin/role", admin, model.UserRoleRequest{UserID: alice.id, Role: model.RoleOperator}, nil)
+	e.mustCall(http.MethodGet, "/api/admin/workflows", alice.token, nil, nil)
+	if code, _ := e.call(http.MethodGet, "/api/admin/audit/records", alice.token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("运维角色访问审计记录返回 %d", code)
+	}
+	var perms []model.Permission
+	e.mustCall(http.MethodGet, "/api/account/permissions", alice.token, nil, &perms)
+	want := map[model.Permission]bool{model.PermAssetCreate: true, model.PermWorkflowManage: true}
+	for _, perm := range perms {
+		delete(want, perm)
+	}
+	if len(want) > 0 {
+		t.Errorf("权限列表 %v 缺少 %v", perms, want)
+	}
+
+	e.mustCall(http.MethodDelete, "/api/admin/role", admin, model.UserRoleRequest{UserID: alice.id, Role: model.RoleOperator}, nil)
+	if code, _ := e.call(http.MethodGet, "/api/admin/workflows", alice.token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("撤销角色后访问结算流程返回 %d", code)
+	}
+}
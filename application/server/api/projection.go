@@ -0,0 +1,35 @@
+package api
+
+import (
+	"application/service"
+	"application/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProjectionHandler struct {
+	svc *service.ProjectionService
+}
+
+func NewProjectionHandler() *ProjectionHandler {
+	return &ProjectionHandler{svc: service.NewProjectionService()}
+}
+
+// 查询读模型同步进度（需要 projection:manage 权限）
+func (h *ProjectionHandler) GetStatus(c *gin.Context) {
+	status, err := h.svc.Status()
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, status)
+}
+
+// 清空读模型并从创世区块重新同步（需要 projection:manage 权限）
+func (h *ProjectionHandler) Rebuild(c *gin.Context) {
+	if err := h.svc.Rebuild(); err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "读模型已清空，正在从链上重新同步", nil)
+}
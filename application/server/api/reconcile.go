@@ -0,0 +1,64 @@
+package api
+
+import (
+	"application/model"
+	"application/pkg/fabric"
+	"application/service"
+	"application/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReconcileHandler struct {
+	svc *service.ReconcileService
+}
+
+func NewReconcileHandler(ledger fabric.LedgerClient) *ReconcileHandler {
+	return &ReconcileHandler{svc: service.NewReconcileService(ledger)}
+}
+
+// 手动执行对账（需要 reconcile:manage 权限），repair=true 时自动修复预扣款不一致
+func (h *ReconcileHandler) Reconcile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	repair := c.Query("repair") == "true"
+	run, err := h.svc.Reconcile(model.ReconcileManual, userID.(int), repair, time.Time{})
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "对账完成", run)
+}
+
+// 查询对账历史（需要 reconcile:manage 权限）
+func (h *ReconcileHandler) ListRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	items, total, err := h.svc.ListRuns(page, size)
+	if err != nil {
+		utils.ServerError(c, "查询失败："+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{"items": items, "total": total})
+}
+
+// 查询单次对账结果（需要 reconcile:manage 权限）
+func (h *ReconcileHandler) GetRun(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.BadRequest(c, "对账记录ID非法")
+		return
+	}
+	run, err := h.svc.GetRun(id)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, run)
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"application/config"
+	"application/middleware"
+	"application/model"
+	"application/pkg/fabric"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter 创建 Gin 路由并注册全部接口，需要先初始化配置、日志和数据库
+// ledger 决定业务服务调用的链码实现，测试时可以传入 fabric.NewMemoryLedger()
+func NewRouter(ledger fabric.LedgerClient) (*gin.Engine, error) {
+	//gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	// 添加日志中间件
+	r.Use(middleware.ZapLogger())
+
+	// 添加CORS中间件
+	r.Use(middleware.CORSMiddleware())
+
+	// 添加静态文件服务
+	r.Static("/public", config.GlobalConfig.Storage.PublicDir)
+
+	apiGroup := r.Group("/api")
+
+	accountHandler := NewAccountHandler(ledger)
+	walletHandler := NewWalletHandler(ledger)
+	assetHandler := NewAssetHandler(ledger)
+	chatHandler, err := NewChatHandler()
+	marketHandler := NewMarketHandler(ledger)
+	auctionHandler := NewAuctionHandler(ledger)
+	voucherHandler := NewVoucherHandler(ledger)
+	auditHandler := NewAuditHandler(ledger)
+	dropHandler := NewDropHandler()
+	workflowHandler := NewWorkflowHandler(ledger)
+	reconcileHandler := NewReconcileHandler(ledger)
+	blockHandler := NewBlockHandler()
+	projectionHandler := NewProjectionHandler()
+	permissionHandler := NewPermissionHandler()
+	membershipHandler := NewMembershipHandler()
+	twoFactorHandler := NewTwoFactorHandler()
+
+	if err != nil {
+		return nil, fmt.Errorf("创建聊天处理程序失败：%v", err)
+	}
+
+	// 创建JWT中间件
+	jwtMiddleware, err := middleware.NewJWTMiddleware()
+	if err != nil {
+		return nil, fmt.Errorf("创建JWT中间件失败：%v", err)
+	}
+
+	// 交易类接口要求邮箱已验证
+	verified := jwtMiddleware.RequireVerifiedEmail()
+	// 铸币、修改组织要求当前会话近期通过两步验证；大额转账在处理函数中按金额判断
+	stepUp := jwtMiddleware.RequireStepUp()
+
+	// 账号相关接口（无需认证）
+	account := apiGroup.Group("/account")
+	{
+		// 用户注册
+		account.POST("/register", accountHandler.Register)
+		// 用户登录
+		account.POST("/login", accountHandler.Login)
+		// 登录第二步，提交两步验证码
+		account.POST("/login/2fa", accountHandler.LoginTwoFactor)
+		// 用户登出
+		account.POST("/logout", accountHandler.Logout)
+		// 用刷新令牌换发访问令牌
+		account.POST("/refresh", accountHandler.Refresh)
+		// 验证邮箱（邮件中的链接）
+		account.POST("/email/verify", accountHandler.VerifyEmail)
+		// 忘记密码，发送重置链接
+		account.POST("/password/forgot", accountHandler.ForgotPassword)
+		// 用重置链接设置新密码
+		account.POST("/password/reset", accountHandler.ResetPassword)
+	}
+
+	// 需要认证的账号接口
+	authAccount := apiGroup.Group("/account").Use(jwtMiddleware.Auth())
+	{
+		// 获取用户信息
+		authAccount.GET("/profile", accountHandler.GetProfile)
+		// 更新用户信息
+		authAccount.PUT("/profile", accountHandler.UpdateProfile)
+		// 获取头像
+		authAccount.GET("/avatar", accountHandler.GetAvatar)
+		// 更新头像
+		authAccount.PUT("/avatar", accountHandler.UpdateAvatar)
+		// 更新组织接口（管理员直接修改）
+		authAccount.PUT("/org", jwtMiddleware.RequirePermission(model.PermAccountManageOrg), stepUp, membershipHandler.UpdateOrg)
+		// 申请加入其他组织
+		authAccount.POST("/org/application", membershipHandler.Apply)
+		authAccount.GET("/org/applications", membershipHandler.ListMine)
+		authAccount.POST("/org/application/:id/cancel", membershipHandler.Cancel)
+		// 获取用户名
+		authAccount.GET("/userName", accountHandler.GetUserNameById)
+		// 当前用户的登录会话
+		authAccount.GET("/sessions", accountHandler.ListSessions)
+		// 注销某个会话
+		authAccount.POST("/session/:id/revoke", accountHandler.RevokeSession)
+		// 注销其他全部会话
+		authAccount.POST("/sessions/revokeOthers", accountHandler.RevokeOtherSessions)
+		// 当前用户的权限
+		authAccount.GET("/permissions", permissionHandler.ListMyPermissions)
+		// 重新发送验证邮件
+		authAccount.POST("/email/sendVerification", accountHandler.SendVerificationEmail)
+		// 两步验证
+		authAccount.GET("/2fa", twoFactorHandler.GetStatus)
+		authAccount.POST("/2fa/setup", twoFactorHandler.Setup)
+		authAccount.POST("/2fa/enable", twoFactorHandler.Enable)
+		authAccount.POST("/2fa/disable", twoFactorHandler.Disable)
+		authAccount.POST("/2fa/recoveryCodes", twoFactorHandler.RegenerateRecoveryCodes)
+		authAccount.POST("/2fa/stepUp", twoFactorHandler.StepUp)
+	}
+
+	// 钱包相关接口
+	wallet := apiGroup.Group("/wallet").Use(jwtMiddleware.Auth())
+	{
+		wallet.POST("/create", walletHandler.CreateAccount)
+		wallet.GET("/balance", walletHandler.GetBalance)
+		wallet.POST("/transfer", verified, walletHandler.Transfer)
+		wallet.POST("/mintToken", jwtMiddleware.RequirePermission(model.PermWalletMint), stepUp, walletHandler.MintToken)
+		wallet.GET("/transferBySenderID", walletHandler.GetTransferBySenderID)
+		wallet.GET("/transferByRecipientID", walletHandler.GetTransferByRecipientID)
+		wallet.POST("/withHoldAccount", verified, walletHandler.WithHoldAccount)
+		wallet.GET("/getWithHoldingByAccountID", walletHandler.GetWithHoldingByAccountID)
+		wallet.GET("/getWithHoldingByListingID", walletHandler.GetWithHoldingByListingID)
+	}
+
+	// 资产相关接口
+	asset := apiGroup.Group("/asset").Use(jwtMiddleware.Auth())
+	{
+		asset.POST("/create", jwtMiddleware.RequirePermission(model.PermAssetCreate), assetHandler.CreateAsset)
+		asset.GET("/getAssetByID", assetHandler.GetAssetByID)
+		asset.GET("/getAssetByAuthorID", assetHandler.GetAssetByAuthorID)
+		asset.GET("/getAssetByOwnerID", assetHandler.GetAssetByOwnerID)
+		asset.POST("/transfer", verified, assetHandler.TransferAsset)
+		asset.GET("/getStatus", assetHandler.GetAssetStatus)
+		asset.PUT("/metadata", assetHandler.UpdateAssetMetadata)
+		asset.GET("/history", assetHandler.GetAssetHistory)
+		// 限量版
+		asset.POST("/createEdition", jwtMiddleware.RequirePermission(model.PermAssetCreate), assetHandler.CreateEditionSeries)
+		asset.GET("/getEditionSeries", assetHandler.GetEditionSeries)
+		asset.GET("/getEditions", assetHandler.GetEditionsBySeriesID)
+	}
+
+	// 聊天 WebSocket，浏览器无法设置认证头，令牌通过子协议传递
+	chat := apiGroup.Group("/chat")
+	{
+		chat.GET("/ws", jwtMiddleware.WebSocketAuth(), chatHandler.SendMessage)
+	}
+
+	// 需要认证的聊天接口
+	authChat := apiGroup.Group("/chat").Use(jwtMiddleware.Auth())
+	{
+		authChat.GET("/getChatSession", chatHandler.GetChatSession)
+		authChat.GET("/getMessages", chatHandler.GetMessages)
+		authChat.POST("/readMessages", chatHandler.ReadMessages)
+		authChat.GET("/getUnreadMessageCount", chatHandler.GetUnreadMessageCount)
+	}
+
+	// 市场（需要 JWT）
+	market := apiGroup.Group("/market", jwtMiddleware.Auth())
+	{
+		market.GET("/listings", marketHandler.ListListings)
+		market.POST("/listing", verified, marketHandler.CreateListing)
+		market.POST("/offer", verified, marketHandler.CreateOffer)
+		market.POST("/offer/:id/accept", verified, marketHandler.AcceptOffer)
+		market.POST("/offer/:id/cancel", marketHandler.CancelOffer)
+		market.GET("/offers/mine", marketHandler.ListMyOffers)
+		market.POST("/buyNow", verified, marketHandler.BuyNow)
+		// 铸造凭证（Lazy Mint）
+		market.POST("/voucher", jwtMiddleware.RequirePermission(model.PermVoucherCreate), verified, voucherHandler.CreateVoucher)
+		market.GET("/vouchers", voucherHandler.ListVouchers)
+		market.POST("/voucher/:id/redeem", verified, voucherHandler.RedeemVoucher)
+		market.POST("/voucher/:id/cancel", verified, voucherHandler.CancelVoucher)
+		// 创作者发售（白名单预售 + 公开发售）
+		market.POST("/drop", jwtMiddleware.RequirePermission(model.PermDropCreate), verified, dropHandler.CreateDrop)
+		market.GET("/drops", dropHandler.ListDrops)
+		market.GET("/drop/:id", dropHandler.GetDrop)
+		market.POST("/drop/:id/allowlist", verified, dropHandler.AddAllowlist)
+		market.DELETE("/drop/:id/allowlist", verified, dropHandler.RemoveAllowlist)
+	}
+
+	// 拍卖相关接口
+	auction := apiGroup.Group("/auction", jwtMiddleware.Auth())
+	{
+		auction.POST("/create", verified, auctionHandler.CreateLot)
+		auction.GET("/list", auctionHandler.GetAllLots)
+		auction.GET("/seller", auctionHandler.GetLotBySellerID)
+		auction.POST("/bid", verified, auctionHandler.SubmitBid)
+		auction.GET("/bid", auctionHandler.GetBidPrice)
+		auction.GET("/result", auctionHandler.GetAuctionResult)
+		auction.POST("/finish", auctionHandler.FinishAuction)
+	}
+
+	// 区块浏览器
+	blocks := apiGroup.Group("/blocks", jwtMiddleware.Auth())
+	{
+		blocks.GET("", blockHandler.ListBlocks)
+		blocks.GET("/latest", blockHandler.GetLatestBlocks)
+		blocks.GET("/tx/:id", blockHandler.GetTransaction)
+		blocks.GET("/:id", blockHandler.GetBlock)
+	}
+
+	// 管理接口，按权限控制访问，见 model.OrgPermissions
+	audit := jwtMiddleware.RequirePermission(model.PermAuditManage)
+	workflows := jwtMiddleware.RequirePermission(model.PermWorkflowManage)
+	reconcile := jwtMiddleware.RequirePermission(model.PermReconcileManage)
+	verify := jwtMiddleware.RequirePermission(model.PermBlocksVerify)
+	projection := jwtMiddleware.RequirePermission(model.PermProjectionManage)
+	roles := jwtMiddleware.RequirePermission(model.PermAccountManageRoles)
+	membership := jwtMiddleware.RequirePermission(model.PermMembershipReview)
+	manageOrg := jwtMiddleware.RequirePermission(model.PermAccountManageOrg)
+	admin := apiGroup.Group("/admin", jwtMiddleware.Auth())
+	{
+		admin.POST("/audit", audit, auditHandler.RunAudit)
+		admin.GET("/audit/records", audit, auditHandler.ListRecords)
+		admin.GET("/audit/record", audit, auditHandler.GetRecord)
+		// 结算流程（查看卡住的流程并手动重试）
+		admin.GET("/workflows", workflows, workflowHandler.ListWorkflows)
+		admin.GET("/workflow", workflows, workflowHandler.GetWorkflow)
+		admin.POST("/workflow/:id/retry", workflows, workflowHandler.RetryWorkflow)
+		// 数据库与账本对账
+		admin.POST("/reconcile", reconcile, reconcileHandler.Reconcile)
+		admin.GET("/reconcile/runs", reconcile, reconcileHandler.ListRuns)
+		admin.GET("/reconcile/run", reconcile, reconcileHandler.GetRun)
+		// 区块哈希链校验
+		admin.POST("/blocks/verify", verify, blockHandler.VerifyChain)
+		admin.GET("/blocks/verify", verify, blockHandler.GetVerifyResults)
+		// 链上数据读模型
+		admin.GET("/projection", projection, projectionHandler.GetStatus)
+		admin.POST("/projection/rebuild", projection, projectionHandler.Rebuild)
+		// 用户角色
+		admin.GET("/roles", roles, permissionHandler.ListRoles)
+		admin.POST("/role", roles, permissionHandler.GrantRole)
+		admin.DELETE("/role", roles, permissionHandler.RevokeRole)
+		// 组织申请审核
+		admin.GET("/org/applications", membership, membershipHandler.ListForReview)
+		admin.POST("/org/application/:id/review", membership, membershipHandler.Review)
+		admin.GET("/org/events", manageOrg, membershipHandler.ListEvents)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,549 @@
+package api_test
+
+import (
+	"application/api"
+	"application/config"
+	"application/middleware"
+	"application/migrate"
+	"application/model"
+	"application/pkg/fabric"
+	"application/service"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testEnv 基于内存账本和 SQLite 的完整后端，每个测试独立一份
+type testEnv struct {
+	t      *testing.T
+	router *gin.Engine
+	ledger *fabric.MemoryLedger
+	db     *gorm.DB
+}
+
+type testUser struct {
+	id    int
+	token string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	config.GlobalConfig = config.Config{
+		Database: config.DatabaseConfig{Driver: config.DriverSQLite, Path: filepath.Join(dir, "test.db")},
+		Auth: config.AuthConfig{JWTSecret: "test-secret", TokenTTL: time.Hour, RefreshTokenTTL: 24 * time.Hour,
+			EmailVerifyTTL: time.Hour, PasswordResetTTL: time.Hour,
+			TwoFactorKey: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", TwoFactorIssuer: "NFT-Trade", StepUpTTL: time.Minute},
+		// 邮件写入临时目录，测试从中读取验证和重置链接
+		Mail: config.MailConfig{Sender: config.MailSenderFile, From: "noreply@example.com",
+			Dir: filepath.Join(dir, "mail"), LinkBaseURL: "http://localhost:5173"},
+		Storage: config.StorageConfig{PublicDir: dir, ImageDir: dir},
+		// 凭证签名私钥用 walletKey 加密保存
+		Fabric: config.FabricConfig{WalletKey: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+		// 读模型依赖区块监听器，测试中直接查询账本
+		Projection: config.ProjectionConfig{Enabled: false},
+	}
+	middleware.GlobalLogger = zap.NewNop()
+
+	if err := model.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+	db := model.GetDB()
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("获取数据库连接失败：%v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	if _, err := migrate.Up(db, 0); err != nil {
+		t.Fatalf("数据库迁移失败：%v", err)
+	}
+
+	ledger := fabric.NewMemoryLedger()
+	router, err := api.NewRouter(ledger)
+	if err != nil {
+		t.Fatalf("创建路由失败：%v", err)
+	}
+	return &testEnv{t: t, router: router, ledger: ledger, db: db}
+}
+
+// send 发送请求并解析统一响应，返回 HTTP 状态码
+func (e *testEnv) send(req *http.Request, token string, data interface{}) (int, string) {
+	e.t.Helper()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	var resp struct {
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		e.t.Fatalf("%s %s 响应无法解析：%s", req.Method, req.URL, w.Body.String())
+	}
+	if data != nil && w.Code == http.StatusOK && len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, data); err != nil {
+			e.t.Fatalf("%s %s 数据无法解析：%v", req.Method, req.URL, err)
+		}
+	}
+	return w.Code, resp.Message
+}
+
+func (e *testEnv) call(method, path, token string, body interface{}, data interface{}) (int, string) {
+	e.t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			e.t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	return e.send(req, token, data)
+}
+
+// mustCall 请求必须成功
+func (e *testEnv) mustCall(method, path, token string, body interface{}, data interface{}) {
+	e.t.Helper()
+	if code, msg := e.call(method, path, token, body, data); code != http.StatusOK {
+		e.t.Fatalf("%s %s 返回 %d：%s", method, path, code, msg)
+	}
+}
+
+func (e *testEnv) register(username string) testUser {
+	e.t.Helper()
+	e.mustCall(http.MethodPost, "/api/account/register", "", model.RegisterRequest{
+		Username: username, Email: username + "@example.com", Password: "password", Org: 2,
+	}, nil)
+	// 交易需要邮箱已验证，验证流程见 email_test.go
+	if err := e.db.Model(&model.User{}).Where("username = ?", username).Update("email_verified_at", time.Now()).Error; err != nil {
+		e.t.Fatal(err)
+	}
+	var login struct {
+		Token string     `json:"token"`
+		User  model.User `json:"user"`
+	}
+	e.mustCall(http.MethodPost, "/api/account/login", "", model.LoginRequest{Username: username, Password: "password"}, &login)
+	return testUser{id: login.User.ID, token: login.Token}
+}
+
+func (e *testEnv) createAsset(u testUser, name string) model.Asset {
+	e.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("name", name)
+	form.WriteField("description", name+" 的描述")
+	part, err := form.CreateFormFile("image", "image.png")
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	part.Write([]byte("png"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/asset/create", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	var asset model.Asset
+	if code, msg := e.send(req, u.token, &asset); code != http.StatusOK {
+		e.t.Fatalf("创建 NFT 返回 %d：%s", code, msg)
+	}
+	return asset
+}
+
+func (e *testEnv) createListing(u testUser, assetID string, price int64, deadline *time.Time) model.MarketListing {
+	e.t.Helper()
+	body := map[string]interface{}{"assetId": assetID, "title": "挂牌 " + assetID, "price": price}
+	if deadline != nil {
+		body["deadline"] = deadline.Format(time.RFC3339)
+	}
+	var l model.MarketListing
+	e.mustCall(http.MethodPost, "/api/market/listing", u.token, body, &l)
+	return l
+}
+
+func (e *testEnv) createOffer(u testUser, listingID int, price int64) model.MarketOffer {
+	e.t.Helper()
+	var o model.MarketOffer
+	e.mustCall(http.MethodPost, "/api/market/offer", u.token, map[string]interface{}{"listingId": listingID, "offerPrice": price}, &o)
+	return o
+}
+
+func (e *testEnv) balance(u testUser) int {
+	e.t.Helper()
+	var balance int
+	e.mustCall(http.MethodGet, "/api/wallet/balance", u.token, nil, &balance)
+	return balance
+}
+
+func (e *testEnv) owner(u testUser, assetID string) int {
+	e.t.Helper()
+	var asset model.Asset
+	e.mustCall(http.MethodGet, "/api/asset/getAssetByID?id="+assetID, u.token, nil, &asset)
+	return asset.OwnerId
+}
+
+func (e *testEnv) expectBalances(want map[string]int, users map[string]testUser) {
+	e.t.Helper()
+	for name, amount := range want {
+		if got := e.balance(users[name]); got != amount {
+			e.t.Errorf("%s 余额为 %d，期望 %d", name, got, amount)
+		}
+	}
+}
+
+func (e *testEnv) offerStatus(id int) string {
+	e.t.Helper()
+	var o model.MarketOffer
+	if err := e.db.First(&o, id).Error; err != nil {
+		e.t.Fatal(err)
+	}
+	return o.Status
+}
+
+func (e *testEnv) listingStatus(id int) string {
+	e.t.Helper()
+	var l model.MarketListing
+	if err := e.db.First(&l, id).Error; err != nil {
+		e.t.Fatal(err)
+	}
+	return l.Status
+}
+
+func (e *testEnv) holdings(listingID int) []model.WithHolding {
+	e.t.Helper()
+	holdings, err := e.ledger.GetWithHoldingsByListing("org2", fmt.Sprintf("%d", listingID))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return holdings
+}
+
+// 注册 → 创建 NFT → 挂牌 → 出价 → 接受出价，核对持有人和余额
+func TestAcceptOffer(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{
+		"alice": e.register("alice"),
+		"bob":   e.register("bob"),
+		"carol": e.register("carol"),
+	}
+	alice, bob, carol := users["alice"], users["bob"], users["carol"]
+	e.expectBalances(map[string]int{"alice": 100, "bob": 100, "carol": 100}, users)
+
+	asset := e.createAsset(alice, "晨曦")
+	if asset.OwnerId != alice.id || asset.AuthorId != alice.id {
+		t.Fatalf("新建 NFT 的作者和持有人应为 alice：%+v", asset)
+	}
+	listing := e.createListing(alice, asset.ID, 50, nil)
+
+	var page struct {
+		Items []model.MarketListing `json:"items"`
+		Total int64                 `json:"total"`
+	}
+	e.mustCall(http.MethodGet, "/api/market/listings", bob.token, nil, &page)
+	if page.Total != 1 || page.Items[0].ID != listing.ID {
+		t.Fatalf("挂牌列表不正确：%+v", page)
+	}
+
+	// 只有持有人可以挂牌，余额不足不能出价
+	if code, _ := e.call(http.MethodPost, "/api/market/listing", bob.token,
+		map[string]interface{}{"assetId": asset.ID, "title": "x", "price": 10}, nil); code == http.StatusOK {
+		t.Fatal("非持有人挂牌应当失败")
+	}
+	if code, _ := e.call(http.MethodPost, "/api/market/offer", bob.token,
+		map[string]interface{}{"listingId": listing.ID, "offerPrice": 500}, nil); code == http.StatusOK {
+		t.Fatal("余额不足时出价应当失败")
+	}
+
+	bobOffer := e.createOffer(bob, listing.ID, 40)
+	carolOffer := e.createOffer(carol, listing.ID, 30)
+	e.expectBalances(map[string]int{"alice": 100, "bob": 60, "carol": 70}, users)
+	if n := len(e.holdings(listing.ID)); n != 2 {
+		t.Fatalf("应有 2 笔冻结，实际 %d", n)
+	}
+
+	// 只有卖家可以接受出价
+	if code, _ := e.call(http.MethodPost, fmt.Sprintf("/api/market/offer/%d/accept", bobOffer.ID), carol.token, nil, nil); code == http.StatusOK {
+		t.Fatal("非卖家接受出价应当失败")
+	}
+	e.mustCall(http.MethodPost, fmt.Sprintf("/api/market/offer/%d/accept", bobOffer.ID), alice.token, nil, nil)
+
+	if got := e.owner(alice, asset.ID); got != bob.id {
+		t.Fatalf("NFT 持有人为 %d，期望 bob(%d)", got, bob.id)
+	}
+	e.expectBalances(map[string]int{"alice": 140, "bob": 60, "carol": 100}, users)
+	if s := e.listingStatus(listing.ID); s != model.ListingSold {
+		t.Errorf("挂牌状态为 %s，期望 %s", s, model.ListingSold)
+	}
+	if s := e.offerStatus(bobOffer.ID); s != model.OfferAccepted {
+		t.Errorf("中标出价状态为 %s，期望 %s", s, model.OfferAccepted)
+	}
+	if s := e.offerStatus(carolOffer.ID); s != model.OfferRejected {
+		t.Errorf("落选出价状态为 %s，期望 %s", s, model.OfferRejected)
+	}
+	if n := len(e.holdings(listing.ID)); n != 0 {
+		t.Errorf("成交后仍有 %d 笔冻结", n)
+	}
+
+	// 成交后挂牌不再出现在列表中
+	e.mustCall(http.MethodGet, "/api/market/listings", bob.token, nil, &page)
+	if page.Total != 0 {
+		t.Errorf("成交后挂牌列表应为空：%+v", page)
+	}
+}
+
+// 过户失败时结算流程回滚，出价和冻结资金保持不变
+func TestAcceptOfferRollback(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{"alice": e.register("alice"), "bob": e.register("bob")}
+	alice, bob := users["alice"], users["bob"]
+
+	asset := e.createAsset(alice, "暮色")
+	listing := e.createListing(alice, asset.ID, 50, nil)
+	offer := e.createOffer(bob, listing.ID, 40)
+
+	e.ledger.FailOn("TransferAsset", func(args []any) error { return errors.New("背书失败") })
+	if code, _ := e.call(http.MethodPost, fmt.Sprintf("/api/market/offer/%d/accept", offer.ID), alice.token, nil, nil); code == http.StatusOK {
+		t.Fatal("过户失败时接受出价应当失败")
+	}
+	e.ledger.FailOn("TransferAsset", nil)
+
+	if got := e.owner(alice, asset.ID); got != alice.id {
+		t.Fatalf("回滚后 NFT 持有人为 %d，期望 alice(%d)", got, alice.id)
+	}
+	e.expectBalances(map[string]int{"alice": 100, "bob": 60}, users)
+	if s := e.listingStatus(listing.ID); s != model.ListingActive {
+		t.Errorf("挂牌状态为 %s，期望 %s", s, model.ListingActive)
+	}
+	if s := e.offerStatus(offer.ID); s != model.OfferPending {
+		t.Errorf("出价状态为 %s，期望 %s", s, model.OfferPending)
+	}
+
+	// 故障恢复后可以再次接受
+	e.mustCall(http.MethodPost, fmt.Sprintf("/api/market/offer/%d/accept", offer.ID), alice.token, nil, nil)
+	if got := e.owner(alice, asset.ID); got != bob.id {
+		t.Fatalf("NFT 持有人为 %d，期望 bob(%d)", got, bob.id)
+	}
+	e.expectBalances(map[string]int{"alice": 140, "bob": 60}, users)
+}
+
+// 执行中租约被其他执行者接手时停止推进，也不清除对方的租约；租约过期后由后台任务完成
+func TestWorkflowLeaseLost(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{"alice": e.register("alice"), "bob": e.register("bob")}
+	alice, bob := users["alice"], users["bob"]
+
+	asset := e.createAsset(alice, "暮色")
+	listing := e.createListing(alice, asset.ID, 50, nil)
+	offer := e.createOffer(bob, listing.ID, 40)
+
+	takeOver := func(until time.Time) {
+		if err := e.db.Model(&model.Workflow{}).Where("listing_id = ?", listing.ID).
+			Updates(map[string]any{"lease_owner": "other", "lease_until": until}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 过户执行期间租约被接手
+	e.ledger.FailOn("TransferAsset", func(args []any) error {
+		takeOver(time.Now().Add(time.Hour))
+		return nil
+	})
+	if code, _ := e.call(http.MethodPost, fmt.Sprintf("/api/market/offer/%d/accept", offer.ID), alice.token, nil, nil); code == http.StatusOK {
+		t.Fatal("租约被接手后不应返回成交")
+	}
+	e.ledger.FailOn("TransferAsset", nil)
+
+	var wf model.Workflow
+	if err := e.db.Where("listing_id = ?", listing.ID).First(&wf).Error; err != nil {
+		t.Fatal(err)
+	}
+	if wf.Status != model.WorkflowRunning || wf.LeaseOwner != "other" || wf.LeaseUntil == nil {
+		t.Fatalf("流程状态为 %s，租约持有人为 %q", wf.Status, wf.LeaseOwner)
+	}
+	if got := e.owner(alice, asset.ID); got != bob.id {
+		t.Fatalf("NFT 持有人为 %d，期望 bob(%d)", got, bob.id)
+	}
+	e.expectBalances(map[string]int{"alice": 100, "bob": 60}, users)
+
+	// 对方租约过期后由后台任务继续
+	takeOver(time.Now().Add(-time.Second))
+	if err := service.NewWorkflowService(e.ledger).ResumePending(); err != nil {
+		t.Fatal(err)
+	}
+	e.expectBalances(map[string]int{"alice": 140, "bob": 60}, users)
+	if s := e.listingStatus(listing.ID); s != model.ListingSold {
+		t.Errorf("挂牌状态为 %s，期望 %s", s, model.ListingSold)
+	}
+}
+
+// 买家撤回出价，冻结资金退回
+func TestCancelOfferRefund(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{"alice": e.register("alice"), "bob": e.register("bob"), "carol": e.register("carol")}
+	alice, bob, carol := users["alice"], users["bob"], users["carol"]
+
+	asset := e.createAsset(alice, "星河")
+	listing := e.createListing(alice, asset.ID, 50, nil)
+	bobOffer := e.createOffer(bob, listing.ID, 20)
+	carolOffer := e.createOffer(carol, listing.ID, 35)
+	e.expectBalances(map[string]int{"bob": 80, "carol": 65}, users)
+
+	// 只能撤回自己的出价
+	if code, _ := e.call(http.MethodPost, fmt.Sprintf("/api/market/offer/%d/cancel", bobOffer.ID), carol.token, nil, nil); code == http.StatusOK {
+		t.Fatal("撤回他人出价应当失败")
+	}
+	e.mustCall(http.MethodPost, fmt.Sprintf("/api/market/offer/%d/cancel", bobOffer.ID), bob.token, nil, nil)
+
+	e.expectBalances(map[string]int{"alice": 100, "bob": 100, "carol": 65}, users)
+	if s := e.offerStatus(bobOffer.ID); s != model.OfferRejected {
+		t.Errorf("撤回后出价状态为 %s，期望 %s", s, model.OfferRejected)
+	}
+	holdings := e.holdings(listing.ID)
+	if len(holdings) != 1 || holdings[0].AccountID != carol.id {
+		t.Errorf("撤回后只应保留 carol 的冻结：%+v", holdings)
+	}
+
+	// 重复撤回失败，余额不变
+	if code, _ := e.call(http.MethodPost, fmt.Sprintf("/api/market/offer/%d/cancel", bobOffer.ID), bob.token, nil, nil); code == http.StatusOK {
+		t.Fatal("重复撤回应当失败")
+	}
+	e.expectBalances(map[string]int{"bob": 100}, users)
+	if s := e.offerStatus(carolOffer.ID); s != model.OfferPending {
+		t.Errorf("carol 的出价状态为 %s，期望 %s", s, model.OfferPending)
+	}
+	// 冻结已经退还后，换一个 txid 也不能再次退款
+	if err := e.ledger.RefundHolding("org2", "another-refund", fmt.Sprintf("%d", listing.ID), bob.id, 20, time.Now()); err == nil {
+		t.Fatal("已退还的冻结不能再次退款")
+	}
+	e.expectBalances(map[string]int{"bob": 100}, users)
+
+	// 同一挂牌每人只能有一个待处理出价
+	if code, _ := e.call(http.MethodPost, "/api/market/offer", carol.token,
+		map[string]interface{}{"listingId": listing.ID, "offerPrice": 40}, nil); code == http.StatusOK {
+		t.Fatal("已有待处理出价时再次出价应当失败")
+	}
+	// 链上冻结失败时出价改为已拒绝，不影响之后重新出价
+	e.ledger.FailOn("WithHoldAccount", func(args []any) error { return errors.New("节点不可用") })
+	if code, _ := e.call(http.MethodPost, "/api/market/offer", bob.token,
+		map[string]interface{}{"listingId": listing.ID, "offerPrice": 30}, nil); code == http.StatusOK {
+		t.Fatal("冻结失败时出价应当失败")
+	}
+	e.ledger.FailOn("WithHoldAccount", nil)
+	e.createOffer(bob, listing.ID, 30)
+	e.expectBalances(map[string]int{"bob": 70}, users)
+}
+
+// 挂牌过期后定时任务关闭挂牌并退还全部出价
+func TestCloseExpiredRefund(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{"alice": e.register("alice"), "bob": e.register("bob"), "carol": e.register("carol")}
+	alice, bob, carol := users["alice"], users["bob"], users["carol"]
+
+	asset := e.createAsset(alice, "极光")
+	deadline := time.Now().Add(time.Hour)
+	listing := e.createListing(alice, asset.ID, 50, &deadline)
+	bobOffer := e.createOffer(bob, listing.ID, 25)
+	carolOffer := e.createOffer(carol, listing.ID, 45)
+
+	// 未过期的挂牌不受影响
+	svc := service.NewMarketService(e.ledger)
+	if err := svc.CloseExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if s := e.listingStatus(listing.ID); s != model.ListingActive {
+		t.Fatalf("未过期挂牌状态为 %s，期望 %s", s, model.ListingActive)
+	}
+	e.expectBalances(map[string]int{"bob": 75, "carol": 55}, users)
+
+	if err := e.db.Model(&model.MarketListing{}).Where("id = ?", listing.ID).
+		Update("deadline", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次退款失败时挂牌保持开放，已退款的出价不会重复退款
+	e.ledger.FailOn("RefundHolding", func(args []any) error {
+		if args[2] == carol.id {
+			return errors.New("节点不可用")
+		}
+		return nil
+	})
+	if err := svc.CloseExpired(); err == nil {
+		t.Fatal("退款失败时应返回错误")
+	}
+	if s := e.listingStatus(listing.ID); s != model.ListingActive {
+		t.Fatalf("部分退款后挂牌状态为 %s，期望 %s", s, model.ListingActive)
+	}
+	e.ledger.FailOn("RefundHolding", nil)
+
+	if err := svc.CloseExpired(); err != nil {
+		t.Fatal(err)
+	}
+	e.expectBalances(map[string]int{"alice": 100, "bob": 100, "carol": 100}, users)
+	if s := e.listingStatus(listing.ID); s != model.ListingClosed {
+		t.Errorf("过期挂牌状态为 %s，期望 %s", s, model.ListingClosed)
+	}
+	for _, id := range []int{bobOffer.ID, carolOffer.ID} {
+		if s := e.offerStatus(id); s != model.OfferRejected {
+			t.Errorf("出价 %d 状态为 %s，期望 %s", id, s, model.OfferRejected)
+		}
+	}
+	if n := len(e.holdings(listing.ID)); n != 0 {
+		t.Errorf("关闭后仍有 %d 笔冻结", n)
+	}
+	if got := e.owner(alice, asset.ID); got != alice.id {
+		t.Errorf("NFT 持有人为 %d，期望 alice(%d)", got, alice.id)
+	}
+}
+
+// 对账发现没有对应出价的孤立预扣款，事务提交后合并退款，同一账户的多笔冻结只退一次
+func TestReconcileOrphanHolds(t *testing.T) {
+	e := newTestEnv(t)
+	users := map[string]testUser{"alice": e.register("alice"), "bob": e.register("bob"), "carol": e.register("carol")}
+	alice, bob, carol := users["alice"], users["bob"], users["carol"]
+
+	asset := e.createAsset(alice, "潮汐")
+	listing := e.createListing(alice, asset.ID, 50, nil)
+	e.createOffer(carol, listing.ID, 30)
+	listingKey := fmt.Sprintf("%d", listing.ID)
+	for i, amount := range []int{10, 15} {
+		if err := e.ledger.WithHoldAccount("org2", fmt.Sprintf("orphan-%d", i), bob.id, listingKey, amount, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.expectBalances(map[string]int{"bob": 75, "carol": 70}, users)
+
+	svc := service.NewReconcileService(e.ledger)
+	run, err := svc.Reconcile(model.ReconcileManual, alice.id, true, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.IssueCount != 2 || run.RepairedCount != 2 {
+		t.Fatalf("对账结果为 %+v", run)
+	}
+	e.expectBalances(map[string]int{"bob": 100, "carol": 70}, users)
+	holdings := e.holdings(listing.ID)
+	if len(holdings) != 1 || holdings[0].AccountID != carol.id {
+		t.Errorf("修复后只应保留 carol 的冻结：%+v", holdings)
+	}
+
+	// 再次对账没有问题
+	if run, err = svc.Reconcile(model.ReconcileManual, alice.id, true, time.Time{}); err != nil || run.IssueCount != 0 {
+		t.Fatalf("再次对账结果为 %+v：%v", run, err)
+	}
+}
@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"application/model"
+	"net/http"
+	"testing"
+)
+
+func (e *testEnv) login(username string) model.TokenPair {
+	e.t.Helper()
+	var pair model.TokenPair
+	e.mustCall(http.MethodPost, "/api/account/login", "", model.LoginRequest{Username: username, Password: "password"}, &pair)
+	return pair
+}
+
+func (e *testEnv) refresh(refreshToken string) (model.TokenPair, int) {
+	e.t.Helper()
+	var pair model.TokenPair
+	code, _ := e.call(http.MethodPost, "/api/account/refresh", "", model.RefreshRequest{RefreshToken: refreshToken}, &pair)
+	return pair, code
+}
+
+// 刷新令牌只能使用一次，旧令牌再次出现时整个会话被注销
+func TestRefreshRotation(t *testing.T) {
+	e := newTestEnv(t)
+	e.register("alice")
+	first := e.login("alice")
+
+	second, code := e.refresh(first.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("刷新返回 %d", code)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("刷新后刷新令牌没有轮换")
+	}
+	e.mustCall(http.MethodGet, "/api/account/profile", second.AccessToken, nil, nil)
+
+	if _, code := e.refresh(first.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("重复使用旧刷新令牌返回 %d", code)
+	}
+	if _, code := e.refresh(second.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("会话注销后新刷新令牌仍然可用，返回 %d", code)
+	}
+	if code, _ := e.call(http.MethodGet, "/api/account/profile", second.AccessToken, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("会话注销后访问令牌仍然可用，返回 %d", code)
+	}
+	if _, code := e.refresh("not-a-token"); code != http.StatusUnauthorized {
+		t.Fatalf("无效刷新令牌返回 %d", code)
+	}
+}
+
+func TestRevokeSessions(t *testing.T) {
+	e := newTestEnv(t)
+	e.register("alice")
+	laptop := e.login("alice")
+	phone := e.login("alice")
+	bob := e.register("bob")
+
+	var sessions []model.Session
+	e.mustCall(http.MethodGet, "/api/account/sessions", laptop.AccessToken, nil, &sessions)
+	if len(sessions) != 3 {
+		t.Fatalf("有效会话数为 %d，期望 3", len(sessions))
+	}
+	// 用 phone 的令牌查询，当前会话就是 phone 的会话
+	var phoneID string
+	e.mustCall(http.MethodGet, "/api/account/sessions", phone.AccessToken, nil, &sessions)
+	for _, s := range sessions {
+		if s.Current {
+			phoneID = s.ID
+		}
+	}
+	if phoneID == "" {
+		t.Fatal("会话列表没有标记当前会话")
+	}
+
+	if code, _ := e.call(http.MethodPost, "/api/account/session/"+phoneID+"/revoke", bob.token, nil, nil); code == http.StatusOK {
+		t.Fatal("可以注销其他用户的会话")
+	}
+	e.mustCall(http.MethodPost, "/api/account/session/"+phoneID+"/revoke", laptop.AccessToken, nil, nil)
+	if code, _ := e.call(http.MethodGet, "/api/account/profile", phone.AccessToken, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("注销后该会话的访问令牌仍然可用，返回 %d", code)
+	}
+	if _, code := e.refresh(phone.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("注销后该会话的刷新令牌仍然可用，返回 %d", code)
+	}
+
+	e.mustCall(http.MethodPost, "/api/account/sessions/revokeOthers", laptop.AccessToken, nil, nil)
+	e.mustCall(http.MethodGet, "/api/account/sessions", laptop.AccessToken, nil, &sessions)
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("注销其他会话后剩余 %d 个会话", len(sessions))
+	}
+
+	e.mustCall(http.MethodPost, "/api/account/logout", laptop.AccessToken, nil, nil)
+	if code, _ := e.call(http.MethodGet, "/api/account/profile", laptop.AccessToken, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("登出后访问令牌仍然可用，返回 %d", code)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"application/model"
+	"application/service"
+	"application/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TwoFactorHandler struct {
+	svc *service.TwoFactorService
+}
+
+func NewTwoFactorHandler() *TwoFactorHandler {
+	return &TwoFactorHandler{svc: service.NewTwoFactorService()}
+}
+
+// 两步验证状态
+func (h *TwoFactorHandler) GetStatus(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	status, err := h.svc.Status(userID.(int), c.GetString("sessionID"))
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, status)
+}
+
+// 生成密钥和 otpauth 地址，前端显示二维码供身份验证器扫描
+func (h *TwoFactorHandler) Setup(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	setup, err := h.svc.Setup(userID.(int))
+	if err != nil {
+		utils.ServerError(c, "生成密钥失败："+err.Error())
+		return
+	}
+	utils.Success(c, setup)
+}
+
+// 用验证码确认密钥并开启两步验证，返回恢复码
+func (h *TwoFactorHandler) Enable(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	codes, err := h.svc.Enable(userID.(int), req.Code)
+	if err != nil {
+		utils.ServerError(c, "开启两步验证失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "两步验证已开启，请妥善保存恢复码", codes)
+}
+
+// 关闭两步验证
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	var req model.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	if err := h.svc.Disable(userID.(int), req.Password, req.Code); err != nil {
+		utils.ServerError(c, "关闭两步验证失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "两步验证已关闭", nil)
+}
+
+// 重新生成恢复码
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	codes, err := h.svc.RegenerateRecoveryCodes(userID.(int), req.Code)
+	if err != nil {
+		utils.ServerError(c, "生成恢复码失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "已生成新的恢复码，旧恢复码已失效", codes)
+}
+
+// 二次验证，之后一段时间内当前会话可以执行铸币、修改组织和大额转账
+func (h *TwoFactorHandler) StepUp(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数格式错误")
+		return
+	}
+	expiresAt, err := h.svc.StepUp(userID.(int), c.GetString("sessionID"), req.Code)
+	if err != nil {
+		utils.ServerError(c, "验证失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "验证成功", gin.H{"expiresAt": expiresAt})
+}
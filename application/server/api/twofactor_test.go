@@ -0,0 +1,151 @@
+package api_test
+
+import (
+	"application/config"
+	"application/model"
+	"application/pkg/totp"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// authenticator 模拟身份验证器，同一个时间步的验证码只能用一次，依次使用误差范围内的时间步
+type authenticator struct {
+	t      *testing.T
+	secret string
+	last   int64
+}
+
+func (a *authenticator) code() string {
+	a.t.Helper()
+	now := totp.Step(time.Now())
+	step := now - 1
+	if step <= a.last {
+		step = a.last + 1
+	}
+	if step > now+1 {
+		a.t.Fatal("当前时间窗口内的验证码已经用完")
+	}
+	a.last = step
+	code, err := totp.Code(a.secret, step)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return code
+}
+
+// enableTwoFactor 开启两步验证，返回身份验证器和恢复码
+func (e *testEnv) enableTwoFactor(token string) (*authenticator, []string) {
+	e.t.Helper()
+	var setup model.TwoFactorSetup
+	e.mustCall(http.MethodPost, "/api/account/2fa/setup", token, nil, &setup)
+	a := &authenticator{t: e.t, secret: setup.Secret}
+	var codes []string
+	e.mustCall(http.MethodPost, "/api/account/2fa/enable", token, model.TwoFactorCodeRequest{Code: a.code()}, &codes)
+	return a, codes
+}
+
+func (e *testEnv) stepUp(token string, a *authenticator) {
+	e.t.Helper()
+	e.mustCall(http.MethodPost, "/api/account/2fa/stepUp", token, model.TwoFactorCodeRequest{Code: a.code()}, nil)
+}
+
+// 开启两步验证：铸币前需要二次验证，登录需要验证码，恢复码只能用一次
+func TestTwoFactor(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.register("alice")
+	bob := e.register("bob")
+	e.db.Model(&model.User{}).Where("username = ?", "alice").Update("org", 3)
+	token := e.login("alice").AccessToken
+	mint := model.MintTokenRequest{AccountID: alice.id, Amount: 100}
+
+	// 没有开启两步验证的用户不能铸币
+	if code, _ := e.call(http.MethodPost, "/api/wallet/mintToken", token, mint, nil); code != http.StatusForbidden {
+		t.Fatalf("未开启两步验证时铸币返回 %d", code)
+	}
+
+	var setup model.TwoFactorSetup
+	e.mustCall(http.MethodPost, "/api/account/2fa/setup", token, nil, &setup)
+	if setup.Secret == "" || setup.URI == "" {
+		t.Fatalf("密钥为空：%+v", setup)
+	}
+	if code, _ := e.call(http.MethodPost, "/api/account/2fa/enable", token, model.TwoFactorCodeRequest{Code: "000000"}, nil); code == http.StatusOK {
+		t.Fatal("错误的验证码不能开启两步验证")
+	}
+	a := &authenticator{t: t, secret: setup.Secret}
+	var recoveryCodes []string
+	e.mustCall(http.MethodPost, "/api/account/2fa/enable", token, model.TwoFactorCodeRequest{Code: a.code()}, &recoveryCodes)
+	if len(recoveryCodes) != 10 {
+		t.Fatalf("恢复码数量为 %d", len(recoveryCodes))
+	}
+
+	// 开启后仍需在当前会话中二次验证
+	if code, _ := e.call(http.MethodPost, "/api/wallet/mintToken", token, mint, nil); code != http.StatusPreconditionRequired {
+		t.Fatalf("未二次验证时铸币返回 %d", code)
+	}
+	e.stepUp(token, a)
+	e.mustCall(http.MethodPost, "/api/wallet/mintToken", token, mint, nil)
+	var status model.TwoFactorStatus
+	e.mustCall(http.MethodGet, "/api/account/2fa", token, nil, &status)
+	if !status.Enabled || status.RecoveryCodesLeft != 10 || status.StepUpExpiresAt == nil {
+		t.Fatalf("两步验证状态为 %+v", status)
+	}
+
+	// 密码正确时只返回挑战令牌，用恢复码完成登录，登录后的会话已完成二次验证
+	var challenge struct {
+		model.TwoFactorChallenge
+		Token string `json:"token"`
+	}
+	e.mustCall(http.MethodPost, "/api/account/login", "", model.LoginRequest{Username: "alice", Password: "password"}, &challenge)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" || challenge.Token != "" {
+		t.Fatalf("开启两步验证后密码登录的响应为 %+v", challenge)
+	}
+	var pair model.TokenPair
+	if code, _ := e.call(http.MethodPost, "/api/account/login/2fa", "",
+		model.TwoFactorLoginRequest{ChallengeToken: token, Code: recoveryCodes[0]}, nil); code == http.StatusOK {
+		t.Fatal("访问令牌不能当作挑战令牌使用")
+	}
+	e.mustCall(http.MethodPost, "/api/account/login/2fa", "",
+		model.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: recoveryCodes[0]}, &pair)
+	e.mustCall(http.MethodPost, "/api/wallet/mintToken", pair.AccessToken, mint, nil)
+	if code, _ := e.call(http.MethodPost, "/api/account/login/2fa", "",
+		model.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: recoveryCodes[0]}, nil); code == http.StatusOK {
+		t.Fatal("恢复码只能使用一次")
+	}
+
+	// 超过阈值的转账需要二次验证
+	config.GlobalConfig.Auth.StepUpTransferThreshold = 50
+	e.mustCall(http.MethodPost, "/api/wallet/transfer", bob.token, model.TransferRequest{RecipientID: alice.id, Amount: 10}, nil)
+	if code, _ := e.call(http.MethodPost, "/api/wallet/transfer", bob.token,
+		model.TransferRequest{RecipientID: alice.id, Amount: 60}, nil); code != http.StatusForbidden {
+		t.Fatalf("未开启两步验证时大额转账返回 %d", code)
+	}
+
+	// 关闭需要密码和验证码，关闭后二次验证失效
+	if code, _ := e.call(http.MethodPost, "/api/account/2fa/disable", token,
+		model.TwoFactorDisableRequest{Password: "wrong", Code: recoveryCodes[1]}, nil); code == http.StatusOK {
+		t.Fatal("密码错误时不能关闭两步验证")
+	}
+	e.mustCall(http.MethodPost, "/api/account/2fa/disable", token, model.TwoFactorDisableRequest{Password: "password", Code: recoveryCodes[1]}, nil)
+	if code, _ := e.call(http.MethodPost, "/api/wallet/mintToken", token, mint, nil); code != http.StatusForbidden {
+		t.Fatalf("关闭两步验证后铸币返回 %d", code)
+	}
+	if e.login("alice").AccessToken == "" {
+		t.Fatal("关闭两步验证后密码登录应当直接返回令牌")
+	}
+}
+
+// 连续输错验证码后锁定，锁定期间正确的验证码也不能通过
+func TestTwoFactorLockout(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.register("alice")
+	a, _ := e.enableTwoFactor(alice.token)
+	for i := 0; i < 5; i++ {
+		if code, _ := e.call(http.MethodPost, "/api/account/2fa/stepUp", alice.token, model.TwoFactorCodeRequest{Code: "000000"}, nil); code == http.StatusOK {
+			t.Fatal("错误的验证码通过了验证")
+		}
+	}
+	if code, _ := e.call(http.MethodPost, "/api/account/2fa/stepUp", alice.token, model.TwoFactorCodeRequest{Code: a.code()}, nil); code == http.StatusOK {
+		t.Fatal("锁定期间验证码不应通过")
+	}
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"application/config"
+	"application/pkg/fabric"
+	"application/service"
+	"application/utils"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type VoucherHandler struct {
+	svc *service.VoucherService
+}
+
+func NewVoucherHandler(ledger fabric.LedgerClient) *VoucherHandler {
+	return &VoucherHandler{svc: service.NewVoucherService(ledger)}
+}
+
+// 创作者发布铸造凭证（form-data：name、description、price、image）
+func (h *VoucherHandler) CreateVoucher(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	name := c.PostForm("name")
+	if name == "" {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	description := c.PostForm("description")
+	if description == "" {
+		description = "暂无描述"
+	}
+	price, err := strconv.ParseInt(c.PostForm("price"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "价格格式错误")
+		return
+	}
+	image, err := c.FormFile("image")
+	if err != nil {
+		utils.ServerError(c, "获取请求参数失败")
+		return
+	}
+
+	// 计算图片哈希，写入凭证签名
+	f, err := image.Open()
+	if err != nil {
+		utils.ServerError(c, fmt.Sprintf("读取图片失败：%s", err.Error()))
+		return
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, f)
+	f.Close()
+	if err != nil {
+		utils.ServerError(c, fmt.Sprintf("读取图片失败：%s", err.Error()))
+		return
+	}
+	imageHash := fmt.Sprintf("%x", hasher.Sum(nil))
+
+	imageName := uuid.New().String() + image.Filename
+	dst := filepath.Join(config.GlobalConfig.Storage.ImageDir, imageName)
+	if err := c.SaveUploadedFile(image, dst); err != nil {
+		utils.ServerError(c, fmt.Sprintf("保存图片失败：%s", err.Error()))
+		return
+	}
+
+	v, err := h.svc.CreateVoucher(userID.(int), name, description, imageName, imageHash, price)
+	if err != nil {
+		utils.ServerError(c, "发布凭证失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "发布凭证成功", v)
+}
+
+// 查询可兑换的凭证
+func (h *VoucherHandler) ListVouchers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+
+	items, total, err := h.svc.ListVouchers(page, size)
+	if err != nil {
+		utils.ServerError(c, "查询失败："+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{"items": items, "total": total})
+}
+
+// 买家兑换凭证
+func (h *VoucherHandler) RedeemVoucher(c *gin.Context) {
+	uidVal, ok := c.Get("userID")
+	if !ok {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	userID, ok := uidVal.(int)
+	if !ok {
+		utils.ServerError(c, "用户ID类型错误")
+		return
+	}
+
+	asset, err := h.svc.RedeemVoucher(userID, c.Param("id"))
+	if err != nil {
+		utils.ServerError(c, "兑换失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "兑换成功", asset)
+}
+
+// 创作者撤回凭证
+func (h *VoucherHandler) CancelVoucher(c *gin.Context) {
+	uidVal, ok := c.Get("userID")
+	if !ok {
+		utils.ServerError(c, "用户信息获取失败")
+		return
+	}
+	userID, ok := uidVal.(int)
+	if !ok {
+		utils.ServerError(c, "用户ID类型错误")
+		return
+	}
+
+	if err := h.svc.CancelVoucher(userID, c.Param("id")); err != nil {
+		utils.ServerError(c, "撤回失败："+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "撤回成功", nil)
+}
@@ -0,0 +1,178 @@
+package api_test
+
+import (
+	"application/model"
+	"application/pkg/fabric"
+	"application/service"
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (e *testEnv) createVoucher(u testUser, name string, price int64) model.MintVoucher {
+	e.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("name", name)
+	form.WriteField("description", name+" 的描述")
+	form.WriteField("price", strconv.FormatInt(price, 10))
+	part, err := form.CreateFormFile("image", "image.png")
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	part.Write([]byte("png"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/market/voucher", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	var v model.MintVoucher
+	if code, msg := e.send(req, u.token, &v); code != http.StatusOK {
+		e.t.Fatalf("发布凭证返回 %d：%s", code, msg)
+	}
+	return v
+}
+
+// 兑换凭证：付款并铸造给买家，签名私钥加密保存
+func TestRedeemVoucher(t *testing.T) {
+	e := newTestEnv(t)
+	creator := e.register("creator")
+	buyer := e.register("buyer")
+	v := e.createVoucher(creator, "v1", 30)
+
+	var key model.SignerKey
+	if err := e.db.Where("user_id = ?", creator.id).First(&key).Error; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(key.PrivateKey, "PRIVATE KEY") {
+		t.Fatal("签名私钥以明文保存")
+	}
+
+	if code, _ := e.call(http.MethodPost, "/api/market/voucher/"+v.ID+"/redeem", creator.token, nil, nil); code == http.StatusOK {
+		t.Fatal("创作者不能兑换自己的凭证")
+	}
+	var asset model.Asset
+	e.mustCall(http.MethodPost, "/api/market/voucher/"+v.ID+"/redeem", buyer.token, nil, &asset)
+	if e.owner(buyer, asset.ID) != buyer.id {
+		t.Fatal("兑换后 NFT 不属于买家")
+	}
+	e.expectBalances(map[string]int{"creator": 130, "buyer": 70}, map[string]testUser{"creator": creator, "buyer": buyer})
+	if code, _ := e.call(http.MethodPost, "/api/market/voucher/"+v.ID+"/cancel", creator.token, nil, nil); code == http.StatusOK {
+		t.Fatal("已兑换的凭证不能撤回")
+	}
+}
+
+// 撤回记录在链上，撤回后即使拿着签名凭证直接调用链码也不能兑换
+func TestCancelVoucher(t *testing.T) {
+	e := newTestEnv(t)
+	creator := e.register("creator")
+	buyer := e.register("buyer")
+	v := e.createVoucher(creator, "v1", 30)
+
+	e.ledger.FailOn("CancelVoucher", func(args []any) error { return errors.New("节点不可用") })
+	if code, _ := e.call(http.MethodPost, "/api/market/voucher/"+v.ID+"/cancel", creator.token, nil, nil); code == http.StatusOK {
+		t.Fatal("链上撤回失败时不应返回成功")
+	}
+	var current model.MintVoucher
+	e.db.Where("id = ?", v.ID).First(&current)
+	if current.Status != model.VoucherOpen {
+		t.Fatalf("链上撤回失败后凭证状态为 %s", current.Status)
+	}
+	e.ledger.FailOn("CancelVoucher", nil)
+
+	if code, _ := e.call(http.MethodPost, "/api/market/voucher/"+v.ID+"/cancel", buyer.token, nil, nil); code == http.StatusOK {
+		t.Fatal("非创作者不能撤回凭证")
+	}
+	e.mustCall(http.MethodPost, "/api/market/voucher/"+v.ID+"/cancel", creator.token, nil, nil)
+	if code, _ := e.call(http.MethodPost, "/api/market/voucher/"+v.ID+"/redeem", buyer.token, nil, nil); code == http.StatusOK {
+		t.Fatal("撤回后的凭证不能兑换")
+	}
+	_, err := e.ledger.RedeemVoucher("org2", fabric.Voucher{
+		ID: v.ID, CreatorID: v.CreatorID, Name: v.Name, Description: v.Description, ImageName: v.ImageName,
+		ImageHash: v.ImageHash, Price: int(v.Price), Signature: v.Signature,
+	}, buyer.id, "asset-1", "transfer-1", time.Now())
+	if err == nil || !strings.Contains(err.Error(), "撤回") {
+		t.Fatalf("链码应当拒绝兑换已撤回的凭证，实际：%v", err)
+	}
+}
+
+// 中途中断的凭证由定时任务按链上状态修正：已上链的兑换标记为已兑换，未上链的恢复为可兑换，撤回重新提交
+func TestResolvePendingVouchers(t *testing.T) {
+	e := newTestEnv(t)
+	creator := e.register("creator")
+	buyer := e.register("buyer")
+	redeemed := e.createVoucher(creator, "v1", 30)
+	lost := e.createVoucher(creator, "v2", 30)
+	cancelling := e.createVoucher(creator, "v3", 30)
+
+	// 链上兑换成功后保存结果失败，凭证停在兑换中
+	const hook = "test:fail_voucher_redeemed"
+	if err := e.db.Callback().Update().Before("gorm:update").Register(hook, func(db *gorm.DB) {
+		if fields, ok := db.Statement.Dest.(map[string]any); ok && fields["status"] == model.VoucherRedeemed {
+			db.AddError(errors.New("数据库不可用"))
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	code, _ := e.call(http.MethodPost, "/api/market/voucher/"+redeemed.ID+"/redeem", buyer.token, nil, nil)
+	if err := e.db.Callback().Update().Remove(hook); err != nil {
+		t.Fatal(err)
+	}
+	if code == http.StatusOK {
+		t.Fatal("保存兑换结果失败时不应返回成功")
+	}
+	// 兑换和撤回提交后进程退出，链上没有执行
+	if err := e.db.Model(&model.MintVoucher{}).Where("id = ?", lost.ID).
+		UpdateColumns(map[string]any{"status": model.VoucherPending, "redeemer_id": buyer.id}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := e.db.Model(&model.MintVoucher{}).Where("id = ?", cancelling.ID).
+		UpdateColumn("status", model.VoucherPending).Error; err != nil {
+		t.Fatal(err)
+	}
+	status := func(id string) model.MintVoucher {
+		var v model.MintVoucher
+		if err := e.db.Where("id = ?", id).First(&v).Error; err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v := status(redeemed.ID); v.Status != model.VoucherPending {
+		t.Fatalf("凭证状态为 %s，期望 %s", v.Status, model.VoucherPending)
+	}
+
+	svc := service.NewVoucherService(e.ledger)
+	if err := svc.ResolvePending(); err != nil {
+		t.Fatal(err)
+	}
+	if v := status(lost.ID); v.Status != model.VoucherPending {
+		t.Fatal("未超时的凭证不应被修正")
+	}
+	if err := e.db.Model(&model.MintVoucher{}).Where("status = ?", model.VoucherPending).
+		UpdateColumn("update_time", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ResolvePending(); err != nil {
+		t.Fatal(err)
+	}
+
+	v := status(redeemed.ID)
+	if v.Status != model.VoucherRedeemed || v.AssetID == nil || e.owner(buyer, *v.AssetID) != buyer.id {
+		t.Fatalf("已上链的兑换修正后为 %+v", v)
+	}
+	if v := status(lost.ID); v.Status != model.VoucherOpen || v.RedeemerID != nil {
+		t.Fatalf("未上链的兑换修正后为 %+v", v)
+	}
+	if v := status(cancelling.ID); v.Status != model.VoucherCancelled {
+		t.Fatalf("撤回中的凭证修正后状态为 %s", v.Status)
+	}
+	e.expectBalances(map[string]int{"creator": 130, "buyer": 70}, map[string]testUser{"creator": creator, "buyer": buyer})
+	e.mustCall(http.MethodPost, "/api/market/voucher/"+lost.ID+"/redeem", buyer.token, nil, nil)
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"application/config"
+	"application/middleware"
 	"application/model"
+	"application/pkg/fabric"
 	"application/service"
 	"application/utils"
 	"fmt"
@@ -10,12 +13,13 @@ import (
 )
 
 type WalletHandler struct {
-	walletService *service.WalletService
+	walletService    *service.WalletService
+	twoFactorService *service.TwoFactorService
 }
 
-func NewWalletHandler() *WalletHandler {
-	walletService := service.NewWalletService()
-	return &WalletHandler{walletService: walletService}
+func NewWalletHandler(ledger fabric.LedgerClient) *WalletHandler {
+	walletService := service.NewWalletService(ledger)
+	return &WalletHandler{walletService: walletService, twoFactorService: service.NewTwoFactorService()}
 }
 
 func (h *WalletHandler) CreateAccount(c *gin.Context) {
@@ -87,6 +91,13 @@ func (h *WalletHandler) Transfer(c *gin.Context) {
 	}
 	recipientID := transferRequest.RecipientID
 	amount := transferRequest.Amount
+	// 大额转账需要二次验证
+	if threshold := config.GlobalConfig.Auth.StepUpTransferThreshold; threshold > 0 && amount > threshold {
+		if err := h.twoFactorService.CheckStepUp(userID.(int), c.GetString("sessionID")); err != nil {
+			middleware.StepUpFailed(c, err)
+			return
+		}
+	}
 	txid, err := h.walletService.Transfer(userID.(int), recipientID, amount, org.(int))
 	if err != nil {
 		utils.ServerError(c, err.Error())
@@ -101,10 +112,6 @@ func (h *WalletHandler) MintToken(c *gin.Context) {
 		utils.ServerError(c, "组织信息获取失败")
 		return
 	}
-	if org.(int) != 3 {
-		utils.ServerError(c, "只有金融组织可以铸币")
-		return
-	}
 	var mintTokenRequest model.MintTokenRequest
 	if err := c.ShouldBindJSON(&mintTokenRequest); err != nil {
 		utils.BadRequest(c, err.Error())
@@ -218,18 +225,3 @@ func (h *WalletHandler) GetWithHoldingByListingID(c *gin.Context) {
 	}
 	utils.Success(c, withHoldings)
 }
-
-func (h *WalletHandler) ClearWithHolding(c *gin.Context) {
-	org, exists := c.Get("org")
-	if !exists {
-		utils.ServerError(c, "组织信息获取失败")
-		return
-	}
-	listingID := c.Query("listingID")
-	err := h.walletService.ClearWithHolding(listingID, org.(int))
-	if err != nil {
-		utils.ServerError(c, err.Error())
-		return
-	}
-	utils.Success(c, "清除预扣款成功")
-}
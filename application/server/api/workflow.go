@@ -0,0 +1,63 @@
+package api
+
+import (
+	"application/pkg/fabric"
+	"application/service"
+	"application/utils"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WorkflowHandler struct {
+	svc *service.WorkflowService
+}
+
+func NewWorkflowHandler(ledger fabric.LedgerClient) *WorkflowHandler {
+	return &WorkflowHandler{svc: service.NewWorkflowService(ledger)}
+}
+
+// 查询结算流程（需要 workflow:manage 权限），stuck=true 只看失败或长时间未完成的流程
+func (h *WorkflowHandler) ListWorkflows(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	stuck := c.DefaultQuery("stuck", "true") == "true"
+
+	items, total, err := h.svc.ListWorkflows(c.Query("status"), stuck, page, size)
+	if err != nil {
+		utils.ServerError(c, "查询失败："+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{"items": items, "total": total})
+}
+
+// 查询单个结算流程及其步骤（需要 workflow:manage 权限）
+func (h *WorkflowHandler) GetWorkflow(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.BadRequest(c, "流程ID非法")
+		return
+	}
+	wf, err := h.svc.GetWorkflow(id)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.Success(c, wf)
+}
+
+// 手动重试结算流程（需要 workflow:manage 权限）
+func (h *WorkflowHandler) RetryWorkflow(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "流程ID非法")
+		return
+	}
+	wf, err := h.svc.Retry(id)
+	if err != nil && !errors.Is(err, service.ErrWorkflowPending) {
+		utils.ServerError(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "已重试", wf)
+}
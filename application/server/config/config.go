@@ -1,28 +1,160 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultConfigPath 默认配置文件路径（相对于工作目录）
+const DefaultConfigPath = "config/config.yaml"
+
 // Config 配置
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	Fabric FabricConfig `yaml:"fabric"`
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Gateway    GatewayConfig    `yaml:"gateway"`
+	Storage    StorageConfig    `yaml:"storage"`
+	Scheduler  SchedulerConfig  `yaml:"scheduler"`
+	Projection ProjectionConfig `yaml:"projection"`
+	Mail       MailConfig       `yaml:"mail"`
+	Fabric     FabricConfig     `yaml:"fabric"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port int `yaml:"port"`
+	Port int    `yaml:"port"`
+	Mode string `yaml:"mode"` // release 或 dev
+}
+
+// 支持的运行模式
+const (
+	ModeRelease = "release" // 默认，密钥不能为空，也不能是仓库中公开过的值
+	ModeDev     = "dev"     // 本地开发，允许空的数据库密码和公开过的默认密钥
+)
+
+// leakedSecrets 曾经提交到仓库中的密钥，只能在 dev 模式下使用
+var leakedSecrets = map[string]bool{
+	"123456": true,
+	"9f2b8c5d1e4a7f0b3d6a2c1e8f5b4a0d9e2c8f6b1a3d5e7c8f9b0a1d2e3c4f5a": true,
+	"adminpw": true,
+}
+
+// 支持的数据库驱动
+const (
+	DriverPostgres = "postgres" // 生产环境
+	DriverSQLite   = "sqlite"   // 本地开发和测试，只支持单实例
+)
+
+// DatabaseConfig 数据库配置
+// driver 为 sqlite 时只使用 path，其余字段是 PostgreSQL 的连接参数
+type DatabaseConfig struct {
+	Driver   string `yaml:"driver"`
+	Path     string `yaml:"path"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"dbName"`
+	SSLMode  string `yaml:"sslMode"`
+	TimeZone string `yaml:"timeZone"`
+	// MigrateOnStart 启动时自动执行未执行的迁移；关闭后有未执行的迁移时拒绝启动，需要先运行 migrate up
+	MigrateOnStart bool `yaml:"migrateOnStart"`
+}
+
+// DSN 生成 PostgreSQL 连接串
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+		d.Host, d.User, d.Password, d.DBName, d.Port, d.SSLMode, d.TimeZone)
+}
+
+// AuthConfig 认证配置
+// 访问令牌（JWT）短期有效，过期后用刷新令牌换发；刷新令牌每次使用后轮换，会话闲置超过 refreshTokenTTL 后需要重新登录
+type AuthConfig struct {
+	JWTSecret        string        `yaml:"jwtSecret"`
+	TokenTTL         time.Duration `yaml:"tokenTTL"`         // 访问令牌有效期
+	RefreshTokenTTL  time.Duration `yaml:"refreshTokenTTL"`  // 刷新令牌有效期
+	EmailVerifyTTL   time.Duration `yaml:"emailVerifyTTL"`   // 邮箱验证链接有效期
+	PasswordResetTTL time.Duration `yaml:"passwordResetTTL"` // 密码重置链接有效期
+	// 两步验证（TOTP）：开启后登录需要验证码；铸币、修改组织和大额转账前需要在 stepUpTTL 内验证过一次
+	TwoFactorKey            string        `yaml:"twoFactorKey"`            // 加密 TOTP 密钥的 AES-256 密钥（base64）
+	PreviousTwoFactorKey    string        `yaml:"previousTwoFactorKey"`    // 更换 twoFactorKey 期间的旧密钥，rotate-keys 重新加密后删除
+	TwoFactorIssuer         string        `yaml:"twoFactorIssuer"`         // 身份验证器中显示的发行方
+	StepUpTTL               time.Duration `yaml:"stepUpTTL"`               // 二次验证的有效期
+	StepUpTransferThreshold int           `yaml:"stepUpTransferThreshold"` // 转账金额超过该值时需要二次验证，0 表示转账不要求
+}
+
+// GatewayConfig Fabric 网关超时配置
+type GatewayConfig struct {
+	EvaluateTimeout     time.Duration `yaml:"evaluateTimeout"`
+	EndorseTimeout      time.Duration `yaml:"endorseTimeout"`
+	SubmitTimeout       time.Duration `yaml:"submitTimeout"`
+	CommitStatusTimeout time.Duration `yaml:"commitStatusTimeout"`
+}
+
+// StorageConfig 本地存储目录配置
+type StorageConfig struct {
+	PublicDir string `yaml:"publicDir"` // 静态文件目录，对外映射为 /public
+	ImageDir  string `yaml:"imageDir"`  // 图片上传目录
+	BlockDir  string `yaml:"blockDir"`  // 区块监听器数据目录
+	LogDir    string `yaml:"logDir"`    // 日志目录
+}
+
+// SchedulerConfig 后台定时任务配置
+type SchedulerConfig struct {
+	Enabled               bool          `yaml:"enabled"`
+	TickInterval          time.Duration `yaml:"tickInterval"`          // 调度循环间隔，也是抢占主节点锁的间隔
+	CloseExpiredInterval  time.Duration `yaml:"closeExpiredInterval"`  // 关闭过期挂牌的间隔
+	FinishAuctionInterval time.Duration `yaml:"finishAuctionInterval"` // 结算到期拍卖的间隔
+	WorkflowInterval      time.Duration `yaml:"workflowInterval"`      // 恢复未完成结算流程和处理中凭证的间隔
+	ReconcileInterval     time.Duration `yaml:"reconcileInterval"`     // 数据库与账本对账的间隔
+	TokenCleanupInterval  time.Duration `yaml:"tokenCleanupInterval"`  // 清理过期刷新令牌和会话的间隔
+	ReconcileAutoRepair   bool          `yaml:"reconcileAutoRepair"`   // 定时对账时是否自动修复预扣款不一致
+	RetryBackoff          time.Duration `yaml:"retryBackoff"`          // 失败重试的初始退避时间，之后每次翻倍
+	MaxBackoff            time.Duration `yaml:"maxBackoff"`            // 最大退避时间
+	LockKey               int64         `yaml:"lockKey"`               // 主节点锁的键（PostgreSQL advisory lock），多实例需一致
+}
+
+// ProjectionConfig 链上数据读模型配置
+type ProjectionConfig struct {
+	Enabled         bool `yaml:"enabled"`         // 是否同步读模型并用于资产、余额、转账和预扣款查询
+	MaxLag          int  `yaml:"maxLag"`          // 读模型最多可以落后的区块数
+	FallbackToChain bool `yaml:"fallbackToChain"` // 读模型落后超过 maxLag 或查不到数据时回退到链上查询
+}
+
+// 支持的邮件发送方式
+const (
+	MailSenderSMTP    = "smtp"    // 通过 SMTP 服务器发送
+	MailSenderFile    = "file"    // 每封邮件写成 dir 目录下的一个 .eml 文件，本地开发使用
+	MailSenderConsole = "console" // 打印到日志，本地开发使用
+)
+
+// MailConfig 邮件配置，用于邮箱验证和密码重置
+type MailConfig struct {
+	Sender      string `yaml:"sender"`      // smtp、file 或 console
+	From        string `yaml:"from"`        // 发件人地址
+	Host        string `yaml:"host"`        // SMTP 服务器
+	Port        int    `yaml:"port"`        // SMTP 端口，587 时使用 STARTTLS
+	Username    string `yaml:"username"`    // SMTP 用户名，为空时不认证
+	Password    string `yaml:"password"`    // SMTP 密码
+	Dir         string `yaml:"dir"`         // file 方式的邮件目录
+	LinkBaseURL string `yaml:"linkBaseURL"` // 邮件中链接指向的前端地址，例如 http://localhost:5173
 }
 
 // FabricConfig Fabric配置
 type FabricConfig struct {
-	ChannelName   string                        `yaml:"channelName"`
-	ChaincodeName string                        `yaml:"chaincodeName"`
-	Organizations map[string]OrganizationConfig `yaml:"organizations"`
+	ChannelName       string                        `yaml:"channelName"`
+	ChaincodeName     string                        `yaml:"chaincodeName"`
+	WalletKey         string                        `yaml:"walletKey"`         // 加密链上身份和凭证签名私钥的 AES-256 密钥（base64），必填
+	PreviousWalletKey string                        `yaml:"previousWalletKey"` // 更换 walletKey 期间的旧密钥，rotate-keys 重新加密后删除
+	Organizations     map[string]OrganizationConfig `yaml:"organizations"`
 }
 
 // OrganizationConfig 组织配置
@@ -33,23 +165,372 @@ type OrganizationConfig struct {
 	TLSCertPath  string `yaml:"tlsCertPath"`
 	PeerEndpoint string `yaml:"peerEndpoint"`
 	GatewayPeer  string `yaml:"gatewayPeer"`
+	// 为用户和组织服务登记身份的 Fabric CA，必填；上面的组织身份只用于查询
+	CA CAConfig `yaml:"ca"`
+}
+
+// CAConfig Fabric CA 配置
+type CAConfig struct {
+	URL             string `yaml:"url"`             // 例如 http://localhost:7054
+	Name            string `yaml:"name"`            // CA 名称，服务端只有一个 CA 时可以为空
+	RegistrarID     string `yaml:"registrarID"`     // 有登记权限的身份，通常是 CA 的引导管理员
+	RegistrarSecret string `yaml:"registrarSecret"` // 登记员密码
+	TLSCertPath     string `yaml:"tlsCertPath"`     // url 为 https 时用于校验 CA 服务端证书
 }
 
 var GlobalConfig Config
 
 // InitConfig 初始化配置
-func InitConfig() error {
+// 配置文件路径优先级：参数 path（--config）> 环境变量 APP_CONFIG > DefaultConfigPath
+// 读取文件后再应用 APP_* 环境变量覆盖，最后做校验
+func InitConfig(path string) error {
+	if path == "" {
+		path = os.Getenv("APP_CONFIG")
+	}
+	if path == "" {
+		path = DefaultConfigPath
+	}
+
 	// 读取配置文件
-	data, err := os.ReadFile("config/config.yaml")
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("读取配置文件失败：%v", err)
+		return fmt.Errorf("读取配置文件 %s 失败：%v", path, err)
 	}
 
 	// 解析配置文件
-	err = yaml.Unmarshal(data, &GlobalConfig)
+	cfg := defaultConfig()
+	err = yaml.Unmarshal(data, &cfg)
 	if err != nil {
-		return fmt.Errorf("解析配置文件失败：%v", err)
+		return fmt.Errorf("解析配置文件 %s 失败：%v", path, err)
 	}
 
+	if err := applyEnvOverrides(&cfg); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("配置校验失败：\n%v", err)
+	}
+
+	GlobalConfig = cfg
 	return nil
 }
+
+// defaultConfig 配置文件中未出现的字段使用的默认值
+func defaultConfig() Config {
+	return Config{
+		Server: ServerConfig{Port: 8888, Mode: ModeRelease},
+		Database: DatabaseConfig{
+			Driver:         DriverPostgres,
+			Path:           "data/app.db",
+			Host:           "127.0.0.1",
+			Port:           5432,
+			SSLMode:        "disable",
+			TimeZone:       "Asia/Shanghai",
+			MigrateOnStart: true,
+		},
+		Auth: AuthConfig{
+			TokenTTL:                15 * time.Minute,
+			RefreshTokenTTL:         30 * 24 * time.Hour,
+			EmailVerifyTTL:          24 * time.Hour,
+			PasswordResetTTL:        30 * time.Minute,
+			TwoFactorIssuer:         "NFT-Trade",
+			StepUpTTL:               5 * time.Minute,
+			StepUpTransferThreshold: 1000,
+		},
+		Gateway: GatewayConfig{
+			EvaluateTimeout:     5 * time.Second,
+			EndorseTimeout:      15 * time.Second,
+			SubmitTimeout:       5 * time.Second,
+			CommitStatusTimeout: time.Minute,
+		},
+		Storage: StorageConfig{
+			PublicDir: "public",
+			ImageDir:  "public/images",
+			BlockDir:  "data/blocks",
+			LogDir:    "logs",
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:               true,
+			TickInterval:          5 * time.Second,
+			CloseExpiredInterval:  30 * time.Second,
+			FinishAuctionInterval: 10 * time.Second,
+			WorkflowInterval:      10 * time.Second,
+			ReconcileInterval:     10 * time.Minute,
+			TokenCleanupInterval:  time.Hour,
+			RetryBackoff:          5 * time.Second,
+			MaxBackoff:            5 * time.Minute,
+			LockKey:               20240801,
+		},
+		Projection: ProjectionConfig{
+			Enabled:         true,
+			MaxLag:          2,
+			FallbackToChain: true,
+		},
+		Mail: MailConfig{
+			Sender:      MailSenderConsole,
+			From:        "noreply@localhost",
+			Port:        587,
+			Dir:         "data/mail",
+			LinkBaseURL: "http://localhost:5173",
+		},
+	}
+}
+
+// envOverride 环境变量覆盖项
+type envOverride struct {
+	name string
+	set  func(cfg *Config, value string) error
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		*field(cfg) = value
+		return nil
+	}
+}
+
+func setInt(field func(*Config) *int) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("不是合法的整数：%q", value)
+		}
+		*field(cfg) = n
+		return nil
+	}
+}
+
+func setBool(field func(*Config) *bool) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("不是合法的布尔值：%q", value)
+		}
+		*field(cfg) = b
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("不是合法的时长（如 5s、1m）：%q", value)
+		}
+		*field(cfg) = d
+		return nil
+	}
+}
+
+// 支持的环境变量，命名规则为 APP_<配置段>_<字段>
+var envOverrides = []envOverride{
+	{"APP_SERVER_PORT", setInt(func(c *Config) *int { return &c.Server.Port })},
+	{"APP_SERVER_MODE", setString(func(c *Config) *string { return &c.Server.Mode })},
+	{"APP_DATABASE_DRIVER", setString(func(c *Config) *string { return &c.Database.Driver })},
+	{"APP_DATABASE_PATH", setString(func(c *Config) *string { return &c.Database.Path })},
+	{"APP_DATABASE_HOST", setString(func(c *Config) *string { return &c.Database.Host })},
+	{"APP_DATABASE_PORT", setInt(func(c *Config) *int { return &c.Database.Port })},
+	{"APP_DATABASE_USER", setString(func(c *Config) *string { return &c.Database.User })},
+	{"APP_DATABASE_PASSWORD", setString(func(c *Config) *string { return &c.Database.Password })},
+	{"APP_DATABASE_NAME", setString(func(c *Config) *string { return &c.Database.DBName })},
+	{"APP_DATABASE_SSLMODE", setString(func(c *Config) *string { return &c.Database.SSLMode })},
+	{"APP_DATABASE_TIMEZONE", setString(func(c *Config) *string { return &c.Database.TimeZone })},
+	{"APP_DATABASE_MIGRATE_ON_START", setBool(func(c *Config) *bool { return &c.Database.MigrateOnStart })},
+	{"APP_AUTH_JWT_SECRET", setString(func(c *Config) *string { return &c.Auth.JWTSecret })},
+	{"APP_AUTH_TOKEN_TTL", setDuration(func(c *Config) *time.Duration { return &c.Auth.TokenTTL })},
+	{"APP_AUTH_REFRESH_TOKEN_TTL", setDuration(func(c *Config) *time.Duration { return &c.Auth.RefreshTokenTTL })},
+	{"APP_AUTH_EMAIL_VERIFY_TTL", setDuration(func(c *Config) *time.Duration { return &c.Auth.EmailVerifyTTL })},
+	{"APP_AUTH_PASSWORD_RESET_TTL", setDuration(func(c *Config) *time.Duration { return &c.Auth.PasswordResetTTL })},
+	{"APP_AUTH_TWO_FACTOR_KEY", setString(func(c *Config) *string { return &c.Auth.TwoFactorKey })},
+	{"APP_AUTH_PREVIOUS_TWO_FACTOR_KEY", setString(func(c *Config) *string { return &c.Auth.PreviousTwoFactorKey })},
+	{"APP_AUTH_STEP_UP_TTL", setDuration(func(c *Config) *time.Duration { return &c.Auth.StepUpTTL })},
+	{"APP_AUTH_STEP_UP_TRANSFER_THRESHOLD", setInt(func(c *Config) *int { return &c.Auth.StepUpTransferThreshold })},
+	{"APP_GATEWAY_EVALUATE_TIMEOUT", setDuration(func(c *Config) *time.Duration { return &c.Gateway.EvaluateTimeout })},
+	{"APP_GATEWAY_ENDORSE_TIMEOUT", setDuration(func(c *Config) *time.Duration { return &c.Gateway.EndorseTimeout })},
+	{"APP_GATEWAY_SUBMIT_TIMEOUT", setDuration(func(c *Config) *time.Duration { return &c.Gateway.SubmitTimeout })},
+	{"APP_GATEWAY_COMMIT_STATUS_TIMEOUT", setDuration(func(c *Config) *time.Duration { return &c.Gateway.CommitStatusTimeout })},
+	{"APP_STORAGE_PUBLIC_DIR", setString(func(c *Config) *string { return &c.Storage.PublicDir })},
+	{"APP_STORAGE_IMAGE_DIR", setString(func(c *Config) *string { return &c.Storage.ImageDir })},
+	{"APP_STORAGE_BLOCK_DIR", setString(func(c *Config) *string { return &c.Storage.BlockDir })},
+	{"APP_STORAGE_LOG_DIR", setString(func(c *Config) *string { return &c.Storage.LogDir })},
+	{"APP_SCHEDULER_ENABLED", setBool(func(c *Config) *bool { return &c.Scheduler.Enabled })},
+	{"APP_SCHEDULER_RECONCILE_AUTO_REPAIR", setBool(func(c *Config) *bool { return &c.Scheduler.ReconcileAutoRepair })},
+	{"APP_PROJECTION_ENABLED", setBool(func(c *Config) *bool { return &c.Projection.Enabled })},
+	{"APP_PROJECTION_MAX_LAG", setInt(func(c *Config) *int { return &c.Projection.MaxLag })},
+	{"APP_PROJECTION_FALLBACK_TO_CHAIN", setBool(func(c *Config) *bool { return &c.Projection.FallbackToChain })},
+	{"APP_MAIL_SENDER", setString(func(c *Config) *string { return &c.Mail.Sender })},
+	{"APP_MAIL_FROM", setString(func(c *Config) *string { return &c.Mail.From })},
+	{"APP_MAIL_HOST", setString(func(c *Config) *string { return &c.Mail.Host })},
+	{"APP_MAIL_PORT", setInt(func(c *Config) *int { return &c.Mail.Port })},
+	{"APP_MAIL_USERNAME", setString(func(c *Config) *string { return &c.Mail.Username })},
+	{"APP_MAIL_PASSWORD", setString(func(c *Config) *string { return &c.Mail.Password })},
+	{"APP_MAIL_DIR", setString(func(c *Config) *string { return &c.Mail.Dir })},
+	{"APP_MAIL_LINK_BASE_URL", setString(func(c *Config) *string { return &c.Mail.LinkBaseURL })},
+	{"APP_FABRIC_CHANNEL_NAME", setString(func(c *Config) *string { return &c.Fabric.ChannelName })},
+	{"APP_FABRIC_CHAINCODE_NAME", setString(func(c *Config) *string { return &c.Fabric.ChaincodeName })},
+	{"APP_FABRIC_WALLET_KEY", setString(func(c *Config) *string { return &c.Fabric.WalletKey })},
+	{"APP_FABRIC_PREVIOUS_WALLET_KEY", setString(func(c *Config) *string { return &c.Fabric.PreviousWalletKey })},
+	{"APP_FABRIC_ORG1_CA_REGISTRAR_SECRET", setCASecret("org1")},
+	{"APP_FABRIC_ORG2_CA_REGISTRAR_SECRET", setCASecret("org2")},
+	{"APP_FABRIC_ORG3_CA_REGISTRAR_SECRET", setCASecret("org3")},
+}
+
+// setCASecret 组织配置保存在 map 中，需要取出修改后写回
+func setCASecret(orgName string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		org, ok := cfg.Fabric.Organizations[orgName]
+		if !ok {
+			return fmt.Errorf("对应的组织 %s 未配置", orgName)
+		}
+		org.CA.RegistrarSecret = value
+		cfg.Fabric.Organizations[orgName] = org
+		return nil
+	}
+}
+
+// applyEnvOverrides 用环境变量覆盖配置文件中的值
+// 每个环境变量都可以换成 <名称>_FILE，值从该文件读取（例如 Docker/Kubernetes 挂载的密钥文件），末尾的换行会被去掉
+func applyEnvOverrides(cfg *Config) error {
+	for _, o := range envOverrides {
+		value, ok := os.LookupEnv(o.name)
+		if file, fromFile := os.LookupEnv(o.name + "_FILE"); fromFile {
+			if ok {
+				return fmt.Errorf("环境变量 %s 和 %s_FILE 不能同时设置", o.name, o.name)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s_FILE 读取文件失败：%v", o.name, err)
+			}
+			value, ok = strings.TrimRight(string(data), "\r\n"), true
+		}
+		if !ok {
+			continue
+		}
+		if err := o.set(cfg, value); err != nil {
+			return fmt.Errorf("环境变量 %s %v", o.name, err)
+		}
+	}
+	return nil
+}
+
+// Validate 校验配置，一次性返回所有问题
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("  - "+format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port 必须在 1-65535 之间，当前为 %d", c.Server.Port)
+	check(c.Server.Mode == ModeRelease || c.Server.Mode == ModeDev,
+		"server.mode 只能是 %s 或 %s，当前为 %q", ModeRelease, ModeDev, c.Server.Mode)
+	dev := c.Server.Mode == ModeDev
+	// 非 dev 模式下不能使用仓库中公开过的密钥
+	notLeaked := func(value, name, env string) {
+		check(dev || !leakedSecrets[value], "%s 是仓库中公开过的默认值，请通过 %s 重新设置", name, env)
+	}
+
+	switch c.Database.Driver {
+	case DriverPostgres:
+		check(c.Database.Host != "", "database.host 不能为空")
+		check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port 必须在 1-65535 之间，当前为 %d", c.Database.Port)
+		check(c.Database.User != "", "database.user 不能为空")
+		check(c.Database.DBName != "", "database.dbName 不能为空")
+		check(dev || c.Database.Password != "", "database.password 不能为空（可通过 APP_DATABASE_PASSWORD 设置）")
+		notLeaked(c.Database.Password, "database.password", "APP_DATABASE_PASSWORD")
+	case DriverSQLite:
+		check(c.Database.Path != "", "database.path 不能为空")
+	default:
+		check(false, "database.driver 只能是 %s 或 %s，当前为 %q", DriverPostgres, DriverSQLite, c.Database.Driver)
+	}
+
+	check(c.Auth.JWTSecret != "", "auth.jwtSecret 不能为空（可通过 APP_AUTH_JWT_SECRET 设置）")
+	check(c.Auth.JWTSecret == "" || len(c.Auth.JWTSecret) >= 32, "auth.jwtSecret 长度至少 32 个字符")
+	notLeaked(c.Auth.JWTSecret, "auth.jwtSecret", "APP_AUTH_JWT_SECRET")
+	check(c.Auth.TokenTTL > 0, "auth.tokenTTL 必须大于 0")
+	check(c.Auth.RefreshTokenTTL > c.Auth.TokenTTL, "auth.refreshTokenTTL 必须大于 tokenTTL")
+	check(c.Auth.EmailVerifyTTL > 0, "auth.emailVerifyTTL 必须大于 0")
+	check(c.Auth.PasswordResetTTL > 0, "auth.passwordResetTTL 必须大于 0")
+	twoFactorKey, err := base64.StdEncoding.DecodeString(c.Auth.TwoFactorKey)
+	check(err == nil && len(twoFactorKey) == 32, "auth.twoFactorKey 必须是 base64 编码的 32 字节密钥（可通过 APP_AUTH_TWO_FACTOR_KEY 设置）")
+	notLeaked(c.Auth.TwoFactorKey, "auth.twoFactorKey", "APP_AUTH_TWO_FACTOR_KEY")
+	if c.Auth.PreviousTwoFactorKey != "" {
+		previous, err := base64.StdEncoding.DecodeString(c.Auth.PreviousTwoFactorKey)
+		check(err == nil && len(previous) == 32, "auth.previousTwoFactorKey 必须是 base64 编码的 32 字节密钥")
+		check(c.Auth.PreviousTwoFactorKey != c.Auth.TwoFactorKey, "auth.previousTwoFactorKey 不能与 twoFactorKey 相同")
+	}
+	check(c.Auth.TwoFactorIssuer != "", "auth.twoFactorIssuer 不能为空")
+	check(c.Auth.StepUpTTL > 0, "auth.stepUpTTL 必须大于 0")
+	check(c.Auth.StepUpTransferThreshold >= 0, "auth.stepUpTransferThreshold 不能小于 0")
+
+	check(c.Gateway.EvaluateTimeout > 0, "gateway.evaluateTimeout 必须大于 0")
+	check(c.Gateway.EndorseTimeout > 0, "gateway.endorseTimeout 必须大于 0")
+	check(c.Gateway.SubmitTimeout > 0, "gateway.submitTimeout 必须大于 0")
+	check(c.Gateway.CommitStatusTimeout > 0, "gateway.commitStatusTimeout 必须大于 0")
+
+	check(c.Storage.PublicDir != "", "storage.publicDir 不能为空")
+	check(c.Storage.ImageDir != "", "storage.imageDir 不能为空")
+	check(c.Storage.BlockDir != "", "storage.blockDir 不能为空")
+	check(c.Storage.LogDir != "", "storage.logDir 不能为空")
+
+	if c.Scheduler.Enabled {
+		check(c.Scheduler.TickInterval > 0, "scheduler.tickInterval 必须大于 0")
+		check(c.Scheduler.CloseExpiredInterval > 0, "scheduler.closeExpiredInterval 必须大于 0")
+		check(c.Scheduler.FinishAuctionInterval > 0, "scheduler.finishAuctionInterval 必须大于 0")
+		check(c.Scheduler.WorkflowInterval > 0, "scheduler.workflowInterval 必须大于 0")
+		check(c.Scheduler.ReconcileInterval > 0, "scheduler.reconcileInterval 必须大于 0")
+		check(c.Scheduler.TokenCleanupInterval > 0, "scheduler.tokenCleanupInterval 必须大于 0")
+		check(c.Scheduler.RetryBackoff > 0, "scheduler.retryBackoff 必须大于 0")
+		check(c.Scheduler.MaxBackoff >= c.Scheduler.RetryBackoff, "scheduler.maxBackoff 不能小于 retryBackoff")
+	}
+
+	check(c.Projection.MaxLag >= 0, "projection.maxLag 不能小于 0")
+
+	switch c.Mail.Sender {
+	case MailSenderSMTP:
+		check(c.Mail.Host != "", "mail.host 不能为空")
+		check(c.Mail.Port > 0 && c.Mail.Port <= 65535, "mail.port 必须在 1-65535 之间，当前为 %d", c.Mail.Port)
+	case MailSenderFile:
+		check(c.Mail.Dir != "", "mail.dir 不能为空")
+	case MailSenderConsole:
+	default:
+		check(false, "mail.sender 只能是 %s、%s 或 %s，当前为 %q", MailSenderSMTP, MailSenderFile, MailSenderConsole, c.Mail.Sender)
+	}
+	check(c.Mail.From != "", "mail.from 不能为空")
+	check(c.Mail.LinkBaseURL != "", "mail.linkBaseURL 不能为空")
+
+	check(c.Fabric.ChannelName != "", "fabric.channelName 不能为空")
+	check(c.Fabric.ChaincodeName != "", "fabric.chaincodeName 不能为空")
+	// 业务代码按 org1/org2/org3 取合约，三个组织都必须配置
+	// 交易以用户或服务身份提交，这两种身份都由 CA 登记，所以每个组织都必须配置 CA
+	for _, orgName := range []string{"org1", "org2", "org3"} {
+		org, ok := c.Fabric.Organizations[orgName]
+		if !ok {
+			check(false, "fabric.organizations 缺少 %s", orgName)
+			continue
+		}
+		check(org.MSPID != "", "fabric.organizations.%s.mspID 不能为空", orgName)
+		check(org.CertPath != "", "fabric.organizations.%s.certPath 不能为空", orgName)
+		check(org.KeyPath != "", "fabric.organizations.%s.keyPath 不能为空", orgName)
+		check(org.TLSCertPath != "", "fabric.organizations.%s.tlsCertPath 不能为空", orgName)
+		check(org.PeerEndpoint != "", "fabric.organizations.%s.peerEndpoint 不能为空", orgName)
+		check(org.GatewayPeer != "", "fabric.organizations.%s.gatewayPeer 不能为空", orgName)
+		check(org.CA.URL != "", "fabric.organizations.%s.ca.url 不能为空", orgName)
+		check(org.CA.RegistrarID != "", "fabric.organizations.%s.ca.registrarID 不能为空", orgName)
+		env := fmt.Sprintf("APP_FABRIC_%s_CA_REGISTRAR_SECRET", strings.ToUpper(orgName))
+		check(org.CA.RegistrarSecret != "", "fabric.organizations.%s.ca.registrarSecret 不能为空（可通过 %s 设置）", orgName, env)
+		notLeaked(org.CA.RegistrarSecret, fmt.Sprintf("fabric.organizations.%s.ca.registrarSecret", orgName), env)
+	}
+	// 用户和服务身份的私钥、创作者的凭证签名私钥都用 walletKey 加密
+	walletKey, err := base64.StdEncoding.DecodeString(c.Fabric.WalletKey)
+	check(err == nil && len(walletKey) == 32, "fabric.walletKey 必须是 base64 编码的 32 字节密钥（可通过 APP_FABRIC_WALLET_KEY 设置）")
+	notLeaked(c.Fabric.WalletKey, "fabric.walletKey", "APP_FABRIC_WALLET_KEY")
+	if c.Fabric.PreviousWalletKey != "" {
+		previous, err := base64.StdEncoding.DecodeString(c.Fabric.PreviousWalletKey)
+		check(err == nil && len(previous) == 32, "fabric.previousWalletKey 必须是 base64 编码的 32 字节密钥")
+		check(c.Fabric.PreviousWalletKey != c.Fabric.WalletKey, "fabric.previousWalletKey 不能与 walletKey 相同")
+	}
+
+	return errors.Join(errs...)
+}
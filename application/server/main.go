@@ -4,20 +4,78 @@ import (
 	"application/api"
 	"application/config"
 	"application/middleware"
+	"application/migrate"
 	"application/model"
 	"application/pkg/fabric"
+	"application/scheduler"
+	"application/service"
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// 配置文件路径，也可以用环境变量 APP_CONFIG 指定
+	configPath := flag.String("config", "", "配置文件路径（默认 "+config.DefaultConfigPath+"）")
+	rebuildProjection := flag.Bool("rebuild-projection", false, "清空链上数据读模型并重置检查点后退出，服务运行时会从区块 0 重新同步")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "用法：%s [参数]\n      %s [参数] migrate up [版本] | down [数量] | status\n      %s [参数] rotate-keys\n",
+			os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	// 初始化配置
-	if err := config.InitConfig(); err != nil {
+	if err := config.InitConfig(*configPath); err != nil {
 		log.Fatalf("初始化配置失败：%v", err)
 	}
 
+	// 结构迁移只需要数据库
+	if flag.Arg(0) == "migrate" {
+		if err := model.InitDB(); err != nil {
+			log.Fatalf("初始化数据库失败：%v", err)
+		}
+		if err := runMigrate(flag.Args()[1:]); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
+	// 更换密钥后重新加密数据库中的密文，只需要数据库
+	if flag.Arg(0) == "rotate-keys" {
+		if err := model.InitDB(); err != nil {
+			log.Fatalf("初始化数据库失败：%v", err)
+		}
+		if err := prepareSchema(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		n, err := service.NewKeyRotationService().Rotate()
+		if err != nil {
+			log.Fatalf("重新加密失败（已完成 %d 条，可以重新执行）：%v", n, err)
+		}
+		log.Printf("重新加密了 %d 条记录，可以删除旧密钥的配置", n)
+		return
+	}
+
+	// 重建读模型只需要数据库
+	if *rebuildProjection {
+		if err := model.InitDB(); err != nil {
+			log.Fatalf("初始化数据库失败：%v", err)
+		}
+		if err := prepareSchema(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := service.NewProjectionService().Rebuild(); err != nil {
+			log.Fatalf("重建读模型失败：%v", err)
+		}
+		return
+	}
+
 	// 初始化日志系统
 	if err := middleware.InitLogger(); err != nil {
 		log.Fatalf("初始化日志系统失败：%v", err)
@@ -33,131 +91,41 @@ func main() {
 	if err := model.InitDB(); err != nil {
 		log.Fatalf("初始化数据库失败：%v", err)
 	}
-
-	// 创建 Gin 路由
-	//gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
-
-	// 添加日志中间件
-	r.Use(middleware.ZapLogger())
-
-	// 添加CORS中间件
-	r.Use(middleware.CORSMiddleware())
-
-	// 添加静态文件服务
-	r.Static("/public", "./public")
-
-	apiGroup := r.Group("/api")
-
-	// 注册路由
-	accountHandler := api.NewAccountHandler()
-	walletHandler := api.NewWalletHandler()
-	assetHandler := api.NewAssetHandler()
-	chatHandler, err := api.NewChatHandler()
-	marketHandler := api.NewMarketHandler()
-	auctionHandler := api.NewAuctionHandler()
-
-	if err != nil {
-		log.Fatalf("创建聊天处理程序失败：%v", err)
+	if err := prepareSchema(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	// 用户的链上身份保存在数据库中，需要在数据库初始化之后创建
+	ledger := fabric.NewLedgerClient(service.NewIdentityService())
+
+	// 同步链上数据读模型
+	if config.GlobalConfig.Projection.Enabled {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go service.NewProjectionService().Run(ctx)
+	}
+
+	// 启动后台调度器（过期挂牌关闭、拍卖到期结算、未完成结算流程和凭证恢复、对账、过期令牌清理）
+	if cfg := config.GlobalConfig.Scheduler; cfg.Enabled {
+		sched := scheduler.New(model.GetDB(), cfg)
+		sched.Register("closeExpiredListings", cfg.CloseExpiredInterval, service.NewMarketService(ledger).CloseExpired)
+		sched.Register("finishExpiredLots", cfg.FinishAuctionInterval, service.NewAuctionService(model.GetDB(), ledger).FinishExpiredLots)
+		sched.Register("resumeWorkflows", cfg.WorkflowInterval, service.NewWorkflowService(ledger).ResumePending)
+		sched.Register("resolvePendingVouchers", cfg.WorkflowInterval, service.NewVoucherService(ledger).ResolvePending)
+		sched.Register("reconcile", cfg.ReconcileInterval, service.NewReconcileService(ledger).RunScheduled(cfg.ReconcileAutoRepair))
+		sched.Register("cleanupTokens", cfg.TokenCleanupInterval, service.NewSessionService().CleanupExpired)
+		emailService, err := service.NewEmailService()
+		if err != nil {
+			log.Fatalf("初始化邮件服务失败：%v", err)
+		}
+		sched.Register("cleanupResetTokens", cfg.TokenCleanupInterval, emailService.CleanupExpired)
+		sched.Start()
+		defer sched.Stop()
 	}
 
-	// 创建JWT中间件
-	jwtMiddleware, err := middleware.NewJWTMiddleware()
+	// 创建 Gin 路由
+	r, err := api.NewRouter(ledger)
 	if err != nil {
-		log.Fatalf("创建JWT中间件失败：%v", err)
-	}
-
-	// 账号相关接口（无需认证）
-	account := apiGroup.Group("/account")
-	{
-		// 用户注册
-		account.POST("/register", accountHandler.Register)
-		// 用户登录
-		account.POST("/login", accountHandler.Login)
-		// 用户登出
-		account.POST("/logout", accountHandler.Logout)
-	}
-
-	// 需要认证的账号接口
-	authAccount := apiGroup.Group("/account").Use(jwtMiddleware.Auth())
-	{
-		// 获取用户信息
-		authAccount.GET("/profile", accountHandler.GetProfile)
-		// 更新用户信息
-		authAccount.PUT("/profile", accountHandler.UpdateProfile)
-		// 获取头像
-		authAccount.GET("/avatar", accountHandler.GetAvatar)
-		// 更新头像
-		authAccount.PUT("/avatar", accountHandler.UpdateAvatar)
-		// 更新组织接口
-		authAccount.PUT("/org", accountHandler.UpdateOrg)
-		// 获取用户名
-		authAccount.GET("/userName", accountHandler.GetUserNameById)
-	}
-
-	// 钱包相关接口
-	wallet := apiGroup.Group("/wallet").Use(jwtMiddleware.Auth())
-	{
-		wallet.POST("/create", walletHandler.CreateAccount)
-		wallet.GET("/balance", walletHandler.GetBalance)
-		wallet.POST("/transfer", walletHandler.Transfer)
-		wallet.POST("/mintToken", walletHandler.MintToken)
-		wallet.GET("/transferBySenderID", walletHandler.GetTransferBySenderID)
-		wallet.GET("/transferByRecipientID", walletHandler.GetTransferByRecipientID)
-		wallet.POST("/withHoldAccount", walletHandler.WithHoldAccount)
-		wallet.GET("/getWithHoldingByAccountID", walletHandler.GetWithHoldingByAccountID)
-		wallet.GET("/getWithHoldingByListingID", walletHandler.GetWithHoldingByListingID)
-		wallet.POST("/clearWithHolding", walletHandler.ClearWithHolding)
-	}
-
-	// 资产相关接口
-	asset := apiGroup.Group("/asset").Use(jwtMiddleware.Auth())
-	{
-		asset.POST("/create", assetHandler.CreateAsset)
-		asset.GET("/getAssetByID", assetHandler.GetAssetByID)
-		asset.GET("/getAssetByAuthorID", assetHandler.GetAssetByAuthorID)
-		asset.GET("/getAssetByOwnerID", assetHandler.GetAssetByOwnerID)
-		asset.POST("/transfer", assetHandler.TransferAsset)
-		asset.GET("/getStatus", assetHandler.GetAssetStatus)
-	}
-
-	// 聊天相关接口（无需认证），主要是因为websocket
-	chat := apiGroup.Group("/chat")
-	{
-		chat.GET("/ws", chatHandler.SendMessage)
-	}
-
-	// 需要认证的聊天接口
-	authChat := apiGroup.Group("/chat").Use(jwtMiddleware.Auth())
-	{
-		authChat.GET("/getChatSession", chatHandler.GetChatSession)
-		authChat.GET("/getMessages", chatHandler.GetMessages)
-		authChat.POST("/readMessages", chatHandler.ReadMessages)
-		authChat.GET("/getUnreadMessageCount", chatHandler.GetUnreadMessageCount)
-	}
-
-	// 市场（需要 JWT）
-	market := apiGroup.Group("/market", jwtMiddleware.Auth())
-	{
-		market.GET("/listings", marketHandler.ListListings)
-		market.POST("/listing", marketHandler.CreateListing)
-		market.POST("/offer", marketHandler.CreateOffer)
-		market.POST("/offer/:id/accept", marketHandler.AcceptOffer)
-		market.POST("/offer/:id/cancel", marketHandler.CancelOffer)
-		market.GET("/offers/mine", marketHandler.ListMyOffers)
-		market.POST("/buyNow", marketHandler.BuyNow)
-	}
-
-	// 拍卖相关接口
-	auction := apiGroup.Group("/auction", jwtMiddleware.Auth())
-	{
-		auction.POST("/create", auctionHandler.CreateLot)
-		auction.GET("/list", auctionHandler.GetAllLots)
-		auction.GET("/seller", auctionHandler.GetLotBySellerID)
-		auction.POST("/bid", auctionHandler.SubmitBid)
-		auction.GET("/bid", auctionHandler.GetBidPrice)
-		auction.GET("/result", auctionHandler.GetAuctionResult)
-		auction.POST("/finish", auctionHandler.FinishAuction)
+		log.Fatalf("创建路由失败：%v", err)
 	}
 
 	// 打印路由信息
@@ -182,3 +150,82 @@ func printRoutes(r *gin.Engine) {
 
 	log.Println("=====================")
 }
+
+// prepareSchema 确认表结构是最新版本：开启 migrateOnStart 时执行未执行的迁移，否则有未执行的迁移时报错
+func prepareSchema() error {
+	db := model.GetDB()
+	if config.GlobalConfig.Database.MigrateOnStart {
+		if _, err := migrate.Up(db, 0); err != nil {
+			return fmt.Errorf("数据库迁移失败：%v", err)
+		}
+		return nil
+	}
+	pending, err := migrate.Pending(db)
+	if err != nil {
+		return fmt.Errorf("检查数据库迁移失败：%v", err)
+	}
+	if pending > 0 {
+		return fmt.Errorf("有 %d 个未执行的数据库迁移，请先运行 migrate up", pending)
+	}
+	return nil
+}
+
+// runMigrate 执行 migrate 子命令
+// up [版本]：执行到指定版本，省略时执行到最新版本
+// down [数量]：回滚最近执行的若干个迁移，省略时回滚一个
+// status：列出全部迁移及执行时间
+func runMigrate(args []string) error {
+	db := model.GetDB()
+	if len(args) == 0 {
+		flag.Usage()
+		return fmt.Errorf("缺少 migrate 子命令")
+	}
+	arg := func(def int) (int, error) {
+		if len(args) < 2 {
+			return def, nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("参数必须是正整数：%s", args[1])
+		}
+		return n, nil
+	}
+	switch args[0] {
+	case "up":
+		target, err := arg(0)
+		if err != nil {
+			return err
+		}
+		n, err := migrate.Up(db, target)
+		if err != nil {
+			return err
+		}
+		log.Printf("执行了 %d 个迁移", n)
+	case "down":
+		steps, err := arg(1)
+		if err != nil {
+			return err
+		}
+		n, err := migrate.Down(db, steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("回滚了 %d 个迁移", n)
+	case "status":
+		list, err := migrate.List(db)
+		if err != nil {
+			return err
+		}
+		for _, s := range list {
+			applied := "未执行"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-30s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		flag.Usage()
+		return fmt.Errorf("未知的 migrate 子命令：%s", args[0])
+	}
+	return nil
+}
@@ -1,19 +1,25 @@
 package middleware
 
 import (
+	"application/config"
 	"application/model"
+	"application/service"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
 	"gorm.io/gorm"
 )
 
 // JWT中间件
 type JWTMiddleware struct {
-	db *gorm.DB
+	db          *gorm.DB
+	sessions    *service.SessionService
+	permissions *service.PermissionService
+	twoFactor   *service.TwoFactorService
 }
 
 // 创建JWT中间件实例
@@ -22,7 +28,12 @@ func NewJWTMiddleware() (*JWTMiddleware, error) {
 	if db == nil {
 		return nil, fmt.Errorf("数据库未初始化")
 	}
-	return &JWTMiddleware{db: db}, nil
+	return &JWTMiddleware{
+		db:          db,
+		sessions:    service.NewSessionService(),
+		permissions: service.NewPermissionService(),
+		twoFactor:   service.NewTwoFactorService(),
+	}, nil
 }
 
 // JWT认证中间件
@@ -50,31 +61,61 @@ func (m *JWTMiddleware) Auth() gin.HandlerFunc {
 			return
 		}
 
-		// 验证令牌
-		claims, err := m.validateToken(token)
-		if err != nil {
+		m.authenticate(c, token)
+	}
+}
+
+// WebSocket 握手认证
+// 浏览器的 WebSocket 无法设置请求头，令牌通过子协议传递：new WebSocket(url, ["bearer", token])
+// 不使用查询参数，避免令牌出现在访问日志中
+func (m *JWTMiddleware) WebSocketAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var token string
+		protocols := websocket.Subprotocols(c.Request)
+		for i := 0; i+1 < len(protocols); i++ {
+			if protocols[i] == model.WebSocketAuthProtocol {
+				token = protocols[i+1]
+				break
+			}
+		}
+		if token == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"code":    http.StatusUnauthorized,
-				"message": "认证失败：" + err.Error(),
+				"message": "缺少认证令牌",
 			})
 			c.Abort()
 			return
 		}
 
-		// 将用户信息存储到上下文中
-		c.Set("userID", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("org", claims.Org)
+		m.authenticate(c, token)
+	}
+}
 
-		c.Next()
+// 验证令牌并将用户信息存储到上下文中
+func (m *JWTMiddleware) authenticate(c *gin.Context, token string) {
+	claims, err := m.validateToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    http.StatusUnauthorized,
+			"message": "认证失败：" + err.Error(),
+		})
+		c.Abort()
+		return
 	}
+
+	c.Set("userID", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("org", claims.Org)
+	c.Set("sessionID", claims.SessionID)
+
+	c.Next()
 }
 
 // 验证JWT令牌
 func (m *JWTMiddleware) validateToken(tokenString string) (*model.Claims, error) {
 	// 解析JWT令牌
 	token, err := jwt.ParseWithClaims(tokenString, &model.Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(model.JWT_SECRET), nil
+		return []byte(config.GlobalConfig.Auth.JWTSecret), nil
 	})
 
 	if err != nil {
@@ -90,24 +131,17 @@ func (m *JWTMiddleware) validateToken(tokenString string) (*model.Claims, error)
 		return nil, fmt.Errorf("无效的JWT声明")
 	}
 
-	// 检查令牌是否在数据库中
-	isInDatabase, err := m.isTokenInDatabase(tokenString)
+	// 检查令牌所属的会话是否仍然有效
+	if claims.SessionID == "" {
+		return nil, fmt.Errorf("令牌缺少会话信息，请重新登录")
+	}
+	active, err := m.sessions.IsActive(claims.SessionID, claims.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("检查令牌数据库失败：%v", err)
+		return nil, fmt.Errorf("检查会话失败：%v", err)
 	}
-	if !isInDatabase {
-		return nil, fmt.Errorf("令牌不在数据库中")
+	if !active {
+		return nil, fmt.Errorf("会话已注销或过期")
 	}
 
 	return claims, nil
 }
-
-// 检查令牌是否在数据库中
-func (m *JWTMiddleware) isTokenInDatabase(token string) (bool, error) {
-	var count int64
-	err := m.db.Model(&model.Token{}).Where("token = ?", token).Count(&count).Error
-	if err != nil {
-		return false, err
-	}
-	return count > 0, nil
-}
@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	appconfig "application/config"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -33,17 +35,18 @@ func InitLogger() error {
 	config.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
 
 	// 创建日志目录
-	if err := os.MkdirAll("logs", 0755); err != nil {
+	logDir := appconfig.GlobalConfig.Storage.LogDir
+	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("创建日志目录失败: %v", err)
 	}
 
 	// 设置日志文件
 	config.OutputPaths = []string{
-		"logs/app.log",
+		filepath.Join(logDir, "app.log"),
 		"stdout",
 	}
 	config.ErrorOutputPaths = []string{
-		"logs/error.log",
+		filepath.Join(logDir, "error.log"),
 		"stderr",
 	}
 
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"application/model"
+	"application/service"
+	"application/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 权限检查中间件，必须放在 Auth 之后
+// 权限由组织和用户角色决定，见 model.OrgPermissions 和 model.RolePermissions
+func (m *JWTMiddleware) RequirePermission(perm model.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			utils.ServerError(c, "用户信息获取失败")
+			c.Abort()
+			return
+		}
+		org, exists := c.Get("org")
+		if !exists {
+			utils.ServerError(c, "组织信息获取失败")
+			c.Abort()
+			return
+		}
+		ok, err := m.permissions.Has(userID.(int), org.(int), perm)
+		if err != nil {
+			utils.ServerError(c, "检查权限失败："+err.Error())
+			c.Abort()
+			return
+		}
+		if !ok {
+			utils.Forbidden(c, "没有权限执行该操作，需要 "+string(perm)+" 权限")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 邮箱验证检查中间件，必须放在 Auth 之后，未验证邮箱的用户不能交易
+// 每次请求都查询数据库，验证后立即生效，不需要重新登录
+func (m *JWTMiddleware) RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			utils.ServerError(c, "用户信息获取失败")
+			c.Abort()
+			return
+		}
+		var user model.User
+		if err := m.db.Select("id", "email_verified_at").First(&user, userID.(int)).Error; err != nil {
+			utils.ServerError(c, "查询用户失败："+err.Error())
+			c.Abort()
+			return
+		}
+		if user.EmailVerifiedAt == nil {
+			utils.Forbidden(c, "请先验证邮箱后再进行交易")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 两步验证检查中间件，必须放在 Auth 之后
+// 当前会话在 auth.stepUpTTL 内通过过两步验证才放行，否则返回 428，客户端提交验证码到 /account/2fa/stepUp 后重试
+func (m *JWTMiddleware) RequireStepUp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			utils.ServerError(c, "用户信息获取失败")
+			c.Abort()
+			return
+		}
+		if err := m.twoFactor.CheckStepUp(userID.(int), c.GetString("sessionID")); err != nil {
+			StepUpFailed(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// StepUpFailed 二次验证没有通过时的响应，按金额等请求内容决定是否需要二次验证的处理函数也使用它
+func StepUpFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrStepUpRequired):
+		utils.Fail(c, http.StatusPreconditionRequired, err.Error())
+	case errors.Is(err, service.ErrTwoFactorNotEnabled):
+		utils.Forbidden(c, err.Error())
+	default:
+		utils.ServerError(c, "检查两步验证失败："+err.Error())
+	}
+}
@@ -0,0 +1,209 @@
+// Package migrate 数据库结构的版本化迁移
+// 每个迁移有递增的版本号和成对的 Up/Down，已执行的版本记录在 schema_migrations 表中
+// 已发布的迁移不能再修改，结构变化一律追加新的迁移
+package migrate
+
+import (
+	"application/model"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一次结构变更
+// Up/Down 在同一个事务中与 schema_migrations 的记录一起提交，失败时整体回滚
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// migrations 全部迁移，按版本号升序排列，新迁移追加到末尾
+var migrations = []Migration{
+	v1Baseline,
+	v2Sessions,
+	v3UserRoles,
+	v4FabricIdentities,
+	v5OrgApplications,
+	v6EmailVerification,
+	v7TwoFactorAuth,
+	v8VoucherSettlement,
+	v9AuctionEscrow,
+	v10ServiceIdentities,
+	v11LotSettling,
+	v12WorkflowLeaseOwner,
+}
+
+// lockKey 迁移互斥锁的键，多个实例同时启动时只有一个执行迁移；需要与配置项 scheduler.lockKey 不同
+const lockKey int64 = 20240802
+
+// schemaMigration 已执行的迁移
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(100);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// Status 单个迁移的执行状态
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // 为空表示未执行
+}
+
+// Latest 当前程序包含的最新版本
+func Latest() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Up 依次执行未执行的迁移直到 target 版本（含），target 为 0 时执行到最新版本，返回执行的迁移数
+func Up(db *gorm.DB, target int) (int, error) {
+	if target == 0 {
+		target = Latest()
+	}
+	count := 0
+	err := withLock(db, func() error {
+		applied, err := appliedVersions(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := model.GetDialect().Migrate(db, func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("执行迁移 %d_%s 失败：%v", m.Version, m.Name, err)
+			}
+			log.Printf("已执行迁移 %d_%s", m.Version, m.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down 从最新的已执行迁移开始回滚 steps 个，返回回滚的迁移数
+func Down(db *gorm.DB, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, fmt.Errorf("回滚的迁移数必须大于 0")
+	}
+	count := 0
+	err := withLock(db, func() error {
+		applied, err := appliedVersions(db)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			err := model.GetDialect().Migrate(db, func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, "version = ?", m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("回滚迁移 %d_%s 失败：%v", m.Version, m.Name, err)
+			}
+			log.Printf("已回滚迁移 %d_%s", m.Version, m.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// List 全部迁移及其执行状态，按版本号升序
+func List(db *gorm.DB) ([]Status, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if r, ok := applied[m.Version]; ok {
+			s.AppliedAt = &r.AppliedAt
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// Pending 未执行的迁移数
+func Pending(db *gorm.DB) (int, error) {
+	list, err := List(db)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, s := range list {
+		if s.AppliedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// appliedVersions 读取已执行的迁移，数据库中有程序不认识的版本时报错，防止旧版本程序运行在新结构上
+func appliedVersions(db *gorm.DB) (map[int]schemaMigration, error) {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, fmt.Errorf("创建 schema_migrations 表失败：%v", err)
+	}
+	var records []schemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询已执行的迁移失败：%v", err)
+	}
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	applied := make(map[int]schemaMigration, len(records))
+	for _, r := range records {
+		if !known[r.Version] {
+			return nil, fmt.Errorf("数据库已执行迁移 %d_%s，当前程序不包含该版本，请升级程序", r.Version, r.Name)
+		}
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// withLock 持有迁移互斥锁执行 fn，其他实例正在迁移时直接返回错误
+func withLock(db *gorm.DB, fn func() error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接池失败：%v", err)
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败：%v", err)
+	}
+	defer conn.Close()
+	locked, err := model.GetDialect().TryLock(ctx, conn, lockKey)
+	if err != nil {
+		return fmt.Errorf("获取迁移锁失败：%v", err)
+	}
+	if !locked {
+		return fmt.Errorf("其他实例正在执行迁移，请稍后重试")
+	}
+	defer model.GetDialect().Unlock(ctx, conn, lockKey)
+	return fn()
+}
@@ -0,0 +1,161 @@
+package migrate_test
+
+import (
+	"application/config"
+	"application/migrate"
+	"application/model"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	config.GlobalConfig = config.Config{
+		Database: config.DatabaseConfig{Driver: config.DriverSQLite, Path: filepath.Join(t.TempDir(), "test.db")},
+	}
+	if err := model.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+	db := model.GetDB()
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("获取数据库连接失败：%v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	db.Logger = logger.Default.LogMode(logger.Silent)
+	return db
+}
+
+func pending(t *testing.T, db *gorm.DB) int {
+	t.Helper()
+	n, err := migrate.Pending(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestUpDown(t *testing.T) {
+	db := openDB(t)
+	if n, err := migrate.Up(db, 0); err != nil || n != migrate.Latest() {
+		t.Fatalf("Up 执行了 %d 个迁移：%v", n, err)
+	}
+	if n, err := migrate.Up(db, 0); err != nil || n != 0 {
+		t.Fatalf("重复 Up 执行了 %d 个迁移：%v", n, err)
+	}
+	if !db.Migrator().HasTable("market_offers") {
+		t.Fatal("缺少 market_offers 表")
+	}
+
+	if n, err := migrate.Down(db, migrate.Latest()); err != nil || n != migrate.Latest() {
+		t.Fatalf("Down 回滚了 %d 个迁移：%v", n, err)
+	}
+	if db.Migrator().HasTable("market_offers") {
+		t.Fatal("回滚后 market_offers 表仍然存在")
+	}
+	if got := pending(t, db); got != migrate.Latest() {
+		t.Fatalf("回滚后未执行的迁移数为 %d", got)
+	}
+	if _, err := migrate.Up(db, 0); err != nil {
+		t.Fatalf("回滚后重新执行失败：%v", err)
+	}
+	if got := pending(t, db); got != 0 {
+		t.Fatalf("未执行的迁移数为 %d", got)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	db := openDB(t)
+	if _, err := migrate.Up(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	seller := model.User{Username: "seller", Email: "s@example.com", Org: 2}
+	if err := db.Create(&seller).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing := func(assetID string) *model.MarketListing {
+		return &model.MarketListing{AssetID: assetID, Title: "t", Price: 10, SellerID: seller.ID, Status: model.ListingActive}
+	}
+	if err := db.Create(listing("a1")).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]any{
+		"同一 NFT 两个 OPEN 挂牌": listing("a1"),
+		"挂牌价格为 0":           &model.MarketListing{AssetID: "a2", Title: "t", SellerID: seller.ID, Status: model.ListingActive},
+		"未知挂牌状态":            &model.MarketListing{AssetID: "a3", Title: "t", Price: 10, SellerID: seller.ID, Status: "DRAFT"},
+		"卖家不存在":             &model.MarketListing{AssetID: "a4", Title: "t", Price: 10, SellerID: 999, Status: model.ListingActive},
+		"出价的挂牌不存在":          &model.MarketOffer{ListingID: 999, BidderID: seller.ID, OfferPrice: 1, Status: model.OfferPending},
+		"非法组织":              &model.User{Username: "x", Org: 9},
+		"发售时间倒置": &model.Drop{CreatorID: seller.ID, Title: "d", StartTime: time.Now(), PublicTime: time.Now().Add(-time.Hour),
+			EndTime: time.Now().Add(time.Hour), PresalePrice: 1},
+	}
+	for name, value := range cases {
+		if err := db.Create(value).Error; err == nil {
+			t.Errorf("%s：写入应该被约束拒绝", name)
+		}
+	}
+}
+
+// 升级前的库由 AutoMigrate 建表，没有 schema_migrations，基线迁移应当直接接管并补上约束
+func TestBaselineAdoptsExistingSchema(t *testing.T) {
+	db := openDB(t)
+	err := db.AutoMigrate(&model.User{}, &model.Token{}, &model.Message{}, &model.ChatSession{}, &model.MarketListing{}, &model.MarketOffer{},
+		&model.Lot{}, &model.Bid{}, &model.AuctionResult{}, &model.MintVoucher{}, &model.SignerKey{}, &model.AuditRecord{},
+		&model.Workflow{}, &model.WorkflowStep{}, &model.ReconcileRun{}, &model.Drop{}, &model.DropAllowlist{},
+		&model.ProjectionCheckpoint{}, &model.LedgerAsset{}, &model.LedgerAccount{}, &model.LedgerTransfer{}, &model.LedgerWithHolding{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seller := model.User{Username: "seller", Email: "s@example.com", Org: 2}
+	if err := db.Create(&seller).Error; err != nil {
+		t.Fatal(err)
+	}
+	open := &model.MarketListing{AssetID: "a1", Title: "t", Price: 10, SellerID: seller.ID, Status: model.ListingActive}
+	if err := db.Create(open).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrate.Up(db, 0); err != nil {
+		t.Fatalf("基线迁移失败：%v", err)
+	}
+	var count int64
+	db.Model(&model.MarketListing{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("迁移后挂牌数为 %d", count)
+	}
+	if !db.Migrator().HasIndex("market_listings", "idx_market_listings_status") {
+		t.Fatal("迁移后原有索引丢失")
+	}
+	dup := &model.MarketListing{AssetID: "a1", Title: "t", Price: 10, SellerID: seller.ID, Status: model.ListingActive}
+	if err := db.Create(dup).Error; err == nil {
+		t.Fatal("迁移后同一 NFT 仍然可以有两个 OPEN 挂牌")
+	}
+}
+
+// 违反约束的旧数据会让迁移整体回滚，不留下半迁移的结构
+func TestBaselineRollsBackOnBadData(t *testing.T) {
+	db := openDB(t)
+	if err := db.AutoMigrate(&model.User{}, &model.MarketListing{}); err != nil {
+		t.Fatal(err)
+	}
+	orphan := &model.MarketListing{AssetID: "a1", Title: "t", Price: 10, SellerID: 999, Status: model.ListingActive}
+	if err := db.Create(orphan).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err := migrate.Up(db, 0)
+	if err == nil || !strings.Contains(err.Error(), "外键") {
+		t.Fatalf("迁移应当因外键失败，实际：%v", err)
+	}
+	if got := pending(t, db); got != migrate.Latest() {
+		t.Fatalf("失败后未执行的迁移数为 %d", got)
+	}
+	if db.Migrator().HasTable("market_offers") {
+		t.Fatal("失败的迁移留下了 market_offers 表")
+	}
+}
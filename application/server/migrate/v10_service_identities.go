@@ -0,0 +1,30 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v10ServiceIdentities 组织在 Fabric CA 登记的服务身份，链码只允许带 role=service 属性的身份执行平台操作
+var v10ServiceIdentities = Migration{
+	Version: 10,
+	Name:    "service_identities",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v10ServiceIdentity{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v10ServiceIdentity{})
+	},
+}
+
+type v10ServiceIdentity struct {
+	OrgName        string `gorm:"primaryKey;type:varchar(16)"`
+	MSPID          string `gorm:"column:msp_id;type:varchar(64);not null"`
+	EnrollmentID   string `gorm:"type:varchar(128);not null;uniqueIndex"`
+	CertificatePEM string `gorm:"type:text;not null"`
+	PrivateKey     string `gorm:"type:text;not null"`
+	CreateTime     time.Time
+}
+
+func (v10ServiceIdentity) TableName() string { return "fabric_service_identities" }
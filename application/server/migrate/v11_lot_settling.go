@@ -0,0 +1,28 @@
+package migrate
+
+import (
+	"gorm.io/gorm"
+)
+
+// v11LotSettling 结算开始时在拍品行锁内标记，之后不再接受出价
+var v11LotSettling = Migration{
+	Version: 11,
+	Name:    "lot_settling",
+	Up: func(tx *gorm.DB) error {
+		// 由 AutoMigrate 建表的库可能已经有新列
+		if tx.Migrator().HasColumn(&v11Lot{}, "Settling") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&v11Lot{}, "Settling")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&v11Lot{}, "Settling")
+	},
+}
+
+// v11Lot 只声明新增的列
+type v11Lot struct {
+	Settling bool `gorm:"not null;default:false"`
+}
+
+func (v11Lot) TableName() string { return "lots" }
@@ -0,0 +1,28 @@
+package migrate
+
+import (
+	"gorm.io/gorm"
+)
+
+// v12WorkflowLeaseOwner 记录持有执行租约的执行者，续约和释放租约时只修改自己持有的
+var v12WorkflowLeaseOwner = Migration{
+	Version: 12,
+	Name:    "workflow_lease_owner",
+	Up: func(tx *gorm.DB) error {
+		// 由 AutoMigrate 建表的库可能已经有新列
+		if tx.Migrator().HasColumn(&v12Workflow{}, "LeaseOwner") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&v12Workflow{}, "LeaseOwner")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&v12Workflow{}, "LeaseOwner")
+	},
+}
+
+// v12Workflow 只声明新增的列
+type v12Workflow struct {
+	LeaseOwner string `gorm:"type:varchar(64);not null;default:''"`
+}
+
+func (v12Workflow) TableName() string { return "workflows" }
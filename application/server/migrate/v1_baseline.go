@@ -0,0 +1,374 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v1Baseline 初始结构：原先 AutoMigrate 建出的全部表，加上模型隐含但之前没有落到数据库的外键、检查约束和唯一约束
+// 下面的结构体是 v1 时的表结构快照，与 model 包解耦，之后模型再变化也不会影响这个迁移
+// 对已经由 AutoMigrate 建好表的旧库执行时，只会补上缺少的约束和索引；已有数据违反约束时迁移失败并整体回滚，需要先清理数据
+var v1Baseline = Migration{
+	Version: 1,
+	Name:    "baseline",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(v1Tables...)
+	},
+	Down: func(tx *gorm.DB) error {
+		// 按依赖倒序删除
+		for i := len(v1Tables) - 1; i >= 0; i-- {
+			if err := tx.Migrator().DropTable(v1Tables[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// v1Tables 被引用的表排在前面
+var v1Tables = []any{
+	&v1User{}, &v1Token{}, &v1Message{}, &v1ChatSession{},
+	&v1Drop{}, &v1DropAllowlist{}, &v1MarketListing{}, &v1MarketOffer{},
+	&v1Lot{}, &v1Bid{}, &v1AuctionResult{},
+	&v1MintVoucher{}, &v1SignerKey{}, &v1AuditRecord{},
+	&v1Workflow{}, &v1WorkflowStep{}, &v1ReconcileRun{},
+	&v1ProjectionCheckpoint{}, &v1LedgerAsset{}, &v1LedgerAccount{}, &v1LedgerTransfer{}, &v1LedgerWithHolding{},
+}
+
+// —— 账户 ——
+
+type v1User struct {
+	ID           int    `gorm:"primaryKey;autoIncrement"`
+	Username     string `gorm:"uniqueIndex;type:varchar(50);not null"`
+	Email        string `gorm:"type:varchar(50);not null"`
+	AvatarURL    string `gorm:"type:varchar(255);not null"`
+	PasswordHash string `gorm:"type:varchar(255);not null"`
+	Org          int    `gorm:"not null;check:chk_users_org,org IN (1, 2, 3)"`
+	CreateTime   time.Time
+	UpdateTime   time.Time
+}
+
+func (v1User) TableName() string { return "users" }
+
+type v1Token struct {
+	ID         int       `gorm:"primaryKey;autoIncrement"`
+	Token      string    `gorm:"uniqueIndex;type:text;not null"`
+	UserID     int       `gorm:"not null"`
+	User       v1User    `gorm:"constraint:OnDelete:CASCADE"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	CreateTime time.Time
+}
+
+func (v1Token) TableName() string { return "tokens" }
+
+// —— 私信 ——
+
+type v1Message struct {
+	ID          int    `gorm:"primaryKey;autoIncrement"`
+	SenderID    int    `gorm:"not null"`
+	Sender      v1User `gorm:"foreignKey:SenderID"`
+	RecipientID int    `gorm:"not null"`
+	Recipient   v1User `gorm:"foreignKey:RecipientID"`
+	Content     string `gorm:"type:text;not null"`
+	TimeStamp   time.Time
+	HasRead     bool `gorm:"default:false"`
+}
+
+func (v1Message) TableName() string { return "messages" }
+
+type v1ChatSession struct {
+	ID           int    `gorm:"primaryKey;autoIncrement"`
+	SenderID     int    `gorm:"not null"`
+	Sender       v1User `gorm:"foreignKey:SenderID"`
+	RecipientID  int    `gorm:"not null"`
+	Recipient    v1User `gorm:"foreignKey:RecipientID"`
+	LastMessage  string `gorm:"type:text;not null"`
+	LastActivity time.Time
+}
+
+func (v1ChatSession) TableName() string { return "chatSessions" }
+
+// —— 发售 ——
+
+type v1Drop struct {
+	ID           int       `gorm:"primaryKey;autoIncrement"`
+	CreatorID    int       `gorm:"not null;index"`
+	Creator      v1User    `gorm:"foreignKey:CreatorID"`
+	Title        string    `gorm:"type:varchar(200);not null"`
+	StartTime    time.Time `gorm:"not null;check:chk_drops_time,start_time < public_time AND public_time <= end_time"`
+	PublicTime   time.Time `gorm:"not null"`
+	EndTime      time.Time `gorm:"not null"`
+	PresalePrice int64     `gorm:"not null;check:chk_drops_presale_price,presale_price > 0"`
+	PerWalletCap int       `gorm:"not null;check:chk_drops_per_wallet_cap,per_wallet_cap >= 0"`
+	CreateTime   time.Time
+	UpdateTime   time.Time
+}
+
+func (v1Drop) TableName() string { return "drops" }
+
+type v1DropAllowlist struct {
+	ID         int    `gorm:"primaryKey;autoIncrement"`
+	DropID     int    `gorm:"not null;uniqueIndex:idx_drop_user"`
+	Drop       v1Drop `gorm:"constraint:OnDelete:CASCADE"`
+	UserID     int    `gorm:"not null;uniqueIndex:idx_drop_user"`
+	User       v1User `gorm:"constraint:OnDelete:CASCADE"`
+	CreateTime time.Time
+}
+
+func (v1DropAllowlist) TableName() string { return "drop_allowlists" }
+
+// —— 市场 ——
+
+// 同一个 NFT 同时只能有一个 OPEN 挂牌，用部分唯一索引保证，并发挂牌时由数据库兜底
+// winner_offer_id 与 market_offers.listing_id 互相引用，建表时无法同时创建，不加外键
+type v1MarketListing struct {
+	ID            int        `gorm:"primaryKey;autoIncrement"`
+	AssetID       string     `gorm:"type:varchar(128);not null;index;uniqueIndex:idx_market_listings_open_asset,where:status = 'OPEN'"`
+	Title         string     `gorm:"type:varchar(200);not null"`
+	Price         int64      `gorm:"not null;check:chk_market_listings_price,price > 0"`
+	SellerID      int        `gorm:"not null"`
+	Seller        v1User     `gorm:"foreignKey:SellerID"`
+	SellerOrg     int32      `gorm:"not null;default:2"`
+	Status        string     `gorm:"type:varchar(16);not null;index;check:chk_market_listings_status,status IN ('OPEN', 'SOLD', 'CLOSED')"`
+	Deadline      *time.Time `gorm:"index"`
+	CreateTime    time.Time
+	UpdateTime    time.Time
+	IsAuction     bool `gorm:"default:false"`
+	ReservePrice  *int64
+	BuyNowPrice   *int64
+	WinnerOfferID *int   `gorm:"index"`
+	SeriesID      string `gorm:"type:varchar(128);index"`
+	EditionNumber int
+	EditionSupply int
+	DropID        *int    `gorm:"index"`
+	Drop          *v1Drop `gorm:"constraint:OnDelete:SET NULL"`
+}
+
+func (v1MarketListing) TableName() string { return "market_listings" }
+
+type v1MarketOffer struct {
+	ID           int             `gorm:"primaryKey;autoIncrement"`
+	ListingID    int             `gorm:"not null;index"`
+	Listing      v1MarketListing `gorm:"foreignKey:ListingID"`
+	BidderID     int             `gorm:"not null"`
+	Bidder       v1User          `gorm:"foreignKey:BidderID"`
+	BidderOrg    int32           `gorm:"not null;default:2"`
+	OfferPrice   int64           `gorm:"not null;check:chk_market_offers_offer_price,offer_price > 0"`
+	Status       string          `gorm:"type:varchar(16);not null;index;check:chk_market_offers_status,status IN ('PENDING', 'ACCEPTED', 'REJECTED')"`
+	CreateTime   time.Time
+	UpdateTime   time.Time
+	IsEscrowed   bool `gorm:"default:false"`
+	EscrowHoldID *string
+	EscrowTxID   *string
+	RefundTxID   *string
+	PayoutTxID   *string
+}
+
+func (v1MarketOffer) TableName() string { return "market_offers" }
+
+// —— 拍卖 ——
+
+type v1Lot struct {
+	ID           int       `gorm:"primaryKey;autoIncrement"`
+	AssetID      string    `gorm:"type:varchar(128);not null;index"`
+	Title        string    `gorm:"type:varchar(200);not null"`
+	ReservePrice int       `gorm:"not null"`
+	CurrentPrice int       `gorm:"not null"`
+	SellerID     int       `gorm:"not null"`
+	Seller       v1User    `gorm:"foreignKey:SellerID"`
+	SellerOrg    int       `gorm:"not null;default:2"`
+	StartTime    time.Time `gorm:"not null;check:chk_lots_time,start_time <= deadline"`
+	Deadline     time.Time `gorm:"not null"`
+	CreateTime   time.Time
+	UpdateTime   time.Time
+}
+
+func (v1Lot) TableName() string { return "lots" }
+
+type v1Bid struct {
+	ID         int    `gorm:"primaryKey;autoIncrement"`
+	LotID      int    `gorm:"not null;index"`
+	Lot        v1Lot  `gorm:"foreignKey:LotID"`
+	BidderID   int    `gorm:"not null"`
+	Bidder     v1User `gorm:"foreignKey:BidderID"`
+	BidderOrg  int    `gorm:"not null;default:2"`
+	BidPrice   int    `gorm:"not null"`
+	CreateTime time.Time
+	UpdateTime time.Time
+}
+
+func (v1Bid) TableName() string { return "bids" }
+
+// 每个拍品只有一条结果，唯一索引防止到期结算与手动结算并发时重复记录
+// 流拍时 bidder_id 为 0，不加外键
+type v1AuctionResult struct {
+	LotID    int   `gorm:"uniqueIndex:idx_auction_results_lot_id"`
+	Lot      v1Lot `gorm:"foreignKey:LotID"`
+	BidPrice int
+	BidderID int
+}
+
+func (v1AuctionResult) TableName() string { return "auction_results" }
+
+// —— 铸造凭证 ——
+
+type v1MintVoucher struct {
+	ID          string `gorm:"primaryKey;type:varchar(64)"`
+	CreatorID   int    `gorm:"not null;index"`
+	Creator     v1User `gorm:"foreignKey:CreatorID"`
+	Name        string `gorm:"type:varchar(200);not null"`
+	Description string `gorm:"type:text"`
+	ImageName   string `gorm:"type:varchar(255);not null"`
+	ImageHash   string `gorm:"type:varchar(64);not null"`
+	Price       int64  `gorm:"not null;check:chk_mint_vouchers_price,price > 0"`
+	Signature   string `gorm:"type:text;not null"`
+	Status      string `gorm:"type:varchar(16);not null;index;check:chk_mint_vouchers_status,status IN ('OPEN', 'REDEEMED', 'CANCELLED')"`
+	RedeemerID  *int
+	Redeemer    *v1User `gorm:"foreignKey:RedeemerID"`
+	AssetID     *string
+	CreateTime  time.Time
+	UpdateTime  time.Time
+}
+
+func (v1MintVoucher) TableName() string { return "mint_vouchers" }
+
+type v1SignerKey struct {
+	UserID        int    `gorm:"primaryKey"`
+	User          v1User `gorm:"constraint:OnDelete:CASCADE"`
+	PrivateKeyPEM string `gorm:"type:text;not null"`
+	PublicKeyPEM  string `gorm:"type:text;not null"`
+	CreateTime    time.Time
+}
+
+func (v1SignerKey) TableName() string { return "signer_keys" }
+
+// —— 审计与对账 ——
+
+type v1AuditRecord struct {
+	ID          int       `gorm:"primaryKey;autoIncrement"`
+	TriggeredBy int       `gorm:"not null"`
+	Admin       v1User    `gorm:"foreignKey:TriggeredBy"`
+	Consistent  bool      `gorm:"not null"`
+	IssueCount  int       `gorm:"not null"`
+	Report      string    `gorm:"type:text"`
+	Error       string    `gorm:"type:text"`
+	CreateTime  time.Time `gorm:"index"`
+}
+
+func (v1AuditRecord) TableName() string { return "audit_records" }
+
+// 定时对账的 triggered_by 为 0，不加外键
+type v1ReconcileRun struct {
+	ID            int    `gorm:"primaryKey;autoIncrement"`
+	Trigger       string `gorm:"type:varchar(16);not null;check:chk_reconcile_runs_trigger,\"trigger\" IN ('MANUAL', 'SCHEDULE')"`
+	TriggeredBy   int
+	AutoRepair    bool      `gorm:"not null"`
+	IssueCount    int       `gorm:"not null"`
+	RepairedCount int       `gorm:"not null"`
+	Issues        string    `gorm:"type:text"`
+	Error         string    `gorm:"type:text"`
+	CreateTime    time.Time `gorm:"index"`
+}
+
+func (v1ReconcileRun) TableName() string { return "reconcile_runs" }
+
+// —— 结算流程 ——
+
+type v1Workflow struct {
+	ID           int             `gorm:"primaryKey;autoIncrement"`
+	Type         string          `gorm:"type:varchar(32);not null;check:chk_workflows_type,type IN ('ACCEPT_OFFER', 'BUY_NOW')"`
+	Status       string          `gorm:"type:varchar(16);not null;index;check:chk_workflows_status,status IN ('RUNNING', 'COMPLETED', 'COMPENSATED', 'FAILED')"`
+	ListingID    int             `gorm:"not null;index"`
+	Listing      v1MarketListing `gorm:"foreignKey:ListingID"`
+	UserID       int             `gorm:"not null;index"`
+	User         v1User          `gorm:"foreignKey:UserID"`
+	Compensating bool            `gorm:"not null;default:false"`
+	Attempts     int             `gorm:"not null;default:0"`
+	LastError    string          `gorm:"type:text"`
+	NextRunAt    time.Time       `gorm:"index"`
+	LeaseUntil   *time.Time
+	CreateTime   time.Time
+	UpdateTime   time.Time
+	Steps        []v1WorkflowStep `gorm:"foreignKey:WorkflowID"`
+}
+
+func (v1Workflow) TableName() string { return "workflows" }
+
+type v1WorkflowStep struct {
+	ID         int    `gorm:"primaryKey;autoIncrement"`
+	WorkflowID int    `gorm:"not null;uniqueIndex:idx_workflow_step"`
+	Seq        int    `gorm:"not null;uniqueIndex:idx_workflow_step"`
+	Name       string `gorm:"type:varchar(32);not null"`
+	TxID       string `gorm:"type:varchar(64);not null"`
+	OfferID    int
+	AssetID    string `gorm:"type:varchar(128)"`
+	FromID     int
+	ToID       int
+	Amount     int64
+	Status     string `gorm:"type:varchar(16);not null;check:chk_workflow_steps_status,status IN ('PENDING', 'DONE', 'COMPENSATED')"`
+	Attempts   int    `gorm:"not null;default:0"`
+	LastError  string `gorm:"type:text"`
+	CreateTime time.Time
+	UpdateTime time.Time
+}
+
+func (v1WorkflowStep) TableName() string { return "workflow_steps" }
+
+// —— 链上数据读模型，数据来自区块，不加外键 ——
+
+type v1ProjectionCheckpoint struct {
+	Name       string `gorm:"primaryKey;type:varchar(32)"`
+	NextBlock  uint64 `gorm:"not null"`
+	Generation int    `gorm:"not null"`
+	UpdateTime time.Time
+}
+
+func (v1ProjectionCheckpoint) TableName() string { return "projection_checkpoints" }
+
+type v1LedgerAsset struct {
+	ID            string `gorm:"primaryKey;type:varchar(128)"`
+	Name          string `gorm:"type:varchar(255)"`
+	ImageName     string `gorm:"type:varchar(255)"`
+	AuthorId      int    `gorm:"index"`
+	OwnerId       int    `gorm:"index"`
+	Description   string `gorm:"type:text"`
+	ImageHash     string `gorm:"type:varchar(128)"`
+	SeriesID      string `gorm:"type:varchar(128);index"`
+	EditionNumber int
+	EditionSupply int
+	TimeStamp     time.Time
+	BlockNum      uint64 `gorm:"not null"`
+}
+
+func (v1LedgerAsset) TableName() string { return "ledger_assets" }
+
+type v1LedgerAccount struct {
+	ID       int    `gorm:"primaryKey;autoIncrement:false"`
+	Balance  int    `gorm:"not null"`
+	BlockNum uint64 `gorm:"not null"`
+}
+
+func (v1LedgerAccount) TableName() string { return "ledger_accounts" }
+
+type v1LedgerTransfer struct {
+	ID          string `gorm:"primaryKey;type:varchar(128)"`
+	SenderID    int    `gorm:"index"`
+	RecipientID int    `gorm:"index"`
+	Amount      int    `gorm:"not null"`
+	TimeStamp   time.Time
+	BlockNum    uint64 `gorm:"not null"`
+}
+
+func (v1LedgerTransfer) TableName() string { return "ledger_transfers" }
+
+type v1LedgerWithHolding struct {
+	ID        string `gorm:"primaryKey;type:varchar(128)"`
+	AccountID int    `gorm:"index"`
+	ListingID string `gorm:"type:varchar(128);index"`
+	Amount    int    `gorm:"not null"`
+	TimeStamp time.Time
+	BlockNum  uint64 `gorm:"not null"`
+}
+
+func (v1LedgerWithHolding) TableName() string { return "ledger_withholdings" }
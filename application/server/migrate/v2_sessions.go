@@ -0,0 +1,55 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v2Sessions 登录会话与刷新令牌
+// tokens 表原来保存 24 小时有效的访问令牌明文，改为保存刷新令牌的哈希并关联到会话；旧令牌全部作废，用户需要重新登录
+var v2Sessions = Migration{
+	Version: 2,
+	Name:    "sessions",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&v1Token{}); err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&v2Session{}, &v2Token{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&v2Token{}, &v2Session{}); err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&v1Token{})
+	},
+}
+
+type v2Session struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36)"`
+	UserID       int       `gorm:"not null;index"`
+	User         v1User    `gorm:"constraint:OnDelete:CASCADE"`
+	UserAgent    string    `gorm:"type:varchar(255)"`
+	IP           string    `gorm:"type:varchar(64)"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	LastSeenAt   time.Time `gorm:"not null"`
+	RevokedAt    *time.Time
+	RevokeReason string `gorm:"type:varchar(64)"`
+	CreateTime   time.Time
+}
+
+func (v2Session) TableName() string { return "sessions" }
+
+type v2Token struct {
+	ID         int       `gorm:"primaryKey;autoIncrement"`
+	Token      string    `gorm:"uniqueIndex;type:varchar(64);not null"`
+	SessionID  string    `gorm:"type:varchar(36);not null;index"`
+	Session    v2Session `gorm:"constraint:OnDelete:CASCADE"`
+	UserID     int       `gorm:"not null"`
+	User       v1User    `gorm:"constraint:OnDelete:CASCADE"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	UsedAt     *time.Time
+	CreateTime time.Time
+}
+
+func (v2Token) TableName() string { return "tokens" }
@@ -0,0 +1,30 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v3UserRoles 用户角色，在组织权限之外授予附加权限
+var v3UserRoles = Migration{
+	Version: 3,
+	Name:    "user_roles",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v3UserRole{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v3UserRole{})
+	},
+}
+
+type v3UserRole struct {
+	ID         int    `gorm:"primaryKey;autoIncrement"`
+	UserID     int    `gorm:"not null;uniqueIndex:idx_user_roles_user_role"`
+	User       v1User `gorm:"constraint:OnDelete:CASCADE"`
+	Role       string `gorm:"type:varchar(32);not null;uniqueIndex:idx_user_roles_user_role"`
+	GrantedBy  int    `gorm:"not null"`
+	CreateTime time.Time
+}
+
+func (v3UserRole) TableName() string { return "user_roles" }
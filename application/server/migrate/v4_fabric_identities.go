@@ -0,0 +1,32 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v4FabricIdentities 用户在 Fabric CA 登记的链上身份
+var v4FabricIdentities = Migration{
+	Version: 4,
+	Name:    "fabric_identities",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v4FabricIdentity{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v4FabricIdentity{})
+	},
+}
+
+type v4FabricIdentity struct {
+	UserID         int    `gorm:"primaryKey;autoIncrement:false"`
+	User           v1User `gorm:"constraint:OnDelete:CASCADE"`
+	OrgName        string `gorm:"type:varchar(16);not null"`
+	MSPID          string `gorm:"column:msp_id;type:varchar(64);not null"`
+	EnrollmentID   string `gorm:"type:varchar(128);not null;uniqueIndex"`
+	CertificatePEM string `gorm:"type:text;not null"`
+	PrivateKey     string `gorm:"type:text;not null"`
+	CreateTime     time.Time
+}
+
+func (v4FabricIdentity) TableName() string { return "fabric_identities" }
@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v5OrgApplications 组织申请和组织变更审计记录
+var v5OrgApplications = Migration{
+	Version: 5,
+	Name:    "org_applications",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&v5OrgApplication{}, &v5OrgChangeEvent{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&v5OrgChangeEvent{}, &v5OrgApplication{})
+	},
+}
+
+type v5OrgApplication struct {
+	ID            int    `gorm:"primaryKey;autoIncrement"`
+	UserID        int    `gorm:"not null;index"`
+	User          v1User `gorm:"constraint:OnDelete:CASCADE"`
+	FromOrg       int    `gorm:"not null;check:chk_org_applications_from_org,from_org IN (1, 2, 3)"`
+	TargetOrg     int    `gorm:"not null;index;check:chk_org_applications_target_org,target_org IN (1, 2, 3)"`
+	Reason        string `gorm:"type:text;not null"`
+	Status        string `gorm:"type:varchar(16);not null;index;check:chk_org_applications_status,status IN ('PENDING', 'APPROVED', 'REJECTED', 'CANCELLED')"`
+	ReviewerID    *int
+	ReviewComment string `gorm:"type:text"`
+	ReviewTime    *time.Time
+	CreateTime    time.Time
+}
+
+func (v5OrgApplication) TableName() string { return "org_applications" }
+
+type v5OrgChangeEvent struct {
+	ID            int       `gorm:"primaryKey;autoIncrement"`
+	UserID        int       `gorm:"not null;index"`
+	User          v1User    `gorm:"constraint:OnDelete:CASCADE"`
+	ApplicationID *int      `gorm:"index"`
+	ActorID       int       `gorm:"not null"`
+	Action        string    `gorm:"type:varchar(16);not null"`
+	FromOrg       int       `gorm:"not null"`
+	ToOrg         int       `gorm:"not null"`
+	Comment       string    `gorm:"type:text"`
+	CreateTime    time.Time `gorm:"index"`
+}
+
+func (v5OrgChangeEvent) TableName() string { return "org_change_events" }
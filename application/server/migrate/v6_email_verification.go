@@ -0,0 +1,51 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v6EmailVerification 邮箱验证时间和密码重置令牌
+// 已有用户在引入邮箱验证之前注册，视为已验证，避免升级后无法交易
+var v6EmailVerification = Migration{
+	Version: 6,
+	Name:    "email_verification",
+	Up: func(tx *gorm.DB) error {
+		// 由 AutoMigrate 建表的旧库可能已经有这一列
+		if !tx.Migrator().HasColumn(&v6User{}, "EmailVerifiedAt") {
+			if err := tx.Migrator().AddColumn(&v6User{}, "EmailVerifiedAt"); err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("UPDATE users SET email_verified_at = create_time").Error; err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&v6PasswordResetToken{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&v6PasswordResetToken{}); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&v6User{}, "EmailVerifiedAt")
+	},
+}
+
+// v6User 只声明新增的列
+type v6User struct {
+	EmailVerifiedAt *time.Time
+}
+
+func (v6User) TableName() string { return "users" }
+
+type v6PasswordResetToken struct {
+	ID         int       `gorm:"primaryKey;autoIncrement"`
+	Token      string    `gorm:"uniqueIndex;type:varchar(64);not null"`
+	UserID     int       `gorm:"not null;index"`
+	User       v1User    `gorm:"constraint:OnDelete:CASCADE"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	UsedAt     *time.Time
+	CreateTime time.Time
+}
+
+func (v6PasswordResetToken) TableName() string { return "password_reset_tokens" }
@@ -0,0 +1,57 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// v7TwoFactorAuth TOTP 密钥、恢复码和会话的二次验证时间
+var v7TwoFactorAuth = Migration{
+	Version: 7,
+	Name:    "two_factor_auth",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&v7Session{}, "StepUpAt"); err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&v7TwoFactor{}, &v7RecoveryCode{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&v7RecoveryCode{}, &v7TwoFactor{}); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&v7Session{}, "StepUpAt")
+	},
+}
+
+// v7Session 只声明新增的列
+type v7Session struct {
+	StepUpAt *time.Time
+}
+
+func (v7Session) TableName() string { return "sessions" }
+
+type v7TwoFactor struct {
+	UserID         int    `gorm:"primaryKey;autoIncrement:false"`
+	User           v1User `gorm:"constraint:OnDelete:CASCADE"`
+	Secret         string `gorm:"type:varchar(255);not null"`
+	EnabledAt      *time.Time
+	LastStep       int64 `gorm:"not null;default:0"`
+	FailedAttempts int   `gorm:"not null;default:0"`
+	LockedUntil    *time.Time
+	CreateTime     time.Time
+	UpdateTime     time.Time
+}
+
+func (v7TwoFactor) TableName() string { return "two_factors" }
+
+type v7RecoveryCode struct {
+	ID         int    `gorm:"primaryKey;autoIncrement"`
+	UserID     int    `gorm:"not null;index"`
+	User       v1User `gorm:"constraint:OnDelete:CASCADE"`
+	CodeHash   string `gorm:"type:varchar(64);not null"`
+	UsedAt     *time.Time
+	CreateTime time.Time
+}
+
+func (v7RecoveryCode) TableName() string { return "recovery_codes" }
@@ -0,0 +1,51 @@
+package migrate
+
+import (
+	"gorm.io/gorm"
+)
+
+// v8VoucherSettlement 凭证兑换和撤回改为先标记 PENDING 再上链，签名私钥改为加密保存
+// 私钥列从 private_key_pem 改名为 private_key，旧数据仍是明文 PEM，由服务在下次读取时用 fabric.walletKey 加密回写
+var v8VoucherSettlement = Migration{
+	Version: 8,
+	Name:    "voucher_settlement",
+	Up: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.DropConstraint(&v1MintVoucher{}, "chk_mint_vouchers_status"); err != nil {
+			return err
+		}
+		if err := m.CreateConstraint(&v8MintVoucher{}, "chk_mint_vouchers_status"); err != nil {
+			return err
+		}
+		// 由 AutoMigrate 建表的库可能已经有新列
+		if m.HasColumn(&v8SignerKey{}, "PrivateKey") {
+			return nil
+		}
+		return m.RenameColumn(&v8SignerKey{}, "private_key_pem", "private_key")
+	},
+	// 回滚前需要先处理 PENDING 的凭证；已加密的私钥不会解密，旧版本需要重新生成签名密钥
+	Down: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.RenameColumn(&v8SignerKey{}, "private_key", "private_key_pem"); err != nil {
+			return err
+		}
+		if err := m.DropConstraint(&v8MintVoucher{}, "chk_mint_vouchers_status"); err != nil {
+			return err
+		}
+		return m.CreateConstraint(&v1MintVoucher{}, "chk_mint_vouchers_status")
+	},
+}
+
+// v8MintVoucher 只声明约束变化的列
+type v8MintVoucher struct {
+	Status string `gorm:"type:varchar(16);not null;index;check:chk_mint_vouchers_status,status IN ('OPEN', 'PENDING', 'REDEEMED', 'CANCELLED')"`
+}
+
+func (v8MintVoucher) TableName() string { return "mint_vouchers" }
+
+// v8SignerKey 只声明改名的列
+type v8SignerKey struct {
+	PrivateKey string `gorm:"type:text;not null"`
+}
+
+func (v8SignerKey) TableName() string { return "signer_keys" }
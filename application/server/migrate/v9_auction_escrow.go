@@ -0,0 +1,41 @@
+package migrate
+
+import (
+	"gorm.io/gorm"
+)
+
+// v9AuctionEscrow 出价时在链上冻结资金，结算时释放给卖家或退还
+// 升级前的出价没有冻结，escrowed 为 false，结算时由赢家直接付款
+var v9AuctionEscrow = Migration{
+	Version: 9,
+	Name:    "auction_escrow",
+	Up: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		for _, field := range []string{"Escrowed", "HoldPending"} {
+			// 由 AutoMigrate 建表的库可能已经有新列
+			if m.HasColumn(&v9Bid{}, field) {
+				continue
+			}
+			if err := m.AddColumn(&v9Bid{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 回滚前需要先结算或退还已冻结的出价
+	Down: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.DropColumn(&v9Bid{}, "HoldPending"); err != nil {
+			return err
+		}
+		return m.DropColumn(&v9Bid{}, "Escrowed")
+	},
+}
+
+// v9Bid 只声明新增的列
+type v9Bid struct {
+	Escrowed    bool `gorm:"not null;default:false"`
+	HoldPending bool `gorm:"not null;default:false"`
+}
+
+func (v9Bid) TableName() string { return "bids" }
@@ -7,23 +7,60 @@ import (
 
 // User 用户信息
 type User struct {
-	ID           int       `json:"id" gorm:"primaryKey;autoIncrement"`                    // 主键，用户 ID
-	Username     string    `json:"username" gorm:"uniqueIndex;type:varchar(50);not null"` // 用户名
-	Email        string    `json:"email" gorm:"type:varchar(50);not null"`                // 邮箱
-	AvatarURL    string    `json:"avatarURL" gorm:"type:varchar(255);not null"`           // 头像URL
-	PasswordHash string    `json:"-" gorm:"type:varchar(255);not null"`                   // 密码哈希
-	Org          int       `json:"org" gorm:"not null"`                                   // 组织，只允许有一个
-	CreateTime   time.Time `json:"createTime" gorm:"autoCreateTime"`                      // 创建时间
-	UpdateTime   time.Time `json:"updateTime" gorm:"autoUpdateTime"`                      // 更新时间
+	ID              int        `json:"id" gorm:"primaryKey;autoIncrement"`                    // 主键，用户 ID
+	Username        string     `json:"username" gorm:"uniqueIndex;type:varchar(50);not null"` // 用户名
+	Email           string     `json:"email" gorm:"type:varchar(50);not null"`                // 邮箱
+	AvatarURL       string     `json:"avatarURL" gorm:"type:varchar(255);not null"`           // 头像URL
+	PasswordHash    string     `json:"-" gorm:"type:varchar(255);not null"`                   // 密码哈希
+	Org             int        `json:"org" gorm:"not null"`                                   // 组织，只允许有一个
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`                                       // 邮箱验证时间，为空表示未验证，未验证的用户不能交易
+	CreateTime      time.Time  `json:"createTime" gorm:"autoCreateTime"`                      // 创建时间
+	UpdateTime      time.Time  `json:"updateTime" gorm:"autoUpdateTime"`                      // 更新时间
 }
 
-// Token 令牌信息
+// Token 刷新令牌
+// 每次刷新都换发新令牌并把旧令牌标记为已使用；已使用的令牌再次出现说明令牌泄露，整个会话会被注销
 type Token struct {
-	ID         int       `json:"id" gorm:"primaryKey;autoIncrement"`          // 主键，令牌 ID
-	Token      string    `json:"token" gorm:"uniqueIndex;type:text;not null"` // 令牌
-	UserID     int       `json:"userID" gorm:"not null"`                      // 用户 ID
-	ExpiresAt  time.Time `json:"expiresAt" gorm:"not null"`                   // 过期时间
-	CreateTime time.Time `json:"createTime" gorm:"autoCreateTime"`            // 创建时间
+	ID         int        `json:"id" gorm:"primaryKey;autoIncrement"`               // 主键，令牌 ID
+	Token      string     `json:"-" gorm:"uniqueIndex;type:varchar(64);not null"`   // 令牌的 SHA-256，不保存明文
+	SessionID  string     `json:"sessionId" gorm:"type:varchar(36);not null;index"` // 所属会话
+	UserID     int        `json:"userID" gorm:"not null"`                           // 用户 ID
+	ExpiresAt  time.Time  `json:"expiresAt" gorm:"not null;index"`                  // 过期时间
+	UsedAt     *time.Time `json:"usedAt"`                                           // 换发新令牌的时间，为空表示仍可使用
+	CreateTime time.Time  `json:"createTime" gorm:"autoCreateTime"`                 // 创建时间
+}
+
+// Session 登录会话，一次登录对应一个会话，刷新令牌轮换时会话不变
+type Session struct {
+	ID           string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID       int        `json:"userId" gorm:"not null;index"`
+	UserAgent    string     `json:"userAgent" gorm:"type:varchar(255)"` // 登录或最近一次刷新时的设备信息
+	IP           string     `json:"ip" gorm:"type:varchar(64)"`         // 登录或最近一次刷新时的 IP
+	ExpiresAt    time.Time  `json:"expiresAt" gorm:"not null;index"`    // 最新刷新令牌的过期时间
+	LastSeenAt   time.Time  `json:"lastSeenAt" gorm:"not null"`         // 最近一次登录或刷新
+	RevokedAt    *time.Time `json:"-"`                                  // 注销时间
+	RevokeReason string     `json:"-" gorm:"type:varchar(64)"`          // 注销原因：登出、用户注销、令牌重用等
+	StepUpAt     *time.Time `json:"-"`                                  // 最近一次在该会话中通过两步验证的时间
+	CreateTime   time.Time  `json:"createTime" gorm:"autoCreateTime"`
+	Current      bool       `json:"current" gorm:"-"` // 是否为发起查询的会话
+}
+
+// —— 会话注销原因 ——
+const (
+	SessionLogout          = "LOGOUT"           // 用户登出
+	SessionRevoked         = "REVOKED"          // 用户在会话列表中注销
+	SessionRefreshReused   = "REFRESH_REUSED"   // 已使用的刷新令牌再次出现
+	SessionPasswordChanged = "PASSWORD_CHANGED" // 修改密码后注销其他会话
+	SessionOrgChanged      = "ORG_CHANGED"      // 组织变更后注销全部会话，令牌中的组织随重新登录更新
+	SessionPasswordReset   = "PASSWORD_RESET"   // 通过邮件重置密码后注销全部会话
+)
+
+// TokenPair 登录或刷新后下发的令牌
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	AccessExpiresAt  time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
 }
 
 // TableName 指定表名
@@ -35,12 +72,21 @@ func (Token) TableName() string {
 	return "tokens"
 }
 
+func (Session) TableName() string {
+	return "sessions"
+}
+
 // LoginRequest 登录请求
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
 // RegisterRequest 注册请求
 type RegisterRequest struct {
 	Username string `json:"username"`
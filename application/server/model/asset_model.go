@@ -1,22 +1,57 @@
 package model
 
 import (
+	"fmt"
 	"time"
 )
 
 // Asset 资产信息
 // 先不管稀有度，因为稀有度应该由平台给定，而不是由上传用户给定
 type Asset struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	ImageName     string    `json:"imageName"`
+	AuthorId      int       `json:"authorId"`
+	OwnerId       int       `json:"ownerId"`
+	Description   string    `json:"description"`
+	ImageHash     string    `json:"imageHash,omitempty"`
+	SeriesID      string    `json:"seriesId,omitempty"`      // 限量系列ID，普通 NFT 为空
+	EditionNumber int       `json:"editionNumber,omitempty"` // 限量版编号，如 12/100 中的 12
+	EditionSupply int       `json:"editionSupply,omitempty"` // 限量版发行量，如 12/100 中的 100
+	TimeStamp     time.Time `json:"timeStamp"`
+}
+
+// EditionSeries 限量系列的共享元数据
+type EditionSeries struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
 	ImageName   string    `json:"imageName"`
 	AuthorId    int       `json:"authorId"`
-	OwnerId     int       `json:"ownerId"`
 	Description string    `json:"description"`
+	Supply      int       `json:"supply"`
 	TimeStamp   time.Time `json:"timeStamp"`
 }
 
+// 限量版拷贝的资产 ID，需要与链码 editionAssetID 保持一致
+func EditionAssetID(seriesID string, editionNumber int) string {
+	return fmt.Sprintf("%s_%d", seriesID, editionNumber)
+}
+
+// AssetVersion NFT 的历史版本
+type AssetVersion struct {
+	TxID      string    `json:"txId"`
+	TimeStamp time.Time `json:"timeStamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Asset     *Asset    `json:"asset,omitempty"`
+}
+
 type TransferAssetRequest struct {
 	ID         string `json:"id"`
 	NewOwnerId int    `json:"newOwnerId"`
 }
+
+type UpdateAssetMetadataRequest struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
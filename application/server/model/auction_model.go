@@ -14,6 +14,7 @@ type Lot struct {
 	SellerOrg    int       `json:"sellerOrg" gorm:"not null;default:2"`             // 卖家组织
 	StartTime    time.Time `json:"startTime" gorm:"not null;"`                      // 开始时间
 	Deadline     time.Time `json:"deadline" gorm:"not null;"`                       // 结束时间
+	Settling     bool      `json:"settling" gorm:"not null;default:false"`          // 已开始结算，不再接受出价
 	CreateTime   time.Time `json:"createTime" gorm:"autoCreateTime"`                // 创建时间
 	UpdateTime   time.Time `json:"updateTime" gorm:"autoUpdateTime"`                // 更新时间
 }
@@ -21,13 +22,15 @@ type Lot struct {
 func (Lot) TableName() string { return "lots" }
 
 type Bid struct {
-	ID         int       `json:"id" gorm:"primaryKey;autoIncrement"`  // 出价ID
-	LotID      int       `json:"lotId" gorm:"not null;index"`         // 拍品ID
-	BidderID   int       `json:"bidderId" gorm:"not null"`            // 出价者ID
-	BidderOrg  int       `json:"bidderOrg" gorm:"not null;default:2"` // 出价者组织
-	BidPrice   int       `json:"bidPrice" gorm:"not null"`            // 出价
-	CreateTime time.Time `json:"createTime" gorm:"autoCreateTime"`    // 创建时间
-	UpdateTime time.Time `json:"updateTime" gorm:"autoUpdateTime"`    // 更新时间
+	ID          int       `json:"id" gorm:"primaryKey;autoIncrement"`        // 出价ID
+	LotID       int       `json:"lotId" gorm:"not null;index"`               // 拍品ID
+	BidderID    int       `json:"bidderId" gorm:"not null"`                  // 出价者ID
+	BidderOrg   int       `json:"bidderOrg" gorm:"not null;default:2"`       // 出价者组织
+	BidPrice    int       `json:"bidPrice" gorm:"not null"`                  // 出价
+	Escrowed    bool      `json:"escrowed" gorm:"not null;default:false"`    // 出价金额是否已冻结在链上，升级前的旧出价为 false
+	HoldPending bool      `json:"holdPending" gorm:"not null;default:false"` // 已登记出价、链上冻结尚未确认
+	CreateTime  time.Time `json:"createTime" gorm:"autoCreateTime"`          // 创建时间
+	UpdateTime  time.Time `json:"updateTime" gorm:"autoUpdateTime"`          // 更新时间
 }
 
 func (Bid) TableName() string { return "bids" }
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// AuditIssue 账本审计发现的单条问题
+type AuditIssue struct {
+	Type   string `json:"type"`   // 问题类型
+	Key    string `json:"key"`    // 相关记录的业务主键
+	Detail string `json:"detail"` // 详细描述
+}
+
+// AuditReport 链码 AuditLedger 返回的审计报告
+type AuditReport struct {
+	AccountCount     int          `json:"accountCount"`     // 账户数
+	TotalBalance     int          `json:"totalBalance"`     // 账户余额合计
+	WithHoldingCount int          `json:"withHoldingCount"` // 预扣款记录数
+	TotalWithHeld    int          `json:"totalWithHeld"`    // 预扣款金额合计
+	AssetCount       int          `json:"assetCount"`       // NFT 数
+	Consistent       bool         `json:"consistent"`       // 是否没有发现问题
+	Issues           []AuditIssue `json:"issues"`           // 发现的问题
+}
+
+// AuditRecord 审计历史记录
+type AuditRecord struct {
+	ID          int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	TriggeredBy int       `json:"triggeredBy" gorm:"not null"`      // 发起审计的管理员 ID
+	Consistent  bool      `json:"consistent" gorm:"not null"`       // 是否一致
+	IssueCount  int       `json:"issueCount" gorm:"not null"`       // 问题数量
+	Report      string    `json:"report" gorm:"type:text"`          // 完整报告（JSON）
+	Error       string    `json:"error,omitempty" gorm:"type:text"` // 审计本身失败时的错误信息
+	CreateTime  time.Time `json:"createTime" gorm:"autoCreateTime;index"`
+}
+
+func (AuditRecord) TableName() string { return "audit_records" }
@@ -95,8 +95,13 @@ func (m *ConnManager) GetOnlineUsers() []int {
 	return users
 }
 
+// WebSocketAuthProtocol 聊天 WebSocket 握手时携带令牌的子协议，令牌作为下一个子协议传递
+const WebSocketAuthProtocol = "bearer"
+
 // WebSocket 升级器
 var Upgrader = websocket.Upgrader{
+	// 浏览器要求服务端确认客户端请求的子协议之一，否则关闭连接
+	Subprotocols: []string{WebSocketAuthProtocol},
 	CheckOrigin: func(r *http.Request) bool {
 		// 开发环境允许所有资源
 		return true
@@ -1,33 +1,29 @@
 package model
 
 import (
+	"application/config"
 	"fmt"
 	"log"
 
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
 func InitDB() error {
-	// PostgreSQL连接配置
-	dsn := "host=127.0.0.1 user=postgres password=123456 dbname=blockchain port=5432 sslmode=disable TimeZone=Asia/Shanghai"
-
-	var err error
-	DB, err = gorm.Open(postgres.Open(dsn))
-
+	cfg := config.GlobalConfig.Database
+	d, err := dialectFor(cfg.Driver)
 	if err != nil {
-		return fmt.Errorf("连接数据库失败：%v", err)
+		return err
 	}
-
-	// 自动迁移表结构
-	err = DB.AutoMigrate(&User{}, &Token{}, &Message{}, &ChatSession{}, &MarketListing{}, &MarketOffer{}, &Lot{}, &Bid{}, &AuctionResult{})
+	DB, err = d.Open(cfg)
 	if err != nil {
-		return fmt.Errorf("数据库迁移失败：%v", err)
+		return fmt.Errorf("连接数据库失败：%v", err)
 	}
+	dialect = d
 
-	log.Println("数据库连接成功，表结构已迁移")
+	// 表结构由 migrate 包的版本化迁移维护，这里只负责连接
+	log.Printf("数据库（%s）连接成功", cfg.Driver)
 	return nil
 }
 
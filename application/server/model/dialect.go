@@ -0,0 +1,132 @@
+package model
+
+import (
+	"application/config"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dialect 屏蔽不同数据库驱动的差异，需要行锁或主节点锁的代码都通过它实现
+type Dialect interface {
+	// Open 按配置连接数据库
+	Open(cfg config.DatabaseConfig) (*gorm.DB, error)
+	// ForUpdate 为查询加行锁，事务结束前其他事务不能修改查到的行
+	ForUpdate(tx *gorm.DB) *gorm.DB
+	// TryLock 在 conn 上尝试获取跨进程的互斥锁，拿不到时立即返回 false
+	TryLock(ctx context.Context, conn *sql.Conn, key int64) (bool, error)
+	// Unlock 释放 TryLock 获取的锁
+	Unlock(ctx context.Context, conn *sql.Conn, key int64) error
+	// Migrate 在一个事务中执行结构迁移，fn 返回错误时整体回滚
+	Migrate(db *gorm.DB, fn func(tx *gorm.DB) error) error
+}
+
+var dialect Dialect = postgresDialect{}
+
+// GetDialect 当前数据库驱动对应的方言
+func GetDialect() Dialect {
+	return dialect
+}
+
+// ForUpdate 为查询加行锁，等同于 GetDialect().ForUpdate(tx)
+func ForUpdate(tx *gorm.DB) *gorm.DB {
+	return dialect.ForUpdate(tx)
+}
+
+func dialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case config.DriverPostgres, "":
+		return postgresDialect{}, nil
+	case config.DriverSQLite:
+		return sqliteDialect{}, nil
+	}
+	return nil, fmt.Errorf("不支持的数据库驱动：%s", driver)
+}
+
+// postgresDialect 生产环境使用，行锁为 SELECT ... FOR UPDATE，主节点锁为 advisory lock
+type postgresDialect struct{}
+
+func (postgresDialect) Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(cfg.DSN()))
+}
+
+func (postgresDialect) ForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+func (postgresDialect) TryLock(ctx context.Context, conn *sql.Conn, key int64) (bool, error) {
+	var locked bool
+	err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked)
+	return locked, err
+}
+
+func (postgresDialect) Unlock(ctx context.Context, conn *sql.Conn, key int64) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key)
+	return err
+}
+
+// Migrate PostgreSQL 的 DDL 支持事务，直接在事务中执行
+func (postgresDialect) Migrate(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(fn)
+}
+
+// sqliteDialect 本地开发和测试使用，只支持单实例
+// SQLite 没有行锁，连接以 _txlock=immediate 打开，事务开始时就拿到整个库的写锁，事务之间串行执行
+type sqliteDialect struct{}
+
+func (sqliteDialect) Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据库目录失败：%v", err)
+	}
+	// 写锁被占用时最多等待 5 秒；WAL 模式下读不会被写事务阻塞
+	dsn := cfg.Path + "?_busy_timeout=5000&_txlock=immediate&_journal_mode=WAL&_foreign_keys=1"
+	return gorm.Open(sqlite.Open(dsn))
+}
+
+func (sqliteDialect) ForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx
+}
+
+// TryLock SQLite 只用于单实例部署，当前进程总是主节点
+func (sqliteDialect) TryLock(ctx context.Context, conn *sql.Conn, key int64) (bool, error) {
+	return true, nil
+}
+
+func (sqliteDialect) Unlock(ctx context.Context, conn *sql.Conn, key int64) error {
+	return nil
+}
+
+// Migrate SQLite 不能直接增删约束，gorm 会重建整张表（新建、复制、删除旧表、改名）
+// 外键检查打开时删除旧表会触发级联，所以迁移期间在同一连接上关闭外键检查，提交前用 foreign_key_check 确认数据仍然满足外键
+// PRAGMA foreign_keys 在事务中不生效，必须在事务开始前设置
+func (sqliteDialect) Migrate(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("PRAGMA foreign_keys = ON")
+		return conn.Transaction(func(tx *gorm.DB) error {
+			if err := fn(tx); err != nil {
+				return err
+			}
+			var violations []struct {
+				Table  string
+				Parent string
+			}
+			if err := tx.Raw("PRAGMA foreign_key_check").Scan(&violations).Error; err != nil {
+				return err
+			}
+			if len(violations) > 0 {
+				return fmt.Errorf("有 %d 条记录违反外键约束，例如表 %s 引用了 %s 中不存在的数据", len(violations), violations[0].Table, violations[0].Parent)
+			}
+			return nil
+		})
+	})
+}
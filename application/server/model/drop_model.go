@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// —— 创作者发售（Drop）——
+// 一个 Drop 包含若干挂牌：StartTime ~ PublicTime 为白名单预售期，PublicTime ~ EndTime 为公开发售期
+type Drop struct {
+	ID           int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	CreatorID    int       `json:"creatorId" gorm:"not null;index"`
+	Title        string    `json:"title" gorm:"type:varchar(200);not null"`
+	StartTime    time.Time `json:"startTime" gorm:"not null"`    // 预售开始
+	PublicTime   time.Time `json:"publicTime" gorm:"not null"`   // 预售结束、公开发售开始
+	EndTime      time.Time `json:"endTime" gorm:"not null"`      // 发售结束
+	PresalePrice int64     `json:"presalePrice" gorm:"not null"` // 预售价，公开发售按挂牌价
+	PerWalletCap int       `json:"perWalletCap" gorm:"not null"` // 每个钱包最多购买数量，0 表示不限
+	CreateTime   time.Time `json:"createTime" gorm:"autoCreateTime"`
+	UpdateTime   time.Time `json:"updateTime" gorm:"autoUpdateTime"`
+}
+
+func (Drop) TableName() string { return "drops" }
+
+// 预售白名单
+type DropAllowlist struct {
+	ID         int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	DropID     int       `json:"dropId" gorm:"not null;uniqueIndex:idx_drop_user"`
+	UserID     int       `json:"userId" gorm:"not null;uniqueIndex:idx_drop_user"`
+	CreateTime time.Time `json:"createTime" gorm:"autoCreateTime"`
+}
+
+func (DropAllowlist) TableName() string { return "drop_allowlists" }
+
+type CreateDropRequest struct {
+	Title        string    `json:"title" binding:"required"`
+	StartTime    time.Time `json:"startTime" binding:"required"`
+	PublicTime   time.Time `json:"publicTime" binding:"required"`
+	EndTime      time.Time `json:"endTime" binding:"required"`
+	PresalePrice int64     `json:"presalePrice" binding:"required"`
+	PerWalletCap int       `json:"perWalletCap"`
+	ListingIDs   []int     `json:"listingIds" binding:"required"`
+	Allowlist    []int     `json:"allowlist"`
+}
+
+type DropAllowlistRequest struct {
+	UserIDs []int `json:"userIds" binding:"required"`
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// EmailVerifyPurpose 邮箱验证令牌的用途，与访问令牌共用签名密钥，靠用途区分
+const EmailVerifyPurpose = "email-verify"
+
+// EmailClaims 邮箱验证令牌的声明，绑定验证时的邮箱，修改邮箱后旧链接失效
+type EmailClaims struct {
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// PasswordResetToken 密码重置令牌，只能使用一次
+type PasswordResetToken struct {
+	ID         int        `json:"id" gorm:"primaryKey;autoIncrement"`
+	Token      string     `json:"-" gorm:"uniqueIndex;type:varchar(64);not null"` // 令牌的 SHA-256，不保存明文
+	UserID     int        `json:"userId" gorm:"not null;index"`
+	ExpiresAt  time.Time  `json:"expiresAt" gorm:"not null;index"`
+	UsedAt     *time.Time `json:"usedAt"` // 使用时间，申请新的重置链接时未使用的旧令牌也会被标记
+	CreateTime time.Time  `json:"createTime" gorm:"autoCreateTime"`
+}
+
+func (PasswordResetToken) TableName() string { return "password_reset_tokens" }
+
+// VerifyEmailRequest 验证邮箱请求
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordRequest 申请重置密码
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest 重置密码
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
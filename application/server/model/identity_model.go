@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// FabricIdentity 用户在 Fabric CA 登记的链上身份，私钥用 fabric.walletKey 加密保存
+type FabricIdentity struct {
+	UserID         int       `json:"userId" gorm:"primaryKey;autoIncrement:false"`
+	OrgName        string    `json:"orgName" gorm:"type:varchar(16);not null"`
+	MSPID          string    `json:"mspId" gorm:"column:msp_id;type:varchar(64);not null"`
+	EnrollmentID   string    `json:"enrollmentId" gorm:"type:varchar(128);not null;uniqueIndex"`
+	CertificatePEM string    `json:"certificatePem" gorm:"type:text;not null"`
+	PrivateKey     string    `json:"-" gorm:"type:text;not null"` // AES-256-GCM 密文（base64）
+	CreateTime     time.Time `json:"createTime" gorm:"autoCreateTime"`
+}
+
+func (FabricIdentity) TableName() string { return "fabric_identities" }
+
+// ServiceIdentity 组织的服务身份，证书带有 role=service 属性，用于提交铸币、释放和退还预扣款等平台交易
+// 每个组织一个，首次使用时登记，私钥用 fabric.walletKey 加密保存
+type ServiceIdentity struct {
+	OrgName        string    `json:"orgName" gorm:"primaryKey;type:varchar(16)"`
+	MSPID          string    `json:"mspId" gorm:"column:msp_id;type:varchar(64);not null"`
+	EnrollmentID   string    `json:"enrollmentId" gorm:"type:varchar(128);not null;uniqueIndex"`
+	CertificatePEM string    `json:"certificatePem" gorm:"type:text;not null"`
+	PrivateKey     string    `json:"-" gorm:"type:text;not null"` // AES-256-GCM 密文（base64）
+	CreateTime     time.Time `json:"createTime" gorm:"autoCreateTime"`
+}
+
+func (ServiceIdentity) TableName() string { return "fabric_service_identities" }
@@ -2,7 +2,7 @@ package model
 
 import ()
 
+// 图片上传目录见 config.StorageConfig.ImageDir
 const (
-	DefaultImageFolder = "public/images"
-	DefaultImageName   = "default.png"
+	DefaultImageName = "default.png"
 )
@@ -26,6 +26,12 @@ type MarketListing struct {
 	ReservePrice  *int64 `json:"reservePrice"` // 低于此价不能成交（可选）
 	BuyNowPrice   *int64 `json:"buyNowPrice"`  // 一口价（可选）
 	WinnerOfferID *int   `json:"winnerOfferId" gorm:"index"`
+	// 限量版挂牌：指向系列中的某一个编号（普通 NFT 为空）
+	SeriesID      string `json:"seriesId,omitempty" gorm:"type:varchar(128);index"`
+	EditionNumber int    `json:"editionNumber,omitempty"`
+	EditionSupply int    `json:"editionSupply,omitempty"`
+	// 所属发售（Drop），为空表示普通挂牌
+	DropID *int `json:"dropId,omitempty" gorm:"index"`
 }
 
 func (MarketListing) TableName() string { return "market_listings" }
@@ -39,9 +45,9 @@ const (
 
 type MarketOffer struct {
 	ID         int       `json:"id" gorm:"primaryKey;autoIncrement"`
-	ListingID  uint      `json:"listingId" gorm:"not null;index"`
+	ListingID  int       `json:"listingId" gorm:"not null;index"`
 	BidderID   int       `json:"bidderId" gorm:"not null"`
-	BidderOrg  int32     `json:"sellerOrg" gorm:"not null;default:2"`
+	BidderOrg  int32     `json:"bidderOrg" gorm:"not null;default:2"`
 	OfferPrice int64     `json:"offerPrice" gorm:"not null"`
 	Status     string    `json:"status" gorm:"type:varchar(16);not null;index"` // PENDING/ACCEPTED/REJECTED
 	CreateTime time.Time `json:"createTime" gorm:"autoCreateTime"`
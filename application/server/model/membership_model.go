@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+// OrgApplication 用户申请加入其他组织，由目标组织的管理员审核，通过后修改 User.Org
+type OrgApplication struct {
+	ID            int        `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID        int        `json:"userId" gorm:"not null;index"`
+	FromOrg       int        `json:"fromOrg" gorm:"not null"`                       // 申请时所在的组织
+	TargetOrg     int        `json:"targetOrg" gorm:"not null;index"`               // 申请加入的组织
+	Reason        string     `json:"reason" gorm:"type:text;not null"`              // 申请说明
+	Status        string     `json:"status" gorm:"type:varchar(16);not null;index"` // 见下方申请状态
+	ReviewerID    *int       `json:"reviewerId,omitempty"`                          // 审核人，撤回时为申请人
+	ReviewComment string     `json:"reviewComment" gorm:"type:text"`                // 审核意见
+	ReviewTime    *time.Time `json:"reviewTime,omitempty"`
+	CreateTime    time.Time  `json:"createTime" gorm:"autoCreateTime"`
+}
+
+func (OrgApplication) TableName() string { return "org_applications" }
+
+// —— 组织申请状态 ——
+const (
+	OrgApplicationPending   = "PENDING"   // 待审核，每个用户同时只能有一个
+	OrgApplicationApproved  = "APPROVED"  // 已通过，用户已加入目标组织
+	OrgApplicationRejected  = "REJECTED"  // 已拒绝
+	OrgApplicationCancelled = "CANCELLED" // 申请人撤回
+)
+
+// OrgChangeEvent 组织变更审计记录，申请的提交、审核、撤回以及管理员直接修改组织都会记录
+type OrgChangeEvent struct {
+	ID            int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID        int       `json:"userId" gorm:"not null;index"`            // 被变更组织的用户
+	ApplicationID *int      `json:"applicationId,omitempty" gorm:"index"`    // 管理员直接修改时为空
+	ActorID       int       `json:"actorId" gorm:"not null"`                 // 操作人
+	Action        string    `json:"action" gorm:"type:varchar(16);not null"` // 见下方操作类型
+	FromOrg       int       `json:"fromOrg" gorm:"not null"`
+	ToOrg         int       `json:"toOrg" gorm:"not null"`
+	Comment       string    `json:"comment" gorm:"type:text"`
+	CreateTime    time.Time `json:"createTime" gorm:"autoCreateTime;index"`
+}
+
+func (OrgChangeEvent) TableName() string { return "org_change_events" }
+
+// —— 组织变更操作类型 ——
+const (
+	OrgEventSubmit   = "SUBMIT"    // 提交申请
+	OrgEventApprove  = "APPROVE"   // 审核通过
+	OrgEventReject   = "REJECT"    // 审核拒绝
+	OrgEventCancel   = "CANCEL"    // 申请人撤回
+	OrgEventAdminSet = "ADMIN_SET" // 管理员直接修改
+)
+
+// OrgApplicationRequest 提交组织申请
+type OrgApplicationRequest struct {
+	TargetOrg int    `json:"targetOrg"`
+	Reason    string `json:"reason"`
+}
+
+// OrgReviewRequest 审核组织申请
+type OrgReviewRequest struct {
+	Approve bool   `json:"approve"`
+	Comment string `json:"comment"`
+}
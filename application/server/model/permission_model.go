@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+// Permission 接口权限，路由注册时通过 RequirePermission 声明
+type Permission string
+
+const (
+	PermAccountManageOrg   Permission = "account:manage-org"   // 修改用户所属组织
+	PermAccountManageRoles Permission = "account:manage-roles" // 授予和撤销用户角色
+	PermMembershipReview   Permission = "membership:review"    // 审核加入本组织的申请
+	PermAssetCreate        Permission = "asset:create"         // 上传 NFT、创建限量版
+	PermVoucherCreate      Permission = "voucher:create"       // 创建铸造凭证
+	PermDropCreate         Permission = "drop:create"          // 创建发售
+	PermWalletMint         Permission = "wallet:mint"          // 铸币
+	PermAuditManage        Permission = "audit:manage"         // 执行和查看账本审计
+	PermReconcileManage    Permission = "reconcile:manage"     // 执行和查看对账
+	PermBlocksVerify       Permission = "blocks:verify"        // 区块哈希链校验
+	PermWorkflowManage     Permission = "workflow:manage"      // 查看和重试结算流程
+	PermProjectionManage   Permission = "projection:manage"    // 查看和重建读模型
+)
+
+// OrgPermissions 各组织成员默认拥有的权限
+// 与链码身份绑定的操作（上传 NFT、铸币等）只能按组织授予，链码会再次校验调用方组织
+var OrgPermissions = map[int][]Permission{
+	1: {PermAccountManageOrg, PermAccountManageRoles, PermMembershipReview, PermAuditManage, PermReconcileManage,
+		PermBlocksVerify, PermWorkflowManage, PermProjectionManage},
+	2: {PermAssetCreate, PermVoucherCreate, PermDropCreate},
+	3: {PermWalletMint},
+}
+
+// 用户角色，在组织权限之外单独授予
+const (
+	RoleAuditor  = "auditor"   // 审计员：审计、对账和区块校验
+	RoleOperator = "operator"  // 运维：结算流程和读模型
+	RoleOrgAdmin = "org-admin" // 组织管理员：审核加入本组织的申请
+)
+
+// RolePermissions 各角色附加的权限
+var RolePermissions = map[string][]Permission{
+	RoleAuditor:  {PermAuditManage, PermReconcileManage, PermBlocksVerify},
+	RoleOperator: {PermWorkflowManage, PermProjectionManage},
+	RoleOrgAdmin: {PermMembershipReview},
+}
+
+// UserRole 授予用户的角色
+type UserRole struct {
+	ID         int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID     int       `json:"userId" gorm:"not null;uniqueIndex:idx_user_roles_user_role"`
+	Role       string    `json:"role" gorm:"type:varchar(32);not null;uniqueIndex:idx_user_roles_user_role"`
+	GrantedBy  int       `json:"grantedBy" gorm:"not null"`
+	CreateTime time.Time `json:"createTime" gorm:"autoCreateTime"`
+}
+
+func (UserRole) TableName() string { return "user_roles" }
+
+type UserRoleRequest struct {
+	UserID int    `json:"userId"`
+	Role   string `json:"role"`
+}
@@ -0,0 +1,103 @@
+package model
+
+import "time"
+
+// 读模型检查点名称
+const ProjectionLedger = "ledger"
+
+// ProjectionCheckpoint 读模型同步进度
+// Generation 在每次全量重建时加一，正在同步的实例发现代数变化后从新检查点重新开始
+type ProjectionCheckpoint struct {
+	Name       string    `json:"name" gorm:"primaryKey;type:varchar(32)"`
+	NextBlock  uint64    `json:"nextBlock" gorm:"not null"`  // 下一个待处理的区块号
+	Generation int       `json:"generation" gorm:"not null"` // 重建代数
+	UpdateTime time.Time `json:"updateTime" gorm:"autoUpdateTime"`
+}
+
+func (ProjectionCheckpoint) TableName() string { return "projection_checkpoints" }
+
+// LedgerAsset 链上 NFT 的读模型（来自 asset1 键的写入）
+type LedgerAsset struct {
+	ID            string `gorm:"primaryKey;type:varchar(128)"`
+	Name          string `gorm:"type:varchar(255)"`
+	ImageName     string `gorm:"type:varchar(255)"`
+	AuthorId      int    `gorm:"index"`
+	OwnerId       int    `gorm:"index"`
+	Description   string `gorm:"type:text"`
+	ImageHash     string `gorm:"type:varchar(128)"`
+	SeriesID      string `gorm:"type:varchar(128);index"`
+	EditionNumber int
+	EditionSupply int
+	TimeStamp     time.Time
+	BlockNum      uint64 `gorm:"not null"` // 最后一次写入所在的区块
+}
+
+func (LedgerAsset) TableName() string { return "ledger_assets" }
+
+func (a LedgerAsset) ToAsset() Asset {
+	return Asset{
+		ID:            a.ID,
+		Name:          a.Name,
+		ImageName:     a.ImageName,
+		AuthorId:      a.AuthorId,
+		OwnerId:       a.OwnerId,
+		Description:   a.Description,
+		ImageHash:     a.ImageHash,
+		SeriesID:      a.SeriesID,
+		EditionNumber: a.EditionNumber,
+		EditionSupply: a.EditionSupply,
+		TimeStamp:     a.TimeStamp,
+	}
+}
+
+// LedgerAccount 链上钱包余额的读模型（来自 account 键的写入）
+type LedgerAccount struct {
+	ID       int    `gorm:"primaryKey;autoIncrement:false"`
+	Balance  int    `gorm:"not null"`
+	BlockNum uint64 `gorm:"not null"`
+}
+
+func (LedgerAccount) TableName() string { return "ledger_accounts" }
+
+// LedgerTransfer 链上转账记录的读模型（来自 sender 键的写入）
+type LedgerTransfer struct {
+	ID          string `gorm:"primaryKey;type:varchar(128)"`
+	SenderID    int    `gorm:"index"`
+	RecipientID int    `gorm:"index"`
+	Amount      int    `gorm:"not null"`
+	TimeStamp   time.Time
+	BlockNum    uint64 `gorm:"not null"`
+}
+
+func (LedgerTransfer) TableName() string { return "ledger_transfers" }
+
+func (t LedgerTransfer) ToTransfer() Transfer {
+	return Transfer{ID: t.ID, SenderID: t.SenderID, RecipientID: t.RecipientID, Amount: t.Amount, TimeStamp: t.TimeStamp}
+}
+
+// LedgerWithHolding 链上预扣款的读模型（来自 withHolding1 键的写入，链上删除时同步删除）
+type LedgerWithHolding struct {
+	ID        string `gorm:"primaryKey;type:varchar(128)"`
+	AccountID int    `gorm:"index"`
+	ListingID string `gorm:"type:varchar(128);index"`
+	Amount    int    `gorm:"not null"`
+	TimeStamp time.Time
+	BlockNum  uint64 `gorm:"not null"`
+}
+
+func (LedgerWithHolding) TableName() string { return "ledger_withholdings" }
+
+func (w LedgerWithHolding) ToWithHolding() WithHolding {
+	return WithHolding{ID: w.ID, AccountID: w.AccountID, ListingID: w.ListingID, Amount: w.Amount, TimeStamp: w.TimeStamp}
+}
+
+// ProjectionStatus 读模型同步状态
+type ProjectionStatus struct {
+	Enabled     bool      `json:"enabled"`
+	NextBlock   uint64    `json:"nextBlock"`
+	Generation  int       `json:"generation"`
+	ChainHeight uint64    `json:"chainHeight"` // 区块监听器看到的通道高度（最新区块号 + 1）
+	Lag         uint64    `json:"lag"`         // 落后的区块数
+	Ready       bool      `json:"ready"`       // 落后不超过 maxLag，查询可以使用读模型
+	UpdateTime  time.Time `json:"updateTime"`
+}
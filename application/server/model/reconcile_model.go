@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// —— 对账问题类型 ——
+const (
+	ReconcileHoldMissing  = "OFFER_HOLD_MISSING"     // 数据库中的出价显示已冻结，但链上没有对应的预扣款
+	ReconcileHoldOrphan   = "ORPHAN_HOLD"            // 链上有预扣款，但数据库中没有对应的待处理出价
+	ReconcileHoldMismatch = "HOLD_MISMATCH"          // 预扣款的账户或金额与出价不一致
+	ReconcileBidMissing   = "BID_HOLD_MISSING"       // 拍卖出价显示已冻结，但链上该出价人在拍品下没有预扣款
+	ReconcileBidMismatch  = "BID_HOLD_MISMATCH"      // 出价人在拍品下的冻结总额与出价不一致
+	ReconcileListingOwner = "LISTING_OWNER_MISMATCH" // 已成交挂牌的买家不是链上 NFT 持有人
+	ReconcileAuctionOwner = "AUCTION_OWNER_MISMATCH" // 拍卖赢家不是链上 NFT 持有人
+)
+
+// —— 对账触发方式 ——
+const (
+	ReconcileManual   = "MANUAL"   // 管理员手动触发
+	ReconcileSchedule = "SCHEDULE" // 定时任务触发
+)
+
+// ReconcileIssue 数据库与账本不一致的单条记录
+type ReconcileIssue struct {
+	Type        string `json:"type"`
+	ListingID   int    `json:"listingId,omitempty"`
+	OfferID     int    `json:"offerId,omitempty"`
+	LotID       int    `json:"lotId,omitempty"`
+	AssetID     string `json:"assetId,omitempty"`
+	HoldID      string `json:"holdId,omitempty"`
+	Detail      string `json:"detail"`
+	Repaired    bool   `json:"repaired"`              // 是否已自动修复
+	RepairError string `json:"repairError,omitempty"` // 自动修复失败的原因
+}
+
+// ReconcileRun 一次对账的记录
+type ReconcileRun struct {
+	ID            int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Trigger       string    `json:"trigger" gorm:"type:varchar(16);not null"` // MANUAL/SCHEDULE
+	TriggeredBy   int       `json:"triggeredBy"`                              // 手动触发的管理员 ID
+	AutoRepair    bool      `json:"autoRepair" gorm:"not null"`               // 是否开启自动修复
+	IssueCount    int       `json:"issueCount" gorm:"not null"`
+	RepairedCount int       `json:"repairedCount" gorm:"not null"`
+	Issues        string    `json:"issues" gorm:"type:text"`          // 问题列表（JSON）
+	Error         string    `json:"error,omitempty" gorm:"type:text"` // 对账过程中的错误（部分检查未完成）
+	CreateTime    time.Time `json:"createTime" gorm:"autoCreateTime;index"`
+}
+
+func (ReconcileRun) TableName() string { return "reconcile_runs" }
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TwoFactorLoginPurpose 两步验证登录挑战令牌的用途，与访问令牌共用签名密钥，靠用途区分
+const TwoFactorLoginPurpose = "2fa-login"
+
+// TwoFactor 用户的 TOTP 密钥，EnabledAt 为空表示已生成密钥但还没有用验证码确认
+type TwoFactor struct {
+	UserID         int        `json:"userId" gorm:"primaryKey;autoIncrement:false"`
+	Secret         string     `json:"-" gorm:"type:varchar(255);not null"` // AES-GCM 加密的 base32 密钥
+	EnabledAt      *time.Time `json:"enabledAt"`
+	LastStep       int64      `json:"-" gorm:"not null;default:0"` // 最近一次通过的时间步，不晚于它的验证码不再接受
+	FailedAttempts int        `json:"-" gorm:"not null;default:0"` // 连续输错的次数
+	LockedUntil    *time.Time `json:"-"`                           // 连续输错过多后锁定到该时间
+	CreateTime     time.Time  `json:"createTime" gorm:"autoCreateTime"`
+	UpdateTime     time.Time  `json:"updateTime" gorm:"autoUpdateTime"`
+}
+
+func (TwoFactor) TableName() string { return "two_factors" }
+
+// RecoveryCode 恢复码，丢失身份验证器时代替验证码使用，每个只能用一次
+type RecoveryCode struct {
+	ID         int        `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID     int        `json:"userId" gorm:"not null;index"`
+	CodeHash   string     `json:"-" gorm:"type:varchar(64);not null"` // 恢复码的 SHA-256，不保存明文
+	UsedAt     *time.Time `json:"usedAt"`
+	CreateTime time.Time  `json:"createTime" gorm:"autoCreateTime"`
+}
+
+func (RecoveryCode) TableName() string { return "recovery_codes" }
+
+// TwoFactorClaims 密码验证通过后签发的挑战令牌，只能用来提交验证码完成登录
+type TwoFactorClaims struct {
+	UserID  int    `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// TwoFactorChallenge 开启了两步验证的用户登录时返回，代替令牌
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"twoFactorRequired"`
+	ChallengeToken    string    `json:"challengeToken"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+// TwoFactorStatus 两步验证状态
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabledAt"`
+	RecoveryCodesLeft int        `json:"recoveryCodesLeft"` // 未使用的恢复码数量
+	StepUpExpiresAt   *time.Time `json:"stepUpExpiresAt"`   // 当前会话的二次验证有效期，为空表示需要重新验证
+}
+
+// TwoFactorSetup 开始开启两步验证时返回的密钥，确认之前不生效
+type TwoFactorSetup struct {
+	Secret string `json:"secret"` // 无法扫码时手动输入
+	URI    string `json:"uri"`    // otpauth:// 地址，渲染为二维码供身份验证器扫描
+}
+
+// TwoFactorCodeRequest 提交验证码，code 也可以是恢复码
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorLoginRequest 登录第二步
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+// TwoFactorDisableRequest 关闭两步验证，需要密码和验证码
+type TwoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
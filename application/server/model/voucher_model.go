@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// —— 凭证状态常量 ——
+const (
+	VoucherOpen      = "OPEN"      // 可兑换
+	VoucherPending   = "PENDING"   // 正在链上兑换或撤回
+	VoucherRedeemed  = "REDEEMED"  // 已兑换（已上链铸造）
+	VoucherCancelled = "CANCELLED" // 创作者已撤回
+)
+
+// —— 铸造凭证（Lazy Mint）——
+// 创作者签名后挂到市场，只有买家兑换时才会在链上铸造 NFT 并付款
+type MintVoucher struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	CreatorID   int       `json:"creatorId" gorm:"not null;index"`
+	Name        string    `json:"name" gorm:"type:varchar(200);not null"`
+	Description string    `json:"description" gorm:"type:text"`
+	ImageName   string    `json:"imageName" gorm:"type:varchar(255);not null"`
+	ImageHash   string    `json:"imageHash" gorm:"type:varchar(64);not null"`
+	Price       int64     `json:"price" gorm:"not null"`
+	Signature   string    `json:"signature" gorm:"type:text;not null"`
+	Status      string    `json:"status" gorm:"type:varchar(16);not null;index"` // OPEN/PENDING/REDEEMED/CANCELLED
+	RedeemerID  *int      `json:"redeemerId"`
+	AssetID     *string   `json:"assetId"`
+	CreateTime  time.Time `json:"createTime" gorm:"autoCreateTime"`
+	UpdateTime  time.Time `json:"updateTime" gorm:"autoUpdateTime"`
+}
+
+func (MintVoucher) TableName() string { return "mint_vouchers" }
+
+// 创作者的凭证签名密钥，公钥会同时登记到链上，私钥用 fabric.walletKey 加密保存
+type SignerKey struct {
+	UserID       int       `json:"userId" gorm:"primaryKey"`
+	PrivateKey   string    `json:"-" gorm:"type:text;not null"` // AES-256-GCM 密文（base64）
+	PublicKeyPEM string    `json:"publicKeyPEM" gorm:"type:text;not null"`
+	CreateTime   time.Time `json:"createTime" gorm:"autoCreateTime"`
+}
+
+func (SignerKey) TableName() string { return "signer_keys" }
@@ -0,0 +1,68 @@
+package model
+
+import "time"
+
+// —— 结算流程类型 ——
+const (
+	WorkflowAcceptOffer = "ACCEPT_OFFER" // 卖家接受出价
+	WorkflowBuyNow      = "BUY_NOW"      // 一口价购买
+)
+
+// —— 结算流程状态 ——
+const (
+	WorkflowRunning     = "RUNNING"     // 执行中（含等待重试），方向见 Compensating
+	WorkflowCompleted   = "COMPLETED"   // 全部步骤成功
+	WorkflowCompensated = "COMPENSATED" // 补偿完成，业务失败但链上和数据库状态一致
+	WorkflowFailed      = "FAILED"      // 重试次数耗尽，需要管理员处理
+)
+
+// 未结束的流程状态，这些流程占用挂牌，挂牌上不能再发起出价、撤回或新的结算
+var WorkflowActiveStatuses = []string{WorkflowRunning, WorkflowFailed}
+
+// —— 步骤状态 ——
+const (
+	StepPending     = "PENDING"     // 未执行或结果未知（执行到一半崩溃）
+	StepDone        = "DONE"        // 已成功
+	StepCompensated = "COMPENSATED" // 已补偿
+)
+
+// Workflow 多步链上结算流程（Saga），每一步的意图和结果都持久化，崩溃重启后可以继续执行
+type Workflow struct {
+	ID           int            `json:"id" gorm:"primaryKey;autoIncrement"`
+	Type         string         `json:"type" gorm:"type:varchar(32);not null"`
+	Status       string         `json:"status" gorm:"type:varchar(16);not null;index"`
+	ListingID    int            `json:"listingId" gorm:"not null;index"`            // 结算的挂牌
+	UserID       int            `json:"userId" gorm:"not null;index"`               // 发起人：接受出价的卖家或一口价的买家
+	Compensating bool           `json:"compensating" gorm:"not null;default:false"` // 是否已转入补偿（回滚已完成的链上步骤）
+	Attempts     int            `json:"attempts" gorm:"not null;default:0"`
+	LastError    string         `json:"lastError,omitempty" gorm:"type:text"`
+	NextRunAt    time.Time      `json:"nextRunAt" gorm:"index"`                        // 下次重试时间
+	LeaseUntil   *time.Time     `json:"leaseUntil,omitempty"`                          // 执行租约，防止多个协程同时推进同一流程
+	LeaseOwner   string         `json:"-" gorm:"type:varchar(64);not null;default:''"` // 持有租约的执行者，续约和释放时校验
+	CreateTime   time.Time      `json:"createTime" gorm:"autoCreateTime"`
+	UpdateTime   time.Time      `json:"updateTime" gorm:"autoUpdateTime"`
+	Steps        []WorkflowStep `json:"steps,omitempty" gorm:"foreignKey:WorkflowID"`
+}
+
+func (Workflow) TableName() string { return "workflows" }
+
+// WorkflowStep 流程中的一步，创建流程时一次性写入全部步骤（outbox），执行时只更新状态和结果
+type WorkflowStep struct {
+	ID         int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	WorkflowID int       `json:"workflowId" gorm:"not null;uniqueIndex:idx_workflow_step"`
+	Seq        int       `json:"seq" gorm:"not null;uniqueIndex:idx_workflow_step"`
+	Name       string    `json:"name" gorm:"type:varchar(32);not null"`
+	TxID       string    `json:"txId" gorm:"type:varchar(64);not null"` // 预先生成的链上幂等 ID，重试时复用
+	OfferID    int       `json:"offerId,omitempty"`                     // 相关出价
+	AssetID    string    `json:"assetId,omitempty" gorm:"type:varchar(128)"`
+	FromID     int       `json:"fromId,omitempty"` // 付款方/原持有人
+	ToID       int       `json:"toId,omitempty"`   // 收款方/新持有人
+	Amount     int64     `json:"amount,omitempty"`
+	Status     string    `json:"status" gorm:"type:varchar(16);not null"`
+	Attempts   int       `json:"attempts" gorm:"not null;default:0"`
+	LastError  string    `json:"lastError,omitempty" gorm:"type:text"`
+	CreateTime time.Time `json:"createTime" gorm:"autoCreateTime"`
+	UpdateTime time.Time `json:"updateTime" gorm:"autoUpdateTime"`
+}
+
+func (WorkflowStep) TableName() string { return "workflow_steps" }
@@ -5,10 +5,14 @@ import (
 	"crypto/sha256"
 	"encoding/asn1"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,8 +24,12 @@ import (
 const (
 	_BlocksBucket = "blocks"        // 存储区块数据
 	_LatestBucket = "latest_blocks" // 存储最新区块信息
+	_HashBucket   = "block_hashes"  // 区块哈希索引：通道或组织_哈希 -> 区块号
+	_TxBucket     = "transactions"  // 存储交易数据：交易 ID -> 交易
+	_TxRefBucket  = "tx_refs"       // 业务 ID 索引：转账 ID、冻结 ID 等 -> 交易 ID
 
-	_RetryInterval = 30 * time.Second // 重试间隔时间
+	_MinRetryInterval = time.Second      // 所有组织的节点都连接失败后的首次等待时间
+	_MaxRetryInterval = 30 * time.Second // 最大等待时间
 )
 
 // BlockData 区块数据结构
@@ -31,6 +39,7 @@ type BlockData struct {
 	DataHash  string    `json:"data_hash"`
 	PrevHash  string    `json:"prev_hash"`
 	TxCount   int       `json:"tx_count"`
+	TxIDs     []string  `json:"tx_ids,omitempty"` // 区块中的交易 ID，按区块内顺序
 	SaveTime  time.Time `json:"save_time"`
 }
 
@@ -41,13 +50,18 @@ type LatestBlock struct {
 }
 
 // blockEventListener 区块事件监听器
+// 所有组织在同一个通道上，监听器按通道保存区块，同一时间只保持一个区块流，
+// 当前节点断开时切换到下一个组织的节点。早期按组织保存的数据（键前缀 org_N）仍然可以查询
 type blockEventListener struct {
-	sync.RWMutex // 读写锁，即允许多个goroutine同时读取，但写入时需要独占
-	networks     map[string]*client.Network
+	sync.RWMutex                            // 读写锁，即允许多个goroutine同时读取，但写入时需要独占
+	channel      string                     // 通道名，也是区块数据的键前缀
+	networks     map[string]*client.Network // 各组织的网络连接，用于故障切换
+	orgOrder     []string                   // 故障切换顺序
 	ctx          context.Context
 	cancel       context.CancelFunc
 	dataDir      string
 	db           *bolt.DB
+	refetching   map[string]bool // 正在重新拉取区块的组织
 }
 
 var (
@@ -61,7 +75,7 @@ func GetBlockListener() *blockEventListener {
 	return listener
 }
 
-func initBlockListener(dataDir string) error {
+func initBlockListener(dataDir string, channel string) error {
 	var initErr error
 	listenerOnce.Do(func() {
 		// 创建数据目录
@@ -86,6 +100,18 @@ func initBlockListener(dataDir string) error {
 			if _, err := tx.CreateBucketIfNotExists([]byte(_LatestBucket)); err != nil {
 				return fmt.Errorf("创建latest_blocks bucket失败: %w", err)
 			}
+			if _, err := tx.CreateBucketIfNotExists([]byte(_HashBucket)); err != nil {
+				return fmt.Errorf("创建block_hashes bucket失败: %w", err)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte(_TxBucket)); err != nil {
+				return fmt.Errorf("创建transactions bucket失败: %w", err)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte(_TxRefBucket)); err != nil {
+				return fmt.Errorf("创建tx_refs bucket失败: %w", err)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte(_VerifyBucket)); err != nil {
+				return fmt.Errorf("创建chain_verify bucket失败: %w", err)
+			}
 			return nil
 		}); err != nil {
 			db.Close()
@@ -95,18 +121,20 @@ func initBlockListener(dataDir string) error {
 
 		ctx, cancel := context.WithCancel(context.Background())
 		listener = &blockEventListener{
-			networks: make(map[string]*client.Network),
-			ctx:      ctx,
-			cancel:   cancel,
-			dataDir:  dataDir,
-			db:       db,
+			channel:    channel,
+			networks:   make(map[string]*client.Network),
+			refetching: make(map[string]bool),
+			ctx:        ctx,
+			cancel:     cancel,
+			dataDir:    dataDir,
+			db:         db,
 		}
 	})
 
 	return initErr
 }
 
-// addNetwork 添加网络
+// addNetwork 添加网络，作为通道区块流的候选节点
 func addNetwork(orgName string, network *client.Network) error {
 	if listener == nil {
 		return fmt.Errorf("区块监听器未初始化")
@@ -115,12 +143,129 @@ func addNetwork(orgName string, network *client.Network) error {
 	listener.Lock()
 	defer listener.Unlock()
 
+	if _, ok := listener.networks[orgName]; !ok {
+		listener.orgOrder = append(listener.orgOrder, orgName)
+		sort.Strings(listener.orgOrder)
+	}
 	listener.networks[orgName] = network
-	go listener.startBlockListener(orgName)
 
 	return nil
 }
 
+// startBlockListener 所有网络添加完成后启动通道区块监听
+func startBlockListener() error {
+	if listener == nil {
+		return fmt.Errorf("区块监听器未初始化")
+	}
+	if len(listener.orgOrder) == 0 {
+		return fmt.Errorf("没有可用于监听区块的网络")
+	}
+	if err := listener.migrateLegacyBlocks(); err != nil {
+		return fmt.Errorf("迁移按组织保存的区块数据失败：%w", err)
+	}
+	go listener.run()
+	return nil
+}
+
+// Channel 返回通道名，即通道级区块数据的查询键
+func (l *blockEventListener) Channel() string {
+	return l.channel
+}
+
+// LatestBlockNum 返回通道已保存的最新区块号
+func (l *blockEventListener) LatestBlockNum() (uint64, bool) {
+	return l.getLastBlockNum(l.channel)
+}
+
+// BlockStream 从 startBlock 开始订阅通道的完整区块，依次尝试各组织的节点，
+// 供需要写集等原始数据的消费者（如读模型）使用，ctx 取消时区块流关闭
+func BlockStream(ctx context.Context, startBlock uint64) (<-chan *common.Block, error) {
+	if listener == nil {
+		return nil, fmt.Errorf("区块监听器未初始化")
+	}
+	listener.RLock()
+	orgs := append([]string(nil), listener.orgOrder...)
+	networks := make([]*client.Network, 0, len(orgs))
+	for _, orgName := range orgs {
+		networks = append(networks, listener.networks[orgName])
+	}
+	listener.RUnlock()
+
+	var errs []error
+	for i, network := range networks {
+		events, err := network.BlockEvents(ctx, client.WithStartBlock(startBlock))
+		if err == nil {
+			return events, nil
+		}
+		errs = append(errs, fmt.Errorf("组织[%s]：%v", orgs[i], err))
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("没有可用于订阅区块的网络")
+	}
+	return nil, fmt.Errorf("创建区块事件请求失败：%w", errors.Join(errs...))
+}
+
+// migrateLegacyBlocks 首次切换到通道级存储时，从区块最多的组织复制已有数据，避免从 0 重新下载
+// 原有的 org_N 数据保留不动
+func (l *blockEventListener) migrateLegacyBlocks() error {
+	if _, exists := l.getLastBlockNum(l.channel); exists {
+		return nil
+	}
+
+	return l.db.Update(func(tx *bolt.Tx) error {
+		latestBucket := tx.Bucket([]byte(_LatestBucket))
+		source := ""
+		var sourceLatest LatestBlock
+		for _, orgName := range l.orgOrder {
+			data := latestBucket.Get([]byte(orgName))
+			if data == nil {
+				continue
+			}
+			var latest LatestBlock
+			if err := json.Unmarshal(data, &latest); err != nil {
+				return err
+			}
+			if source == "" || latest.BlockNum > sourceLatest.BlockNum {
+				source, sourceLatest = orgName, latest
+			}
+		}
+		if source == "" {
+			return nil
+		}
+
+		blocks := tx.Bucket([]byte(_BlocksBucket))
+		hashes := tx.Bucket([]byte(_HashBucket))
+		copied := 0
+		for num := uint64(0); num <= sourceLatest.BlockNum; num++ {
+			data := blocks.Get([]byte(fmt.Sprintf("%s_%d", source, num)))
+			if data == nil {
+				continue
+			}
+			var block BlockData
+			if err := json.Unmarshal(data, &block); err != nil {
+				return err
+			}
+			if err := blocks.Put([]byte(fmt.Sprintf("%s_%d", l.channel, num)), data); err != nil {
+				return err
+			}
+			hashKey := fmt.Sprintf("%s_%s", l.channel, block.BlockHash)
+			if err := hashes.Put([]byte(hashKey), []byte(strconv.FormatUint(num, 10))); err != nil {
+				return err
+			}
+			copied++
+		}
+		latestJSON, err := json.Marshal(sourceLatest)
+		if err != nil {
+			return err
+		}
+		if err := latestBucket.Put([]byte(l.channel), latestJSON); err != nil {
+			return err
+		}
+		fmt.Printf("已从组织[%s]迁移 %d 个区块到通道[%s]\n", source, copied, l.channel)
+		return nil
+	})
+}
+
 // getLastBlockNum 获取最后保存的区块号
 func (l *blockEventListener) getLastBlockNum(orgName string) (uint64, bool) {
 	var lastBlock LatestBlock
@@ -147,59 +292,75 @@ func (l *blockEventListener) getLastBlockNum(orgName string) (uint64, bool) {
 	return lastBlock.BlockNum, true
 }
 
-// startBlockListener 启动区块监听
-func (l *blockEventListener) startBlockListener(orgName string) {
-	retryCount := 0
-	network := l.networks[orgName]
-	if network == nil {
-		fmt.Printf("组织[%s]的网络未找到\n", orgName)
-		return
-	}
+// run 通道区块监听：同一时间只使用一个组织的节点，区块流中断后立即切换到下一个组织，
+// 所有组织都失败一轮后才按指数退避等待
+func (l *blockEventListener) run() {
+	failures := 0
+	idx := 0
 	for {
-		lastBlockNum, exists := l.getLastBlockNum(orgName)
-		var startBlock uint64
-		if !exists {
-			// 首次启动，从0开始
-			startBlock = 0
-		} else {
-			// 已有数据，从下一个开始
-			startBlock = lastBlockNum + 1
+		l.RLock()
+		orgName := l.orgOrder[idx%len(l.orgOrder)]
+		network := l.networks[orgName]
+		orgCount := len(l.orgOrder)
+		l.RUnlock()
+
+		received, err := l.consume(orgName, network)
+		if l.ctx.Err() != nil {
+			return
+		}
+		if received > 0 {
+			failures = 0
 		}
+		failures++
+		idx++
+		fmt.Printf("通道[%s]在组织[%s]节点上的区块监听中断：%v\n", l.channel, orgName, err)
 
-		events, err := network.BlockEvents(l.ctx, client.WithStartBlock(startBlock))
-		if err != nil {
-			retryCount++
-			fmt.Printf("创建区块事件请求失败（已重试%d次）：%v\n", retryCount, err)
-			select {
-			case <-l.ctx.Done():
-				return
-			case <-time.After(_RetryInterval):
-				continue
-			}
+		if failures%orgCount != 0 {
+			continue
+		}
+		delay := _MinRetryInterval
+		for i := 1; i < failures/orgCount && delay < _MaxRetryInterval; i++ {
+			delay *= 2
+		}
+		if delay > _MaxRetryInterval {
+			delay = _MaxRetryInterval
+		}
+		fmt.Printf("所有组织的节点均不可用（已连续失败%d次），%s 后重试\n", failures, delay)
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-time.After(delay):
 		}
+	}
+}
 
-		for {
-			select {
-			case <-l.ctx.Done():
-				return
-			case block, ok := <-events:
-				if !ok {
-					retryCount++
-					fmt.Printf("组织[%s]的区块事件监听中断（已重试%d次），准备重试...\n", orgName, retryCount)
-					select {
-					case <-l.ctx.Done():
-						return
-					case <-time.After(_RetryInterval):
-						break
-					}
-					goto RETRY
-				}
-				l.saveBlock(orgName, block)
+// consume 从检查点的下一个区块开始接收区块，直到区块流中断，返回本次收到的区块数
+func (l *blockEventListener) consume(orgName string, network *client.Network) (int, error) {
+	var startBlock uint64
+	if lastBlockNum, exists := l.getLastBlockNum(l.channel); exists {
+		startBlock = lastBlockNum + 1
+	}
+
+	ctx, cancel := context.WithCancel(l.ctx)
+	defer cancel()
+	events, err := network.BlockEvents(ctx, client.WithStartBlock(startBlock))
+	if err != nil {
+		return 0, fmt.Errorf("创建区块事件请求失败：%v", err)
+	}
+	fmt.Printf("通道[%s]使用组织[%s]的节点监听区块，从区块[%d]开始\n", l.channel, orgName, startBlock)
+
+	received := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return received, ctx.Err()
+		case block, ok := <-events:
+			if !ok {
+				return received, fmt.Errorf("区块事件流已关闭")
 			}
+			l.saveBlock(l.channel, block)
+			received++
 		}
-
-	RETRY:
-		continue
 	}
 }
 
@@ -228,6 +389,13 @@ func (l *blockEventListener) saveBlock(orgName string, block *common.Block) {
 	}
 	blockHash := sha256.Sum256(headerBytes)
 
+	// 解析区块中的交易
+	txs := decodeBlockTxs(block)
+	txIDs := make([]string, 0, len(txs))
+	for _, t := range txs {
+		txIDs = append(txIDs, t.TxID)
+	}
+
 	// 准备区块数据
 	blockData := BlockData{
 		BlockNum:  blockNum,
@@ -235,10 +403,12 @@ func (l *blockEventListener) saveBlock(orgName string, block *common.Block) {
 		DataHash:  fmt.Sprintf("%x", block.GetHeader().GetDataHash()),
 		PrevHash:  fmt.Sprintf("%x", block.GetHeader().GetPreviousHash()),
 		TxCount:   len(block.GetData().GetData()),
+		TxIDs:     txIDs,
 		SaveTime:  time.Now(),
 	}
 
 	// 使用事务保存数据
+	var issues []ChainIssue
 	err = l.db.Update(func(tx *bolt.Tx) error {
 		// 保存区块数据
 		_BlocksBucket := tx.Bucket([]byte(_BlocksBucket))
@@ -251,8 +421,51 @@ func (l *blockEventListener) saveBlock(orgName string, block *common.Block) {
 			return fmt.Errorf("保存区块数据失败：%v", err)
 		}
 
-		// 更新最新区块信息
+		// 保存哈希索引
+		hashKey := fmt.Sprintf("%s_%s", orgName, blockData.BlockHash)
+		if err := tx.Bucket([]byte(_HashBucket)).Put([]byte(hashKey), []byte(strconv.FormatUint(blockNum, 10))); err != nil {
+			return fmt.Errorf("保存区块哈希索引失败：%v", err)
+		}
+
+		// 保存交易及业务 ID 索引，所有组织在同一通道上，交易按 ID 只存一份
+		txBucket := tx.Bucket([]byte(_TxBucket))
+		refBucket := tx.Bucket([]byte(_TxRefBucket))
+		for _, t := range txs {
+			txJSON, err := json.Marshal(t)
+			if err != nil {
+				return fmt.Errorf("序列化交易数据失败：%v", err)
+			}
+			if err := txBucket.Put([]byte(t.TxID), txJSON); err != nil {
+				return fmt.Errorf("保存交易数据失败：%v", err)
+			}
+			for _, ref := range txRefs(t) {
+				// 同一业务 ID 可能被重复提交（重试），保留最早验证通过的那笔
+				if existing := refBucket.Get([]byte(ref)); existing != nil {
+					var prev TxData
+					if data := txBucket.Get(existing); data != nil && json.Unmarshal(data, &prev) == nil &&
+						(prev.Valid || !t.Valid) {
+						continue
+					}
+				}
+				if err := refBucket.Put([]byte(ref), []byte(t.TxID)); err != nil {
+					return fmt.Errorf("保存交易索引失败：%v", err)
+				}
+			}
+		}
+
+		// 增量校验与相邻区块的哈希链接
+		if issues, err = checkLinks(tx, orgName, &blockData); err != nil {
+			return fmt.Errorf("校验区块哈希链失败：%v", err)
+		}
+
+		// 更新最新区块信息，重新拉取的旧区块不能让最新区块号回退
 		_LatestBucket := tx.Bucket([]byte(_LatestBucket))
+		if data := _LatestBucket.Get([]byte(orgName)); data != nil {
+			var current LatestBlock
+			if err := json.Unmarshal(data, &current); err == nil && current.BlockNum > blockNum {
+				return nil
+			}
+		}
 		latestBlock := LatestBlock{
 			BlockNum: blockNum,
 			SaveTime: time.Now(),
@@ -273,7 +486,10 @@ func (l *blockEventListener) saveBlock(orgName string, block *common.Block) {
 		return
 	}
 
-	fmt.Printf("已保存组织[%s]的区块[%d]\n", orgName, blockNum)
+	fmt.Printf("已保存[%s]的区块[%d]\n", orgName, blockNum)
+	if len(issues) > 0 {
+		l.onChainIssues(orgName, issues)
+	}
 }
 
 // Close 关闭监听器
@@ -313,6 +529,117 @@ func (l *blockEventListener) GetBlockByNumber(orgName string, blockNum uint64) (
 	return &blockData, nil
 }
 
+// GetBlockByHash 根据组织名和区块哈希查询区块
+// 建立哈希索引之前保存的区块不在索引中，回退为按区块号逐个查找
+func (l *blockEventListener) GetBlockByHash(orgName string, blockHash string) (*BlockData, error) {
+	blockHash = strings.ToLower(blockHash)
+	var blockData *BlockData
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(_BlocksBucket))
+		if b == nil {
+			return fmt.Errorf("blocks bucket不存在")
+		}
+
+		if idx := tx.Bucket([]byte(_HashBucket)); idx != nil {
+			if num := idx.Get([]byte(fmt.Sprintf("%s_%s", orgName, blockHash))); num != nil {
+				data := b.Get([]byte(fmt.Sprintf("%s_%s", orgName, num)))
+				if data != nil {
+					blockData = &BlockData{}
+					return json.Unmarshal(data, blockData)
+				}
+			}
+		}
+
+		// 按区块号逐个读取精确的键，按 orgName+"_" 前缀扫描会匹配到名称以它开头的其他通道或组织
+		data := tx.Bucket([]byte(_LatestBucket)).Get([]byte(orgName))
+		if data == nil {
+			return fmt.Errorf("区块不存在")
+		}
+		var latest LatestBlock
+		if err := json.Unmarshal(data, &latest); err != nil {
+			return err
+		}
+		for num := uint64(0); num <= latest.BlockNum; num++ {
+			v := b.Get([]byte(fmt.Sprintf("%s_%d", orgName, num)))
+			if v == nil {
+				continue
+			}
+			var block BlockData
+			if err := json.Unmarshal(v, &block); err != nil {
+				return err
+			}
+			if block.BlockHash == blockHash {
+				blockData = &block
+				return nil
+			}
+		}
+		return fmt.Errorf("区块不存在")
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return blockData, nil
+}
+
+// GetLatestBlocks 查询每个组织已保存的最新区块
+func (l *blockEventListener) GetLatestBlocks() (map[string]LatestBlock, error) {
+	result := make(map[string]LatestBlock)
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(_LatestBucket))
+		if b == nil {
+			return fmt.Errorf("latest_blocks bucket不存在")
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var latest LatestBlock
+			if err := json.Unmarshal(v, &latest); err != nil {
+				return err
+			}
+			result[string(k)] = latest
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetTransaction 根据交易 ID 或业务 ID（转账 ID、冻结 ID、释放/退款 txid）查询交易
+func (l *blockEventListener) GetTransaction(id string) (*TxData, error) {
+	var txData TxData
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(_TxBucket))
+		if b == nil {
+			return fmt.Errorf("transactions bucket不存在")
+		}
+		data := b.Get([]byte(id))
+		if data == nil {
+			if refs := tx.Bucket([]byte(_TxRefBucket)); refs != nil {
+				if txID := refs.Get([]byte(id)); txID != nil {
+					data = b.Get(txID)
+				}
+			}
+		}
+		if data == nil {
+			return fmt.Errorf("交易不存在")
+		}
+		return json.Unmarshal(data, &txData)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &txData, nil
+}
+
 // BlockQueryResult 区块查询结果
 type BlockQueryResult struct {
 	Blocks   []*BlockData `json:"blocks"`    // 区块数据列表
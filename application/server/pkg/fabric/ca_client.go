@@ -0,0 +1,261 @@
+package fabric
+
+import (
+	"application/config"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// CAClient Fabric CA 的 REST 客户端，只实现为用户登记（register）和注册（enroll）身份
+type CAClient struct {
+	cfg  config.CAConfig
+	http *http.Client
+
+	mu        sync.Mutex
+	registrar *enrollment // 登记员的证书和私钥，首次登记用户时注册
+}
+
+// enrollment 注册得到的证书和私钥
+type enrollment struct {
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+// caResponse Fabric CA 接口的统一响应
+type caResponse struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// NewCAClient 创建 CA 客户端，url 为 https 时用 tlsCertPath 校验服务端证书
+func NewCAClient(cfg config.CAConfig) (*CAClient, error) {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	if cfg.TLSCertPath != "" {
+		certificatePEM, err := os.ReadFile(cfg.TLSCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA的TLS证书失败：%w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(certificatePEM) {
+			return nil, fmt.Errorf("解析CA的TLS证书失败")
+		}
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return &CAClient{cfg: cfg, http: httpClient}, nil
+}
+
+// EnrollUser 以 enrollmentID 登记一个 client 类型的新身份并立即注册，返回证书和 PKCS#8 私钥（PEM）
+// 每个身份只允许注册一次，密码随机生成且不保存
+func (c *CAClient) EnrollUser(enrollmentID string) ([]byte, []byte, error) {
+	return c.enrollNew(enrollmentID, nil)
+}
+
+// EnrollService 登记并注册带 role=service 属性的服务身份，链码只允许服务身份执行铸币、释放和退还预扣款
+func (c *CAClient) EnrollService(enrollmentID string) ([]byte, []byte, error) {
+	return c.enrollNew(enrollmentID, []attribute{{Name: ServiceRoleAttribute, Value: ServiceRoleValue}})
+}
+
+// 服务身份证书中的属性，需要与链码的 SERVICE_ROLE_ATTRIBUTE、SERVICE_ROLE_VALUE 保持一致
+const (
+	ServiceRoleAttribute = "role"
+	ServiceRoleValue     = "service"
+)
+
+// attribute 登记时写入证书的属性
+type attribute struct {
+	Name  string
+	Value string
+}
+
+// enrollNew 登记新身份并立即注册，attrs 写入注册得到的证书
+func (c *CAClient) enrollNew(enrollmentID string, attrs []attribute) ([]byte, []byte, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, nil, fmt.Errorf("生成登记密码失败：%v", err)
+	}
+	secret := hex.EncodeToString(raw)
+	if err := c.register(enrollmentID, secret, attrs); err != nil {
+		return nil, nil, err
+	}
+	e, err := c.enroll(enrollmentID, secret, attrs)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(e.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("编码私钥失败：%v", err)
+	}
+	return e.certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// register 由登记员登记新身份
+func (c *CAClient) register(enrollmentID string, secret string, attrs []attribute) error {
+	registrar, err := c.getRegistrar()
+	if err != nil {
+		return err
+	}
+	request := map[string]interface{}{
+		"id":              enrollmentID,
+		"type":            "client",
+		"secret":          secret,
+		"max_enrollments": 1,
+		"caname":          c.cfg.Name,
+	}
+	if len(attrs) > 0 {
+		registered := make([]map[string]interface{}, 0, len(attrs))
+		for _, a := range attrs {
+			registered = append(registered, map[string]interface{}{"name": a.Name, "value": a.Value, "ecert": true})
+		}
+		request["attrs"] = registered
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url("/api/v1/register"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	token, err := registrar.token(req.Method, req.URL.RequestURI(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", token)
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("登记身份 %s 失败：%v", enrollmentID, err)
+	}
+	return nil
+}
+
+// enroll 用登记的密码注册，私钥在本地生成，只把证书签名请求发给 CA
+// attrs 不为空时要求 CA 把这些属性写入证书，缺少任一属性时注册失败
+func (c *CAClient) enroll(enrollmentID string, secret string, attrs []attribute) (*enrollment, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成私钥失败：%v", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: enrollmentID},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("生成证书签名请求失败：%v", err)
+	}
+	request := map[string]interface{}{
+		"certificate_request": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		"caname":              c.cfg.Name,
+	}
+	if len(attrs) > 0 {
+		attrReqs := make([]map[string]interface{}, 0, len(attrs))
+		for _, a := range attrs {
+			attrReqs = append(attrReqs, map[string]interface{}{"name": a.Name, "optional": false})
+		}
+		request["attr_reqs"] = attrReqs
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url("/api/v1/enroll"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(enrollmentID, secret)
+	var result struct {
+		Cert string `json:"Cert"`
+	}
+	if err := c.do(req, &result); err != nil {
+		return nil, fmt.Errorf("注册身份 %s 失败：%v", enrollmentID, err)
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(result.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("解析证书失败：%v", err)
+	}
+	return &enrollment{certPEM: certPEM, key: key}, nil
+}
+
+// getRegistrar 登记员的身份，首次使用时用配置的密码注册
+func (c *CAClient) getRegistrar() (*enrollment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.registrar != nil {
+		return c.registrar, nil
+	}
+	registrar, err := c.enroll(c.cfg.RegistrarID, c.cfg.RegistrarSecret, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.registrar = registrar
+	return registrar, nil
+}
+
+// token Fabric CA 的身份令牌：<base64 证书>.<base64 签名>
+// 签名内容为 <方法>.<base64 URI>.<base64 请求体>.<base64 证书> 的 SHA-256
+func (e *enrollment) token(method string, uri string, body []byte) (string, error) {
+	b64cert := base64.StdEncoding.EncodeToString(e.certPEM)
+	payload := strings.Join([]string{
+		method,
+		base64.StdEncoding.EncodeToString([]byte(uri)),
+		base64.StdEncoding.EncodeToString(body),
+		b64cert,
+	}, ".")
+	sign, err := identity.NewPrivateKeySign(e.key)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := sign(digest[:])
+	if err != nil {
+		return "", fmt.Errorf("签名失败：%v", err)
+	}
+	return b64cert + "." + base64.StdEncoding.EncodeToString(signature), nil
+}
+
+func (c *CAClient) url(path string) string {
+	return strings.TrimRight(c.cfg.URL, "/") + path
+}
+
+// do 发送请求并解析统一响应，result 为空时忽略返回数据
+func (c *CAClient) do(req *http.Request, result interface{}) error {
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var body caResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("CA 返回 %s，响应无法解析：%v", resp.Status, err)
+	}
+	if !body.Success {
+		if len(body.Errors) > 0 {
+			return fmt.Errorf("CA 返回错误 %d：%s", body.Errors[0].Code, body.Errors[0].Message)
+		}
+		return fmt.Errorf("CA 返回 %s", resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(body.Result, result)
+}
@@ -0,0 +1,253 @@
+package fabric_test
+
+import (
+	"application/config"
+	"application/pkg/fabric"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// fakeCA 按 Fabric CA 的协议实现 register 和 enroll，校验登记员令牌并签发证书
+type fakeCA struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	cert    *x509.Certificate
+	secrets map[string]string
+	attrs   map[string]map[string]string // 登记时写入 ecert 的属性
+	serial  int64
+}
+
+// attrOID Fabric CA 在证书扩展中保存属性的 OID，内容为 {"attrs":{...}}
+var attrOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca.org2.togettoyou.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &fakeCA{t: t, key: key, cert: cert, secrets: map[string]string{"admin": "adminpw"}, attrs: map[string]map[string]string{}, serial: 1}
+}
+
+func (ca *fakeCA) reply(w http.ResponseWriter, result interface{}, errMsg string) {
+	body := map[string]interface{}{"success": errMsg == "", "result": result, "errors": []interface{}{}}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		body["errors"] = []interface{}{map[string]interface{}{"code": 20, "message": errMsg}}
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func (ca *fakeCA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	switch r.URL.Path {
+	case "/api/v1/enroll":
+		user, pass, ok := r.BasicAuth()
+		if !ok || ca.secrets[user] != pass {
+			ca.reply(w, nil, "Authentication failure")
+			return
+		}
+		var req struct {
+			CertificateRequest string `json:"certificate_request"`
+			AttrReqs           []struct {
+				Name     string `json:"name"`
+				Optional bool   `json:"optional"`
+			} `json:"attr_reqs"`
+		}
+		json.Unmarshal(body, &req)
+		block, _ := pem.Decode([]byte(req.CertificateRequest))
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil || csr.CheckSignature() != nil {
+			ca.reply(w, nil, "Invalid CSR")
+			return
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(ca.serial + 1),
+			Subject:      pkix.Name{CommonName: user, OrganizationalUnit: []string{"client"}},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		if len(req.AttrReqs) > 0 {
+			granted := map[string]string{}
+			for _, a := range req.AttrReqs {
+				value, ok := ca.attrs[user][a.Name]
+				if !ok && !a.Optional {
+					ca.reply(w, nil, "Identity does not have attribute "+a.Name)
+					return
+				}
+				if ok {
+					granted[a.Name] = value
+				}
+			}
+			ext, _ := json.Marshal(map[string]interface{}{"attrs": granted})
+			template.ExtraExtensions = []pkix.Extension{{Id: attrOID, Value: ext}}
+		}
+		ca.serial++
+		der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+		if err != nil {
+			ca.t.Fatal(err)
+		}
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		ca.reply(w, map[string]string{"Cert": base64.StdEncoding.EncodeToString(certPEM)}, "")
+	case "/api/v1/register":
+		if err := ca.verifyToken(r, body); err != "" {
+			ca.reply(w, nil, err)
+			return
+		}
+		var req struct {
+			ID     string `json:"id"`
+			Secret string `json:"secret"`
+			Attrs  []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+				ECert bool   `json:"ecert"`
+			} `json:"attrs"`
+		}
+		json.Unmarshal(body, &req)
+		ca.secrets[req.ID] = req.Secret
+		ca.attrs[req.ID] = map[string]string{}
+		for _, a := range req.Attrs {
+			if a.ECert {
+				ca.attrs[req.ID][a.Name] = a.Value
+			}
+		}
+		ca.reply(w, map[string]string{"secret": req.Secret}, "")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verifyToken 校验令牌中的证书由本 CA 签发，且签名覆盖方法、URI、请求体和证书
+func (ca *fakeCA) verifyToken(r *http.Request, body []byte) string {
+	b64cert, b64sig, ok := strings.Cut(r.Header.Get("Authorization"), ".")
+	if !ok {
+		return "Invalid token"
+	}
+	certPEM, _ := base64.StdEncoding.DecodeString(b64cert)
+	cert, err := identity.CertificateFromPEM(certPEM)
+	if err != nil || cert.CheckSignatureFrom(ca.cert) != nil {
+		return "Untrusted certificate"
+	}
+	sig, _ := base64.StdEncoding.DecodeString(b64sig)
+	payload := strings.Join([]string{
+		r.Method,
+		base64.StdEncoding.EncodeToString([]byte(r.URL.RequestURI())),
+		base64.StdEncoding.EncodeToString(body),
+		b64cert,
+	}, ".")
+	digest := sha256.Sum256([]byte(payload))
+	if !ecdsa.VerifyASN1(cert.PublicKey.(*ecdsa.PublicKey), digest[:], sig) {
+		return "Invalid signature"
+	}
+	return ""
+}
+
+func TestCAClientEnrollUser(t *testing.T) {
+	ca := newFakeCA(t)
+	server := httptest.NewServer(ca)
+	defer server.Close()
+
+	client, err := fabric.NewCAClient(config.CAConfig{URL: server.URL, RegistrarID: "admin", RegistrarSecret: "adminpw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := client.EnrollUser("user-7.abcd")
+	if err != nil {
+		t.Fatalf("登记用户失败：%v", err)
+	}
+	cert, err := identity.CertificateFromPEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "user-7.abcd" {
+		t.Fatalf("证书 CN 为 %s", cert.Subject.CommonName)
+	}
+	key, err := identity.PrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.PublicKey.(*ecdsa.PublicKey).Equal(key.(*ecdsa.PrivateKey).Public()) {
+		t.Fatal("返回的私钥与证书不匹配")
+	}
+
+	// 登记员密码错误时报错
+	bad, _ := fabric.NewCAClient(config.CAConfig{URL: server.URL, RegistrarID: "admin", RegistrarSecret: "wrong"})
+	if _, _, err := bad.EnrollUser("user-8.abcd"); err == nil {
+		t.Fatal("登记员密码错误时应当失败")
+	}
+}
+
+// 服务身份的证书带有 role=service 属性，用户身份没有
+func TestCAClientEnrollService(t *testing.T) {
+	ca := newFakeCA(t)
+	server := httptest.NewServer(ca)
+	defer server.Close()
+
+	client, err := fabric.NewCAClient(config.CAConfig{URL: server.URL, RegistrarID: "admin", RegistrarSecret: "adminpw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := func(certPEM []byte) map[string]string {
+		cert, err := identity.CertificateFromPEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(attrOID) {
+				var value struct {
+					Attrs map[string]string `json:"attrs"`
+				}
+				if err := json.Unmarshal(ext.Value, &value); err != nil {
+					t.Fatal(err)
+				}
+				return value.Attrs
+			}
+		}
+		return nil
+	}
+
+	certPEM, _, err := client.EnrollService("service-org1.abcd")
+	if err != nil {
+		t.Fatalf("登记服务身份失败：%v", err)
+	}
+	if got := attrs(certPEM)[fabric.ServiceRoleAttribute]; got != fabric.ServiceRoleValue {
+		t.Fatalf("服务身份的 %s 属性为 %q", fabric.ServiceRoleAttribute, got)
+	}
+	certPEM, _, err = client.EnrollUser("user-9.abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := attrs(certPEM)[fabric.ServiceRoleAttribute]; ok {
+		t.Fatalf("用户身份不应带有 %s 属性，当前为 %q", fabric.ServiceRoleAttribute, got)
+	}
+}
@@ -0,0 +1,373 @@
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	_VerifyBucket = "chain_verify" // 存储每个组织最近一次的校验结果
+
+	_RefetchTimeout   = 2 * time.Minute // 重新拉取一段区块的超时时间
+	_MaxRefetchBlocks = 1000            // 一次校验最多重新拉取的区块数，其余问题留给下一次校验
+)
+
+// 哈希链问题类型
+const (
+	ChainIssueGap      = "GAP"           // 区块缺失
+	ChainIssueMismatch = "HASH_MISMATCH" // 区块的 PrevHash 与上一个区块的哈希不一致
+)
+
+// ChainIssue 哈希链问题，From/To 为需要重新拉取的区块范围
+type ChainIssue struct {
+	Type   string `json:"type"`
+	From   uint64 `json:"from"`
+	To     uint64 `json:"to"`
+	Detail string `json:"detail"`
+}
+
+// ChainVerifyResult 哈希链校验结果
+type ChainVerifyResult struct {
+	OrgName    string       `json:"org_name"`
+	Latest     uint64       `json:"latest"`     // 校验时的最新区块号
+	Checked    int          `json:"checked"`    // 校验的区块数
+	Valid      bool         `json:"valid"`      // 是否完整且连续
+	Refetched  bool         `json:"refetched"`  // 是否重新拉取过问题区块
+	Refetching bool         `json:"refetching"` // 后台正在重新拉取问题区块，完成后重新校验并更新结果
+	Issues     []ChainIssue `json:"issues"`
+	VerifyTime time.Time    `json:"verify_time"`
+}
+
+// getBlockTx 在事务内读取区块，不存在时返回 nil
+func getBlockTx(tx *bolt.Tx, orgName string, blockNum uint64) (*BlockData, error) {
+	data := tx.Bucket([]byte(_BlocksBucket)).Get([]byte(fmt.Sprintf("%s_%d", orgName, blockNum)))
+	if data == nil {
+		return nil, nil
+	}
+	var block BlockData
+	if err := json.Unmarshal(data, &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// checkLinks 增量校验：检查区块与前后相邻区块的哈希链接
+func checkLinks(tx *bolt.Tx, orgName string, block *BlockData) ([]ChainIssue, error) {
+	var issues []ChainIssue
+	if block.BlockNum > 0 {
+		prev, err := getBlockTx(tx, orgName, block.BlockNum-1)
+		if err != nil {
+			return nil, err
+		}
+		if prev == nil {
+			// 向前找到最近一个已保存的区块，中间都是缺失的
+			from := block.BlockNum - 1
+			for from > 0 {
+				p, err := getBlockTx(tx, orgName, from-1)
+				if err != nil {
+					return nil, err
+				}
+				if p != nil {
+					break
+				}
+				from--
+			}
+			issues = append(issues, ChainIssue{
+				Type:   ChainIssueGap,
+				From:   from,
+				To:     block.BlockNum - 1,
+				Detail: fmt.Sprintf("区块 %d-%d 缺失", from, block.BlockNum-1),
+			})
+		} else if prev.BlockHash != block.PrevHash {
+			issues = append(issues, ChainIssue{
+				Type: ChainIssueMismatch,
+				From: block.BlockNum - 1,
+				To:   block.BlockNum,
+				Detail: fmt.Sprintf("区块 %d 的 PrevHash %s 与区块 %d 的哈希 %s 不一致",
+					block.BlockNum, block.PrevHash, prev.BlockNum, prev.BlockHash),
+			})
+		}
+	}
+	next, err := getBlockTx(tx, orgName, block.BlockNum+1)
+	if err != nil {
+		return nil, err
+	}
+	if next != nil && next.PrevHash != block.BlockHash {
+		issues = append(issues, ChainIssue{
+			Type: ChainIssueMismatch,
+			From: block.BlockNum,
+			To:   block.BlockNum + 1,
+			Detail: fmt.Sprintf("区块 %d 的 PrevHash %s 与区块 %d 的哈希 %s 不一致",
+				next.BlockNum, next.PrevHash, block.BlockNum, block.BlockHash),
+		})
+	}
+	return issues, nil
+}
+
+// onChainIssues 增量校验发现问题时记录日志并在后台重新拉取
+// 重新拉取过程中保存的区块不会再次触发拉取，避免循环
+func (l *blockEventListener) onChainIssues(orgName string, issues []ChainIssue) {
+	for _, issue := range issues {
+		fmt.Printf("组织[%s]区块哈希链异常：%s\n", orgName, issue.Detail)
+	}
+	l.Lock()
+	if l.refetching[orgName] {
+		l.Unlock()
+		return
+	}
+	l.refetching[orgName] = true
+	l.Unlock()
+
+	go func() {
+		defer func() {
+			l.Lock()
+			delete(l.refetching, orgName)
+			l.Unlock()
+		}()
+		for _, issue := range issues {
+			if err := l.refetchRange(orgName, issue.From, issue.To); err != nil {
+				fmt.Printf("组织[%s]重新拉取区块 %d-%d 失败：%v\n", orgName, issue.From, issue.To, err)
+			}
+		}
+	}()
+}
+
+// refetchRange 重新拉取 from 到 to 的区块，覆盖本地保存的数据
+// 通道数据依次尝试各组织的节点；按组织保存的旧数据只使用该组织的节点
+func (l *blockEventListener) refetchRange(scope string, from, to uint64) error {
+	l.RLock()
+	orgs := []string{scope}
+	if scope == l.channel {
+		orgs = append([]string(nil), l.orgOrder...)
+	}
+	networks := make([]*client.Network, 0, len(orgs))
+	for _, orgName := range orgs {
+		if network := l.networks[orgName]; network != nil {
+			networks = append(networks, network)
+		}
+	}
+	l.RUnlock()
+	if len(networks) == 0 {
+		return fmt.Errorf("[%s]的网络未找到", scope)
+	}
+
+	var errs []error
+	for _, network := range networks {
+		err := l.fetchRange(network, scope, from, to)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// fetchRange 通过 BlockEvents 从 from 开始拉取区块，直到 to 为止
+func (l *blockEventListener) fetchRange(network *client.Network, scope string, from, to uint64) error {
+	ctx, cancel := context.WithTimeout(l.ctx, _RefetchTimeout)
+	defer cancel()
+	events, err := network.BlockEvents(ctx, client.WithStartBlock(from))
+	if err != nil {
+		return fmt.Errorf("创建区块事件请求失败：%v", err)
+	}
+	fmt.Printf("开始重新拉取[%s]的区块 %d-%d\n", scope, from, to)
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("重新拉取区块超时")
+		case block, ok := <-events:
+			if !ok {
+				return fmt.Errorf("区块事件流中断")
+			}
+			l.saveBlock(scope, block)
+			if block.GetHeader().GetNumber() >= to {
+				return nil
+			}
+		}
+	}
+}
+
+// walkChain 从 0 遍历到最新区块，检查缺失和哈希链接
+func (l *blockEventListener) walkChain(orgName string) (*ChainVerifyResult, error) {
+	result := &ChainVerifyResult{OrgName: orgName, VerifyTime: time.Now()}
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		latestData := tx.Bucket([]byte(_LatestBucket)).Get([]byte(orgName))
+		if latestData == nil {
+			return fmt.Errorf("组织数据不存在")
+		}
+		var latest LatestBlock
+		if err := json.Unmarshal(latestData, &latest); err != nil {
+			return err
+		}
+		result.Latest = latest.BlockNum
+
+		var prev *BlockData
+		var gapStart uint64
+		inGap := false
+		for num := uint64(0); num <= latest.BlockNum; num++ {
+			block, err := getBlockTx(tx, orgName, num)
+			if err != nil {
+				return err
+			}
+			if block == nil {
+				if !inGap {
+					gapStart = num
+					inGap = true
+				}
+				prev = nil
+				continue
+			}
+			if inGap {
+				result.Issues = append(result.Issues, ChainIssue{
+					Type:   ChainIssueGap,
+					From:   gapStart,
+					To:     num - 1,
+					Detail: fmt.Sprintf("区块 %d-%d 缺失", gapStart, num-1),
+				})
+				inGap = false
+			}
+			result.Checked++
+			if prev != nil && prev.BlockHash != block.PrevHash {
+				result.Issues = append(result.Issues, ChainIssue{
+					Type: ChainIssueMismatch,
+					From: prev.BlockNum,
+					To:   block.BlockNum,
+					Detail: fmt.Sprintf("区块 %d 的 PrevHash %s 与区块 %d 的哈希 %s 不一致",
+						block.BlockNum, block.PrevHash, prev.BlockNum, prev.BlockHash),
+				})
+			}
+			prev = block
+		}
+		if inGap {
+			result.Issues = append(result.Issues, ChainIssue{
+				Type:   ChainIssueGap,
+				From:   gapStart,
+				To:     latest.BlockNum,
+				Detail: fmt.Sprintf("区块 %d-%d 缺失", gapStart, latest.BlockNum),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Valid = len(result.Issues) == 0
+	return result, nil
+}
+
+// VerifyChain 校验组织已保存的完整哈希链
+// refetch 为 true 时在后台重新拉取问题区块（最多 _MaxRefetchBlocks 个），拉取完成后再校验一次并更新保存的结果
+func (l *blockEventListener) VerifyChain(orgName string, refetch bool) (*ChainVerifyResult, error) {
+	result, err := l.walkChain(orgName)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid && refetch {
+		result.Refetching = true
+		l.startRefetch(orgName, result.Issues)
+	}
+	l.logVerifyResult(result)
+	if err := l.saveVerifyResult(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// startRefetch 后台重新拉取问题区块，同一组织同时只有一个拉取任务，已有任务时直接返回
+func (l *blockEventListener) startRefetch(orgName string, issues []ChainIssue) {
+	l.Lock()
+	if l.refetching[orgName] {
+		l.Unlock()
+		return
+	}
+	l.refetching[orgName] = true
+	l.Unlock()
+
+	go func() {
+		defer func() {
+			l.Lock()
+			delete(l.refetching, orgName)
+			l.Unlock()
+		}()
+		budget := uint64(_MaxRefetchBlocks)
+		for _, issue := range issues {
+			if budget == 0 {
+				fmt.Printf("组织[%s]本次重新拉取已达 %d 个区块，其余问题留给下一次校验\n", orgName, _MaxRefetchBlocks)
+				break
+			}
+			to := issue.To
+			if to-issue.From+1 > budget {
+				to = issue.From + budget - 1
+			}
+			budget -= to - issue.From + 1
+			if err := l.refetchRange(orgName, issue.From, to); err != nil {
+				fmt.Printf("组织[%s]重新拉取区块 %d-%d 失败：%v\n", orgName, issue.From, to, err)
+			}
+		}
+		result, err := l.walkChain(orgName)
+		if err != nil {
+			fmt.Printf("组织[%s]重新拉取后校验失败：%v\n", orgName, err)
+			return
+		}
+		result.Refetched = true
+		l.logVerifyResult(result)
+		if err := l.saveVerifyResult(result); err != nil {
+			fmt.Printf("组织[%s]%v\n", orgName, err)
+		}
+	}()
+}
+
+func (l *blockEventListener) logVerifyResult(result *ChainVerifyResult) {
+	if result.Valid {
+		fmt.Printf("组织[%s]区块哈希链校验通过，共 %d 个区块\n", result.OrgName, result.Checked)
+		return
+	}
+	for _, issue := range result.Issues {
+		fmt.Printf("组织[%s]区块哈希链异常：%s\n", result.OrgName, issue.Detail)
+	}
+}
+
+// saveVerifyResult 保存组织最近一次的校验结果
+func (l *blockEventListener) saveVerifyResult(result *ChainVerifyResult) error {
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(_VerifyBucket)).Put([]byte(result.OrgName), data)
+	})
+	if err != nil {
+		return fmt.Errorf("保存校验结果失败：%v", err)
+	}
+	return nil
+}
+
+// GetVerifyResults 查询每个组织最近一次的校验结果
+func (l *blockEventListener) GetVerifyResults() (map[string]ChainVerifyResult, error) {
+	results := make(map[string]ChainVerifyResult)
+	err := l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(_VerifyBucket)).ForEach(func(k, v []byte) error {
+			var result ChainVerifyResult
+			if err := json.Unmarshal(v, &result); err != nil {
+				return err
+			}
+			// 进程在拉取过程中重启时保存的结果仍是拉取中，以当前实际状态为准
+			l.RLock()
+			result.Refetching = l.refetching[string(k)]
+			l.RUnlock()
+			results[string(k)] = result
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"path/filepath"
-	"time"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/hyperledger/fabric-gateway/pkg/hash"
@@ -18,14 +16,18 @@ import (
 )
 
 var (
-	// 组织对应的合约客户端
+	// 组织对应的合约客户端，使用组织共用的 User1 身份，只用于查询
 	contracts = make(map[string]*client.Contract)
+	// 组织对应的 gRPC 连接，用户身份的网关复用这些连接
+	connections = make(map[string]*grpc.ClientConn)
+	// 组织对应的 Fabric CA 客户端，未配置 CA 的组织没有
+	caClients = make(map[string]*CAClient)
 )
 
 // InitFabric 初始化 Fabric 客户端
 func InitFabric() error {
 	// 初始化区块监听器
-	if err := initBlockListener(filepath.Join("data", "blocks")); err != nil {
+	if err := initBlockListener(config.GlobalConfig.Storage.BlockDir, config.GlobalConfig.Fabric.ChannelName); err != nil {
 		return fmt.Errorf("初始化区块监听器失败: %w", err)
 	}
 
@@ -36,6 +38,7 @@ func InitFabric() error {
 		if err != nil {
 			return fmt.Errorf("创建组织[%s]的gRPC连接失败：%v", orgName, err)
 		}
+		connections[orgName] = clientConnection
 
 		// 创建组织身份
 		id, err := newIdentity(orgConfig)
@@ -50,16 +53,7 @@ func InitFabric() error {
 		}
 
 		// 创建 Gateway 连接
-		gw, err := client.Connect(
-			id,
-			client.WithSign(sign),
-			client.WithHash(hash.SHA256),
-			client.WithClientConnection(clientConnection),
-			client.WithEvaluateTimeout(5*time.Second),
-			client.WithEndorseTimeout(15*time.Second),
-			client.WithSubmitTimeout(5*time.Second),
-			client.WithCommitStatusTimeout(1*time.Minute),
-		)
+		gw, err := connectGateway(id, sign, clientConnection)
 		if err != nil {
 			return fmt.Errorf("连接组织[%s]的Fabric网关失败：%v", orgName, err)
 		}
@@ -67,12 +61,26 @@ func InitFabric() error {
 		network := gw.GetNetwork(config.GlobalConfig.Fabric.ChannelName)
 		contracts[orgName] = network.GetContract(config.GlobalConfig.Fabric.ChaincodeName)
 
-		// 添加网络到区块监听器
+		// 创建 CA 客户端，用于为用户和组织服务登记链上身份
+		if orgConfig.CA.URL != "" {
+			caClient, err := NewCAClient(orgConfig.CA)
+			if err != nil {
+				return fmt.Errorf("创建组织[%s]的CA客户端失败：%v", orgName, err)
+			}
+			caClients[orgName] = caClient
+		}
+
+		// 添加网络到区块监听器，作为故障切换的候选节点
 		if err := addNetwork(orgName, network); err != nil {
 			return fmt.Errorf("添加网络到区块监听器失败：%v", err)
 		}
 	}
 
+	// 整个通道只启动一个区块流
+	if err := startBlockListener(); err != nil {
+		return fmt.Errorf("启动区块监听失败：%v", err)
+	}
+
 	return nil
 }
 
@@ -81,6 +89,25 @@ func GetContract(orgName string) *client.Contract {
 	return contracts[orgName]
 }
 
+// GetCAClient 获取指定组织的 CA 客户端，未配置 CA 时返回 nil
+func GetCAClient(orgName string) *CAClient {
+	return caClients[orgName]
+}
+
+// connectGateway 以指定身份连接 Fabric 网关
+func connectGateway(id identity.Identity, sign identity.Sign, clientConnection *grpc.ClientConn) (*client.Gateway, error) {
+	return client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithHash(hash.SHA256),
+		client.WithClientConnection(clientConnection),
+		client.WithEvaluateTimeout(config.GlobalConfig.Gateway.EvaluateTimeout),
+		client.WithEndorseTimeout(config.GlobalConfig.Gateway.EndorseTimeout),
+		client.WithSubmitTimeout(config.GlobalConfig.Gateway.SubmitTimeout),
+		client.WithCommitStatusTimeout(config.GlobalConfig.Gateway.CommitStatusTimeout),
+	)
+}
+
 // ExtractErrorMessage 从错误中提取详细信息
 func ExtractErrorMessage(err error) string {
 	if err == nil {
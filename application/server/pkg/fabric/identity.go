@@ -0,0 +1,119 @@
+package fabric
+
+import (
+	"application/config"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// UserIdentity 通过 Fabric CA 注册的 X.509 身份，用户身份和组织的服务身份都用它表示
+type UserIdentity struct {
+	OrgName string
+	MSPID   string
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// IdentityStore 查询提交交易使用的链上身份，组织未配置 CA 时返回 nil，此时不能提交交易
+type IdentityStore interface {
+	// UserIdentity 用户的身份，以账户名义发起的交易用它提交
+	UserIdentity(userID int) (*UserIdentity, error)
+	// ServiceIdentity 组织带 role=service 属性的服务身份，铸币、释放和退还预扣款用它提交
+	ServiceIdentity(orgName string) (*UserIdentity, error)
+}
+
+// 缓存的用户网关数量上限，超过后关闭最久未使用的网关
+// 网关共用组织的 gRPC 连接，关闭只取消该网关上未完成的调用，上限需要远大于同时提交交易的身份数
+const maxUserGateways = 1024
+
+// gatewayCache 按证书摘要缓存以用户身份连接的网关，最近最少使用的先淘汰
+type gatewayCache struct {
+	mu    sync.Mutex
+	limit int
+	order *list.List               // 最近使用的在前
+	items map[string]*list.Element // 证书摘要 -> *cachedGateway
+}
+
+type cachedGateway struct {
+	key      string
+	gateway  io.Closer
+	contract *client.Contract
+}
+
+func newGatewayCache(limit int) *gatewayCache {
+	return &gatewayCache{limit: limit, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *gatewayCache) get(key string) (*client.Contract, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedGateway).contract, true
+}
+
+// add 缓存新建的网关，并发请求已经缓存了同一身份的网关时关闭新建的，返回缓存中的合约
+func (c *gatewayCache) add(key string, gateway io.Closer, contract *client.Contract) *client.Contract {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		gateway.Close()
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cachedGateway).contract
+	}
+	c.items[key] = c.order.PushFront(&cachedGateway{key: key, gateway: gateway, contract: contract})
+	for c.order.Len() > c.limit {
+		oldest := c.order.Remove(c.order.Back()).(*cachedGateway)
+		delete(c.items, oldest.key)
+		oldest.gateway.Close()
+	}
+	return contract
+}
+
+var userGateways = newGatewayCache(maxUserGateways)
+
+// getUserContract 获取以用户或服务身份提交交易的合约客户端，复用所属组织的 gRPC 连接
+func getUserContract(id *UserIdentity) (*client.Contract, error) {
+	digest := sha256.Sum256(id.CertPEM)
+	key := hex.EncodeToString(digest[:])
+	if contract, ok := userGateways.get(key); ok {
+		return contract, nil
+	}
+
+	clientConnection := connections[id.OrgName]
+	if clientConnection == nil {
+		return nil, fmt.Errorf("组织[%s]的gRPC连接未初始化", id.OrgName)
+	}
+	certificate, err := identity.CertificateFromPEM(id.CertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析用户证书失败：%v", err)
+	}
+	x509ID, err := identity.NewX509Identity(id.MSPID, certificate)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := identity.PrivateKeyFromPEM(id.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析用户私钥失败：%v", err)
+	}
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	gw, err := connectGateway(x509ID, sign, clientConnection)
+	if err != nil {
+		return nil, fmt.Errorf("以用户身份连接Fabric网关失败：%v", err)
+	}
+	contract := gw.GetNetwork(config.GlobalConfig.Fabric.ChannelName).GetContract(config.GlobalConfig.Fabric.ChaincodeName)
+	return userGateways.add(key, gw, contract), nil
+}
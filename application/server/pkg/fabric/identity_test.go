@@ -0,0 +1,34 @@
+package fabric
+
+import "testing"
+
+type fakeGateway struct{ closed bool }
+
+func (g *fakeGateway) Close() error {
+	g.closed = true
+	return nil
+}
+
+func TestGatewayCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newGatewayCache(2)
+	a, b, c := &fakeGateway{}, &fakeGateway{}, &fakeGateway{}
+	cache.add("a", a, nil)
+	cache.add("b", b, nil)
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("a 应在缓存中")
+	}
+	cache.add("c", c, nil)
+
+	if _, ok := cache.get("b"); ok || !b.closed {
+		t.Fatalf("最久未使用的 b 应被淘汰并关闭, closed=%v", b.closed)
+	}
+	if _, ok := cache.get("a"); !ok || a.closed {
+		t.Fatal("a 最近使用过，不应被淘汰")
+	}
+
+	dup := &fakeGateway{}
+	cache.add("c", dup, nil)
+	if !dup.closed || c.closed {
+		t.Fatal("重复缓存同一身份时应关闭新建的网关")
+	}
+}
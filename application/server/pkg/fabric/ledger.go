@@ -0,0 +1,349 @@
+package fabric
+
+import (
+	"application/model"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LedgerClient 链码调用接口，每个方法对应一个链码函数，orgName 决定以哪个组织的身份提交
+// 业务服务通过构造函数注入，生产环境使用 NewLedgerClient，测试使用 NewMemoryLedger
+type LedgerClient interface {
+	// 钱包
+	CreateAccount(orgName string, id int) error
+	GetBalance(orgName string, id int) (int, error)
+	Transfer(orgName string, id string, senderID int, recipientID int, amount int, timeStamp time.Time) error
+	MintToken(orgName string, accountID int, amount int) error
+	GetTransfersBySender(orgName string, senderID int) ([]model.Transfer, error)
+	GetTransfersByRecipient(orgName string, recipientID int) ([]model.Transfer, error)
+	WithHoldAccount(orgName string, id string, accountID int, listingID string, amount int, timeStamp time.Time) error
+	GetWithHoldingsByAccount(orgName string, accountID int) ([]model.WithHolding, error)
+	GetWithHoldingsByListing(orgName string, listingID string) ([]model.WithHolding, error)
+	ClearWithHolding(orgName string, listingID string) error
+	ReleaseHolding(orgName string, txID string, listingID string, bidderID int, sellerID int, amount int, timeStamp time.Time) error
+	RefundHolding(orgName string, txID string, listingID string, bidderID int, amount int, timeStamp time.Time) error
+
+	// NFT
+	CreateAsset(orgName string, id string, imageName string, name string, authorID int, ownerID int,
+		description string, timeStamp time.Time) (model.Asset, error)
+	GetAsset(orgName string, id string) (model.Asset, error)
+	GetAssetsByAuthor(orgName string, authorID int) ([]model.Asset, error)
+	GetAssetsByOwner(orgName string, ownerID int) ([]model.Asset, error)
+	TransferAsset(orgName string, id string, newOwnerID int, userID int, timeStamp time.Time) error
+	UpdateAssetMetadata(orgName string, id string, name string, description string, userID int) (model.Asset, error)
+	GetAssetHistory(orgName string, id string) ([]model.AssetVersion, error)
+	CreateEditionSeries(orgName string, id string, imageName string, name string, authorID int,
+		description string, supply int, timeStamp time.Time) (model.EditionSeries, error)
+	GetEditionSeries(orgName string, id string) (model.EditionSeries, error)
+	GetEditionsBySeries(orgName string, id string) ([]model.Asset, error)
+
+	// 铸造凭证
+	SetSignerKey(orgName string, accountID int, publicKeyPEM string) error
+	RedeemVoucher(orgName string, voucher Voucher, buyerID int, assetID string, transferID string, timeStamp time.Time) (model.Asset, error)
+	CancelVoucher(orgName string, voucher Voucher, timeStamp time.Time) error
+
+	// 审计
+	AuditLedger(orgName string) (model.AuditReport, error)
+}
+
+// Voucher 链码中的铸造凭证结构，字段需要与链码 MintVoucher 保持一致
+type Voucher struct {
+	ID          string `json:"id"`
+	CreatorID   int    `json:"creatorId"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ImageName   string `json:"imageName"`
+	ImageHash   string `json:"imageHash"`
+	Price       int    `json:"price"`
+	Signature   string `json:"signature"`
+}
+
+// VoucherDigest 凭证签名摘要，字段顺序需要与链码 voucherDigest 保持一致
+func VoucherDigest(v Voucher) []byte {
+	payload := fmt.Sprintf("%s|%d|%s|%s|%s|%s|%d", v.ID, v.CreatorID, v.Name, v.Description, v.ImageName, v.ImageHash, v.Price)
+	digest := sha256.Sum256([]byte(payload))
+	return digest[:]
+}
+
+// contractLedger 通过 Fabric Gateway 调用链码
+type contractLedger struct {
+	identities IdentityStore
+}
+
+// NewLedgerClient 返回基于 Fabric Gateway 的实现，需要先调用 InitFabric
+// 与账户绑定的交易以账户所属用户的身份提交，平台操作以组织的服务身份提交，组织共用的 User1 身份只用于查询
+func NewLedgerClient(identities IdentityStore) LedgerClient {
+	return contractLedger{identities: identities}
+}
+
+// submit 以 orgName 的服务身份提交平台操作，链码据证书中的 role=service 属性放行
+func (l contractLedger) submit(orgName string, fn string, args ...string) ([]byte, error) {
+	if l.identities == nil {
+		return nil, fmt.Errorf("未配置链上身份，不能提交交易 %s", fn)
+	}
+	id, err := l.identities.ServiceIdentity(orgName)
+	if err != nil {
+		return nil, fmt.Errorf("获取组织[%s]的服务身份失败：%v", orgName, err)
+	}
+	if id == nil {
+		return nil, fmt.Errorf("组织[%s]未配置 CA，没有服务身份", orgName)
+	}
+	contract, err := getUserContract(id)
+	if err != nil {
+		return nil, err
+	}
+	return contract.SubmitTransaction(fn, args...)
+}
+
+// submitAs 以 userID 的链上身份提交交易，链码据此校验调用方就是被操作的账户
+// 用户没有身份时直接报错，不能退回组织身份
+func (l contractLedger) submitAs(orgName string, userID int, fn string, args ...string) ([]byte, error) {
+	if l.identities == nil {
+		return nil, fmt.Errorf("未配置链上身份，不能提交交易 %s", fn)
+	}
+	id, err := l.identities.UserIdentity(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 的链上身份失败：%v", userID, err)
+	}
+	if id == nil {
+		return nil, fmt.Errorf("用户 %d 所属组织未配置 CA，没有链上身份", userID)
+	}
+	contract, err := getUserContract(id)
+	if err != nil {
+		return nil, err
+	}
+	return contract.SubmitTransaction(fn, args...)
+}
+
+func (contractLedger) evaluate(orgName string, fn string, args ...string) ([]byte, error) {
+	contract := GetContract(orgName)
+	if contract == nil {
+		return nil, fmt.Errorf("组织[%s]的合约未初始化", orgName)
+	}
+	return contract.EvaluateTransaction(fn, args...)
+}
+
+// decode 解析链码返回的 JSON，空结果（例如查询不到记录的列表）保持零值
+func decode(data []byte, value interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("解析数据失败：%v", err)
+	}
+	return nil
+}
+
+func itoa(n int) string {
+	return fmt.Sprintf("%d", n)
+}
+
+func (l contractLedger) CreateAccount(orgName string, id int) error {
+	_, err := l.submitAs(orgName, id, "CreateAccount", itoa(id))
+	return err
+}
+
+func (l contractLedger) GetBalance(orgName string, id int) (int, error) {
+	result, err := l.evaluate(orgName, "GetBalance", itoa(id))
+	if err != nil {
+		return 0, err
+	}
+	var balance int
+	return balance, decode(result, &balance)
+}
+
+func (l contractLedger) Transfer(orgName string, id string, senderID int, recipientID int, amount int, timeStamp time.Time) error {
+	_, err := l.submitAs(orgName, senderID, "Transfer", id, itoa(senderID), itoa(recipientID), itoa(amount), timeStamp.Format(time.RFC3339))
+	return err
+}
+
+func (l contractLedger) MintToken(orgName string, accountID int, amount int) error {
+	_, err := l.submit(orgName, "MintToken", itoa(accountID), itoa(amount))
+	return err
+}
+
+func (l contractLedger) GetTransfersBySender(orgName string, senderID int) ([]model.Transfer, error) {
+	result, err := l.evaluate(orgName, "GetTransferBySenderID", itoa(senderID))
+	if err != nil {
+		return nil, err
+	}
+	var transfers []model.Transfer
+	return transfers, decode(result, &transfers)
+}
+
+func (l contractLedger) GetTransfersByRecipient(orgName string, recipientID int) ([]model.Transfer, error) {
+	result, err := l.evaluate(orgName, "GetTransferByRecipientID", itoa(recipientID))
+	if err != nil {
+		return nil, err
+	}
+	var transfers []model.Transfer
+	return transfers, decode(result, &transfers)
+}
+
+func (l contractLedger) WithHoldAccount(orgName string, id string, accountID int, listingID string, amount int, timeStamp time.Time) error {
+	_, err := l.submitAs(orgName, accountID, "WithHoldAccount", id, itoa(accountID), listingID, itoa(amount), timeStamp.Format(time.RFC3339))
+	return err
+}
+
+func (l contractLedger) GetWithHoldingsByAccount(orgName string, accountID int) ([]model.WithHolding, error) {
+	result, err := l.evaluate(orgName, "GetWithHoldingByAccountID", itoa(accountID))
+	if err != nil {
+		return nil, err
+	}
+	var holdings []model.WithHolding
+	return holdings, decode(result, &holdings)
+}
+
+func (l contractLedger) GetWithHoldingsByListing(orgName string, listingID string) ([]model.WithHolding, error) {
+	result, err := l.evaluate(orgName, "GetWithHoldingByListingID", listingID)
+	if err != nil {
+		return nil, err
+	}
+	var holdings []model.WithHolding
+	return holdings, decode(result, &holdings)
+}
+
+func (l contractLedger) ClearWithHolding(orgName string, listingID string) error {
+	_, err := l.submit(orgName, "ClearWithHolding", listingID)
+	return err
+}
+
+func (l contractLedger) ReleaseHolding(orgName string, txID string, listingID string, bidderID int, sellerID int, amount int, timeStamp time.Time) error {
+	_, err := l.submit(orgName, "ReleaseHolding", listingID, itoa(sellerID), itoa(amount), timeStamp.Format(time.RFC3339), txID, itoa(bidderID))
+	return err
+}
+
+func (l contractLedger) RefundHolding(orgName string, txID string, listingID string, bidderID int, amount int, timeStamp time.Time) error {
+	_, err := l.submit(orgName, "RefundHolding", listingID, itoa(bidderID), itoa(amount), timeStamp.Format(time.RFC3339), txID)
+	return err
+}
+
+func (l contractLedger) CreateAsset(orgName string, id string, imageName string, name string, authorID int, ownerID int,
+	description string, timeStamp time.Time) (model.Asset, error) {
+	result, err := l.submitAs(orgName, authorID, "CreateAsset", id, imageName, name, itoa(authorID), itoa(ownerID), description,
+		timeStamp.Format(time.RFC3339))
+	if err != nil {
+		return model.Asset{}, err
+	}
+	var asset model.Asset
+	return asset, decode(result, &asset)
+}
+
+func (l contractLedger) GetAsset(orgName string, id string) (model.Asset, error) {
+	result, err := l.evaluate(orgName, "GetAssetByID", id)
+	if err != nil {
+		return model.Asset{}, err
+	}
+	var asset model.Asset
+	return asset, decode(result, &asset)
+}
+
+func (l contractLedger) GetAssetsByAuthor(orgName string, authorID int) ([]model.Asset, error) {
+	result, err := l.evaluate(orgName, "GetAssetByAuthorID", itoa(authorID))
+	if err != nil {
+		return nil, err
+	}
+	var assets []model.Asset
+	return assets, decode(result, &assets)
+}
+
+func (l contractLedger) GetAssetsByOwner(orgName string, ownerID int) ([]model.Asset, error) {
+	result, err := l.evaluate(orgName, "GetAssetByOwnerID", itoa(ownerID))
+	if err != nil {
+		return nil, err
+	}
+	var assets []model.Asset
+	return assets, decode(result, &assets)
+}
+
+func (l contractLedger) TransferAsset(orgName string, id string, newOwnerID int, userID int, timeStamp time.Time) error {
+	_, err := l.submitAs(orgName, userID, "TransferAsset", id, itoa(newOwnerID), itoa(userID), timeStamp.Format(time.RFC3339))
+	return err
+}
+
+func (l contractLedger) UpdateAssetMetadata(orgName string, id string, name string, description string, userID int) (model.Asset, error) {
+	result, err := l.submitAs(orgName, userID, "UpdateAssetMetadata", id, name, description, itoa(userID))
+	if err != nil {
+		return model.Asset{}, err
+	}
+	var asset model.Asset
+	return asset, decode(result, &asset)
+}
+
+func (l contractLedger) GetAssetHistory(orgName string, id string) ([]model.AssetVersion, error) {
+	result, err := l.evaluate(orgName, "GetAssetHistory", id)
+	if err != nil {
+		return nil, err
+	}
+	var versions []model.AssetVersion
+	return versions, decode(result, &versions)
+}
+
+func (l contractLedger) CreateEditionSeries(orgName string, id string, imageName string, name string, authorID int,
+	description string, supply int, timeStamp time.Time) (model.EditionSeries, error) {
+	result, err := l.submitAs(orgName, authorID, "CreateEditionSeries", id, imageName, name, itoa(authorID), description, itoa(supply),
+		timeStamp.Format(time.RFC3339))
+	if err != nil {
+		return model.EditionSeries{}, err
+	}
+	var series model.EditionSeries
+	return series, decode(result, &series)
+}
+
+func (l contractLedger) GetEditionSeries(orgName string, id string) (model.EditionSeries, error) {
+	result, err := l.evaluate(orgName, "GetEditionSeries", id)
+	if err != nil {
+		return model.EditionSeries{}, err
+	}
+	var series model.EditionSeries
+	return series, decode(result, &series)
+}
+
+func (l contractLedger) GetEditionsBySeries(orgName string, id string) ([]model.Asset, error) {
+	result, err := l.evaluate(orgName, "GetEditionsBySeriesID", id)
+	if err != nil {
+		return nil, err
+	}
+	var assets []model.Asset
+	return assets, decode(result, &assets)
+}
+
+func (l contractLedger) SetSignerKey(orgName string, accountID int, publicKeyPEM string) error {
+	_, err := l.submitAs(orgName, accountID, "SetSignerKey", itoa(accountID), publicKeyPEM)
+	return err
+}
+
+func (l contractLedger) RedeemVoucher(orgName string, voucher Voucher, buyerID int, assetID string, transferID string,
+	timeStamp time.Time) (model.Asset, error) {
+	voucherJSON, err := json.Marshal(voucher)
+	if err != nil {
+		return model.Asset{}, fmt.Errorf("序列化凭证失败：%v", err)
+	}
+	result, err := l.submitAs(orgName, buyerID, "RedeemVoucher", string(voucherJSON), itoa(buyerID), assetID, transferID,
+		timeStamp.Format(time.RFC3339))
+	if err != nil {
+		return model.Asset{}, err
+	}
+	var asset model.Asset
+	return asset, decode(result, &asset)
+}
+
+func (l contractLedger) CancelVoucher(orgName string, voucher Voucher, timeStamp time.Time) error {
+	voucherJSON, err := json.Marshal(voucher)
+	if err != nil {
+		return fmt.Errorf("序列化凭证失败：%v", err)
+	}
+	_, err = l.submitAs(orgName, voucher.CreatorID, "CancelVoucher", string(voucherJSON), timeStamp.Format(time.RFC3339))
+	return err
+}
+
+func (l contractLedger) AuditLedger(orgName string) (model.AuditReport, error) {
+	result, err := l.evaluate(orgName, "AuditLedger")
+	if err != nil {
+		return model.AuditReport{}, err
+	}
+	var report model.AuditReport
+	return report, decode(result, &report)
+}
@@ -0,0 +1,686 @@
+package fabric
+
+import (
+	"application/model"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 与链码保持一致的常量
+const (
+	_MemInitialBalance = 100 // 开通钱包赠送的代币
+	_MemSignerOrg      = "org2"
+)
+
+// MemoryLedger 内存中的账本，按链码的规则实现 LedgerClient，用于测试和本地开发
+// 每个方法先完成全部校验再修改状态，与链码交易失败时不落任何写入的语义一致
+type MemoryLedger struct {
+	mu          sync.Mutex
+	accounts    map[int]int                       // 账户 -> 余额
+	transfers   map[string]model.Transfer         // 转账 ID -> 转账记录
+	holdings    map[string]model.WithHolding      // 预扣款 ID -> 预扣款
+	settlements map[string]bool                   // 已执行的释放/退款 txId
+	assets      map[string]model.Asset            // NFT ID -> NFT
+	history     map[string][]model.AssetVersion   // NFT ID -> 历史版本（旧的在前）
+	series      map[string]model.EditionSeries    // 系列 ID -> 限量系列
+	signerKeys  map[int]*ecdsa.PublicKey          // 创作者 -> 凭证签名公钥
+	redeemed    map[string]bool                   // 已兑换的凭证 ID
+	cancelled   map[string]bool                   // 已撤回的凭证 ID
+	txSeq       int                               // 模拟交易 ID
+	failures    map[string]func(args []any) error // 注入的故障，用于测试失败和重试
+}
+
+// NewMemoryLedger 创建空的内存账本
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{
+		accounts:    map[int]int{},
+		transfers:   map[string]model.Transfer{},
+		holdings:    map[string]model.WithHolding{},
+		settlements: map[string]bool{},
+		assets:      map[string]model.Asset{},
+		history:     map[string][]model.AssetVersion{},
+		series:      map[string]model.EditionSeries{},
+		signerKeys:  map[int]*ecdsa.PublicKey{},
+		redeemed:    map[string]bool{},
+		cancelled:   map[string]bool{},
+		failures:    map[string]func(args []any) error{},
+	}
+}
+
+// FailOn 让之后对 fn（方法名，如 "TransferAsset"）的调用先经过 check，check 返回错误时调用失败且不修改状态
+// check 为 nil 时取消注入
+func (m *MemoryLedger) FailOn(fn string, check func(args []any) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if check == nil {
+		delete(m.failures, fn)
+		return
+	}
+	m.failures[fn] = check
+}
+
+// 调用方需持有锁
+func (m *MemoryLedger) injected(fn string, args ...any) error {
+	if check := m.failures[fn]; check != nil {
+		return check(args)
+	}
+	return nil
+}
+
+func (m *MemoryLedger) CreateAccount(orgName string, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("CreateAccount", id); err != nil {
+		return err
+	}
+	if _, ok := m.accounts[id]; ok {
+		return fmt.Errorf("账户已存在")
+	}
+	m.accounts[id] = _MemInitialBalance
+	return nil
+}
+
+func (m *MemoryLedger) GetBalance(orgName string, id int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetBalance", id); err != nil {
+		return 0, err
+	}
+	balance, ok := m.accounts[id]
+	if !ok {
+		return 0, fmt.Errorf("查询余额失败：账户 %d 不存在", id)
+	}
+	return balance, nil
+}
+
+func (m *MemoryLedger) Transfer(orgName string, id string, senderID int, recipientID int, amount int, timeStamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("Transfer", id, senderID, recipientID, amount); err != nil {
+		return err
+	}
+	return m.transfer(id, senderID, recipientID, amount, timeStamp)
+}
+
+// transfer 与链码 Transfer 相同：同一个转账 ID 只生效一次
+func (m *MemoryLedger) transfer(id string, senderID int, recipientID int, amount int, timeStamp time.Time) error {
+	if amount <= 0 {
+		return fmt.Errorf("转账金额必须大于 0")
+	}
+	if senderID == recipientID {
+		return fmt.Errorf("发送方和接收方不能是同一个账户")
+	}
+	if t, ok := m.transfers[id]; ok && t.SenderID == senderID {
+		return nil
+	}
+	senderBalance, ok := m.accounts[senderID]
+	if !ok {
+		return fmt.Errorf("查询发送方账户失败：账户 %d 不存在", senderID)
+	}
+	if _, ok := m.accounts[recipientID]; !ok {
+		return fmt.Errorf("查询接收方账户失败：账户 %d 不存在", recipientID)
+	}
+	if senderBalance < amount {
+		return fmt.Errorf("发送方账户 %d 余额不足", senderID)
+	}
+	m.accounts[senderID] -= amount
+	m.accounts[recipientID] += amount
+	m.transfers[id] = model.Transfer{ID: id, SenderID: senderID, RecipientID: recipientID, Amount: amount, TimeStamp: timeStamp}
+	return nil
+}
+
+func (m *MemoryLedger) MintToken(orgName string, accountID int, amount int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("MintToken", accountID, amount); err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return fmt.Errorf("铸币金额必须大于 0")
+	}
+	if _, ok := m.accounts[accountID]; !ok {
+		return fmt.Errorf("查询账户失败：账户 %d 不存在", accountID)
+	}
+	m.accounts[accountID] += amount
+	return nil
+}
+
+// 链码按复合键顺序返回，即按记录 ID 排序
+func (m *MemoryLedger) listTransfers(match func(model.Transfer) bool) []model.Transfer {
+	var transfers []model.Transfer
+	for _, t := range m.transfers {
+		if match(t) {
+			transfers = append(transfers, t)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].ID < transfers[j].ID })
+	return transfers
+}
+
+func (m *MemoryLedger) GetTransfersBySender(orgName string, senderID int) ([]model.Transfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetTransfersBySender", senderID); err != nil {
+		return nil, err
+	}
+	return m.listTransfers(func(t model.Transfer) bool { return t.SenderID == senderID }), nil
+}
+
+func (m *MemoryLedger) GetTransfersByRecipient(orgName string, recipientID int) ([]model.Transfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetTransfersByRecipient", recipientID); err != nil {
+		return nil, err
+	}
+	return m.listTransfers(func(t model.Transfer) bool { return t.RecipientID == recipientID }), nil
+}
+
+func (m *MemoryLedger) WithHoldAccount(orgName string, id string, accountID int, listingID string, amount int, timeStamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("WithHoldAccount", id, accountID, listingID, amount); err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return fmt.Errorf("预扣款金额必须大于 0")
+	}
+	balance, ok := m.accounts[accountID]
+	if !ok {
+		return fmt.Errorf("查询账户失败：账户 %d 不存在", accountID)
+	}
+	if balance < amount {
+		return fmt.Errorf("账户余额不足")
+	}
+	m.accounts[accountID] -= amount
+	m.holdings[id] = model.WithHolding{ID: id, AccountID: accountID, ListingID: listingID, Amount: amount, TimeStamp: timeStamp}
+	return nil
+}
+
+func (m *MemoryLedger) listHoldings(match func(model.WithHolding) bool) []model.WithHolding {
+	var holdings []model.WithHolding
+	for _, h := range m.holdings {
+		if match(h) {
+			holdings = append(holdings, h)
+		}
+	}
+	sort.Slice(holdings, func(i, j int) bool { return holdings[i].ID < holdings[j].ID })
+	return holdings
+}
+
+func (m *MemoryLedger) GetWithHoldingsByAccount(orgName string, accountID int) ([]model.WithHolding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetWithHoldingsByAccount", accountID); err != nil {
+		return nil, err
+	}
+	return m.listHoldings(func(h model.WithHolding) bool { return h.AccountID == accountID }), nil
+}
+
+func (m *MemoryLedger) GetWithHoldingsByListing(orgName string, listingID string) ([]model.WithHolding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetWithHoldingsByListing", listingID); err != nil {
+		return nil, err
+	}
+	return m.listHoldings(func(h model.WithHolding) bool { return h.ListingID == listingID }), nil
+}
+
+func (m *MemoryLedger) ClearWithHolding(orgName string, listingID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("ClearWithHolding", listingID); err != nil {
+		return err
+	}
+	holdings := m.listHoldings(func(h model.WithHolding) bool { return h.ListingID == listingID })
+	if len(holdings) == 0 {
+		return fmt.Errorf("没有相关商品的扣款记录")
+	}
+	for _, h := range holdings {
+		if _, ok := m.accounts[h.AccountID]; !ok {
+			return fmt.Errorf("查询余额失败：账户 %d 不存在", h.AccountID)
+		}
+	}
+	for _, h := range holdings {
+		m.accounts[h.AccountID] += h.Amount
+		delete(m.holdings, h.ID)
+	}
+	return nil
+}
+
+// ReleaseHolding 与链码相同：给卖家加钱并删除挂牌下全部冻结记录，同一个 txId 只执行一次
+func (m *MemoryLedger) ReleaseHolding(orgName string, txID string, listingID string, bidderID int, sellerID int, amount int, timeStamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("ReleaseHolding", txID, listingID, sellerID, amount, bidderID); err != nil {
+		return err
+	}
+	if m.settlements[txID] {
+		return nil
+	}
+	if err := m.takeHoldings(listingID, bidderID, amount); err != nil {
+		return err
+	}
+	m.accounts[sellerID] += amount
+	m.settlements[txID] = true
+	return nil
+}
+
+// RefundHolding 与链码相同：把金额退给出价人并删除其在该挂牌下的冻结记录，同一个 txId 只执行一次
+func (m *MemoryLedger) RefundHolding(orgName string, txID string, listingID string, bidderID int, amount int, timeStamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("RefundHolding", txID, listingID, bidderID, amount); err != nil {
+		return err
+	}
+	if m.settlements[txID] {
+		return nil
+	}
+	if err := m.takeHoldings(listingID, bidderID, amount); err != nil {
+		return err
+	}
+	m.accounts[bidderID] += amount
+	m.settlements[txID] = true
+	return nil
+}
+
+// takeHoldings 与链码相同：删除账户在该挂牌下的冻结记录，没有冻结或总额不一致时报错且不修改状态
+func (m *MemoryLedger) takeHoldings(listingID string, accountID int, amount int) error {
+	held := m.listHoldings(func(h model.WithHolding) bool {
+		return h.ListingID == listingID && h.AccountID == accountID
+	})
+	if len(held) == 0 {
+		return fmt.Errorf("账户 %d 在 %s 下没有冻结资金，可能已经释放或退还", accountID, listingID)
+	}
+	total := 0
+	for _, h := range held {
+		total += h.Amount
+	}
+	if total != amount {
+		return fmt.Errorf("账户 %d 在 %s 下冻结了 %d，与结算金额 %d 不一致", accountID, listingID, total, amount)
+	}
+	for _, h := range held {
+		delete(m.holdings, h.ID)
+	}
+	return nil
+}
+
+// putAsset 写入 NFT 并记录一个历史版本
+func (m *MemoryLedger) putAsset(asset model.Asset) {
+	m.txSeq++
+	m.assets[asset.ID] = asset
+	version := asset
+	m.history[asset.ID] = append(m.history[asset.ID], model.AssetVersion{
+		TxID:      fmt.Sprintf("memtx-%d", m.txSeq),
+		TimeStamp: time.Now(),
+		Asset:     &version,
+	})
+}
+
+func (m *MemoryLedger) CreateAsset(orgName string, id string, imageName string, name string, authorID int, ownerID int,
+	description string, timeStamp time.Time) (model.Asset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("CreateAsset", id, authorID, ownerID); err != nil {
+		return model.Asset{}, err
+	}
+	if ownerID != authorID {
+		return model.Asset{}, fmt.Errorf("新建的 NFT 必须由作者 %d 持有，不能直接发给账户 %d", authorID, ownerID)
+	}
+	asset := model.Asset{
+		ID:          id,
+		ImageName:   imageName,
+		Name:        name,
+		AuthorId:    authorID,
+		OwnerId:     ownerID,
+		Description: description,
+		TimeStamp:   timeStamp,
+	}
+	m.putAsset(asset)
+	return asset, nil
+}
+
+func (m *MemoryLedger) getAsset(id string) (model.Asset, error) {
+	asset, ok := m.assets[id]
+	if !ok {
+		return model.Asset{}, fmt.Errorf("查询 NFT 失败：NFT %s 不存在", id)
+	}
+	return asset, nil
+}
+
+func (m *MemoryLedger) GetAsset(orgName string, id string) (model.Asset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetAsset", id); err != nil {
+		return model.Asset{}, err
+	}
+	return m.getAsset(id)
+}
+
+func (m *MemoryLedger) listAssets(match func(model.Asset) bool) []model.Asset {
+	var assets []model.Asset
+	for _, a := range m.assets {
+		if match(a) {
+			assets = append(assets, a)
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].ID < assets[j].ID })
+	return assets
+}
+
+func (m *MemoryLedger) GetAssetsByAuthor(orgName string, authorID int) ([]model.Asset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetAssetsByAuthor", authorID); err != nil {
+		return nil, err
+	}
+	return m.listAssets(func(a model.Asset) bool { return a.AuthorId == authorID }), nil
+}
+
+func (m *MemoryLedger) GetAssetsByOwner(orgName string, ownerID int) ([]model.Asset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetAssetsByOwner", ownerID); err != nil {
+		return nil, err
+	}
+	return m.listAssets(func(a model.Asset) bool { return a.OwnerId == ownerID }), nil
+}
+
+func (m *MemoryLedger) TransferAsset(orgName string, id string, newOwnerID int, userID int, timeStamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("TransferAsset", id, newOwnerID, userID); err != nil {
+		return err
+	}
+	asset, err := m.getAsset(id)
+	if err != nil {
+		return err
+	}
+	if asset.OwnerId != userID {
+		return fmt.Errorf("只有 NFT 的所有者可以转移所有权")
+	}
+	if asset.OwnerId == newOwnerID {
+		return fmt.Errorf("新旧主人不能相同")
+	}
+	asset.OwnerId = newOwnerID
+	m.putAsset(asset)
+	return nil
+}
+
+func (m *MemoryLedger) UpdateAssetMetadata(orgName string, id string, name string, description string, userID int) (model.Asset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("UpdateAssetMetadata", id, userID); err != nil {
+		return model.Asset{}, err
+	}
+	asset, err := m.getAsset(id)
+	if err != nil {
+		return model.Asset{}, err
+	}
+	if asset.AuthorId != userID {
+		return model.Asset{}, fmt.Errorf("只有 NFT 的作者可以修改元数据")
+	}
+	if asset.OwnerId != userID {
+		return model.Asset{}, fmt.Errorf("NFT 已转移，作者不能再修改元数据")
+	}
+	if asset.SeriesID != "" {
+		return model.Asset{}, fmt.Errorf("限量版拷贝共享系列元数据，不能单独修改")
+	}
+	if name == "" {
+		return model.Asset{}, fmt.Errorf("名称不能为空")
+	}
+	asset.Name = name
+	asset.Description = description
+	m.putAsset(asset)
+	return asset, nil
+}
+
+// GetAssetHistory 与链码相同，最新的版本在前
+func (m *MemoryLedger) GetAssetHistory(orgName string, id string) ([]model.AssetVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetAssetHistory", id); err != nil {
+		return nil, err
+	}
+	history := m.history[id]
+	versions := make([]model.AssetVersion, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		versions = append(versions, history[i])
+	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	return versions, nil
+}
+
+func (m *MemoryLedger) CreateEditionSeries(orgName string, id string, imageName string, name string, authorID int,
+	description string, supply int, timeStamp time.Time) (model.EditionSeries, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("CreateEditionSeries", id, authorID, supply); err != nil {
+		return model.EditionSeries{}, err
+	}
+	// 发行量上限只由链码的 MAX_EDITION_SUPPLY 限制
+	if supply <= 0 {
+		return model.EditionSeries{}, fmt.Errorf("发行量必须大于 0")
+	}
+	if _, ok := m.series[id]; ok {
+		return model.EditionSeries{}, fmt.Errorf("限量系列已存在")
+	}
+	series := model.EditionSeries{
+		ID:          id,
+		Name:        name,
+		ImageName:   imageName,
+		AuthorId:    authorID,
+		Description: description,
+		Supply:      supply,
+		TimeStamp:   timeStamp,
+	}
+	m.series[id] = series
+	for n := 1; n <= supply; n++ {
+		m.putAsset(model.Asset{
+			ID:            model.EditionAssetID(id, n),
+			ImageName:     imageName,
+			Name:          name,
+			AuthorId:      authorID,
+			OwnerId:       authorID,
+			Description:   description,
+			SeriesID:      id,
+			EditionNumber: n,
+			EditionSupply: supply,
+			TimeStamp:     timeStamp,
+		})
+	}
+	return series, nil
+}
+
+func (m *MemoryLedger) GetEditionSeries(orgName string, id string) (model.EditionSeries, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetEditionSeries", id); err != nil {
+		return model.EditionSeries{}, err
+	}
+	series, ok := m.series[id]
+	if !ok {
+		return model.EditionSeries{}, fmt.Errorf("查询限量系列失败：系列 %s 不存在", id)
+	}
+	return series, nil
+}
+
+func (m *MemoryLedger) GetEditionsBySeries(orgName string, id string) ([]model.Asset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("GetEditionsBySeries", id); err != nil {
+		return nil, err
+	}
+	series, ok := m.series[id]
+	if !ok {
+		return nil, fmt.Errorf("查询限量系列失败：系列 %s 不存在", id)
+	}
+	assets := make([]model.Asset, 0, series.Supply)
+	for n := 1; n <= series.Supply; n++ {
+		asset, err := m.getAsset(model.EditionAssetID(id, n))
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, nil
+}
+
+// parseSignerKey 与链码相同，只接受 PEM 格式的 ECDSA 公钥
+func parseSignerKey(publicKeyPEM string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("公钥格式错误")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析公钥失败：%v", err)
+	}
+	ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("只支持 ECDSA 公钥")
+	}
+	return ecdsaPub, nil
+}
+
+// SetSignerKey 与链码相同，只允许创作者组织登记
+func (m *MemoryLedger) SetSignerKey(orgName string, accountID int, publicKeyPEM string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("SetSignerKey", accountID); err != nil {
+		return err
+	}
+	if orgName != _MemSignerOrg {
+		return fmt.Errorf("只有创作者组织可以登记签名公钥")
+	}
+	pub, err := parseSignerKey(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+	m.signerKeys[accountID] = pub
+	return nil
+}
+
+func (m *MemoryLedger) RedeemVoucher(orgName string, voucher Voucher, buyerID int, assetID string, transferID string,
+	timeStamp time.Time) (model.Asset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("RedeemVoucher", voucher.ID, buyerID, assetID); err != nil {
+		return model.Asset{}, err
+	}
+	if voucher.Price <= 0 {
+		return model.Asset{}, fmt.Errorf("凭证价格必须大于 0")
+	}
+	if voucher.CreatorID == buyerID {
+		return model.Asset{}, fmt.Errorf("不能兑换自己的凭证")
+	}
+	if m.redeemed[voucher.ID] {
+		return model.Asset{}, fmt.Errorf("凭证已被兑换")
+	}
+	if m.cancelled[voucher.ID] {
+		return model.Asset{}, fmt.Errorf("凭证已被撤回")
+	}
+	if err := m.verifyVoucher(voucher); err != nil {
+		return model.Asset{}, err
+	}
+	if _, ok := m.assets[assetID]; ok {
+		return model.Asset{}, fmt.Errorf("NFT %s 已存在", assetID)
+	}
+	// 付款是最后一个可能失败的步骤，失败时前面没有任何写入
+	if err := m.transfer(transferID, buyerID, voucher.CreatorID, voucher.Price, timeStamp); err != nil {
+		return model.Asset{}, err
+	}
+	asset := model.Asset{
+		ID:          assetID,
+		ImageName:   voucher.ImageName,
+		Name:        voucher.Name,
+		AuthorId:    voucher.CreatorID,
+		OwnerId:     buyerID,
+		Description: voucher.Description,
+		ImageHash:   voucher.ImageHash,
+		TimeStamp:   timeStamp,
+	}
+	m.putAsset(asset)
+	m.redeemed[voucher.ID] = true
+	return asset, nil
+}
+
+// CancelVoucher 与链码相同，校验签名后记录撤回，已兑换或已撤回的凭证不能撤回
+func (m *MemoryLedger) CancelVoucher(orgName string, voucher Voucher, timeStamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("CancelVoucher", voucher.ID); err != nil {
+		return err
+	}
+	if err := m.verifyVoucher(voucher); err != nil {
+		return err
+	}
+	if m.redeemed[voucher.ID] {
+		return fmt.Errorf("凭证已被兑换")
+	}
+	if m.cancelled[voucher.ID] {
+		return fmt.Errorf("凭证已被撤回")
+	}
+	m.cancelled[voucher.ID] = true
+	return nil
+}
+
+// 调用方需持有锁
+func (m *MemoryLedger) verifyVoucher(voucher Voucher) error {
+	pub, ok := m.signerKeys[voucher.CreatorID]
+	if !ok {
+		return fmt.Errorf("查询签名公钥失败：创作者 %d 未登记公钥", voucher.CreatorID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(voucher.Signature)
+	if err != nil {
+		return fmt.Errorf("解析签名失败：%v", err)
+	}
+	if !ecdsa.VerifyASN1(pub, VoucherDigest(voucher), signature) {
+		return fmt.Errorf("凭证签名校验失败")
+	}
+	return nil
+}
+
+// AuditLedger 内存账本的索引天然一致，只检查余额和预扣款的合法性并汇总
+func (m *MemoryLedger) AuditLedger(orgName string) (model.AuditReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.injected("AuditLedger"); err != nil {
+		return model.AuditReport{}, err
+	}
+	report := model.AuditReport{Issues: []model.AuditIssue{}}
+	for id, balance := range m.accounts {
+		if balance < 0 {
+			report.Issues = append(report.Issues, model.AuditIssue{Type: "ACCOUNT_BALANCE", Key: fmt.Sprintf("%d", id),
+				Detail: fmt.Sprintf("账户余额为负数：%d", balance)})
+		}
+		report.AccountCount++
+		report.TotalBalance += balance
+	}
+	for _, h := range m.holdings {
+		if _, ok := m.accounts[h.AccountID]; !ok {
+			report.Issues = append(report.Issues, model.AuditIssue{Type: "WITHHOLDING_ACCOUNT", Key: h.ID,
+				Detail: fmt.Sprintf("预扣款对应的账户 %d 不存在", h.AccountID)})
+		}
+		report.WithHoldingCount++
+		report.TotalWithHeld += h.Amount
+	}
+	report.AssetCount = len(m.assets)
+	sort.Slice(report.Issues, func(i, j int) bool {
+		if report.Issues[i].Type != report.Issues[j].Type {
+			return report.Issues[i].Type < report.Issues[j].Type
+		}
+		return report.Issues[i].Key < report.Issues[j].Key
+	})
+	report.Consistent = len(report.Issues) == 0
+	return report, nil
+}
+
+var _ LedgerClient = (*MemoryLedger)(nil)
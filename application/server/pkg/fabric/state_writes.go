@@ -0,0 +1,117 @@
+package fabric
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// KVWrite 交易写集中的一条状态写入
+type KVWrite struct {
+	Key      string
+	Value    []byte
+	IsDelete bool
+}
+
+// TxWrites 一笔有效交易对指定链码的全部状态写入
+type TxWrites struct {
+	TxID   string
+	Writes []KVWrite
+}
+
+// DecodeBlockWrites 按交易顺序解析区块中有效交易对 namespace 链码的写集
+// 无效交易没有写入账本，直接跳过；有效交易解析失败时返回错误，避免读模型漏掉写入
+func DecodeBlockWrites(block *common.Block, namespace string) ([]TxWrites, error) {
+	var filter []byte
+	if metadata := block.GetMetadata().GetMetadata(); len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	var result []TxWrites
+	for i, envBytes := range block.GetData().GetData() {
+		if i >= len(filter) || peer.TxValidationCode(filter[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+		txWrites, err := decodeEnvelopeWrites(envBytes, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("解析区块[%d]第%d笔交易的写集失败：%v", block.GetHeader().GetNumber(), i, err)
+		}
+		if txWrites != nil && len(txWrites.Writes) > 0 {
+			result = append(result, *txWrites)
+		}
+	}
+	return result, nil
+}
+
+// decodeEnvelopeWrites 解析交易信封中背书结果的写集，非背书交易返回 nil
+func decodeEnvelopeWrites(envBytes []byte, namespace string) (*TxWrites, error) {
+	env := &common.Envelope{}
+	if err := proto.Unmarshal(envBytes, env); err != nil {
+		return nil, fmt.Errorf("解析交易信封失败：%v", err)
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.GetPayload(), payload); err != nil {
+		return nil, fmt.Errorf("解析交易负载失败：%v", err)
+	}
+	chdr := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), chdr); err != nil {
+		return nil, fmt.Errorf("解析通道头失败：%v", err)
+	}
+	if chdr.GetType() != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+		return nil, nil
+	}
+
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(payload.GetData(), transaction); err != nil {
+		return nil, fmt.Errorf("解析交易失败：%v", err)
+	}
+	result := &TxWrites{TxID: chdr.GetTxId()}
+	for _, action := range transaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(action.GetPayload(), actionPayload); err != nil {
+			return nil, fmt.Errorf("解析链码动作失败：%v", err)
+		}
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, fmt.Errorf("解析背书结果失败：%v", err)
+		}
+		ccAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.GetExtension(), ccAction); err != nil {
+			return nil, fmt.Errorf("解析链码执行结果失败：%v", err)
+		}
+		txRWSet := &rwset.TxReadWriteSet{}
+		if err := proto.Unmarshal(ccAction.GetResults(), txRWSet); err != nil {
+			return nil, fmt.Errorf("解析读写集失败：%v", err)
+		}
+		for _, ns := range txRWSet.GetNsRwset() {
+			if ns.GetNamespace() != namespace {
+				continue
+			}
+			kv := &kvrwset.KVRWSet{}
+			if err := proto.Unmarshal(ns.GetRwset(), kv); err != nil {
+				return nil, fmt.Errorf("解析命名空间[%s]的读写集失败：%v", namespace, err)
+			}
+			for _, w := range kv.GetWrites() {
+				result.Writes = append(result.Writes, KVWrite{Key: w.GetKey(), Value: w.GetValue(), IsDelete: w.GetIsDelete()})
+			}
+		}
+	}
+	return result, nil
+}
+
+// SplitCompositeKey 拆分链码复合键（\x00类型\x00属性1\x00...\x00），不是复合键时返回 false
+func SplitCompositeKey(key string) (string, []string, bool) {
+	if !strings.HasPrefix(key, "\x00") {
+		return "", nil, false
+	}
+	parts := strings.Split(key[1:], "\x00")
+	if len(parts) < 2 || parts[len(parts)-1] != "" {
+		return "", nil, false
+	}
+	return parts[0], parts[1 : len(parts)-1], true
+}
@@ -0,0 +1,162 @@
+package fabric
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// 单个参数保存的最大长度，超出部分截断（例如凭证 JSON、公钥 PEM）
+const _MaxArgLength = 1024
+
+// TxData 交易数据结构
+type TxData struct {
+	TxID           string    `json:"tx_id"`
+	BlockNum       uint64    `json:"block_num"`
+	TxIndex        int       `json:"tx_index"`       // 在区块中的序号
+	Type           string    `json:"type"`           // 交易类型，例如 ENDORSER_TRANSACTION、CONFIG
+	CreatorMSP     string    `json:"creator_msp"`    // 提交者所属 MSP
+	ChaincodeName  string    `json:"chaincode_name"` // 调用的链码
+	Function       string    `json:"function"`       // 调用的函数
+	Args           []string  `json:"args"`           // 调用参数（不含函数名）
+	ValidationCode string    `json:"validation_code"`
+	Valid          bool      `json:"valid"`                  // 是否通过验证并写入账本
+	Timestamp      time.Time `json:"timestamp"`              // 客户端提交时间
+	DecodeError    string    `json:"decode_error,omitempty"` // 解析失败的原因
+}
+
+// 业务 ID 在链码参数中的位置，用于把数据库中记录的转账 ID、冻结 ID 等映射到链上交易
+var _TxRefArgs = map[string][]int{
+	"Transfer":        {0}, // 转账 ID
+	"WithHoldAccount": {0}, // 冻结 ID（EscrowHoldID）
+	"ReleaseHolding":  {4}, // 释放 txid（PayoutTxID）
+	"RefundHolding":   {4}, // 退款 txid（RefundTxID）
+	"RedeemVoucher":   {3}, // 凭证兑换的转账 ID
+}
+
+// decodeBlockTxs 解析区块中的全部交易，单笔交易解析失败不影响其他交易
+func decodeBlockTxs(block *common.Block) []*TxData {
+	envelopes := block.GetData().GetData()
+	var filter []byte
+	if metadata := block.GetMetadata().GetMetadata(); len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	txs := make([]*TxData, 0, len(envelopes))
+	for i, envBytes := range envelopes {
+		tx := &TxData{
+			BlockNum: block.GetHeader().GetNumber(),
+			TxIndex:  i,
+		}
+		if i < len(filter) {
+			code := peer.TxValidationCode(filter[i])
+			tx.ValidationCode = code.String()
+			tx.Valid = code == peer.TxValidationCode_VALID
+		}
+		if err := decodeEnvelope(envBytes, tx); err != nil {
+			tx.DecodeError = err.Error()
+		}
+		if tx.TxID == "" {
+			// 无法解析出交易 ID 时使用区块内位置作为主键
+			tx.TxID = fmt.Sprintf("block%d_tx%d", tx.BlockNum, i)
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// decodeEnvelope 解析交易信封：头部信息、提交者以及链码调用
+func decodeEnvelope(envBytes []byte, tx *TxData) error {
+	env := &common.Envelope{}
+	if err := proto.Unmarshal(envBytes, env); err != nil {
+		return fmt.Errorf("解析交易信封失败：%v", err)
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.GetPayload(), payload); err != nil {
+		return fmt.Errorf("解析交易负载失败：%v", err)
+	}
+	chdr := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), chdr); err != nil {
+		return fmt.Errorf("解析通道头失败：%v", err)
+	}
+	tx.TxID = chdr.GetTxId()
+	tx.Type = common.HeaderType(chdr.GetType()).String()
+	if ts := chdr.GetTimestamp(); ts != nil {
+		tx.Timestamp = ts.AsTime()
+	}
+
+	shdr := &common.SignatureHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetSignatureHeader(), shdr); err != nil {
+		return fmt.Errorf("解析签名头失败：%v", err)
+	}
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(shdr.GetCreator(), creator); err != nil {
+		return fmt.Errorf("解析提交者身份失败：%v", err)
+	}
+	tx.CreatorMSP = creator.GetMspid()
+
+	if chdr.GetType() != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+		return nil
+	}
+	return decodeInvocation(payload.GetData(), tx)
+}
+
+// decodeInvocation 解析背书交易中的链码名、函数名和参数
+func decodeInvocation(data []byte, tx *TxData) error {
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(data, transaction); err != nil {
+		return fmt.Errorf("解析交易失败：%v", err)
+	}
+	actions := transaction.GetActions()
+	if len(actions) == 0 {
+		return nil
+	}
+	actionPayload := &peer.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(actions[0].GetPayload(), actionPayload); err != nil {
+		return fmt.Errorf("解析链码动作失败：%v", err)
+	}
+	proposalPayload := &peer.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(actionPayload.GetChaincodeProposalPayload(), proposalPayload); err != nil {
+		return fmt.Errorf("解析提案负载失败：%v", err)
+	}
+	spec := &peer.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(proposalPayload.GetInput(), spec); err != nil {
+		return fmt.Errorf("解析链码调用失败：%v", err)
+	}
+
+	tx.ChaincodeName = spec.GetChaincodeSpec().GetChaincodeId().GetName()
+	args := spec.GetChaincodeSpec().GetInput().GetArgs()
+	if len(args) == 0 {
+		return nil
+	}
+	// contractapi 的函数名可能带有合约名前缀，例如 "SmartContract:Transfer"
+	fn := string(args[0])
+	if idx := strings.LastIndex(fn, ":"); idx >= 0 {
+		fn = fn[idx+1:]
+	}
+	tx.Function = fn
+	tx.Args = make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		if len(arg) > _MaxArgLength {
+			arg = append(arg[:_MaxArgLength:_MaxArgLength], "..."...)
+		}
+		tx.Args = append(tx.Args, string(arg))
+	}
+	return nil
+}
+
+// txRefs 返回交易参数中的业务 ID
+func txRefs(tx *TxData) []string {
+	var refs []string
+	for _, idx := range _TxRefArgs[tx.Function] {
+		if idx < len(tx.Args) && tx.Args[idx] != "" {
+			refs = append(refs, tx.Args[idx])
+		}
+	}
+	return refs
+}
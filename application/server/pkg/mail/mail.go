@@ -0,0 +1,104 @@
+package mail
+
+import (
+	"application/config"
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message 纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender 发送邮件，实现由 mail.sender 配置决定
+type Sender interface {
+	Send(msg Message) error
+}
+
+// NewSender 按配置创建发送方式
+func NewSender(cfg config.MailConfig) (Sender, error) {
+	switch cfg.Sender {
+	case config.MailSenderSMTP:
+		return smtpSender{cfg: cfg}, nil
+	case config.MailSenderFile:
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建邮件目录失败：%v", err)
+		}
+		return fileSender{from: cfg.From, dir: cfg.Dir}, nil
+	case config.MailSenderConsole:
+		return consoleSender{}, nil
+	}
+	return nil, fmt.Errorf("不支持的邮件发送方式：%q", cfg.Sender)
+}
+
+// smtpSender 通过 SMTP 服务器发送，服务器支持时自动使用 STARTTLS
+type smtpSender struct {
+	cfg config.MailConfig
+}
+
+func (s smtpSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)
+	if err := smtp.SendMail(addr, auth, s.cfg.From, []string{msg.To}, encode(s.cfg.From, msg)); err != nil {
+		return fmt.Errorf("发送邮件失败：%v", err)
+	}
+	return nil
+}
+
+// fileSender 每封邮件写成一个 .eml 文件，可以直接用邮件客户端打开
+type fileSender struct {
+	from string
+	dir  string
+}
+
+func (s fileSender) Send(msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), sanitize(msg.To))
+	if err := os.WriteFile(filepath.Join(s.dir, name), encode(s.from, msg), 0o600); err != nil {
+		return fmt.Errorf("保存邮件失败：%v", err)
+	}
+	return nil
+}
+
+// consoleSender 把邮件打印到日志
+type consoleSender struct{}
+
+func (consoleSender) Send(msg Message) error {
+	log.Printf("邮件 -> %s：%s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// encode 生成 RFC 5322 格式的邮件，主题按 RFC 2047 编码
+func encode(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,51 @@
+package totp_test
+
+import (
+	"application/pkg/totp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA-1 测试向量，取后 6 位
+func TestCode(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("时间 %d 的验证码为 %s，期望 %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	previous, _ := totp.Code(secret, totp.Step(now)-1)
+	step, ok := totp.Validate(secret, previous, now, 1)
+	if !ok || step != totp.Step(now)-1 {
+		t.Fatalf("上一个时间步的验证码应当在误差范围内：%v %d", ok, step)
+	}
+	stale, _ := totp.Code(secret, totp.Step(now)-3)
+	if _, ok := totp.Validate(secret, stale, now, 1); ok {
+		t.Fatal("超出误差范围的验证码不应通过")
+	}
+
+	uri := totp.URI("NFT-Trade", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/NFT-Trade:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("otpauth 地址不正确：%s", uri)
+	}
+}
@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"application/config"
+	"application/model"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JobFunc 定时任务，返回错误时按退避策略重试
+type JobFunc func() error
+
+// job 任务及其运行状态
+type job struct {
+	name     string
+	interval time.Duration
+	fn       JobFunc
+	failures int       // 连续失败次数
+	nextRun  time.Time // 下次运行时间
+}
+
+// Scheduler 后台定时任务调度器
+// 多实例部署时，只有持有主节点锁（PostgreSQL advisory lock）的实例会执行任务；SQLite 只支持单实例，当前进程总是主节点
+type Scheduler struct {
+	mu       sync.Mutex
+	db       *gorm.DB
+	cfg      config.SchedulerConfig
+	jobs     []*job
+	lockConn *sql.Conn // 持有主节点锁的专用连接，连接断开锁即释放
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// New 创建调度器
+func New(db *gorm.DB, cfg config.SchedulerConfig) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		db:     db,
+		cfg:    cfg,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Register 注册任务，需要在 Start 之前调用
+func (s *Scheduler) Register(name string, interval time.Duration, fn JobFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &job{name: name, interval: interval, fn: fn})
+}
+
+// Start 启动调度循环
+func (s *Scheduler) Start() {
+	go s.loop()
+	log.Printf("后台任务调度器已启动，共 %d 个任务", len(s.jobs))
+}
+
+// Stop 停止调度循环并释放主节点锁
+func (s *Scheduler) Stop() {
+	s.cancel()
+	<-s.done
+	s.releaseLock()
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.TickInterval)
+	defer ticker.Stop()
+	for {
+		if s.acquireLock() {
+			s.runDueJobs(time.Now())
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueJobs 依次执行到期的任务
+func (s *Scheduler) runDueJobs(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if now.Before(j.nextRun) {
+			continue
+		}
+		if err := runSafely(j); err != nil {
+			j.failures++
+			delay := s.backoff(j.failures)
+			j.nextRun = time.Now().Add(delay)
+			log.Printf("定时任务[%s]执行失败（连续失败%d次），%s 后重试：%v", j.name, j.failures, delay, err)
+			continue
+		}
+		if j.failures > 0 {
+			log.Printf("定时任务[%s]已恢复", j.name)
+		}
+		j.failures = 0
+		j.nextRun = time.Now().Add(j.interval)
+	}
+}
+
+// runSafely 执行任务，任务 panic 时转为错误，避免拖垮调度循环
+func runSafely(j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.fn()
+}
+
+// backoff 指数退避：retryBackoff * 2^(failures-1)，不超过 maxBackoff
+func (s *Scheduler) backoff(failures int) time.Duration {
+	delay := s.cfg.RetryBackoff
+	for i := 1; i < failures && delay < s.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.cfg.MaxBackoff {
+		delay = s.cfg.MaxBackoff
+	}
+	return delay
+}
+
+// acquireLock 尝试成为主节点，已持有锁时检查连接是否仍然有效
+func (s *Scheduler) acquireLock() bool {
+	if s.lockConn != nil {
+		if err := s.lockConn.PingContext(s.ctx); err == nil {
+			return true
+		}
+		log.Printf("后台任务主节点锁连接已断开，放弃主节点身份")
+		s.lockConn.Close()
+		s.lockConn = nil
+	}
+
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Printf("获取数据库连接池失败：%v", err)
+		return false
+	}
+	conn, err := sqlDB.Conn(s.ctx)
+	if err != nil {
+		log.Printf("获取数据库连接失败：%v", err)
+		return false
+	}
+	locked, err := model.GetDialect().TryLock(s.ctx, conn, s.cfg.LockKey)
+	if err != nil {
+		log.Printf("获取主节点锁失败：%v", err)
+		conn.Close()
+		return false
+	}
+	if !locked {
+		// 其他实例是主节点
+		conn.Close()
+		return false
+	}
+	s.lockConn = conn
+	log.Printf("已成为后台任务主节点")
+	return true
+}
+
+// releaseLock 释放主节点锁
+func (s *Scheduler) releaseLock() {
+	if s.lockConn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := model.GetDialect().Unlock(ctx, s.lockConn, s.cfg.LockKey); err != nil {
+		log.Printf("释放主节点锁失败：%v", err)
+	}
+	s.lockConn.Close()
+	s.lockConn = nil
+}
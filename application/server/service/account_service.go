@@ -4,24 +4,29 @@ import (
 	"application/model"
 	"application/pkg/fabric"
 	"fmt"
-	"time"
+	"log"
+	"net/mail"
+	"strings"
 
-	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// 邮箱的最大长度，与 users.email 列一致
+const maxEmailLength = 50
+
 type AccountService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	ledger fabric.LedgerClient
 }
 
 // 创建账号服务实例
-func NewAccountService() (*AccountService, error) {
+func NewAccountService(ledger fabric.LedgerClient) (*AccountService, error) {
 	db := model.GetDB()
 	if db == nil {
 		return nil, fmt.Errorf("数据库未初始化")
 	}
-	return &AccountService{db: db}, nil
+	return &AccountService{db: db, ledger: ledger}, nil
 }
 
 // 用户注册
@@ -30,9 +35,13 @@ func (s *AccountService) Register(req *model.RegisterRequest) error {
 	if req.Org != 2 {
 		return fmt.Errorf("只允许直接注册创作者身份")
 	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return err
+	}
 	// 检查用户名是否已存在
 	var existingUser model.User
-	err := s.db.Where("username = ?", req.Username).First(&existingUser).Error
+	err = s.db.Where("username = ?", req.Username).First(&existingUser).Error
 	if err == nil {
 		return fmt.Errorf("用户名已存在")
 	}
@@ -49,7 +58,7 @@ func (s *AccountService) Register(req *model.RegisterRequest) error {
 	// 创建用户，使用默认头像
 	user := &model.User{
 		Username:     req.Username,
-		Email:        req.Email,
+		Email:        email,
 		AvatarURL:    model.DefaultImageName,
 		PasswordHash: string(passwordHash),
 		Org:          req.Org,
@@ -62,61 +71,76 @@ func (s *AccountService) Register(req *model.RegisterRequest) error {
 		return fmt.Errorf("保存用户失败：%v", err)
 	}
 
+	// 登记链上身份，之后该用户的交易以自己的身份提交
+	if _, err := NewIdentityService().Enroll(user); err != nil {
+		return fmt.Errorf("登记链上身份失败：%v", err)
+	}
+
 	// 创建钱包
 	orgName, err := model.GetOrg(user.Org)
 	if err != nil {
 		return fmt.Errorf("获取组织失败：%v", err)
 	}
-	contract := fabric.GetContract(orgName)
-	_, err = contract.SubmitTransaction("CreateAccount", fmt.Sprintf("%d", user.ID))
+	err = s.ledger.CreateAccount(orgName, user.ID)
 	if err != nil {
 		return fmt.Errorf("钱包开通失败：%s", fabric.ExtractErrorMessage(err))
 	}
 
+	// 发送验证邮件，失败时用户可以在登录后重新发送
+	s.sendVerification(user)
 	return nil
 }
 
-// 用户登录
-func (s *AccountService) Login(req *model.LoginRequest) (string, *model.User, error) {
+// 用户登录，成功后创建会话并签发令牌
+// 开启了两步验证时只返回挑战，客户端提交验证码到 LoginTwoFactor 后才创建会话
+func (s *AccountService) Login(req *model.LoginRequest, userAgent string, ip string) (*model.TokenPair, *model.User, *model.TwoFactorChallenge, error) {
 	// 查找用户
 	var user model.User
 	err := s.db.Where("username = ?", req.Username).First(&user).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return "", nil, fmt.Errorf("用户不存在")
+			return nil, nil, nil, fmt.Errorf("用户不存在")
 		}
-		return "", nil, fmt.Errorf("查询用户失败：%v", err)
+		return nil, nil, nil, fmt.Errorf("查询用户失败：%v", err)
 	}
 
 	// 验证密码
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
-		return "", nil, fmt.Errorf("密码错误")
+		return nil, nil, nil, fmt.Errorf("密码错误")
 	}
 
-	// 生成JWT令牌
-	token, err := s.generateJWT(&user)
+	twoFactor := NewTwoFactorService()
+	enabled, err := twoFactor.Enabled(user.ID)
 	if err != nil {
-		return "", nil, fmt.Errorf("生成JWT令牌失败：%v", err)
+		return nil, nil, nil, err
+	}
+	if enabled {
+		challenge, err := twoFactor.Challenge(&user)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, challenge, nil
 	}
 
-	// 保存令牌到数据库
-	err = s.saveToken(user.ID, token)
+	pair, err := NewSessionService().Create(&user, userAgent, ip, false)
 	if err != nil {
-		return "", nil, fmt.Errorf("保存令牌失败：%v", err)
+		return nil, nil, nil, err
 	}
-
-	return token, &user, nil
+	return pair, &user, nil, nil
 }
 
-// 用户登出
-func (s *AccountService) Logout(tokenString string) error {
-	// 从数据库中删除令牌
-	err := s.db.Where("token = ?", tokenString).Delete(&model.Token{}).Error
+// 登录第二步：校验挑战令牌和验证码（或恢复码）后创建会话
+func (s *AccountService) LoginTwoFactor(req *model.TwoFactorLoginRequest, userAgent string, ip string) (*model.TokenPair, *model.User, error) {
+	user, err := NewTwoFactorService().VerifyChallenge(req.ChallengeToken, req.Code)
 	if err != nil {
-		return fmt.Errorf("删除令牌失败：%v", err)
+		return nil, nil, err
 	}
-	return nil
+	pair, err := NewSessionService().Create(user, userAgent, ip, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
 }
 
 // 根据用户ID获取用户信息
@@ -144,9 +168,18 @@ func (s *AccountService) UpdateUser(userID int, updates map[string]interface{})
 		return fmt.Errorf("查询用户失败：%v", err)
 	}
 
-	// 更新字段
+	// 更新字段，修改邮箱后需要重新验证
+	emailChanged := false
 	if email, ok := updates["email"].(string); ok && email != "" {
-		user.Email = email
+		email, err := normalizeEmail(email)
+		if err != nil {
+			return err
+		}
+		if email != user.Email {
+			user.Email = email
+			user.EmailVerifiedAt = nil
+			emailChanged = true
+		}
 	}
 
 	if password, ok := updates["password"].(string); ok && password != "" {
@@ -163,6 +196,9 @@ func (s *AccountService) UpdateUser(userID int, updates map[string]interface{})
 		return fmt.Errorf("更新用户失败：%v", err)
 	}
 
+	if emailChanged {
+		s.sendVerification(&user)
+	}
 	return nil
 }
 
@@ -199,20 +235,6 @@ func (s *AccountService) UpdateAvatar(userID int, newAvatarName string) (string,
 
 // 更新组织
 
-func (s *AccountService) UpdateOrg(userID int, org int) error {
-	var user model.User
-	err := s.db.Where("id = ?", userID).First(&user).Error
-	if err != nil {
-		return fmt.Errorf("查询用户失败：%v", err)
-	}
-	user.Org = org
-	err = s.db.Save(&user).Error
-	if err != nil {
-		return fmt.Errorf("更新组织失败：%v", err)
-	}
-	return nil
-}
-
 func (s *AccountService) GetUserNameById(userID int) (string, error) {
 	var user model.User
 	err := s.db.Where("id = ?", userID).First(&user).Error
@@ -222,39 +244,26 @@ func (s *AccountService) GetUserNameById(userID int) (string, error) {
 	return user.Username, nil
 }
 
-// 辅助方法
-
-// 生成JWT令牌
-func (s *AccountService) generateJWT(user *model.User) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // 24小时过期
-
-	claims := &model.Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Org:      user.Org,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
+// sendVerification 发送验证邮件，失败只记录日志
+func (s *AccountService) sendVerification(user *model.User) {
+	emailService, err := NewEmailService()
+	if err == nil {
+		err = emailService.SendVerification(user)
+	}
+	if err != nil {
+		log.Printf("给用户 %d 发送验证邮件失败：%v", user.ID, err)
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(model.JWT_SECRET))
 }
 
-// saveToken 保存令牌
-func (s *AccountService) saveToken(userID int, token string) error {
-	tokenRecord := &model.Token{
-		Token:     token,
-		UserID:    userID,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+// normalizeEmail 校验邮箱格式，只接受不带显示名的地址
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", fmt.Errorf("邮箱格式不正确")
 	}
-
-	err := s.db.Create(tokenRecord).Error
-	if err != nil {
-		return fmt.Errorf("保存令牌失败：%v", err)
+	if len(email) > maxEmailLength {
+		return "", fmt.Errorf("邮箱不能超过 %d 个字符", maxEmailLength)
 	}
-
-	return nil
+	return email, nil
 }
@@ -3,7 +3,6 @@ package service
 import (
 	"application/model"
 	"application/pkg/fabric"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -13,11 +12,12 @@ import (
 )
 
 type AssetService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	ledger fabric.LedgerClient
 }
 
-func NewAssetService(db *gorm.DB) *AssetService {
-	return &AssetService{db: db}
+func NewAssetService(db *gorm.DB, ledger fabric.LedgerClient) *AssetService {
+	return &AssetService{db: db, ledger: ledger}
 }
 
 // 创建 nft 资产
@@ -27,78 +27,80 @@ func (s *AssetService) CreateAsset(name string, imageName string, authorId int,
 	if err != nil {
 		return model.Asset{}, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
 	uid := uuid.New().String()
-	result, err := contract.SubmitTransaction("CreateAsset", uid, imageName, name, fmt.Sprintf("%d", authorId),
-		fmt.Sprintf("%d", ownerId), description, time.Now().Format(time.RFC3339))
+	asset, err := s.ledger.CreateAsset(orgName, uid, imageName, name, authorId, ownerId, description, time.Now())
 	if err != nil {
 		return model.Asset{}, fmt.Errorf("创建 NFT 失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	var asset model.Asset
-	err = json.Unmarshal(result, &asset)
-	if err != nil {
-		return model.Asset{}, fmt.Errorf("解析数据失败：%s", err)
-	}
 	return asset, nil
 }
 
 func (s *AssetService) GetAssetByID(id string, org int) (model.Asset, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetAsset(id)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getAssetByIDFromChain(id, org)
+}
+
+// getAssetByIDFromChain 直接查询链上
+func (s *AssetService) getAssetByIDFromChain(id string, org int) (model.Asset, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return model.Asset{}, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	result, err := contract.EvaluateTransaction("GetAssetByID", id)
+	asset, err := s.ledger.GetAsset(orgName, id)
 	if err != nil {
 		return model.Asset{}, fmt.Errorf("获取 NFT 失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	var asset model.Asset
-	err = json.Unmarshal(result, &asset)
-	if err != nil {
-		return model.Asset{}, fmt.Errorf("解析数据失败：%s", err)
-	}
 	return asset, nil
 }
 
 func (s *AssetService) GetAssetByAuthorID(authorId int, org int) ([]model.Asset, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetAssetsByAuthor(authorId)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getAssetByAuthorIDFromChain(authorId, org)
+}
+
+// getAssetByAuthorIDFromChain 直接查询链上
+func (s *AssetService) getAssetByAuthorIDFromChain(authorId int, org int) ([]model.Asset, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return nil, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	results, err := contract.EvaluateTransaction("GetAssetByAuthorID", fmt.Sprintf("%d", authorId))
+	assets, err := s.ledger.GetAssetsByAuthor(orgName, authorId)
 	if err != nil {
 		return nil, fmt.Errorf("获取 NFT 失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	if len(results) == 0 {
-		return nil, nil
-	}
-	var assets []model.Asset
-	err = json.Unmarshal(results, &assets)
-	if err != nil {
-		return nil, fmt.Errorf("解析数据失败：%s", err)
-	}
 	return assets, nil
 }
 
 func (s *AssetService) GetAssetByOwnerID(ownerId int, org int) ([]model.Asset, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetAssetsByOwner(ownerId)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getAssetByOwnerIDFromChain(ownerId, org)
+}
+
+// getAssetByOwnerIDFromChain 直接查询链上
+func (s *AssetService) getAssetByOwnerIDFromChain(ownerId int, org int) ([]model.Asset, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return nil, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	results, err := contract.EvaluateTransaction("GetAssetByOwnerID", fmt.Sprintf("%d", ownerId))
+	assets, err := s.ledger.GetAssetsByOwner(orgName, ownerId)
 	if err != nil {
 		return nil, fmt.Errorf("获取 NFT 失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	if len(results) == 0 {
-		return nil, nil
-	}
-	var assets []model.Asset
-	err = json.Unmarshal(results, &assets)
-	if err != nil {
-		return nil, fmt.Errorf("解析数据失败：%s", err)
-	}
 	return assets, nil
 }
 
@@ -107,14 +109,89 @@ func (s *AssetService) TransferAsset(id string, newOwnerId int, userID int, org
 	if err != nil {
 		return fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	_, err = contract.SubmitTransaction("TransferAsset", id, fmt.Sprintf("%d", newOwnerId), fmt.Sprintf("%d", userID), time.Now().Format(time.RFC3339))
+	err = s.ledger.TransferAsset(orgName, id, newOwnerId, userID, time.Now())
 	if err != nil {
 		return fmt.Errorf("转移NFT失败：%s", fabric.ExtractErrorMessage(err))
 	}
 	return nil
 }
 
+// 修改 NFT 元数据（仅作者且仍持有时）
+func (s *AssetService) UpdateAssetMetadata(id string, name string, description string, userID int, org int) (model.Asset, error) {
+	orgName, err := model.GetOrg(org)
+	if err != nil {
+		return model.Asset{}, fmt.Errorf("获取组织失败：%s", err)
+	}
+	asset, err := s.ledger.UpdateAssetMetadata(orgName, id, name, description, userID)
+	if err != nil {
+		return model.Asset{}, fmt.Errorf("修改 NFT 元数据失败：%s", fabric.ExtractErrorMessage(err))
+	}
+	return asset, nil
+}
+
+// 查询 NFT 的历史版本
+func (s *AssetService) GetAssetHistory(id string, org int) ([]model.AssetVersion, error) {
+	orgName, err := model.GetOrg(org)
+	if err != nil {
+		return nil, fmt.Errorf("获取组织失败：%s", err)
+	}
+	versions, err := s.ledger.GetAssetHistory(orgName, id)
+	if err != nil {
+		return nil, fmt.Errorf("获取 NFT 历史失败：%s", fabric.ExtractErrorMessage(err))
+	}
+	return versions, nil
+}
+
+// 创建限量系列，全部编号的拷贝初始归作者所有
+func (s *AssetService) CreateEditionSeries(name string, imageName string, authorId int,
+	description string, supply int, org int) (model.EditionSeries, error) {
+	orgName, err := model.GetOrg(org)
+	if err != nil {
+		return model.EditionSeries{}, fmt.Errorf("获取组织失败：%s", err)
+	}
+	uid := uuid.New().String()
+	series, err := s.ledger.CreateEditionSeries(orgName, uid, imageName, name, authorId, description, supply, time.Now())
+	if err != nil {
+		return model.EditionSeries{}, fmt.Errorf("创建限量系列失败：%s", fabric.ExtractErrorMessage(err))
+	}
+	return series, nil
+}
+
+func (s *AssetService) GetEditionSeries(id string, org int) (model.EditionSeries, error) {
+	orgName, err := model.GetOrg(org)
+	if err != nil {
+		return model.EditionSeries{}, fmt.Errorf("获取组织失败：%s", err)
+	}
+	series, err := s.ledger.GetEditionSeries(orgName, id)
+	if err != nil {
+		return model.EditionSeries{}, fmt.Errorf("获取限量系列失败：%s", fabric.ExtractErrorMessage(err))
+	}
+	return series, nil
+}
+
+func (s *AssetService) GetEditionsBySeriesID(id string, org int) ([]model.Asset, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetAssetsBySeries(id)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getEditionsBySeriesIDFromChain(id, org)
+}
+
+// getEditionsBySeriesIDFromChain 直接查询链上
+func (s *AssetService) getEditionsBySeriesIDFromChain(id string, org int) ([]model.Asset, error) {
+	orgName, err := model.GetOrg(org)
+	if err != nil {
+		return nil, fmt.Errorf("获取组织失败：%s", err)
+	}
+	assets, err := s.ledger.GetEditionsBySeries(orgName, id)
+	if err != nil {
+		return nil, fmt.Errorf("获取限量版失败：%s", fabric.ExtractErrorMessage(err))
+	}
+	return assets, nil
+}
+
 // 查询 NFT 资产状态
 // 0: 未上架
 // 1: 普通出售
@@ -3,19 +3,24 @@ package service
 import (
 	"application/model"
 	"application/pkg/fabric"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// 拍卖到期但无人出价，流拍结果已记录
+var ErrNoBids = errors.New("当前无出价，交易失败")
+
 type AuctionService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	ledger fabric.LedgerClient
 }
 
-func NewAuctionService(db *gorm.DB) *AuctionService {
-	return &AuctionService{db: db}
+func NewAuctionService(db *gorm.DB, ledger fabric.LedgerClient) *AuctionService {
+	return &AuctionService{db: db, ledger: ledger}
 }
 
 func (s *AuctionService) CreateLot(AssetID string, Title string, ReservePrice int, SellerID int,
@@ -78,51 +83,181 @@ func (s *AuctionService) GetAllLots() ([]model.Lot, error) {
 	return lots, nil
 }
 
+// 拍品在链上的冻结键，与挂牌的冻结键（挂牌 ID）区分开
+func lotHoldKey(lotID int) string {
+	return fmt.Sprintf("lot-%d", lotID)
+}
+
+// 出价的预扣款 ID 由拍品、出价人和出价推导，提交结果不明时可以据此确认是否已经冻结
+func bidHoldID(lotID int, bidderID int, price int) string {
+	return fmt.Sprintf("lot-%d-bid-%d-%d", lotID, bidderID, price)
+}
+
+// 出价时在链上冻结资金：同一出价人加价时只冻结差额，冻结总额始终等于当前出价
+// 先在拍品行锁内登记出价并标记为冻结中，链上冻结在事务外提交，失败时恢复原出价
 func (s *AuctionService) SubmitBid(LotID int, BidderID int, BidPrice int, BidderOrg int) error {
-	// 检查出价是否高于当前价
-	lot := model.Lot{}
-	err := s.db.Where("id = ?", LotID).First(&lot).Error
+	prev := model.Bid{} // 加价前的出价，ID 为 0 表示首次出价
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		lot := model.Lot{}
+		if err := model.ForUpdate(tx).Where("id = ?", LotID).First(&lot).Error; err != nil {
+			return fmt.Errorf("查询拍品失败：%v", err)
+		}
+		// 拍卖未开始或者已结束
+		if lot.Deadline.Before(time.Now()) || lot.StartTime.After(time.Now()) {
+			return fmt.Errorf("拍卖品未开始或者已结束，不允许出价")
+		}
+		// 开始结算后不能再出价，否则冻结的资金没有人退还
+		if lot.Settling {
+			return fmt.Errorf("拍卖正在结算，不允许出价")
+		}
+		var finished int64
+		if err := tx.Model(&model.AuctionResult{}).Where("lot_id = ?", LotID).Count(&finished).Error; err != nil {
+			return fmt.Errorf("查询拍卖结果失败：%v", err)
+		}
+		if finished > 0 {
+			return fmt.Errorf("拍卖已结束")
+		}
+		if BidPrice <= lot.CurrentPrice {
+			return fmt.Errorf("出价必须高于当前价")
+		}
+		err := tx.Where("lot_id = ? and bidder_id = ?", LotID, BidderID).First(&prev).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("查询出价失败：%v", err)
+		}
+		if prev.HoldPending {
+			return fmt.Errorf("上一次出价正在冻结资金，请稍后再试")
+		}
+		bid := prev
+		if prev.ID == 0 {
+			bid = model.Bid{LotID: LotID, BidderID: BidderID, BidderOrg: BidderOrg}
+		}
+		bid.BidPrice = BidPrice
+		bid.HoldPending = true
+		if err := tx.Save(&bid).Error; err != nil {
+			return fmt.Errorf("更新出价失败：%v", err)
+		}
+		if err := tx.Model(&model.Lot{}).Where("id = ?", LotID).Update("current_price", BidPrice).Error; err != nil {
+			return fmt.Errorf("更新拍品当前价失败：%v", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("查询拍品失败：%v", err)
+		return err
 	}
-	// 拍卖未开始或者已结束
-	if lot.Deadline.Before(time.Now()) || lot.StartTime.After(time.Now()) {
-		return fmt.Errorf("拍卖品未开始或者已结束，不允许出价")
+
+	// 旧出价没有冻结时按首次出价处理，冻结全部金额
+	amount := BidPrice
+	if prev.Escrowed {
+		amount -= prev.BidPrice
 	}
-	if BidPrice <= lot.CurrentPrice {
-		return fmt.Errorf("出价必须高于当前价")
+	w := NewWalletService(s.ledger)
+	holdID := bidHoldID(LotID, BidderID, BidPrice)
+	if holdErr := w.WithHoldAccountWithID(holdID, BidderID, lotHoldKey(LotID), amount, BidderOrg); holdErr != nil {
+		held, err := s.holdOnChain(LotID, holdID)
+		if err != nil {
+			// 无法确认是否已经冻结，出价保持冻结中，结算前由 resolvePendingBids 按链上状态修正
+			log.Printf("拍品 %d 查询预扣款 %s 失败：%v", LotID, holdID, err)
+			return holdErr
+		}
+		if !held {
+			if err := s.revertBid(LotID, BidderID, prev); err != nil {
+				log.Printf("拍品 %d 出价人 %d 恢复原出价失败：%v", LotID, BidderID, err)
+			}
+			return holdErr
+		}
 	}
-	// 更新拍品当前价
-	lot.CurrentPrice = BidPrice
-	err = s.db.Save(lot).Error
+	return s.db.Model(&model.Bid{}).
+		Where("lot_id = ? and bidder_id = ?", LotID, BidderID).
+		Updates(map[string]any{"escrowed": true, "hold_pending": false}).Error
+}
+
+// 链上是否已有指定的预扣款
+func (s *AuctionService) holdOnChain(lotID int, holdID string) (bool, error) {
+	holdings, err := NewWalletService(s.ledger).getWithHoldingByListingIDFromChain(lotHoldKey(lotID), workflowOrg)
 	if err != nil {
-		return fmt.Errorf("更新拍品当前价失败：%v", err)
+		return false, err
 	}
-	// 检查该用户是否已有出价
-	// 如果不存在则创建
-	// 如果存在则更新
-	bid := model.Bid{}
-	err = s.db.Where("lot_id = ? and bidder_id = ?", LotID, BidderID).First(&bid).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			bid = model.Bid{
-				LotID:     LotID,
-				BidderID:  BidderID,
-				BidderOrg: BidderOrg,
-				BidPrice:  BidPrice,
-			}
-			return s.db.Create(&bid).Error
+	for _, h := range holdings {
+		if h.ID == holdID {
+			return true, nil
 		}
-		return fmt.Errorf("查询出价失败：%v", err)
 	}
-	bid.BidPrice = BidPrice
-	err = s.db.Save(bid).Error
+	return false, nil
+}
+
+// 冻结结果不明的出价超过该时间后按链上状态修正，需要长于一次链上提交的最长等待时间
+const pendingBidTimeout = 5 * time.Minute
+
+// 修正冻结结果不明的出价（提交后进程退出或确认时查询失败）：
+// 本次冻结已上链则标记为已冻结，否则恢复为链上实际冻结的金额，链上没有冻结时删除出价
+func (s *AuctionService) resolvePendingBids(lotID int) error {
+	var bids []model.Bid
+	err := s.db.Where("lot_id = ? and hold_pending = ? and update_time < ?", lotID, true, time.Now().Add(-pendingBidTimeout)).
+		Find(&bids).Error
+	if err != nil || len(bids) == 0 {
+		return err
+	}
+	holdings, err := NewWalletService(s.ledger).getWithHoldingByListingIDFromChain(lotHoldKey(lotID), workflowOrg)
 	if err != nil {
-		return fmt.Errorf("更新出价失败：%v", err)
+		return err
+	}
+	for _, bid := range bids {
+		held, confirmed := 0, false
+		for _, h := range holdings {
+			if h.AccountID != bid.BidderID {
+				continue
+			}
+			held += h.Amount
+			if h.ID == bidHoldID(lotID, bid.BidderID, bid.BidPrice) {
+				confirmed = true
+			}
+		}
+		if confirmed {
+			err = s.db.Model(&model.Bid{}).Where("id = ?", bid.ID).
+				Updates(map[string]any{"escrowed": true, "hold_pending": false}).Error
+		} else {
+			prev := model.Bid{}
+			if held > 0 {
+				prev = model.Bid{ID: bid.ID, BidPrice: held, Escrowed: true}
+			}
+			err = s.revertBid(lotID, bid.BidderID, prev)
+		}
+		if err != nil {
+			return fmt.Errorf("修正出价人 %d 的出价失败：%v", bid.BidderID, err)
+		}
 	}
 	return nil
 }
 
+// 链上冻结失败时恢复加价前的出价，拍品当前价恢复为剩余出价中的最高价
+func (s *AuctionService) revertBid(lotID int, bidderID int, prev model.Bid) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		lot := model.Lot{}
+		if err := model.ForUpdate(tx).Where("id = ?", lotID).First(&lot).Error; err != nil {
+			return err
+		}
+		bids := tx.Model(&model.Bid{}).Where("lot_id = ? and bidder_id = ?", lotID, bidderID)
+		if prev.ID == 0 {
+			if err := bids.Delete(&model.Bid{}).Error; err != nil {
+				return err
+			}
+		} else if err := bids.Updates(map[string]any{
+			"bid_price": prev.BidPrice, "escrowed": prev.Escrowed, "hold_pending": false,
+		}).Error; err != nil {
+			return err
+		}
+		var top *int
+		if err := tx.Model(&model.Bid{}).Where("lot_id = ?", lotID).Select("MAX(bid_price)").Scan(&top).Error; err != nil {
+			return err
+		}
+		price := lot.ReservePrice
+		if top != nil && *top > price {
+			price = *top
+		}
+		return tx.Model(&model.Lot{}).Where("id = ?", lotID).Update("current_price", price).Error
+	})
+}
+
 func (s *AuctionService) GetBidPrice(LotID int, BidderID int) (int, error) {
 	bid := model.Bid{}
 	err := s.db.Where("lot_id = ? and bidder_id = ?", LotID, BidderID).First(&bid).Error
@@ -135,56 +270,156 @@ func (s *AuctionService) GetBidPrice(LotID int, BidderID int) (int, error) {
 	return bid.BidPrice, nil
 }
 
+// 结算拍卖：在拍品行锁内确认尚未结算，链上步骤在事务外执行
+// 先退还落选出价，再把 NFT 过户给赢家，最后把赢家冻结的资金释放给卖家
+// 每一步都使用由拍品推导的固定 txid 或先检查链上状态，中途失败后重复结算不会重复记账
 func (s *AuctionService) FinishAuction(LotID int) error {
+	if err := s.resolvePendingBids(LotID); err != nil {
+		return err
+	}
 	lot := model.Lot{}
-	bid := model.Bid{}
-	// 查询当前最高出价者
-	err := s.db.Where("lot_id = ?", LotID).Order("bid_price desc").First(&bid).Error
-	if err != nil {
-		// 无人出价，交易失败
-		if err == gorm.ErrRecordNotFound {
-			auctionResult := model.AuctionResult{
-				LotID:    LotID,
-				BidPrice: 0,
-				BidderID: 0,
+	var bids []model.Bid
+	noBids := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := model.ForUpdate(tx).Where("id = ?", LotID).First(&lot).Error; err != nil {
+			return fmt.Errorf("查询拍品失败：%v", err)
+		}
+		// 截止时间在拍品行锁内检查，与出价互斥，截止前结算会让之后的出价冻结的资金无人退还
+		if lot.Deadline.After(time.Now()) {
+			return fmt.Errorf("拍卖尚未截止，不能结算")
+		}
+		// 已有拍卖结果说明已经结算过，避免重复转账
+		var finished int64
+		if err := tx.Model(&model.AuctionResult{}).Where("lot_id = ?", LotID).Count(&finished).Error; err != nil {
+			return fmt.Errorf("查询拍卖结果失败：%v", err)
+		}
+		if finished > 0 {
+			return fmt.Errorf("拍卖已结束")
+		}
+		if err := tx.Where("lot_id = ?", LotID).Order("bid_price desc").Find(&bids).Error; err != nil {
+			return fmt.Errorf("查询出价失败：%v", err)
+		}
+		for _, bid := range bids {
+			if bid.HoldPending {
+				return fmt.Errorf("出价人 %d 的出价正在冻结资金，稍后再结算", bid.BidderID)
 			}
-			err = s.db.Create(&auctionResult).Error
-			if err != nil {
+		}
+		if err := tx.Model(&model.Lot{}).Where("id = ?", LotID).Update("settling", true).Error; err != nil {
+			return fmt.Errorf("标记拍品结算中失败：%v", err)
+		}
+		if len(bids) == 0 {
+			// 无人出价，交易失败
+			noBids = true
+			if err := tx.Create(&model.AuctionResult{LotID: LotID}).Error; err != nil {
 				return fmt.Errorf("记录拍卖结果失败：%v", err)
 			}
-			return fmt.Errorf("当前无出价，交易失败")
 		}
-		return fmt.Errorf("查询最高出价失败：%v", err)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if noBids {
+		return ErrNoBids
 	}
-	// 查询拍品
-	err = s.db.Where("id = ?", LotID).First(&lot).Error
+
+	w := NewWalletService(s.ledger)
+	as := NewAssetService(s.db, s.ledger)
+	winner := bids[0]
+	// 1) 退还落选出价
+	for _, bid := range bids[1:] {
+		if err := s.refundBid(lot, bid); err != nil {
+			return err
+		}
+	}
+	// 2) 升级前的出价没有冻结，赢家先直接付款，付款失败时 NFT 不会移动
+	paymentID := fmt.Sprintf("lot-%d-payment", LotID)
+	if !winner.Escrowed {
+		if err := w.TransferWithID(paymentID, winner.BidderID, lot.SellerID, winner.BidPrice, winner.BidderOrg); err != nil {
+			return err
+		}
+	}
+	// 3) NFT 过户，上次已经过户时跳过
+	asset, err := as.getAssetByIDFromChain(lot.AssetID, winner.BidderOrg)
 	if err != nil {
+		return err
+	}
+	switch asset.OwnerId {
+	case winner.BidderID:
+	case lot.SellerID:
+		if err := as.TransferAsset(lot.AssetID, winner.BidderID, lot.SellerID, lot.SellerOrg); err != nil {
+			return err
+		}
+	default:
+		// 卖家在拍卖期间转走了 NFT，重试也无法完成，退还赢家的资金并按流拍记录
+		if winner.Escrowed {
+			if err := s.refundBid(lot, winner); err != nil {
+				return err
+			}
+		} else if err := w.TransferWithID(paymentID+"-c", lot.SellerID, winner.BidderID, winner.BidPrice, lot.SellerOrg); err != nil {
+			return err
+		}
+		log.Printf("拍品 %d 的 NFT %s 当前持有人为 %d，拍卖取消，出价已退还", LotID, lot.AssetID, asset.OwnerId)
+		return s.recordResult(model.AuctionResult{LotID: LotID})
+	}
+	// 4) 赢家冻结的资金释放给卖家
+	if winner.Escrowed {
+		err := w.ReleaseHoldingWithID(fmt.Sprintf("lot-%d-payout", LotID), lotHoldKey(LotID), winner.BidderID, lot.SellerID, winner.BidPrice, workflowOrg)
+		if err != nil {
+			return err
+		}
+	}
+	return s.recordResult(model.AuctionResult{LotID: LotID, BidPrice: winner.BidPrice, BidderID: winner.BidderID})
+}
+
+// 卖家手动结算自己的拍品，与定时任务一样只能结算已截止的拍卖
+func (s *AuctionService) FinishAuctionBySeller(LotID int, SellerID int) error {
+	lot := model.Lot{}
+	if err := s.db.Where("id = ?", LotID).First(&lot).Error; err != nil {
 		return fmt.Errorf("查询拍品失败：%v", err)
 	}
-	orgName, err := model.GetOrg(bid.BidderOrg)
-	if err != nil {
-		return fmt.Errorf("获取组织失败：%s", err)
+	if lot.SellerID != SellerID {
+		return fmt.Errorf("只有卖家可以结算拍卖")
 	}
-	contract := fabric.GetContract(orgName)
-	// 转移 NFT 的所有权
-	_, err = contract.SubmitTransaction("TransferAsset", lot.AssetID, fmt.Sprintf("%d", bid.BidderID),
-		fmt.Sprintf("%d", lot.SellerID), time.Now().Format(time.RFC3339))
-	if err != nil {
-		return fmt.Errorf("转移 NFT 的所有权失败：%v", err)
+	return s.FinishAuction(LotID)
+}
+
+// 退还一个出价冻结的资金，升级前没有冻结的出价不需要退款
+func (s *AuctionService) refundBid(lot model.Lot, bid model.Bid) error {
+	if !bid.Escrowed {
+		return nil
+	}
+	txid := fmt.Sprintf("lot-%d-refund-%d", lot.ID, bid.BidderID)
+	return NewWalletService(s.ledger).RefundHoldingWithID(txid, lotHoldKey(lot.ID), bid.BidderID, bid.BidPrice, workflowOrg)
+}
+
+// 记录拍卖结果，lot_id 上有唯一索引，并发结算时已有结果说明另一次已经完成
+func (s *AuctionService) recordResult(result model.AuctionResult) error {
+	if err := s.db.Create(&result).Error; err != nil {
+		var finished int64
+		if s.db.Model(&model.AuctionResult{}).Where("lot_id = ?", result.LotID).Count(&finished).Error == nil && finished > 0 {
+			return nil
+		}
+		return fmt.Errorf("记录拍卖结果失败：%v", err)
 	}
-	// 转账
-	_, err = contract.SubmitTransaction("Transfer", uuid.New().String(), fmt.Sprintf("%d", bid.BidderID), fmt.Sprintf("%d", lot.SellerID),
-		fmt.Sprintf("%d", bid.BidPrice), time.Now().Format(time.RFC3339))
+	return nil
+}
+
+// 定时任务：结算所有已到期但还没有结果的拍卖
+func (s *AuctionService) FinishExpiredLots() error {
+	var lots []model.Lot
+	err := s.db.Where("deadline <= ? AND id NOT IN (?)", time.Now(),
+		s.db.Model(&model.AuctionResult{}).Select("lot_id")).Find(&lots).Error
 	if err != nil {
-		return fmt.Errorf("转账失败：%v", err)
+		return fmt.Errorf("查询到期拍品失败：%v", err)
 	}
-	// 记录拍卖结果
-	auctionResult := model.AuctionResult{
-		LotID:    LotID,
-		BidPrice: bid.BidPrice,
-		BidderID: bid.BidderID,
+	var errs []error
+	for _, lot := range lots {
+		if err := s.FinishAuction(lot.ID); err != nil && !errors.Is(err, ErrNoBids) {
+			errs = append(errs, fmt.Errorf("拍品 %d 结算失败：%v", lot.ID, err))
+		}
 	}
-	return s.db.Create(&auctionResult).Error
+	return errors.Join(errs...)
 }
 
 func (s *AuctionService) GetAuctionResult(LotID int) (model.AuctionResult, error) {
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"application/model"
+	"application/pkg/fabric"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type AuditService struct {
+	db     *gorm.DB
+	ledger fabric.LedgerClient
+}
+
+func NewAuditService(ledger fabric.LedgerClient) *AuditService {
+	return &AuditService{db: model.GetDB(), ledger: ledger}
+}
+
+// 执行一次账本审计，无论成功失败都记录到历史
+func (s *AuditService) RunAudit(userID int, org int) (*model.AuditRecord, error) {
+	orgName, err := model.GetOrg(org)
+	if err != nil {
+		return nil, fmt.Errorf("获取组织失败：%s", err)
+	}
+	record := &model.AuditRecord{TriggeredBy: userID}
+
+	report, err := s.ledger.AuditLedger(orgName)
+	if err != nil {
+		record.Error = fabric.ExtractErrorMessage(err)
+	} else {
+		result, err := json.Marshal(report)
+		if err != nil {
+			return nil, fmt.Errorf("序列化审计报告失败：%v", err)
+		}
+		record.Consistent = report.Consistent
+		record.IssueCount = len(report.Issues)
+		record.Report = string(result)
+	}
+
+	if err := s.db.Create(record).Error; err != nil {
+		return nil, fmt.Errorf("保存审计记录失败：%v", err)
+	}
+	if record.Error != "" {
+		return record, fmt.Errorf("账本审计失败：%s", record.Error)
+	}
+	return record, nil
+}
+
+// 分页查询审计历史（不含完整报告）
+func (s *AuditService) ListRecords(page, pageSize int) ([]model.AuditRecord, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+	var (
+		items []model.AuditRecord
+		total int64
+	)
+	q := s.db.Model(&model.AuditRecord{})
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Omit("report").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// 查询单次审计的完整报告
+func (s *AuditService) GetRecord(id int) (*model.AuditRecord, error) {
+	var record model.AuditRecord
+	if err := s.db.First(&record, id).Error; err != nil {
+		return nil, fmt.Errorf("查询审计记录失败：%v", err)
+	}
+	return &record, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"application/config"
+	"application/pkg/fabric"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// 区块哈希为 SHA-256 的十六进制表示
+var blockHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// BlockService 基于区块监听器本地存储的区块浏览
+type BlockService struct{}
+
+func NewBlockService() *BlockService {
+	return &BlockService{}
+}
+
+// 校验查询范围：空值查询通道区块（当前唯一在更新的数据），
+// 指定组织名时查询切换到通道监听之前按组织保存的旧数据
+func (s *BlockService) checkOrg(orgName string) (string, error) {
+	if fabric.GetBlockListener() == nil {
+		return "", errors.New("区块监听器未初始化")
+	}
+	if orgName == "" || orgName == fabric.GetBlockListener().Channel() {
+		return fabric.GetBlockListener().Channel(), nil
+	}
+	if _, ok := config.GlobalConfig.Fabric.Organizations[orgName]; !ok {
+		return "", fmt.Errorf("组织 %s 不存在", orgName)
+	}
+	return orgName, nil
+}
+
+// 分页查询区块列表（按区块号降序）
+func (s *BlockService) ListBlocks(orgName string, page, pageSize int) (*fabric.BlockQueryResult, error) {
+	orgName, err := s.checkOrg(orgName)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return fabric.GetBlockListener().GetBlocksByOrg(orgName, pageSize, page)
+}
+
+// 按区块号或区块哈希查询区块详情
+func (s *BlockService) GetBlock(orgName string, id string) (*fabric.BlockData, error) {
+	orgName, err := s.checkOrg(orgName)
+	if err != nil {
+		return nil, err
+	}
+	if blockHashPattern.MatchString(id) {
+		return fabric.GetBlockListener().GetBlockByHash(orgName, id)
+	}
+	num, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("请输入区块号或 64 位十六进制区块哈希")
+	}
+	return fabric.GetBlockListener().GetBlockByNumber(orgName, num)
+}
+
+// 按链上交易 ID 或业务 ID（转账 ID、冻结 ID、释放/退款 txid）查询交易及其提交状态
+func (s *BlockService) GetTransaction(id string) (*fabric.TxData, error) {
+	if fabric.GetBlockListener() == nil {
+		return nil, errors.New("区块监听器未初始化")
+	}
+	return fabric.GetBlockListener().GetTransaction(id)
+}
+
+// 校验组织的区块哈希链，refetch 为 true 时在后台重新拉取缺失或不一致的区块
+func (s *BlockService) VerifyChain(orgName string, refetch bool) (*fabric.ChainVerifyResult, error) {
+	orgName, err := s.checkOrg(orgName)
+	if err != nil {
+		return nil, err
+	}
+	return fabric.GetBlockListener().VerifyChain(orgName, refetch)
+}
+
+// 查询每个组织最近一次的哈希链校验结果
+func (s *BlockService) GetVerifyResults() (map[string]fabric.ChainVerifyResult, error) {
+	if fabric.GetBlockListener() == nil {
+		return nil, errors.New("区块监听器未初始化")
+	}
+	return fabric.GetBlockListener().GetVerifyResults()
+}
+
+// 查询每个组织的最新区块高度
+func (s *BlockService) GetLatestBlocks() (map[string]fabric.LatestBlock, error) {
+	if fabric.GetBlockListener() == nil {
+		return nil, errors.New("区块监听器未初始化")
+	}
+	return fabric.GetBlockListener().GetLatestBlocks()
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"application/model"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DropService struct {
+	db *gorm.DB
+}
+
+func NewDropService() *DropService {
+	return &DropService{db: model.GetDB()}
+}
+
+// 创建发售：把创作者自己的若干 OPEN 挂牌打包成一个 Drop
+func (s *DropService) CreateDrop(creatorID int, req *model.CreateDropRequest) (*model.Drop, error) {
+	if !req.StartTime.Before(req.PublicTime) || req.PublicTime.After(req.EndTime) {
+		return nil, errors.New("时间非法：需满足 开始时间 < 公开发售时间 <= 结束时间")
+	}
+	if req.EndTime.Before(time.Now()) {
+		return nil, errors.New("结束时间不能早于当前时间")
+	}
+	if req.PresalePrice <= 0 {
+		return nil, errors.New("预售价必须大于0")
+	}
+	if req.PerWalletCap < 0 {
+		return nil, errors.New("每个钱包购买上限不能为负数")
+	}
+	if len(req.ListingIDs) == 0 {
+		return nil, errors.New("发售至少需要包含一个挂牌")
+	}
+
+	drop := &model.Drop{
+		CreatorID:    creatorID,
+		Title:        req.Title,
+		StartTime:    req.StartTime,
+		PublicTime:   req.PublicTime,
+		EndTime:      req.EndTime,
+		PresalePrice: req.PresalePrice,
+		PerWalletCap: req.PerWalletCap,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var listings []model.MarketListing
+		if err := model.ForUpdate(tx).
+			Where("id IN ?", req.ListingIDs).Find(&listings).Error; err != nil {
+			return err
+		}
+		if len(listings) != len(req.ListingIDs) {
+			return errors.New("部分挂牌不存在")
+		}
+		for _, l := range listings {
+			if l.SellerID != creatorID {
+				return fmt.Errorf("挂牌 %d 不属于当前用户", l.ID)
+			}
+			if l.Status != model.ListingActive {
+				return fmt.Errorf("挂牌 %d 已不可售", l.ID)
+			}
+			if l.DropID != nil {
+				return fmt.Errorf("挂牌 %d 已属于其他发售", l.ID)
+			}
+		}
+		if err := tx.Create(drop).Error; err != nil {
+			return fmt.Errorf("保存发售失败：%v", err)
+		}
+		if err := tx.Model(&model.MarketListing{}).
+			Where("id IN ?", req.ListingIDs).
+			Updates(map[string]any{
+				"drop_id":     drop.ID,
+				"update_time": time.Now(),
+			}).Error; err != nil {
+			return fmt.Errorf("关联挂牌失败：%v", err)
+		}
+		return addAllowlistTx(tx, drop.ID, req.Allowlist)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return drop, nil
+}
+
+// 写入白名单，已存在的用户忽略
+func addAllowlistTx(tx *gorm.DB, dropID int, userIDs []int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	entries := make([]model.DropAllowlist, 0, len(userIDs))
+	for _, uid := range userIDs {
+		entries = append(entries, model.DropAllowlist{DropID: dropID, UserID: uid})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entries).Error; err != nil {
+		return fmt.Errorf("保存白名单失败：%v", err)
+	}
+	return nil
+}
+
+// 追加白名单（仅发售创建者）
+func (s *DropService) AddAllowlist(creatorID int, dropID int, userIDs []int) error {
+	var drop model.Drop
+	if err := s.db.First(&drop, dropID).Error; err != nil {
+		return err
+	}
+	if drop.CreatorID != creatorID {
+		return errors.New("无权修改该发售")
+	}
+	return addAllowlistTx(s.db, dropID, userIDs)
+}
+
+// 移除白名单（仅发售创建者）
+func (s *DropService) RemoveAllowlist(creatorID int, dropID int, userIDs []int) error {
+	var drop model.Drop
+	if err := s.db.First(&drop, dropID).Error; err != nil {
+		return err
+	}
+	if drop.CreatorID != creatorID {
+		return errors.New("无权修改该发售")
+	}
+	return s.db.Where("drop_id = ? AND user_id IN ?", dropID, userIDs).
+		Delete(&model.DropAllowlist{}).Error
+}
+
+// 查询所有未结束的发售
+func (s *DropService) ListDrops() ([]model.Drop, error) {
+	var drops []model.Drop
+	if err := s.db.Where("end_time > ?", time.Now()).Order("start_time").Find(&drops).Error; err != nil {
+		return nil, err
+	}
+	return drops, nil
+}
+
+// 查询发售详情及其挂牌，userID 用于返回当前用户是否在白名单中
+func (s *DropService) GetDrop(dropID int, userID int) (*model.Drop, []model.MarketListing, bool, error) {
+	var drop model.Drop
+	if err := s.db.First(&drop, dropID).Error; err != nil {
+		return nil, nil, false, err
+	}
+	var listings []model.MarketListing
+	if err := s.db.Where("drop_id = ?", dropID).Order("id").Find(&listings).Error; err != nil {
+		return nil, nil, false, err
+	}
+	var cnt int64
+	if err := s.db.Model(&model.DropAllowlist{}).
+		Where("drop_id = ? AND user_id = ?", dropID, userID).
+		Count(&cnt).Error; err != nil {
+		return nil, nil, false, err
+	}
+	return &drop, listings, cnt > 0, nil
+}
+
+// 在 BuyNow 的事务内校验发售规则，返回本次应付价格
+// 会对 Drop 行加锁，使同一发售下的购买串行化，保证每钱包上限的计数不被并发绕过
+func checkDropRulesTx(tx *gorm.DB, l *model.MarketListing, buyerID int, now time.Time) (int64, error) {
+	if l.DropID == nil {
+		return l.Price, nil
+	}
+	var drop model.Drop
+	if err := model.ForUpdate(tx).
+		First(&drop, *l.DropID).Error; err != nil {
+		return 0, fmt.Errorf("查询发售失败：%v", err)
+	}
+	if now.Before(drop.StartTime) {
+		return 0, errors.New("发售尚未开始")
+	}
+	if !now.Before(drop.EndTime) {
+		return 0, errors.New("发售已结束")
+	}
+
+	price := l.Price
+	if now.Before(drop.PublicTime) {
+		// 预售期：只有白名单用户可以购买，按预售价成交
+		var cnt int64
+		if err := tx.Model(&model.DropAllowlist{}).
+			Where("drop_id = ? AND user_id = ?", drop.ID, buyerID).
+			Count(&cnt).Error; err != nil {
+			return 0, fmt.Errorf("查询白名单失败：%v", err)
+		}
+		if cnt == 0 {
+			return 0, errors.New("预售期仅限白名单用户购买")
+		}
+		price = drop.PresalePrice
+	}
+
+	if drop.PerWalletCap > 0 {
+		var bought int64
+		if err := tx.Model(&model.MarketOffer{}).
+			Joins("JOIN market_listings ON market_listings.id = market_offers.listing_id").
+			Where("market_listings.drop_id = ? AND market_offers.bidder_id = ? AND market_offers.status = ?",
+				drop.ID, buyerID, model.OfferAccepted).
+			Count(&bought).Error; err != nil {
+			return 0, fmt.Errorf("查询购买记录失败：%v", err)
+		}
+		// 还在结算中的购买也要计入，否则并发购买可以绕过上限
+		var inflight int64
+		if err := tx.Model(&model.Workflow{}).
+			Joins("JOIN market_listings ON market_listings.id = workflows.listing_id").
+			Where("market_listings.drop_id = ? AND workflows.user_id = ? AND workflows.type = ? AND workflows.status IN ?",
+				drop.ID, buyerID, model.WorkflowBuyNow, model.WorkflowActiveStatuses).
+			Count(&inflight).Error; err != nil {
+			return 0, fmt.Errorf("查询购买记录失败：%v", err)
+		}
+		if int(bought+inflight) >= drop.PerWalletCap {
+			return 0, fmt.Errorf("已达到每个钱包最多购买 %d 件的上限", drop.PerWalletCap)
+		}
+	}
+	return price, nil
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"application/config"
+	"application/model"
+	"application/pkg/mail"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// EmailService 邮箱验证和密码重置
+// 验证链接是签名令牌（JWT），不落库；重置链接是随机令牌，数据库保存哈希，使用一次后失效
+type EmailService struct {
+	db       *gorm.DB
+	sender   mail.Sender
+	sessions *SessionService
+}
+
+func NewEmailService() (*EmailService, error) {
+	sender, err := mail.NewSender(config.GlobalConfig.Mail)
+	if err != nil {
+		return nil, err
+	}
+	return &EmailService{db: model.GetDB(), sender: sender, sessions: NewSessionService()}, nil
+}
+
+// SendVerification 发送邮箱验证邮件
+func (s *EmailService) SendVerification(user *model.User) error {
+	if user.EmailVerifiedAt != nil {
+		return fmt.Errorf("邮箱已验证")
+	}
+	now := time.Now()
+	claims := &model.EmailClaims{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Purpose: model.EmailVerifyPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(config.GlobalConfig.Auth.EmailVerifyTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.GlobalConfig.Auth.JWTSecret))
+	if err != nil {
+		return fmt.Errorf("生成验证令牌失败：%v", err)
+	}
+	return s.sender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "验证你的邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %s 内打开下面的链接完成邮箱验证，验证后才能进行交易：\n\n%s\n\n如果不是你本人注册，请忽略这封邮件。\n",
+			user.Username, config.GlobalConfig.Auth.EmailVerifyTTL, link("/verify-email", token)),
+	})
+}
+
+// Verify 校验验证令牌并标记邮箱已验证，令牌签发后修改过邮箱时失效
+func (s *EmailService) Verify(token string) error {
+	claims := &model.EmailClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.GlobalConfig.Auth.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsed.Valid || claims.Purpose != model.EmailVerifyPurpose {
+		return fmt.Errorf("验证链接无效或已过期")
+	}
+
+	var user model.User
+	if err := s.db.First(&user, claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("用户不存在")
+		}
+		return fmt.Errorf("查询用户失败：%v", err)
+	}
+	if !strings.EqualFold(user.Email, claims.Email) {
+		return fmt.Errorf("邮箱已修改，请重新发送验证邮件")
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	if err := s.db.Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("更新验证状态失败：%v", err)
+	}
+	return nil
+}
+
+// 同一用户两次申请重置链接的最短间隔，间隔内的申请直接忽略，防止被用来轰炸邮箱
+const resetCooldown = time.Minute
+
+// RequestPasswordReset 在后台给使用该邮箱的每个用户发送重置链接，失败只记录日志
+// 不返回结果，邮箱是否注册、发送是否成功都不会从响应内容或耗时上暴露
+func (s *EmailService) RequestPasswordReset(email string) {
+	go func() {
+		if err := s.SendPasswordReset(email); err != nil {
+			log.Printf("发送重置密码邮件失败：%v", err)
+		}
+	}()
+}
+
+// SendPasswordReset 给使用该邮箱的每个用户发送重置链接，之前未使用的链接作废
+// 距上次申请不到 resetCooldown 的用户跳过
+func (s *EmailService) SendPasswordReset(email string) error {
+	var users []model.User
+	if err := s.db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).Find(&users).Error; err != nil {
+		return fmt.Errorf("查询用户失败：%v", err)
+	}
+	var errs []error
+	for i := range users {
+		if err := s.sendReset(&users[i]); err != nil {
+			errs = append(errs, fmt.Errorf("用户 %d：%v", users[i].ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *EmailService) sendReset(user *model.User) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("生成重置令牌失败：%v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	ttl := config.GlobalConfig.Auth.PasswordResetTTL
+	skipped := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁住用户行，同一用户的并发申请依次判断冷却时间
+		if err := model.ForUpdate(tx).First(&model.User{}, user.ID).Error; err != nil {
+			return err
+		}
+		var recent int64
+		if err := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL AND create_time > ?", user.ID, time.Now().Add(-resetCooldown)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			skipped = true
+			return nil
+		}
+		if err := invalidateResetTokensTx(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Create(&model.PasswordResetToken{
+			Token:     hashToken(token),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("保存重置令牌失败：%v", err)
+	}
+	if skipped {
+		log.Printf("用户 %d 在 %s 内已申请过重置链接，本次忽略", user.ID, resetCooldown)
+		return nil
+	}
+	return s.sender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "重置密码",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %s 内打开下面的链接重置密码，链接只能使用一次：\n\n%s\n\n如果不是你本人操作，请忽略这封邮件，你的密码不会改变。\n",
+			user.Username, ttl, link("/reset-password", token)),
+	})
+}
+
+// ResetPassword 用重置令牌设置新密码，成功后注销该用户的全部会话
+// 重置链接发到了用户的邮箱，能打开链接说明邮箱属于用户，未验证的邮箱同时标记为已验证
+func (s *EmailService) ResetPassword(token string, password string) error {
+	if password == "" {
+		return fmt.Errorf("新密码不能为空")
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("密码加密失败：%v", err)
+	}
+
+	var userID int
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var reset model.PasswordResetToken
+		if err := model.ForUpdate(tx).Where("token = ?", hashToken(token)).First(&reset).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("重置链接无效")
+			}
+			return fmt.Errorf("查询重置令牌失败：%v", err)
+		}
+		if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+			return fmt.Errorf("重置链接已使用或已过期")
+		}
+		userID = reset.UserID
+
+		var user model.User
+		if err := tx.First(&user, reset.UserID).Error; err != nil {
+			return fmt.Errorf("查询用户失败：%v", err)
+		}
+		updates := map[string]any{"password_hash": string(passwordHash)}
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return fmt.Errorf("更新密码失败：%v", err)
+		}
+		return invalidateResetTokensTx(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := s.sessions.RevokeOthers(userID, "", model.SessionPasswordReset); err != nil {
+		log.Printf("用户 %d 重置密码后注销会话失败：%v", userID, err)
+	}
+	return nil
+}
+
+// CleanupExpired 定时任务：删除过期的重置令牌
+func (s *EmailService) CleanupExpired() error {
+	if err := s.db.Where("expires_at < ?", time.Now()).Delete(&model.PasswordResetToken{}).Error; err != nil {
+		return fmt.Errorf("清理重置令牌失败：%v", err)
+	}
+	return nil
+}
+
+// invalidateResetTokensTx 把用户未使用的重置令牌标记为已使用
+func invalidateResetTokensTx(tx *gorm.DB, userID int) error {
+	return tx.Model(&model.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
+
+// link 邮件中指向前端页面的链接
+func link(path string, token string) string {
+	return strings.TrimRight(config.GlobalConfig.Mail.LinkBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"application/config"
+	"application/model"
+	"application/pkg/fabric"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdentityService 管理用户和组织服务在 Fabric CA 登记的链上身份，实现 fabric.IdentityStore
+type IdentityService struct {
+	db *gorm.DB
+}
+
+func NewIdentityService() *IdentityService {
+	return &IdentityService{db: model.GetDB()}
+}
+
+// Enroll 在用户所属组织的 CA 登记新身份，私钥加密后保存，原组织签发的身份被替换
+// 登记在锁住用户行的事务中进行，并发请求只登记一次，后到的直接返回已保存的身份
+// 组织未配置 CA 时返回 nil，该用户不能提交链上交易（配置校验要求每个组织都配置 CA，只有测试中会出现）
+func (s *IdentityService) Enroll(user *model.User) (*model.FabricIdentity, error) {
+	var identity *model.FabricIdentity
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 重新读取用户，组织以加锁后的为准
+		var locked model.User
+		if err := model.ForUpdate(tx).Where("id = ?", user.ID).First(&locked).Error; err != nil {
+			return fmt.Errorf("查询用户失败：%v", err)
+		}
+		orgName, err := model.GetOrg(locked.Org)
+		if err != nil {
+			return fmt.Errorf("获取组织失败：%v", err)
+		}
+
+		var existing model.FabricIdentity
+		err = tx.Where("user_id = ?", locked.ID).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("查询链上身份失败：%v", err)
+		}
+		if err == nil && existing.OrgName == orgName {
+			identity = &existing
+			return nil
+		}
+
+		ca := fabric.GetCAClient(orgName)
+		if ca == nil {
+			return nil
+		}
+		// CN 中的账户 ID 供链码校验调用方，随机后缀保证重新登记时不与旧身份冲突
+		suffix := make([]byte, 4)
+		if _, err := rand.Read(suffix); err != nil {
+			return fmt.Errorf("生成身份名失败：%v", err)
+		}
+		enrollmentID := fmt.Sprintf("user-%d.%s", locked.ID, hex.EncodeToString(suffix))
+		certPEM, keyPEM, err := ca.EnrollUser(enrollmentID)
+		if err != nil {
+			return err
+		}
+		sealed, err := sealPrivateKey(keyPEM)
+		if err != nil {
+			return err
+		}
+
+		identity = &model.FabricIdentity{
+			UserID:         locked.ID,
+			OrgName:        orgName,
+			MSPID:          config.GlobalConfig.Fabric.Organizations[orgName].MSPID,
+			EnrollmentID:   enrollmentID,
+			CertificatePEM: string(certPEM),
+			PrivateKey:     sealed,
+		}
+		if err := tx.Save(identity).Error; err != nil {
+			return fmt.Errorf("保存链上身份失败：%v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// UserIdentity 用户当前组织的链上身份，没有或组织已变更时重新登记
+func (s *IdentityService) UserIdentity(userID int) (*fabric.UserIdentity, error) {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("用户不存在")
+		}
+		return nil, fmt.Errorf("查询用户失败：%v", err)
+	}
+	orgName, err := model.GetOrg(user.Org)
+	if err != nil {
+		return nil, fmt.Errorf("获取组织失败：%v", err)
+	}
+
+	var identity model.FabricIdentity
+	err = s.db.Where("user_id = ?", userID).First(&identity).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询链上身份失败：%v", err)
+	}
+	stored := &identity
+	if err != nil || identity.OrgName != orgName {
+		if stored, err = s.Enroll(&user); err != nil {
+			return nil, err
+		}
+		if stored == nil {
+			return nil, nil
+		}
+	}
+
+	keyPEM, err := openPrivateKey(stored.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &fabric.UserIdentity{
+		OrgName: stored.OrgName,
+		MSPID:   stored.MSPID,
+		CertPEM: []byte(stored.CertificatePEM),
+		KeyPEM:  keyPEM,
+	}, nil
+}
+
+// ServiceIdentity 组织的服务身份，没有时在该组织的 CA 登记一个带 role=service 属性的身份
+// 多个实例同时登记时以先保存的为准
+func (s *IdentityService) ServiceIdentity(orgName string) (*fabric.UserIdentity, error) {
+	var stored model.ServiceIdentity
+	err := s.db.Where("org_name = ?", orgName).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = s.enrollService(orgName, &stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.OrgName == "" {
+		return nil, nil
+	}
+
+	keyPEM, err := openPrivateKey(stored.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &fabric.UserIdentity{
+		OrgName: stored.OrgName,
+		MSPID:   stored.MSPID,
+		CertPEM: []byte(stored.CertificatePEM),
+		KeyPEM:  keyPEM,
+	}, nil
+}
+
+// enrollService 登记组织的服务身份并保存到 stored，组织未配置 CA 时 stored 保持为空
+func (s *IdentityService) enrollService(orgName string, stored *model.ServiceIdentity) error {
+	ca := fabric.GetCAClient(orgName)
+	if ca == nil {
+		return nil
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("生成身份名失败：%v", err)
+	}
+	enrollmentID := fmt.Sprintf("service-%s.%s", orgName, hex.EncodeToString(suffix))
+	certPEM, keyPEM, err := ca.EnrollService(enrollmentID)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealPrivateKey(keyPEM)
+	if err != nil {
+		return err
+	}
+
+	identity := model.ServiceIdentity{
+		OrgName:        orgName,
+		MSPID:          config.GlobalConfig.Fabric.Organizations[orgName].MSPID,
+		EnrollmentID:   enrollmentID,
+		CertificatePEM: string(certPEM),
+		PrivateKey:     sealed,
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&identity)
+	if result.Error != nil {
+		return fmt.Errorf("保存服务身份失败：%v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// 其他实例已经登记，使用已保存的身份
+		if err := s.db.Where("org_name = ?", orgName).First(stored).Error; err != nil {
+			return fmt.Errorf("查询服务身份失败：%v", err)
+		}
+		return nil
+	}
+	*stored = identity
+	return nil
+}
+
+// sealingKey 加密数据库中密文的密钥，previous 是更换密钥期间的旧密钥
+// 加密总是用当前密钥，解密时当前密钥失败再尝试旧密钥，rotate-keys 命令把旧密文重新加密后即可删除旧密钥
+type sealingKey struct {
+	name     string // 配置项，用于错误提示
+	current  string
+	previous string
+}
+
+// walletKey fabric.walletKey，加密链上身份和凭证签名私钥
+func walletKey() sealingKey {
+	return sealingKey{
+		name:     "fabric.walletKey",
+		current:  config.GlobalConfig.Fabric.WalletKey,
+		previous: config.GlobalConfig.Fabric.PreviousWalletKey,
+	}
+}
+
+func (k sealingKey) seal(plaintext []byte) (string, error) {
+	aead, err := aesCipher(k.current, k.name)
+	if err != nil {
+		return "", err
+	}
+	return seal(aead, plaintext)
+}
+
+// open 解密，stale 表示密文是旧密钥加密的
+func (k sealingKey) open(sealed string) (plaintext []byte, stale bool, err error) {
+	aead, err := aesCipher(k.current, k.name)
+	if err != nil {
+		return nil, false, err
+	}
+	if plaintext, err := open(aead, sealed); err == nil {
+		return plaintext, false, nil
+	}
+	if k.previous != "" {
+		previous, err := aesCipher(k.previous, k.name+" 的旧密钥")
+		if err != nil {
+			return nil, false, err
+		}
+		if plaintext, err := open(previous, sealed); err == nil {
+			return plaintext, true, nil
+		}
+	}
+	return nil, false, fmt.Errorf("解密失败，请检查 %s", k.name)
+}
+
+// sealPrivateKey 用 fabric.walletKey 加密私钥
+func sealPrivateKey(keyPEM []byte) (string, error) {
+	return walletKey().seal(keyPEM)
+}
+
+func openPrivateKey(sealed string) ([]byte, error) {
+	keyPEM, _, err := walletKey().open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("解密私钥失败：%v", err)
+	}
+	return keyPEM, nil
+}
+
+// aesCipher 用 base64 编码的 32 字节密钥创建 AES-256-GCM，name 是密钥的配置项，用于错误提示
+func aesCipher(key string, name string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("%s 必须是 base64 编码的 32 字节密钥", name)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密，结果为 base64(nonce || 密文)
+func seal(aead cipher.AEAD, plaintext []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败：%v", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func open(aead cipher.AEAD, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("密文格式错误")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"application/model"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// KeyRotationService 更换加密密钥后把数据库中的旧密文用当前密钥重新加密
+// 更换步骤：把旧密钥配置为 previous*Key、新密钥配置为当前密钥并重启，运行期间旧密文仍可解密；
+// 执行 rotate-keys 重新加密全部密文后删除旧密钥配置
+type KeyRotationService struct {
+	db *gorm.DB
+}
+
+func NewKeyRotationService() *KeyRotationService {
+	return &KeyRotationService{db: model.GetDB()}
+}
+
+// sealedColumn 保存密文的列
+type sealedColumn struct {
+	table  string
+	id     string // 主键列
+	column string
+	key    func() sealingKey
+}
+
+var sealedColumns = []sealedColumn{
+	{table: "fabric_identities", id: "user_id", column: "private_key", key: walletKey},
+	{table: "fabric_service_identities", id: "org_name", column: "private_key", key: walletKey},
+	{table: "signer_keys", id: "user_id", column: "private_key", key: walletKey},
+	{table: "two_factors", id: "user_id", column: "secret", key: twoFactorKey},
+}
+
+// Rotate 重新加密所有旧密钥加密的密文，已经是当前密钥加密的跳过，可以重复执行，返回重新加密的记录数
+func (s *KeyRotationService) Rotate() (int, error) {
+	total := 0
+	for _, c := range sealedColumns {
+		n, err := s.reseal(c)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n > 0 {
+			log.Printf("%s.%s 重新加密了 %d 条记录", c.table, c.column, n)
+		}
+	}
+	return total, nil
+}
+
+func (s *KeyRotationService) reseal(c sealedColumn) (int, error) {
+	var rows []map[string]any
+	if err := s.db.Table(c.table).Select(c.id + " AS id, " + c.column + " AS value").Find(&rows).Error; err != nil {
+		return 0, fmt.Errorf("查询 %s 失败：%v", c.table, err)
+	}
+	key := c.key()
+	count := 0
+	for _, row := range rows {
+		id := row["id"]
+		var value string
+		switch v := row["value"].(type) {
+		case string:
+			value = v
+		case []byte:
+			value = string(v)
+		}
+		// 加密保存之前遗留的明文私钥在下次使用时加密
+		if strings.HasPrefix(value, "-----BEGIN") {
+			continue
+		}
+		plaintext, stale, err := key.open(value)
+		if err != nil {
+			return count, fmt.Errorf("%s %s=%v：%v", c.table, c.id, id, err)
+		}
+		if !stale {
+			continue
+		}
+		sealed, err := key.seal(plaintext)
+		if err != nil {
+			return count, err
+		}
+		// 只替换读取时的密文，同时被重新登记的记录保持新值
+		result := s.db.Table(c.table).Where(c.id+" = ? AND "+c.column+" = ?", id, value).Update(c.column, sealed)
+		if result.Error != nil {
+			return count, fmt.Errorf("更新 %s %s=%v 失败：%v", c.table, c.id, id, result.Error)
+		}
+		count += int(result.RowsAffected)
+	}
+	return count, nil
+}
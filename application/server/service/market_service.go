@@ -2,20 +2,23 @@ package service
 
 import (
 	"application/model"
+	"application/pkg/fabric"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type MarketService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	ledger fabric.LedgerClient
 }
 
-func NewMarketService() *MarketService {
-	return &MarketService{db: model.GetDB()}
+func NewMarketService(ledger fabric.LedgerClient) *MarketService {
+	return &MarketService{db: model.GetDB(), ledger: ledger}
 }
 func isPast(deadline *time.Time, now time.Time) bool {
 	if deadline == nil {
@@ -30,9 +33,9 @@ func isPast(deadline *time.Time, now time.Time) bool {
 func (s *MarketService) CreateListing(userID int, assetId, title string, price int64, deadline *time.Time) (*model.MarketListing, error) {
 	const org2 = 2
 
-	// 1) 链上校验：只有 NFT 当前 Owner 才能挂牌
-	as := NewAssetService(model.GetDB())
-	asset, err := as.GetAssetByID(assetId, org2)
+	// 1) 链上校验：只有 NFT 当前 Owner 才能挂牌（直接查账本，读模型可能滞后）
+	as := NewAssetService(model.GetDB(), s.ledger)
+	asset, err := as.getAssetByIDFromChain(assetId, org2)
 	if err != nil {
 		return nil, fmt.Errorf("查询NFT失败：%v", err)
 	}
@@ -80,6 +83,10 @@ func (s *MarketService) CreateListing(userID int, assetId, title string, price i
 		SellerOrg: org2,
 		Deadline:  deadline,
 		Status:    model.ListingActive,
+		// 限量版记录具体编号，便于在市场中展示 12/100
+		SeriesID:      asset.SeriesID,
+		EditionNumber: asset.EditionNumber,
+		EditionSupply: asset.EditionSupply,
 	}
 	if err := s.db.Create(l).Error; err != nil {
 		return nil, fmt.Errorf("保存挂牌失败：%v", err)
@@ -113,7 +120,7 @@ func (s *MarketService) ListListings(page, pageSize int) ([]model.MarketListing,
 	return items, total, nil
 }
 
-func (s *MarketService) CreateOffer(userID int, listingId uint, offerPrice int64) (*model.MarketOffer, error) {
+func (s *MarketService) CreateOffer(userID int, listingId int, offerPrice int64) (*model.MarketOffer, error) {
 	// 1) 挂牌校验
 	var listing model.MarketListing
 	if err := s.db.First(&listing, listingId).Error; err != nil {
@@ -125,14 +132,17 @@ func (s *MarketService) CreateOffer(userID int, listingId uint, offerPrice int64
 	if listing.Deadline != nil && time.Now().After(*listing.Deadline) {
 		return nil, errors.New("已过截止时间，不能出价")
 	}
+	if listing.DropID != nil {
+		return nil, errors.New("发售中的挂牌不支持议价，请直接购买")
+	}
 	if offerPrice <= 0 {
 		return nil, errors.New("出价必须大于 0")
 	}
 
-	// 2) 余额校验（org 固定 2）
+	// 2) 余额校验（org 固定 2，直接查账本）
 	const org2 = 2
-	w := NewWalletService()
-	bal, err := w.GetBalance(userID, org2)
+	w := NewWalletService(s.ledger)
+	bal, err := w.getBalanceFromChain(userID, org2)
 	if err != nil {
 		return nil, fmt.Errorf("查询钱包余额失败：%v", err)
 	}
@@ -140,142 +150,206 @@ func (s *MarketService) CreateOffer(userID int, listingId uint, offerPrice int64
 		return nil, errors.New("余额不足，无法提交出价")
 	}
 
-	// 3) 链码级冻结（listingId -> string）
-	listingKey := fmt.Sprintf("%d", listingId)
-	holdID, holdTx, err := w.WithHoldAccount(userID, listingKey, int(offerPrice), org2)
-	if err != nil {
-		return nil, fmt.Errorf("冻结失败：%v", err)
-	}
-
-	// 4) 落库
+	// 3) 锁定挂牌后先落库为冻结中，链上冻结在事务外提交，避免长时间持有挂牌行锁
+	// 冻结中的出价不能被接受或撤回，接受出价和关闭挂牌会等它确认后再处理
+	holdID := uuid.New().String()
 	o := &model.MarketOffer{
 		ListingID:    listingId,
 		BidderID:     userID,
 		BidderOrg:    2,
 		OfferPrice:   offerPrice,
 		Status:       model.OfferPending,
-		IsEscrowed:   true,
 		EscrowHoldID: &holdID,
-		EscrowTxID:   &holdTx,
+		EscrowTxID:   &holdID,
 	}
-	if err := s.db.Create(o).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := model.ForUpdate(tx).
+			First(&listing, listingId).Error; err != nil {
+			return err
+		}
+		if listing.Status != model.ListingActive {
+			return errors.New("挂牌不可出价（已成交或已下架）")
+		}
+		busy, err := listingHasActiveWorkflowTx(tx, listing.ID)
+		if err != nil {
+			return err
+		}
+		if busy {
+			return errors.New("该挂牌正在结算中，不能出价")
+		}
+		// 链码按账户结算挂牌下的冻结，同一挂牌每人只能有一个待处理出价
+		var cnt int64
+		if err := tx.Model(&model.MarketOffer{}).
+			Where("listing_id = ? AND bidder_id = ? AND status = ?", listingId, userID, model.OfferPending).
+			Count(&cnt).Error; err != nil {
+			return err
+		}
+		if cnt > 0 {
+			return errors.New("已有待处理的出价，请先撤回")
+		}
+		return tx.Create(o).Error
+	})
+	if err != nil {
 		return nil, err
 	}
-	return o, nil
-}
 
-func (s *MarketService) AcceptOffer(userID int, offerId uint) error {
-	// A. 读取 & 校验
-	var offer model.MarketOffer
-	if err := s.db.First(&offer, offerId).Error; err != nil {
-		return err
+	// 4) 链码级冻结（listingId -> string）
+	listingKey := fmt.Sprintf("%d", listingId)
+	if holdErr := w.WithHoldAccountWithID(holdID, userID, listingKey, int(offerPrice), org2); holdErr != nil {
+		held, err := holdOnListing(w, listingKey, holdID)
+		if err != nil {
+			// 无法确认是否已经冻结，由 CloseExpired 按链上状态修正
+			log.Printf("出价 %d 查询预扣款失败：%v", o.ID, err)
+			return nil, fmt.Errorf("冻结失败：%v", holdErr)
+		}
+		if !held {
+			if err := s.rejectOffer(o.ID); err != nil {
+				log.Printf("出价 %d 冻结失败后更新状态失败：%v", o.ID, err)
+			}
+			return nil, fmt.Errorf("冻结失败：%v", holdErr)
+		}
 	}
-	var listing model.MarketListing
-	if err := s.db.First(&listing, offer.ListingID).Error; err != nil {
-		return err
+	if err := s.db.Model(&model.MarketOffer{}).Where("id = ? AND status = ?", o.ID, model.OfferPending).
+		Update("is_escrowed", true).Error; err != nil {
+		return nil, err
 	}
+	o.IsEscrowed = true
+	return o, nil
+}
 
-	if listing.SellerID != userID {
-		return errors.New("无权接受该出价")
-	}
-	if listing.Status != model.ListingActive {
-		return errors.New("挂牌已非可售状态")
-	}
-	if offer.Status != model.OfferPending || !offer.IsEscrowed || offer.EscrowHoldID == nil {
-		return errors.New("该出价不可被接受")
-	}
-	if listing.Deadline != nil && time.Now().After(*listing.Deadline) {
-		return errors.New("已过截止时间，无法接受出价")
-	}
-	if listing.IsAuction && listing.ReservePrice != nil && offer.OfferPrice < *listing.ReservePrice {
-		return errors.New("未达保留价，无法成交")
-	}
+// 出价退款的 txid 由出价 ID 推导，撤回、关闭挂牌和接受其他出价的结算流程使用同一个 txid，链码只退款一次
+func offerRefundTxID(offerID int) string {
+	return fmt.Sprintf("offer-%d-refund", offerID)
+}
 
-	// B. 先链上清算（org 固定 2）
-	const org2 = 2
-	w := NewWalletService()
+// 冻结中的出价：已落库、链上冻结尚未确认
+func offerHoldPending(o model.MarketOffer) bool {
+	return o.Status == model.OfferPending && !o.IsEscrowed && o.EscrowHoldID != nil
+}
 
-	// 1) 赢家释放到卖家
-	listingKey := fmt.Sprintf("%d", offer.ListingID)
-	payoutTx, err := w.ReleaseHolding(listingKey, listing.SellerID, int(offer.OfferPrice), org2)
+// 链上是否已有指定的预扣款
+func holdOnListing(w *WalletService, listingKey string, holdID string) (bool, error) {
+	holdings, err := w.getWithHoldingByListingIDFromChain(listingKey, workflowOrg)
 	if err != nil {
-		return fmt.Errorf("释放失败（向卖家结算）：%v", err)
-	}
-
-	// 2) 其他人退款
-	var others []model.MarketOffer
-	if err := s.db.
-		Where("listing_id = ? AND id <> ? AND status = ?", offer.ListingID, offer.ID, model.OfferPending).
-		Find(&others).Error; err != nil {
-		return err
+		return false, err
 	}
-	refundTxMap := make(map[int]string, len(others))
-	for _, o := range others {
-		okey := fmt.Sprintf("%d", o.ListingID)
-		rtx, e := w.RefundHolding(okey, o.BidderID, int(o.OfferPrice), org2)
-		if e != nil {
-			return fmt.Errorf("退款失败（offer %d）：%v", o.ID, e)
+	for _, h := range holdings {
+		if h.ID == holdID {
+			return true, nil
 		}
-		refundTxMap[o.ID] = rtx
 	}
+	return false, nil
+}
 
-	// 2.5) 清算成功后 → 转移 NFT（卖家 → 赢家）
-	as := NewAssetService(model.GetDB())
-	if err := as.TransferAsset(listing.AssetID, offer.BidderID, listing.SellerID, org2); err != nil {
-		return fmt.Errorf("NFT转移失败：%v", err)
-	}
+// 冻结未成功或已经退款的出价改为已拒绝
+func (s *MarketService) rejectOffer(offerID int) error {
+	return s.db.Model(&model.MarketOffer{}).
+		Where("id = ? AND status = ?", offerID, model.OfferPending).
+		Updates(map[string]any{
+			"status":      model.OfferRejected,
+			"is_escrowed": false,
+			"update_time": time.Now(),
+		}).Error
+}
 
-	// C. 事务落库
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			First(&listing, listing.ID).Error; err != nil {
+// 接受出价：在事务内锁定挂牌、校验并写入结算流程，提交后按步骤执行链上清算
+// 顺序为 NFT 过户 → 释放中标资金 → 退还其他出价 → 落库，过户失败时自动回滚
+func (s *MarketService) AcceptOffer(userID int, offerId int) error {
+	wfSvc := NewWorkflowService(s.ledger)
+	var wf *model.Workflow
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// A. 读取 & 校验
+		var offer model.MarketOffer
+		if err := tx.First(&offer, offerId).Error; err != nil {
+			return err
+		}
+		var listing model.MarketListing
+		if err := model.ForUpdate(tx).
+			First(&listing, offer.ListingID).Error; err != nil {
 			return err
 		}
+
+		if listing.SellerID != userID {
+			return errors.New("无权接受该出价")
+		}
 		if listing.Status != model.ListingActive {
-			return errors.New("挂牌状态已改变，无法成交")
+			return errors.New("挂牌已非可售状态")
+		}
+		if offer.Status != model.OfferPending || !offer.IsEscrowed || offer.EscrowHoldID == nil || offer.RefundTxID != nil {
+			return errors.New("该出价不可被接受")
+		}
+		if listing.Deadline != nil && time.Now().After(*listing.Deadline) {
+			return errors.New("已过截止时间，无法接受出价")
+		}
+		if listing.IsAuction && listing.ReservePrice != nil && offer.OfferPrice < *listing.ReservePrice {
+			return errors.New("未达保留价，无法成交")
+		}
+		busy, err := listingHasActiveWorkflowTx(tx, listing.ID)
+		if err != nil {
+			return err
+		}
+		if busy {
+			return errors.New("该挂牌正在结算中")
 		}
-		now := time.Now()
 
-		// 赢家
-		if err := tx.Model(&model.MarketOffer{}).
-			Where("id = ? AND status = ?", offer.ID, model.OfferPending).
-			Updates(map[string]interface{}{
-				"status":       model.OfferAccepted,
-				"payout_tx_id": payoutTx,
-				"update_time":  now,
-			}).Error; err != nil {
+		// B. 规划结算步骤
+		var others []model.MarketOffer
+		if err := tx.
+			Where("listing_id = ? AND id <> ? AND status = ?", offer.ListingID, offer.ID, model.OfferPending).
+			Find(&others).Error; err != nil {
 			return err
 		}
-		// 其他人
 		for _, o := range others {
-			if err := tx.Model(&model.MarketOffer{}).
-				Where("id = ? AND status = ?", o.ID, model.OfferPending).
-				Updates(map[string]interface{}{
-					"status":       model.OfferRejected,
-					"is_escrowed":  false,
-					"refund_tx_id": refundTxMap[o.ID],
-					"update_time":  now,
-				}).Error; err != nil {
-				return err
+			if offerHoldPending(o) {
+				return errors.New("有出价正在冻结资金，请稍后再试")
 			}
 		}
-		// 挂牌 SOLD
-		winnerID := int(offer.ID)
-		if err := tx.Model(&model.MarketListing{}).
-			Where("id = ? AND status = ?", listing.ID, model.ListingActive).
-			Updates(map[string]interface{}{
-				"status":          model.ListingSold,
-				"winner_offer_id": &winnerID,
-				"update_time":     now,
-			}).Error; err != nil {
-			return err
+		// 1) NFT 过户（卖家 → 赢家）
+		transfer := newStep(stepTransferAsset)
+		transfer.AssetID = listing.AssetID
+		transfer.FromID = listing.SellerID
+		transfer.ToID = offer.BidderID
+		// 2) 赢家冻结资金释放到卖家
+		release := newStep(stepReleaseHold)
+		release.OfferID = offer.ID
+		release.FromID = offer.BidderID
+		release.ToID = listing.SellerID
+		release.Amount = offer.OfferPrice
+		steps := []model.WorkflowStep{transfer, release}
+		// 3) 其他人退款
+		for _, o := range others {
+			if !o.IsEscrowed {
+				continue
+			}
+			refund := newStep(stepRefundHold)
+			refund.TxID = offerRefundTxID(o.ID)
+			refund.OfferID = o.ID
+			refund.ToID = o.BidderID
+			refund.Amount = o.OfferPrice
+			steps = append(steps, refund)
 		}
-		return nil
+		// 4) 落库
+		finalize := newStep(stepFinalize)
+		finalize.OfferID = offer.ID
+		steps = append(steps, finalize)
+
+		wf = &model.Workflow{
+			Type:      model.WorkflowAcceptOffer,
+			ListingID: listing.ID,
+			UserID:    userID,
+			Steps:     steps,
+		}
+		return wfSvc.createTx(tx, wf)
 	})
+	if err != nil {
+		return err
+	}
+	return wfSvc.runOwned(wf.ID, wf.LeaseOwner)
 }
 
 // 撤回出价（只能撤回 PENDING 状态的出价）
-func (s *MarketService) CancelOffer(userID int, offerId uint) error {
+// 在挂牌行锁内登记退款 txid，链上退款在事务外提交，成功后再改为已拒绝；退款失败时可以再次撤回
+func (s *MarketService) CancelOffer(userID int, offerId int) error {
 	var o model.MarketOffer
 	if err := s.db.First(&o, offerId).Error; err != nil {
 		return err
@@ -297,83 +371,185 @@ func (s *MarketService) CancelOffer(userID int, offerId uint) error {
 		return errors.New("已过截止时间，不能撤回")
 	}
 
-	// 链上退款
-	w := NewWalletService()
-	listingKey := fmt.Sprintf("%d", o.ListingID)
-	rtx, err := w.RefundHolding(listingKey, o.BidderID, int(o.OfferPrice), int(o.BidderOrg))
+	// 1) 锁定挂牌后标记为退款中，结算流程进行中时不能撤回（流程会负责退款）
+	txid := offerRefundTxID(o.ID)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := model.ForUpdate(tx).
+			First(&listing, o.ListingID).Error; err != nil {
+			return err
+		}
+		busy, err := listingHasActiveWorkflowTx(tx, listing.ID)
+		if err != nil {
+			return err
+		}
+		if busy {
+			return errors.New("该挂牌正在结算中，不能撤回")
+		}
+		if err := tx.First(&o, o.ID).Error; err != nil {
+			return err
+		}
+		if o.Status != model.OfferPending {
+			return errors.New("该出价不可撤回")
+		}
+		return tx.Model(&model.MarketOffer{}).Where("id = ?", o.ID).
+			Updates(map[string]any{"refund_tx_id": txid, "update_time": time.Now()}).Error
+	})
 	if err != nil {
+		return err
+	}
+
+	// 2) 链上退款
+	w := NewWalletService(s.ledger)
+	listingKey := fmt.Sprintf("%d", o.ListingID)
+	if err := w.RefundHoldingWithID(txid, listingKey, o.BidderID, int(o.OfferPrice), workflowOrg); err != nil {
 		return fmt.Errorf("退款失败：%v", err)
 	}
 
-	// 落库
-	return s.db.Model(&model.MarketOffer{}).
-		Where("id = ? AND status = ?", o.ID, model.OfferPending).
-		Updates(map[string]any{
-			"status":       model.OfferRejected,
-			"is_escrowed":  false,
-			"refund_tx_id": rtx,
-			"update_time":  time.Now(),
-		}).Error
+	// 3) 落库
+	return s.rejectOffer(o.ID)
+}
+
+// 冻结中或退款中的出价超过该时间后由 CloseExpired 按链上状态修正，需要长于一次链上提交的最长等待时间
+const pendingOfferTimeout = 5 * time.Minute
+
+// 修正中途中断的出价（提交后进程退出或确认时查询失败）：
+// 冻结中的出价链上已有冻结则标记为已冻结，否则改为已拒绝；退款中的出价用原 txid 重新退款
+func (s *MarketService) resolvePendingOffers() error {
+	var offs []model.MarketOffer
+	if err := s.db.
+		Where("status = ? AND update_time < ?", model.OfferPending, time.Now().Add(-pendingOfferTimeout)).
+		Where("((is_escrowed = ? AND escrow_hold_id IS NOT NULL) OR refund_tx_id IS NOT NULL)", false).
+		Find(&offs).Error; err != nil {
+		return err
+	}
+	w := NewWalletService(s.ledger)
+	var errs []error
+	for _, o := range offs {
+		listingKey := fmt.Sprintf("%d", o.ListingID)
+		var err error
+		switch {
+		case o.RefundTxID != nil:
+			if err = w.RefundHoldingWithID(*o.RefundTxID, listingKey, o.BidderID, int(o.OfferPrice), workflowOrg); err == nil {
+				err = s.rejectOffer(o.ID)
+			}
+		default:
+			var held bool
+			if held, err = holdOnListing(w, listingKey, *o.EscrowHoldID); err != nil {
+				break
+			}
+			if held {
+				err = s.db.Model(&model.MarketOffer{}).Where("id = ? AND status = ?", o.ID, model.OfferPending).
+					Update("is_escrowed", true).Error
+			} else {
+				err = s.rejectOffer(o.ID)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("修正出价 %d 失败：%v", o.ID, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // 定时任务：关闭过期挂牌（若有），并退款所有 PENDING 出价
 func (s *MarketService) CloseExpired() error {
+	// 单个挂牌失败不影响其他挂牌，错误汇总后返回，由调度器重试
+	var errs []error
+	if err := s.resolvePendingOffers(); err != nil {
+		errs = append(errs, err)
+	}
+
 	now := time.Now()
 	var listings []model.MarketListing
+	// 正在结算的挂牌由结算流程负责，不在这里关闭
 	if err := s.db.
 		Where("status = ? AND deadline IS NOT NULL AND deadline < ?", model.ListingActive, now).
+		Where("id NOT IN (?)", s.db.Model(&model.Workflow{}).Select("listing_id").
+			Where("status IN ?", model.WorkflowActiveStatuses)).
 		Find(&listings).Error; err != nil {
 		return err
 	}
-
-	w := NewWalletService()
-
 	for _, l := range listings {
-		// 查该 listing 下仍 PENDING 的出价
-		var offs []model.MarketOffer
-		if err := s.db.Where("listing_id = ? AND status = ?", l.ID, model.OfferPending).
+		if err := s.closeExpiredListing(l.ID); err != nil {
+			errs = append(errs, fmt.Errorf("listing %d：%v", l.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 关闭单个过期挂牌：锁内登记退款 txid，事务外逐个退款，全部退款成功后才关闭挂牌
+// 部分退款失败时已退款的出价先改为已拒绝，挂牌保持 OPEN 等待下次重试
+func (s *MarketService) closeExpiredListing(listingID int) error {
+	// 1) 锁定挂牌，标记待处理出价为退款中
+	var offs []model.MarketOffer
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var l model.MarketListing
+		if err := model.ForUpdate(tx).First(&l, listingID).Error; err != nil {
+			return err
+		}
+		if l.Status != model.ListingActive {
+			return nil
+		}
+		busy, err := listingHasActiveWorkflowTx(tx, l.ID)
+		if err != nil || busy {
+			return err
+		}
+		if err := tx.Where("listing_id = ? AND status = ?", l.ID, model.OfferPending).
 			Find(&offs).Error; err != nil {
 			return err
 		}
-
-		// 全部退款（链上）
-		refundMap := map[int]string{}
-		for _, o := range offs {
-			okey := fmt.Sprintf("%d", o.ListingID)
-			rtx, e := w.RefundHolding(okey, o.BidderID, int(o.OfferPrice), int(o.BidderOrg))
-			if e != nil {
-				return fmt.Errorf("listing %d 退款失败（offer %d）：%v", l.ID, o.ID, e)
+		for i := range offs {
+			if offerHoldPending(offs[i]) {
+				offs = nil
+				return errors.New("有出价正在冻结资金，稍后再关闭")
 			}
-			refundMap[o.ID] = rtx
-		}
-
-		// 事务：更新 offers & listing
-		if err := s.db.Transaction(func(tx *gorm.DB) error {
-			// offers
-			for _, o := range offs {
-				if err := tx.Model(&model.MarketOffer{}).
-					Where("id = ? AND status = ?", o.ID, model.OfferPending).
-					Updates(map[string]any{
-						"status":       model.OfferRejected,
-						"is_escrowed":  false,
-						"refund_tx_id": refundMap[o.ID],
-						"update_time":  now,
-					}).Error; err != nil {
-					return err
-				}
+			if offs[i].RefundTxID != nil || !offs[i].IsEscrowed {
+				continue
 			}
-			// listing CLOSED
-			return tx.Model(&model.MarketListing{}).
-				Where("id = ? AND status = ?", l.ID, model.ListingActive).
-				Updates(map[string]any{
-					"status":      model.ListingClosed,
-					"update_time": now,
-				}).Error
-		}); err != nil {
-			return err
+			txid := offerRefundTxID(offs[i].ID)
+			if err := tx.Model(&model.MarketOffer{}).Where("id = ?", offs[i].ID).
+				Update("refund_tx_id", txid).Error; err != nil {
+				return err
+			}
+			offs[i].RefundTxID = &txid
+		}
+		// 锁内确认可以关闭，没有待处理出价时直接关闭
+		if len(offs) == 0 {
+			return closeListingTx(tx, &l)
+		}
+		return nil
+	})
+	if err != nil || len(offs) == 0 {
+		return err
+	}
+
+	// 2) 全部退款（链上），未冻结的出价不需要退款
+	w := NewWalletService(s.ledger)
+	listingKey := fmt.Sprintf("%d", listingID)
+	var errs []error
+	for _, o := range offs {
+		if o.IsEscrowed {
+			if err := w.RefundHoldingWithID(*o.RefundTxID, listingKey, o.BidderID, int(o.OfferPrice), workflowOrg); err != nil {
+				errs = append(errs, fmt.Errorf("退款失败（offer %d）：%v", o.ID, err))
+				continue
+			}
+		}
+		if err := s.rejectOffer(o.ID); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// 3) listing CLOSED
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var l model.MarketListing
+		if err := model.ForUpdate(tx).First(&l, listingID).Error; err != nil {
+			return err
+		}
+		return closeListingTx(tx, &l)
+	})
 }
 
 // 仅把当前 OPEN 的挂牌改为 CLOSED
@@ -385,14 +561,19 @@ func closeListingTx(tx *gorm.DB, l *model.MarketListing) error {
 			"update_time": time.Now(),
 		}).Error
 }
-func (s *MarketService) BuyNow(buyerID int, listingId uint) error {
+
+// 一口价购买：在事务内锁定挂牌、校验并写入结算流程，提交后按步骤执行
+// 顺序为 买家转账 → NFT 过户 → 落库，任一链上步骤失败时自动回滚已完成的步骤
+func (s *MarketService) BuyNow(buyerID int, listingId int) error {
 	const org2 = 2
-	w := NewWalletService()
+	w := NewWalletService(s.ledger)
+	wfSvc := NewWorkflowService(s.ledger)
 
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	var wf *model.Workflow
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// 1) 锁定 & 校验
 		var l model.MarketListing
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		if err := model.ForUpdate(tx).
 			First(&l, listingId).Error; err != nil {
 			return err
 		}
@@ -412,59 +593,54 @@ func (s *MarketService) BuyNow(buyerID int, listingId uint) error {
 		if l.Price <= 0 {
 			return errors.New("价格非法")
 		}
-
-		// 2) 余额校验
-		bal, err := w.GetBalance(buyerID, org2)
+		busy, err := listingHasActiveWorkflowTx(tx, l.ID)
 		if err != nil {
-			return fmt.Errorf("查询余额失败：%v", err)
+			return err
 		}
-		if int64(bal) < l.Price {
-			return errors.New("余额不足")
+		if busy {
+			return errors.New("该挂牌正在结算中")
 		}
 
-		// 3) 直接转卖家
-		txid, err := w.Transfer(buyerID, l.SellerID, int(l.Price), org2)
+		// 1.5) 发售规则（时间窗口、白名单、每钱包上限），并确定成交价
+		price, err := checkDropRulesTx(tx, &l, buyerID, time.Now())
 		if err != nil {
-			return fmt.Errorf("转账失败：%v", err)
-		}
-
-		// 4) NFT 过户
-		as := NewAssetService(model.GetDB()) // 你原来的
-		if err := as.TransferAsset(l.AssetID, buyerID, l.SellerID, org2); err != nil {
-			// 可选：失败则考虑退款（按你的实现）
-			return fmt.Errorf("NFT转移失败：%v", err)
+			return err
 		}
 
-		// 5) 成交记录
-		off := &model.MarketOffer{
-			ListingID:  uint(l.ID),
-			BidderID:   buyerID,
-			BidderOrg:  org2,
-			OfferPrice: l.Price,
-			Status:     model.OfferAccepted,
-			PayoutTxID: &txid,
-			CreateTime: time.Now(),
-			UpdateTime: time.Now(),
+		// 2) 余额校验（直接查账本）
+		bal, err := w.getBalanceFromChain(buyerID, org2)
+		if err != nil {
+			return fmt.Errorf("查询余额失败：%v", err)
 		}
-		if err := tx.Create(off).Error; err != nil {
-			return fmt.Errorf("保存成交记录失败：%v", err)
+		if int64(bal) < price {
+			return errors.New("余额不足")
 		}
 
-		// 6) 标记 SOLD
-		winnerID := uint(off.ID)
-		if err := tx.Model(&model.MarketListing{}).
-			Where("id = ? AND status = ?", l.ID, model.ListingActive).
-			Updates(map[string]any{
-				"status":          model.ListingSold,
-				"winner_offer_id": &winnerID,
-				"update_time":     time.Now(),
-			}).Error; err != nil {
-			return fmt.Errorf("更新挂牌状态失败：%v", err)
+		// 3) 规划结算步骤：直接转卖家 → NFT 过户 → 成交记录并标记 SOLD
+		pay := newStep(stepTransferToken)
+		pay.FromID = buyerID
+		pay.ToID = l.SellerID
+		pay.Amount = price
+		transfer := newStep(stepTransferAsset)
+		transfer.AssetID = l.AssetID
+		transfer.FromID = l.SellerID
+		transfer.ToID = buyerID
+		finalize := newStep(stepFinalize)
+		finalize.ToID = buyerID
+		finalize.Amount = price
+
+		wf = &model.Workflow{
+			Type:      model.WorkflowBuyNow,
+			ListingID: l.ID,
+			UserID:    buyerID,
+			Steps:     []model.WorkflowStep{pay, transfer, finalize},
 		}
-
-		// 注意：不需要也不会改任何 Asset 字段
-		return nil
+		return wfSvc.createTx(tx, wf)
 	})
+	if err != nil {
+		return err
+	}
+	return wfSvc.runOwned(wf.ID, wf.LeaseOwner)
 }
 
 // 我提交的出价（保持不变）
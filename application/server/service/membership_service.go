@@ -0,0 +1,297 @@
+package service
+
+import (
+	"application/model"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// 申请说明的最大长度（字符）
+const maxOrgApplicationReason = 1000
+
+// MembershipService 用户组织变更：申请、审核和管理员直接修改，每一步都记录到 org_change_events
+type MembershipService struct {
+	db          *gorm.DB
+	permissions *PermissionService
+	sessions    *SessionService
+	identities  *IdentityService
+}
+
+func NewMembershipService() *MembershipService {
+	return &MembershipService{
+		db:          model.GetDB(),
+		permissions: NewPermissionService(),
+		sessions:    NewSessionService(),
+		identities:  NewIdentityService(),
+	}
+}
+
+// Apply 提交加入其他组织的申请，每个用户同时只能有一个待审核的申请
+func (s *MembershipService) Apply(userID int, req *model.OrgApplicationRequest) (*model.OrgApplication, error) {
+	if _, err := model.GetOrg(req.TargetOrg); err != nil {
+		return nil, fmt.Errorf("目标组织不存在")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("请填写申请说明")
+	}
+	if utf8.RuneCountInString(reason) > maxOrgApplicationReason {
+		return nil, fmt.Errorf("申请说明不能超过 %d 个字", maxOrgApplicationReason)
+	}
+
+	var application model.OrgApplication
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁住用户，避免并发提交出两个待审核的申请
+		var user model.User
+		if err := model.ForUpdate(tx).First(&user, userID).Error; err != nil {
+			return fmt.Errorf("查询用户失败：%v", err)
+		}
+		if user.Org == req.TargetOrg {
+			return fmt.Errorf("已经是该组织的成员")
+		}
+		var pending int64
+		err := tx.Model(&model.OrgApplication{}).
+			Where("user_id = ? AND status = ?", userID, model.OrgApplicationPending).Count(&pending).Error
+		if err != nil {
+			return fmt.Errorf("查询申请失败：%v", err)
+		}
+		if pending > 0 {
+			return fmt.Errorf("已有待审核的申请，请等待审核或撤回后再提交")
+		}
+
+		application = model.OrgApplication{
+			UserID:    userID,
+			FromOrg:   user.Org,
+			TargetOrg: req.TargetOrg,
+			Reason:    reason,
+			Status:    model.OrgApplicationPending,
+		}
+		if err := tx.Create(&application).Error; err != nil {
+			return fmt.Errorf("保存申请失败：%v", err)
+		}
+		return recordOrgEvent(tx, &model.OrgChangeEvent{
+			UserID: userID, ApplicationID: &application.ID, ActorID: userID, Action: model.OrgEventSubmit,
+			FromOrg: user.Org, ToOrg: req.TargetOrg, Comment: reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &application, nil
+}
+
+// Cancel 申请人撤回待审核的申请
+func (s *MembershipService) Cancel(userID int, id int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		application, err := lockPendingApplication(tx, id)
+		if err != nil {
+			return err
+		}
+		if application.UserID != userID {
+			return fmt.Errorf("只能撤回自己的申请")
+		}
+		if err := closeApplication(tx, application, model.OrgApplicationCancelled, userID, ""); err != nil {
+			return err
+		}
+		return recordOrgEvent(tx, &model.OrgChangeEvent{
+			UserID: userID, ApplicationID: &application.ID, ActorID: userID, Action: model.OrgEventCancel,
+			FromOrg: application.FromOrg, ToOrg: application.TargetOrg,
+		})
+	})
+}
+
+// ListMine 用户自己提交的申请，最新的在前
+func (s *MembershipService) ListMine(userID int) ([]model.OrgApplication, error) {
+	var applications []model.OrgApplication
+	if err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&applications).Error; err != nil {
+		return nil, fmt.Errorf("查询申请失败：%v", err)
+	}
+	return applications, nil
+}
+
+// ListForReview 审核人可以审核的申请，status 为空时返回全部状态
+// 平台运营方可以看到所有组织的申请，其他组织的管理员只能看到加入本组织的申请
+func (s *MembershipService) ListForReview(reviewerID int, reviewerOrg int, status string) ([]model.OrgApplication, error) {
+	query := s.db.Model(&model.OrgApplication{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	all, err := s.permissions.Has(reviewerID, reviewerOrg, model.PermAccountManageOrg)
+	if err != nil {
+		return nil, err
+	}
+	if !all {
+		query = query.Where("target_org = ?", reviewerOrg)
+	}
+	var applications []model.OrgApplication
+	if err := query.Order("id DESC").Find(&applications).Error; err != nil {
+		return nil, fmt.Errorf("查询申请失败：%v", err)
+	}
+	return applications, nil
+}
+
+// Review 审核申请，通过时把用户移到目标组织
+func (s *MembershipService) Review(reviewerID int, reviewerOrg int, id int, req *model.OrgReviewRequest) (*model.OrgApplication, error) {
+	// 申请的目标组织不会变化，审核资格在事务外检查
+	var target model.OrgApplication
+	if err := s.db.First(&target, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("申请不存在")
+		}
+		return nil, fmt.Errorf("查询申请失败：%v", err)
+	}
+	if target.UserID == reviewerID {
+		return nil, fmt.Errorf("不能审核自己的申请")
+	}
+	if err := s.checkReviewer(reviewerID, reviewerOrg, target.TargetOrg); err != nil {
+		return nil, err
+	}
+
+	var application *model.OrgApplication
+	var user model.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if application, err = lockPendingApplication(tx, id); err != nil {
+			return err
+		}
+		if err := model.ForUpdate(tx).First(&user, application.UserID).Error; err != nil {
+			return fmt.Errorf("查询用户失败：%v", err)
+		}
+
+		comment := strings.TrimSpace(req.Comment)
+		if !req.Approve {
+			if err := closeApplication(tx, application, model.OrgApplicationRejected, reviewerID, comment); err != nil {
+				return err
+			}
+			return recordOrgEvent(tx, &model.OrgChangeEvent{
+				UserID: user.ID, ApplicationID: &application.ID, ActorID: reviewerID, Action: model.OrgEventReject,
+				FromOrg: user.Org, ToOrg: application.TargetOrg, Comment: comment,
+			})
+		}
+		if err := closeApplication(tx, application, model.OrgApplicationApproved, reviewerID, comment); err != nil {
+			return err
+		}
+		return changeOrgTx(tx, &user, application.TargetOrg, &model.OrgChangeEvent{
+			ApplicationID: &application.ID, ActorID: reviewerID, Action: model.OrgEventApprove, Comment: comment,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if req.Approve {
+		s.afterOrgChange(&user)
+	}
+	return application, nil
+}
+
+// SetOrg 管理员直接修改用户组织（需要 account:manage-org 权限），同样记录审计
+func (s *MembershipService) SetOrg(adminID int, userID int, org int) error {
+	if _, err := model.GetOrg(org); err != nil {
+		return fmt.Errorf("目标组织不存在")
+	}
+	var user model.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := model.ForUpdate(tx).First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("用户不存在")
+			}
+			return fmt.Errorf("查询用户失败：%v", err)
+		}
+		if user.Org == org {
+			return fmt.Errorf("用户已经是该组织的成员")
+		}
+		return changeOrgTx(tx, &user, org, &model.OrgChangeEvent{ActorID: adminID, Action: model.OrgEventAdminSet})
+	})
+	if err != nil {
+		return err
+	}
+	s.afterOrgChange(&user)
+	return nil
+}
+
+// ListEvents 用户的组织变更记录，最新的在前
+func (s *MembershipService) ListEvents(userID int) ([]model.OrgChangeEvent, error) {
+	var events []model.OrgChangeEvent
+	if err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("查询组织变更记录失败：%v", err)
+	}
+	return events, nil
+}
+
+// checkReviewer 审核人必须属于目标组织，平台运营方可以审核所有组织的申请
+func (s *MembershipService) checkReviewer(reviewerID int, reviewerOrg int, targetOrg int) error {
+	if reviewerOrg == targetOrg {
+		return nil
+	}
+	ok, err := s.permissions.Has(reviewerID, reviewerOrg, model.PermAccountManageOrg)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("只能审核加入本组织的申请")
+	}
+	return nil
+}
+
+// afterOrgChange 组织变更提交后的处理，失败只记录日志：
+// 链上钱包按用户 ID 记账，与组织无关，余额和预扣款不需要迁移；
+// 链上身份由原组织的 CA 签发，在新组织的 CA 重新登记，失败时下一次交易会自动登记；
+// 注销用户的全部会话，令牌中的组织和权限在重新登录后更新
+func (s *MembershipService) afterOrgChange(user *model.User) {
+	if _, err := s.identities.Enroll(user); err != nil {
+		log.Printf("用户 %d 在新组织登记链上身份失败：%v", user.ID, err)
+	}
+	if _, err := s.sessions.RevokeOthers(user.ID, "", model.SessionOrgChanged); err != nil {
+		log.Printf("用户 %d 组织变更后注销会话失败：%v", user.ID, err)
+	}
+}
+
+// changeOrgTx 修改用户组织并记录审计，event 只需要填写操作人、操作类型和关联的申请
+func changeOrgTx(tx *gorm.DB, user *model.User, org int, event *model.OrgChangeEvent) error {
+	event.UserID = user.ID
+	event.FromOrg = user.Org
+	event.ToOrg = org
+	if err := tx.Model(user).Update("org", org).Error; err != nil {
+		return fmt.Errorf("更新组织失败：%v", err)
+	}
+	return recordOrgEvent(tx, event)
+}
+
+func recordOrgEvent(tx *gorm.DB, event *model.OrgChangeEvent) error {
+	if err := tx.Create(event).Error; err != nil {
+		return fmt.Errorf("记录组织变更失败：%v", err)
+	}
+	return nil
+}
+
+func lockPendingApplication(tx *gorm.DB, id int) (*model.OrgApplication, error) {
+	var application model.OrgApplication
+	if err := model.ForUpdate(tx).First(&application, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("申请不存在")
+		}
+		return nil, fmt.Errorf("查询申请失败：%v", err)
+	}
+	if application.Status != model.OrgApplicationPending {
+		return nil, fmt.Errorf("申请已处理")
+	}
+	return &application, nil
+}
+
+func closeApplication(tx *gorm.DB, application *model.OrgApplication, status string, reviewerID int, comment string) error {
+	now := time.Now()
+	application.Status = status
+	application.ReviewerID = &reviewerID
+	application.ReviewComment = comment
+	application.ReviewTime = &now
+	if err := tx.Save(application).Error; err != nil {
+		return fmt.Errorf("更新申请失败：%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"application/model"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// PermissionService 计算用户的权限：组织默认权限加上单独授予的角色权限
+type PermissionService struct {
+	db *gorm.DB
+}
+
+func NewPermissionService() *PermissionService {
+	return &PermissionService{db: model.GetDB()}
+}
+
+// Has 用户是否拥有权限，先看组织权限，没有时再查询角色
+func (s *PermissionService) Has(userID int, org int, perm model.Permission) (bool, error) {
+	if containsPermission(model.OrgPermissions[org], perm) {
+		return true, nil
+	}
+	roles, err := s.roles(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if containsPermission(model.RolePermissions[role], perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// List 用户拥有的全部权限，前端据此显示可用的功能
+func (s *PermissionService) List(userID int, org int) ([]model.Permission, error) {
+	roles, err := s.roles(userID)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[model.Permission]bool)
+	for _, perm := range model.OrgPermissions[org] {
+		set[perm] = true
+	}
+	for _, role := range roles {
+		for _, perm := range model.RolePermissions[role] {
+			set[perm] = true
+		}
+	}
+	perms := make([]model.Permission, 0, len(set))
+	for perm := range set {
+		perms = append(perms, perm)
+	}
+	sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+	return perms, nil
+}
+
+// ListRoles 用户被授予的角色
+func (s *PermissionService) ListRoles(userID int) ([]model.UserRole, error) {
+	var roles []model.UserRole
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("查询角色失败：%v", err)
+	}
+	return roles, nil
+}
+
+// GrantRole 授予角色，已有该角色时不做任何事
+func (s *PermissionService) GrantRole(userID int, role string, grantedBy int) error {
+	if _, ok := model.RolePermissions[role]; !ok {
+		return fmt.Errorf("未知角色：%s", role)
+	}
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("用户不存在")
+		}
+		return fmt.Errorf("查询用户失败：%v", err)
+	}
+	var count int64
+	if err := s.db.Model(&model.UserRole{}).Where("user_id = ? AND role = ?", userID, role).Count(&count).Error; err != nil {
+		return fmt.Errorf("查询角色失败：%v", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if err := s.db.Create(&model.UserRole{UserID: userID, Role: role, GrantedBy: grantedBy}).Error; err != nil {
+		return fmt.Errorf("授予角色失败：%v", err)
+	}
+	return nil
+}
+
+// RevokeRole 撤销角色
+func (s *PermissionService) RevokeRole(userID int, role string) error {
+	result := s.db.Where("user_id = ? AND role = ?", userID, role).Delete(&model.UserRole{})
+	if result.Error != nil {
+		return fmt.Errorf("撤销角色失败：%v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("用户没有该角色")
+	}
+	return nil
+}
+
+func (s *PermissionService) roles(userID int) ([]string, error) {
+	var roles []string
+	if err := s.db.Model(&model.UserRole{}).Where("user_id = ?", userID).Pluck("role", &roles).Error; err != nil {
+		return nil, fmt.Errorf("查询角色失败：%v", err)
+	}
+	return roles, nil
+}
+
+func containsPermission(perms []model.Permission, perm model.Permission) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
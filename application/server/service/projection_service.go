@@ -0,0 +1,440 @@
+package service
+
+import (
+	"application/config"
+	"application/model"
+	"application/pkg/fabric"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	projectionMinRetry      = time.Second
+	projectionMaxRetry      = 30 * time.Second
+	projectionCheckInterval = 10 * time.Second // 没有新区块时检查是否被重建的间隔
+)
+
+// 链码状态键的类型，需要与链码中的常量保持一致
+const (
+	ledgerKeyAccount = "account"
+	ledgerKeySender  = "sender"
+	ledgerKeyHolding = "withHolding1"
+	ledgerKeyAsset   = "asset1"
+	ledgerKeySeries  = "series"
+)
+
+// 检查点已被重建或被其他实例推进到不连续的位置，需要从数据库中的检查点重新订阅
+var errCheckpointMoved = errors.New("读模型检查点已变化")
+
+// ProjectionService 把链码写集同步到 PostgreSQL 读模型，资产、余额等查询不再每次都访问节点
+type ProjectionService struct {
+	db *gorm.DB
+}
+
+func NewProjectionService() *ProjectionService {
+	return &ProjectionService{db: model.GetDB()}
+}
+
+// readModel 读模型可用时返回读模型，否则返回 nil，调用方直接查询链上
+func readModel() *ProjectionService {
+	cfg := config.GlobalConfig.Projection
+	if !cfg.Enabled {
+		return nil
+	}
+	s := NewProjectionService()
+	if s.db == nil {
+		return nil
+	}
+	if !cfg.FallbackToChain {
+		return s
+	}
+	status, err := s.Status()
+	if err != nil || !status.Ready {
+		return nil
+	}
+	return s
+}
+
+// fallbackToChain 读模型查询失败或查不到数据时是否改为查询链上
+func fallbackToChain() bool {
+	return config.GlobalConfig.Projection.FallbackToChain
+}
+
+// 读取检查点，不存在时视为从 0 开始的第 0 代
+func (s *ProjectionService) checkpoint(tx *gorm.DB) (model.ProjectionCheckpoint, error) {
+	cp := model.ProjectionCheckpoint{Name: model.ProjectionLedger}
+	err := tx.Where("name = ?", model.ProjectionLedger).Take(&cp).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return cp, fmt.Errorf("读取读模型检查点失败：%v", err)
+	}
+	return cp, nil
+}
+
+// Status 查询读模型同步进度
+func (s *ProjectionService) Status() (*model.ProjectionStatus, error) {
+	cp, err := s.checkpoint(s.db)
+	if err != nil {
+		return nil, err
+	}
+	status := &model.ProjectionStatus{
+		Enabled:    config.GlobalConfig.Projection.Enabled,
+		NextBlock:  cp.NextBlock,
+		Generation: cp.Generation,
+		UpdateTime: cp.UpdateTime,
+	}
+	if l := fabric.GetBlockListener(); l != nil {
+		if latest, ok := l.LatestBlockNum(); ok {
+			status.ChainHeight = latest + 1
+		}
+	}
+	if status.ChainHeight > status.NextBlock {
+		status.Lag = status.ChainHeight - status.NextBlock
+	}
+	// 监听器还没有收到任何区块时无法判断读模型是否最新
+	status.Ready = status.Enabled && status.ChainHeight > 0 && status.Lag <= uint64(config.GlobalConfig.Projection.MaxLag)
+	return status, nil
+}
+
+// Rebuild 清空读模型并把检查点重置到 0，同步协程发现代数变化后从创世区块重新同步
+func (s *ProjectionService) Rebuild() error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		cp, err := s.checkpoint(model.ForUpdate(tx))
+		if err != nil {
+			return err
+		}
+		for _, table := range []interface{}{&model.LedgerAsset{}, &model.LedgerAccount{}, &model.LedgerTransfer{}, &model.LedgerWithHolding{}} {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(table).Error; err != nil {
+				return fmt.Errorf("清空读模型失败：%v", err)
+			}
+		}
+		cp.NextBlock = 0
+		cp.Generation++
+		if err := tx.Save(&cp).Error; err != nil {
+			return fmt.Errorf("重置读模型检查点失败：%v", err)
+		}
+		log.Printf("读模型已清空，第 %d 代将从区块 0 重新同步", cp.Generation)
+		return nil
+	})
+}
+
+// Run 持续同步读模型直到 ctx 取消，区块流中断后按指数退避重新订阅
+// 多个实例同时运行时按检查点行锁串行处理，同一区块只会写入一次
+func (s *ProjectionService) Run(ctx context.Context) {
+	delay := projectionMinRetry
+	for ctx.Err() == nil {
+		applied, err := s.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errCheckpointMoved) {
+			continue
+		}
+		if applied > 0 {
+			delay = projectionMinRetry
+		}
+		log.Printf("读模型同步中断，%s 后重试：%v", delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > projectionMaxRetry {
+			delay = projectionMaxRetry
+		}
+	}
+}
+
+// follow 从检查点订阅区块并逐个写入读模型，返回本次处理的区块数
+func (s *ProjectionService) follow(ctx context.Context) (int, error) {
+	cp, err := s.checkpoint(s.db)
+	if err != nil {
+		return 0, err
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	blocks, err := fabric.BlockStream(streamCtx, cp.NextBlock)
+	if err != nil {
+		return 0, err
+	}
+	ticker := time.NewTicker(projectionCheckInterval)
+	defer ticker.Stop()
+
+	applied := 0
+	for {
+		select {
+		case <-streamCtx.Done():
+			return applied, streamCtx.Err()
+		case <-ticker.C:
+			current, err := s.checkpoint(s.db)
+			if err != nil {
+				return applied, err
+			}
+			if current.Generation != cp.Generation {
+				return applied, errCheckpointMoved
+			}
+		case block, ok := <-blocks:
+			if !ok {
+				return applied, errors.New("区块事件流已关闭")
+			}
+			if err := s.ApplyBlock(block, cp.Generation); err != nil {
+				return applied, err
+			}
+			applied++
+		}
+	}
+}
+
+// ApplyBlock 在一个事务内写入区块的全部状态变化并推进检查点
+// 区块已处理过时跳过；区块号与检查点不连续或代数不一致时返回 errCheckpointMoved
+func (s *ProjectionService) ApplyBlock(block *common.Block, generation int) error {
+	blockNum := block.GetHeader().GetNumber()
+	txWrites, err := fabric.DecodeBlockWrites(block, config.GlobalConfig.Fabric.ChaincodeName)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		cp, err := s.checkpoint(model.ForUpdate(tx))
+		if err != nil {
+			return err
+		}
+		if cp.Generation != generation || blockNum > cp.NextBlock {
+			return errCheckpointMoved
+		}
+		if blockNum < cp.NextBlock {
+			return nil
+		}
+		for _, t := range txWrites {
+			for _, w := range t.Writes {
+				if err := applyWrite(tx, blockNum, w); err != nil {
+					return fmt.Errorf("写入区块[%d]交易[%s]的状态失败：%v", blockNum, t.TxID, err)
+				}
+			}
+		}
+		cp.NextBlock = blockNum + 1
+		if err := tx.Save(&cp).Error; err != nil {
+			return fmt.Errorf("更新读模型检查点失败：%v", err)
+		}
+		return nil
+	})
+}
+
+// applyWrite 把一条链码状态写入映射到读模型，与读模型无关的键忽略
+func applyWrite(tx *gorm.DB, blockNum uint64, w fabric.KVWrite) error {
+	objectType, attrs, ok := fabric.SplitCompositeKey(w.Key)
+	if !ok || len(attrs) == 0 {
+		return nil
+	}
+	upsert := tx.Clauses(clause.OnConflict{UpdateAll: true})
+	id := attrs[len(attrs)-1]
+
+	switch objectType {
+	case ledgerKeyAsset:
+		if w.IsDelete {
+			return tx.Delete(&model.LedgerAsset{}, "id = ?", id).Error
+		}
+		var asset model.Asset
+		if err := json.Unmarshal(w.Value, &asset); err != nil {
+			return fmt.Errorf("解析 NFT 失败：%v", err)
+		}
+		return upsert.Create(&model.LedgerAsset{
+			ID:            asset.ID,
+			Name:          asset.Name,
+			ImageName:     asset.ImageName,
+			AuthorId:      asset.AuthorId,
+			OwnerId:       asset.OwnerId,
+			Description:   asset.Description,
+			ImageHash:     asset.ImageHash,
+			SeriesID:      asset.SeriesID,
+			EditionNumber: asset.EditionNumber,
+			EditionSupply: asset.EditionSupply,
+			TimeStamp:     asset.TimeStamp,
+			BlockNum:      blockNum,
+		}).Error
+
+	case ledgerKeySeries:
+		if w.IsDelete {
+			return nil
+		}
+		var series model.EditionSeries
+		if err := json.Unmarshal(w.Value, &series); err != nil {
+			return fmt.Errorf("解析限量系列失败：%v", err)
+		}
+		// 链码只在拷贝第一次转移时写入 asset1，之前的拷贝按系列生成，已有记录的不覆盖
+		editions := make([]model.LedgerAsset, 0, series.Supply)
+		for n := 1; n <= series.Supply; n++ {
+			editions = append(editions, model.LedgerAsset{
+				ID:            model.EditionAssetID(series.ID, n),
+				Name:          series.Name,
+				ImageName:     series.ImageName,
+				AuthorId:      series.AuthorId,
+				OwnerId:       series.AuthorId,
+				Description:   series.Description,
+				SeriesID:      series.ID,
+				EditionNumber: n,
+				EditionSupply: series.Supply,
+				TimeStamp:     series.TimeStamp,
+				BlockNum:      blockNum,
+			})
+		}
+		if len(editions) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(editions, 200).Error
+
+	case ledgerKeyAccount:
+		accountID, err := strconv.Atoi(id)
+		if err != nil {
+			return fmt.Errorf("账户 ID 不合法：%q", id)
+		}
+		if w.IsDelete {
+			return tx.Delete(&model.LedgerAccount{}, "id = ?", accountID).Error
+		}
+		var wallet model.Wallet
+		if err := json.Unmarshal(w.Value, &wallet); err != nil {
+			return fmt.Errorf("解析账户失败：%v", err)
+		}
+		return upsert.Create(&model.LedgerAccount{ID: accountID, Balance: wallet.Balance, BlockNum: blockNum}).Error
+
+	case ledgerKeySender:
+		if w.IsDelete {
+			return tx.Delete(&model.LedgerTransfer{}, "id = ?", id).Error
+		}
+		var transfer model.Transfer
+		if err := json.Unmarshal(w.Value, &transfer); err != nil {
+			return fmt.Errorf("解析转账记录失败：%v", err)
+		}
+		return upsert.Create(&model.LedgerTransfer{
+			ID:          transfer.ID,
+			SenderID:    transfer.SenderID,
+			RecipientID: transfer.RecipientID,
+			Amount:      transfer.Amount,
+			TimeStamp:   transfer.TimeStamp,
+			BlockNum:    blockNum,
+		}).Error
+
+	case ledgerKeyHolding:
+		if w.IsDelete {
+			return tx.Delete(&model.LedgerWithHolding{}, "id = ?", id).Error
+		}
+		var holding model.WithHolding
+		if err := json.Unmarshal(w.Value, &holding); err != nil {
+			return fmt.Errorf("解析预扣款失败：%v", err)
+		}
+		return upsert.Create(&model.LedgerWithHolding{
+			ID:        holding.ID,
+			AccountID: holding.AccountID,
+			ListingID: holding.ListingID,
+			Amount:    holding.Amount,
+			TimeStamp: holding.TimeStamp,
+			BlockNum:  blockNum,
+		}).Error
+	}
+	return nil
+}
+
+// —— 读模型查询 ——
+
+func (s *ProjectionService) GetAsset(id string) (model.Asset, error) {
+	var a model.LedgerAsset
+	if err := s.db.Where("id = ?", id).Take(&a).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Asset{}, fmt.Errorf("获取 NFT 失败：NFT %s 不存在", id)
+		}
+		return model.Asset{}, fmt.Errorf("获取 NFT 失败：%v", err)
+	}
+	return a.ToAsset(), nil
+}
+
+func (s *ProjectionService) listAssets(order string, query string, args ...interface{}) ([]model.Asset, error) {
+	var rows []model.LedgerAsset
+	if err := s.db.Where(query, args...).Order(order).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("获取 NFT 失败：%v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	assets := make([]model.Asset, 0, len(rows))
+	for _, a := range rows {
+		assets = append(assets, a.ToAsset())
+	}
+	return assets, nil
+}
+
+func (s *ProjectionService) GetAssetsByAuthor(authorID int) ([]model.Asset, error) {
+	return s.listAssets("time_stamp, id", "author_id = ?", authorID)
+}
+
+func (s *ProjectionService) GetAssetsByOwner(ownerID int) ([]model.Asset, error) {
+	return s.listAssets("time_stamp, id", "owner_id = ?", ownerID)
+}
+
+func (s *ProjectionService) GetAssetsBySeries(seriesID string) ([]model.Asset, error) {
+	return s.listAssets("edition_number", "series_id = ?", seriesID)
+}
+
+func (s *ProjectionService) GetBalance(accountID int) (int, error) {
+	var a model.LedgerAccount
+	if err := s.db.Where("id = ?", accountID).Take(&a).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("获取余额失败：账户 %d 不存在", accountID)
+		}
+		return 0, fmt.Errorf("获取余额失败：%v", err)
+	}
+	return a.Balance, nil
+}
+
+func (s *ProjectionService) listTransfers(query string, args ...interface{}) ([]model.Transfer, error) {
+	var rows []model.LedgerTransfer
+	if err := s.db.Where(query, args...).Order("time_stamp, id").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("获取转账记录失败：%v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	transfers := make([]model.Transfer, 0, len(rows))
+	for _, t := range rows {
+		transfers = append(transfers, t.ToTransfer())
+	}
+	return transfers, nil
+}
+
+func (s *ProjectionService) GetTransfersBySender(senderID int) ([]model.Transfer, error) {
+	return s.listTransfers("sender_id = ?", senderID)
+}
+
+func (s *ProjectionService) GetTransfersByRecipient(recipientID int) ([]model.Transfer, error) {
+	return s.listTransfers("recipient_id = ?", recipientID)
+}
+
+func (s *ProjectionService) listWithHoldings(query string, args ...interface{}) ([]model.WithHolding, error) {
+	var rows []model.LedgerWithHolding
+	if err := s.db.Where(query, args...).Order("time_stamp, id").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("获取预扣款记录失败：%v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	holdings := make([]model.WithHolding, 0, len(rows))
+	for _, h := range rows {
+		holdings = append(holdings, h.ToWithHolding())
+	}
+	return holdings, nil
+}
+
+func (s *ProjectionService) GetWithHoldingsByAccount(accountID int) ([]model.WithHolding, error) {
+	return s.listWithHoldings("account_id = ?", accountID)
+}
+
+func (s *ProjectionService) GetWithHoldingsByListing(listingID string) ([]model.WithHolding, error) {
+	return s.listWithHoldings("listing_id = ?", listingID)
+}
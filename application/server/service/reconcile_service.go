@@ -0,0 +1,515 @@
+package service
+
+import (
+	"application/model"
+	"application/pkg/fabric"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 定时对账只检查最近一段时间内有变动的挂牌和拍卖，手动对账检查全部
+const reconcileLookback = 7 * 24 * time.Hour
+
+type ReconcileService struct {
+	db     *gorm.DB
+	ledger fabric.LedgerClient
+}
+
+func NewReconcileService(ledger fabric.LedgerClient) *ReconcileService {
+	return &ReconcileService{db: model.GetDB(), ledger: ledger}
+}
+
+// 对账过程中的上下文
+type reconciler struct {
+	db      *gorm.DB
+	repair  bool
+	since   time.Time
+	issues  []model.ReconcileIssue
+	errs    []error
+	wallet  *WalletService
+	assets  *AssetService
+	ownerOf map[string]int // 已查询过的 NFT 持有人
+}
+
+// 执行一次对账并保存记录
+// repair 为 true 时自动修复预扣款相关的问题；NFT 持有人不一致只报告，因为可能是后续转卖或直接转移造成的
+func (s *ReconcileService) Reconcile(trigger string, userID int, repair bool, since time.Time) (*model.ReconcileRun, error) {
+	r := &reconciler{
+		db:      s.db,
+		repair:  repair,
+		since:   since,
+		wallet:  NewWalletService(s.ledger),
+		assets:  NewAssetService(s.db, s.ledger),
+		ownerOf: map[string]int{},
+	}
+	r.checkHoldings()
+	r.checkLotHoldings()
+	r.checkSoldListings()
+	r.checkAuctionResults()
+
+	run := &model.ReconcileRun{
+		Trigger:     trigger,
+		TriggeredBy: userID,
+		AutoRepair:  repair,
+		IssueCount:  len(r.issues),
+	}
+	for _, issue := range r.issues {
+		if issue.Repaired {
+			run.RepairedCount++
+		}
+	}
+	issues, err := json.Marshal(r.issues)
+	if err != nil {
+		return nil, fmt.Errorf("序列化对账结果失败：%v", err)
+	}
+	run.Issues = string(issues)
+	if err := errors.Join(r.errs...); err != nil {
+		run.Error = err.Error()
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		return nil, fmt.Errorf("保存对账记录失败：%v", err)
+	}
+	if run.Error != "" {
+		return run, fmt.Errorf("对账未全部完成：%s", run.Error)
+	}
+	return run, nil
+}
+
+// 定时任务：按配置决定是否自动修复
+func (s *ReconcileService) RunScheduled(repair bool) func() error {
+	return func() error {
+		_, err := s.Reconcile(model.ReconcileSchedule, 0, repair, time.Now().Add(-reconcileLookback))
+		return err
+	}
+}
+
+// 需要核对预扣款的挂牌：进行中的挂牌、仍有冻结出价的挂牌，以及最近有变动的挂牌
+func (r *reconciler) checkHoldings() {
+	var listingIDs []int
+	if err := r.db.Model(&model.MarketListing{}).
+		Where("status = ? OR update_time >= ? OR id IN (?)", model.ListingActive, r.since,
+			r.db.Model(&model.MarketOffer{}).Select("listing_id").
+				Where("status = ? AND is_escrowed = ?", model.OfferPending, true)).
+		Order("id").Pluck("id", &listingIDs).Error; err != nil {
+		r.errs = append(r.errs, fmt.Errorf("查询挂牌失败：%v", err))
+		return
+	}
+	for _, id := range listingIDs {
+		if err := r.checkListingHoldings(id); err != nil {
+			r.errs = append(r.errs, fmt.Errorf("挂牌 %d 对账失败：%v", id, err))
+		}
+	}
+}
+
+// 孤立预扣款的退款，按账户合并，在事务提交后提交到链上
+type holdRefund struct {
+	txid    string
+	account int
+	amount  int
+	issues  []int // 对应 r.issues 的下标
+}
+
+// 在锁住挂牌的事务内核对该挂牌的出价和链上预扣款，避免与出价、撤回、结算并发
+// 孤立预扣款的链上退款在事务外提交，不在链上调用期间持有挂牌行锁；
+// 期间该账户又冻结了新的出价时冻结总额对不上，链码会拒绝退款，不会误退
+func (r *reconciler) checkListingHoldings(listingID int) error {
+	listingKey := fmt.Sprintf("%d", listingID)
+	var refunds []*holdRefund
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var listing model.MarketListing
+		if err := model.ForUpdate(tx).
+			First(&listing, listingID).Error; err != nil {
+			return err
+		}
+		// 结算中的挂牌状态本来就是中间态，由结算流程负责
+		busy, err := listingHasActiveWorkflowTx(tx, listingID)
+		if err != nil || busy {
+			return err
+		}
+
+		holds, err := r.wallet.getWithHoldingByListingIDFromChain(listingKey, workflowOrg)
+		if err != nil {
+			return err
+		}
+		var offers []model.MarketOffer
+		if err := tx.Where("listing_id = ? AND status = ? AND (is_escrowed = ? OR escrow_hold_id IS NOT NULL)", listingID, model.OfferPending, true).
+			Find(&offers).Error; err != nil {
+			return err
+		}
+
+		holdByID := make(map[string]model.WithHolding, len(holds))
+		for _, h := range holds {
+			holdByID[h.ID] = h
+		}
+		matched := map[string]bool{}
+		activeAccounts := map[int]bool{} // 在该挂牌上还有有效冻结的账户
+		for _, o := range offers {
+			if offerHoldPending(o) {
+				// 冻结中的出价由 CreateOffer 或 CloseExpired 确认，链上的冻结不算孤立
+				matched[*o.EscrowHoldID] = true
+				activeAccounts[o.BidderID] = true
+				continue
+			}
+			var h model.WithHolding
+			ok := false
+			if o.EscrowHoldID != nil {
+				h, ok = holdByID[*o.EscrowHoldID]
+			}
+			if !ok {
+				issue := model.ReconcileIssue{
+					Type:      model.ReconcileHoldMissing,
+					ListingID: listingID,
+					OfferID:   o.ID,
+					Detail:    fmt.Sprintf("出价 %d 标记为已冻结，但链上没有对应的预扣款", o.ID),
+				}
+				if r.repair {
+					// 资金已经不在冻结中，出价不能再被接受，改为已拒绝
+					err := tx.Model(&model.MarketOffer{}).
+						Where("id = ? AND status = ?", o.ID, model.OfferPending).
+						Updates(map[string]any{
+							"status":      model.OfferRejected,
+							"is_escrowed": false,
+							"update_time": time.Now(),
+						}).Error
+					r.markRepaired(&issue, err)
+				}
+				r.issues = append(r.issues, issue)
+				continue
+			}
+			matched[h.ID] = true
+			activeAccounts[h.AccountID] = true
+			if h.AccountID != o.BidderID || int64(h.Amount) != o.OfferPrice {
+				r.issues = append(r.issues, model.ReconcileIssue{
+					Type:      model.ReconcileHoldMismatch,
+					ListingID: listingID,
+					OfferID:   o.ID,
+					HoldID:    h.ID,
+					Detail: fmt.Sprintf("出价为账户 %d 金额 %d，链上预扣款为账户 %d 金额 %d",
+						o.BidderID, o.OfferPrice, h.AccountID, h.Amount),
+				})
+			}
+		}
+
+		byAccount := map[int]*holdRefund{}
+		for _, h := range holds {
+			if matched[h.ID] {
+				continue
+			}
+			issue := model.ReconcileIssue{
+				Type:      model.ReconcileHoldOrphan,
+				ListingID: listingID,
+				HoldID:    h.ID,
+				Detail:    fmt.Sprintf("账户 %d 在链上冻结了 %d，但没有对应的待处理出价", h.AccountID, h.Amount),
+			}
+			if r.repair {
+				if activeAccounts[h.AccountID] {
+					// 链码按账户退还该挂牌下的全部预扣款，自动退款会连带退掉有效出价的冻结
+					issue.RepairError = "该账户在此挂牌上还有有效出价，需要人工处理"
+				} else {
+					// 链码一次退还账户在该挂牌下的全部冻结，同一账户的孤立预扣款合并为一笔退款
+					refund := byAccount[h.AccountID]
+					if refund == nil {
+						// 固定的 txid 保证重复对账不会重复退款
+						refund = &holdRefund{txid: "reconcile-" + h.ID, account: h.AccountID}
+						byAccount[h.AccountID] = refund
+						refunds = append(refunds, refund)
+					}
+					refund.amount += h.Amount
+					refund.issues = append(refund.issues, len(r.issues))
+				}
+			}
+			r.issues = append(r.issues, issue)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, refund := range refunds {
+		err := r.wallet.RefundHoldingWithID(refund.txid, listingKey, refund.account, refund.amount, workflowOrg)
+		for _, i := range refund.issues {
+			r.markRepaired(&r.issues[i], err)
+		}
+	}
+	return nil
+}
+
+// 需要核对预扣款的拍品：还没有拍卖结果的拍品，以及最近有变动的拍品
+func (r *reconciler) checkLotHoldings() {
+	var lotIDs []int
+	if err := r.db.Model(&model.Lot{}).
+		Where("id NOT IN (?) OR update_time >= ?", r.db.Model(&model.AuctionResult{}).Select("lot_id"), r.since).
+		Order("id").Pluck("id", &lotIDs).Error; err != nil {
+		r.errs = append(r.errs, fmt.Errorf("查询拍品失败：%v", err))
+		return
+	}
+	for _, id := range lotIDs {
+		if err := r.checkLot(id); err != nil {
+			r.errs = append(r.errs, fmt.Errorf("拍品 %d 对账失败：%v", id, err))
+		}
+	}
+}
+
+// 在锁住拍品的事务内核对 lot-N 下的链上预扣款：
+// 没有结果时每个已冻结出价的出价人冻结总额等于出价（加价分多笔冻结），有结果后不应再有冻结
+// 孤立预扣款在事务外退款，与挂牌相同
+func (r *reconciler) checkLot(lotID int) error {
+	lotKey := lotHoldKey(lotID)
+	var refunds []*holdRefund
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var lot model.Lot
+		if err := model.ForUpdate(tx).First(&lot, lotID).Error; err != nil {
+			return err
+		}
+		var finished int64
+		if err := tx.Model(&model.AuctionResult{}).Where("lot_id = ?", lotID).Count(&finished).Error; err != nil {
+			return err
+		}
+		// 结算中的拍品由结算重试负责
+		if lot.Settling && finished == 0 {
+			return nil
+		}
+		holds, err := r.wallet.getWithHoldingByListingIDFromChain(lotKey, workflowOrg)
+		if err != nil {
+			return err
+		}
+		var bids []model.Bid
+		if finished == 0 {
+			if err := tx.Where("lot_id = ?", lotID).Find(&bids).Error; err != nil {
+				return err
+			}
+		}
+
+		held := map[int]int{}
+		holdsOf := map[int][]model.WithHolding{}
+		for _, h := range holds {
+			held[h.AccountID] += h.Amount
+			holdsOf[h.AccountID] = append(holdsOf[h.AccountID], h)
+		}
+		bidders := map[int]bool{} // 有已冻结或冻结中出价的出价人
+		for _, bid := range bids {
+			if bid.HoldPending {
+				// 冻结中的出价由 SubmitBid 或 resolvePendingBids 确认
+				bidders[bid.BidderID] = true
+				continue
+			}
+			if !bid.Escrowed {
+				continue
+			}
+			bidders[bid.BidderID] = true
+			switch amount := held[bid.BidderID]; {
+			case amount == 0:
+				issue := model.ReconcileIssue{
+					Type:   model.ReconcileBidMissing,
+					LotID:  lotID,
+					Detail: fmt.Sprintf("出价人 %d 的出价 %d 标记为已冻结，但链上没有对应的预扣款", bid.BidderID, bid.BidPrice),
+				}
+				if r.repair {
+					// 按升级前没有冻结的出价处理，赢得拍卖时由出价人直接付款
+					err := tx.Model(&model.Bid{}).Where("id = ? AND escrowed = ?", bid.ID, true).
+						Update("escrowed", false).Error
+					r.markRepaired(&issue, err)
+				}
+				r.issues = append(r.issues, issue)
+			case amount != bid.BidPrice:
+				r.issues = append(r.issues, model.ReconcileIssue{
+					Type:   model.ReconcileBidMismatch,
+					LotID:  lotID,
+					Detail: fmt.Sprintf("出价人 %d 出价 %d，链上冻结总额为 %d", bid.BidderID, bid.BidPrice, amount),
+				})
+			}
+		}
+
+		accounts := make([]int, 0, len(holdsOf))
+		for account := range holdsOf {
+			accounts = append(accounts, account)
+		}
+		sort.Ints(accounts)
+		for _, account := range accounts {
+			if bidders[account] {
+				continue
+			}
+			hs := holdsOf[account]
+			issue := model.ReconcileIssue{
+				Type:   model.ReconcileHoldOrphan,
+				LotID:  lotID,
+				HoldID: hs[0].ID,
+				Detail: fmt.Sprintf("账户 %d 在链上冻结了 %d，但没有对应的有效出价", account, held[account]),
+			}
+			if r.repair {
+				// 固定的 txid 保证重复对账不会重复退款
+				refunds = append(refunds, &holdRefund{
+					txid: "reconcile-" + hs[0].ID, account: account, amount: held[account], issues: []int{len(r.issues)},
+				})
+			}
+			r.issues = append(r.issues, issue)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, refund := range refunds {
+		err := r.wallet.RefundHoldingWithID(refund.txid, lotKey, refund.account, refund.amount, workflowOrg)
+		for _, i := range refund.issues {
+			r.markRepaired(&r.issues[i], err)
+		}
+	}
+	return nil
+}
+
+func (r *reconciler) markRepaired(issue *model.ReconcileIssue, err error) {
+	if err != nil {
+		issue.RepairError = err.Error()
+		return
+	}
+	issue.Repaired = true
+}
+
+// 查询 NFT 当前持有人
+func (r *reconciler) owner(assetID string) (int, error) {
+	if id, ok := r.ownerOf[assetID]; ok {
+		return id, nil
+	}
+	asset, err := r.assets.getAssetByIDFromChain(assetID, workflowOrg)
+	if err != nil {
+		return 0, err
+	}
+	r.ownerOf[assetID] = asset.OwnerId
+	return asset.OwnerId, nil
+}
+
+// 该 NFT 在 after 之后是否又被挂牌或拍卖过，此时持有人以后续交易为准
+func (r *reconciler) tradedAfter(assetID string, after time.Time) (bool, error) {
+	var cnt int64
+	if err := r.db.Model(&model.MarketListing{}).
+		Where("asset_id = ? AND create_time > ?", assetID, after).
+		Count(&cnt).Error; err != nil {
+		return false, err
+	}
+	if cnt > 0 {
+		return true, nil
+	}
+	if err := r.db.Model(&model.Lot{}).
+		Where("asset_id = ? AND create_time > ?", assetID, after).
+		Count(&cnt).Error; err != nil {
+		return false, err
+	}
+	return cnt > 0, nil
+}
+
+// 已成交挂牌：买家应当是链上 NFT 持有人
+func (r *reconciler) checkSoldListings() {
+	var listings []model.MarketListing
+	if err := r.db.Where("status = ? AND winner_offer_id IS NOT NULL AND update_time >= ?", model.ListingSold, r.since).
+		Order("id").Find(&listings).Error; err != nil {
+		r.errs = append(r.errs, fmt.Errorf("查询已成交挂牌失败：%v", err))
+		return
+	}
+	for _, l := range listings {
+		later, err := r.tradedAfter(l.AssetID, l.CreateTime)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("挂牌 %d 对账失败：%v", l.ID, err))
+			continue
+		}
+		if later {
+			continue
+		}
+		var offer model.MarketOffer
+		if err := r.db.First(&offer, *l.WinnerOfferID).Error; err != nil {
+			r.errs = append(r.errs, fmt.Errorf("挂牌 %d 查询成交出价失败：%v", l.ID, err))
+			continue
+		}
+		owner, err := r.owner(l.AssetID)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("挂牌 %d 查询 NFT 失败：%v", l.ID, err))
+			continue
+		}
+		if owner != offer.BidderID {
+			r.issues = append(r.issues, model.ReconcileIssue{
+				Type:      model.ReconcileListingOwner,
+				ListingID: l.ID,
+				OfferID:   offer.ID,
+				AssetID:   l.AssetID,
+				Detail:    fmt.Sprintf("挂牌成交给账户 %d，链上持有人为 %d（也可能已通过直接转移改变所有权）", offer.BidderID, owner),
+			})
+		}
+	}
+}
+
+// 拍卖结果：赢家应当是链上 NFT 持有人
+func (r *reconciler) checkAuctionResults() {
+	var lots []model.Lot
+	if err := r.db.Where("deadline >= ? AND deadline <= ?", r.since, time.Now()).
+		Where("id IN (?)", r.db.Model(&model.AuctionResult{}).Select("lot_id").Where("bidder_id > 0")).
+		Order("id").Find(&lots).Error; err != nil {
+		r.errs = append(r.errs, fmt.Errorf("查询拍卖结果失败：%v", err))
+		return
+	}
+	for _, lot := range lots {
+		var result model.AuctionResult
+		if err := r.db.Where("lot_id = ?", lot.ID).First(&result).Error; err != nil {
+			r.errs = append(r.errs, fmt.Errorf("拍品 %d 查询拍卖结果失败：%v", lot.ID, err))
+			continue
+		}
+		later, err := r.tradedAfter(lot.AssetID, lot.CreateTime)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("拍品 %d 对账失败：%v", lot.ID, err))
+			continue
+		}
+		if later {
+			continue
+		}
+		owner, err := r.owner(lot.AssetID)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("拍品 %d 查询 NFT 失败：%v", lot.ID, err))
+			continue
+		}
+		if owner != result.BidderID {
+			r.issues = append(r.issues, model.ReconcileIssue{
+				Type:    model.ReconcileAuctionOwner,
+				LotID:   lot.ID,
+				AssetID: lot.AssetID,
+				Detail:  fmt.Sprintf("拍卖赢家为账户 %d，链上持有人为 %d（也可能已通过直接转移改变所有权）", result.BidderID, owner),
+			})
+		}
+	}
+}
+
+// 分页查询对账记录（不含问题列表）
+func (s *ReconcileService) ListRuns(page, pageSize int) ([]model.ReconcileRun, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+	var (
+		items []model.ReconcileRun
+		total int64
+	)
+	q := s.db.Model(&model.ReconcileRun{})
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Omit("issues").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// 查询单次对账的完整结果
+func (s *ReconcileService) GetRun(id int) (*model.ReconcileRun, error) {
+	var run model.ReconcileRun
+	if err := s.db.First(&run, id).Error; err != nil {
+		return nil, fmt.Errorf("查询对账记录失败：%v", err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"application/config"
+	"application/model"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 刷新令牌校验失败，调用方应返回 401 让客户端重新登录
+var (
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效或会话已注销")
+	ErrRefreshTokenExpired = errors.New("刷新令牌已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，为安全起见会话已注销，请重新登录")
+)
+
+// sessionCheckInterval 会话确认有效后，这段时间内认证不再查询数据库
+// 在本实例注销的会话会立即从缓存中移除；其他实例注销的会话最多延迟这段时间生效
+const sessionCheckInterval = 30 * time.Second
+
+// activeSessions 最近确认仍然有效的会话 ID 及确认时间
+var activeSessions sync.Map
+
+// SessionService 登录会话：签发访问令牌、轮换刷新令牌、列出和注销会话
+type SessionService struct {
+	db *gorm.DB
+}
+
+func NewSessionService() *SessionService {
+	return &SessionService{db: model.GetDB()}
+}
+
+// Create 登录成功后创建会话并签发第一对令牌
+// 通过两步验证登录时 stepUp 为 true，会话从登录起就算作完成了二次验证
+func (s *SessionService) Create(user *model.User, userAgent string, ip string, stepUp bool) (*model.TokenPair, error) {
+	var pair *model.TokenPair
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := &model.Session{ID: uuid.New().String(), UserID: user.ID}
+		if stepUp {
+			session.StepUpAt = &now
+		}
+		var err error
+		pair, err = s.issue(tx, user, session, userAgent, ip, now, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh 用刷新令牌换发新的一对令牌，旧刷新令牌随即失效
+// 已经换发过的刷新令牌再次出现，说明令牌被复制，合法用户和攻击者无法区分，直接注销整个会话
+func (s *SessionService) Refresh(refreshToken string, userAgent string, ip string) (*model.TokenPair, error) {
+	var pair *model.TokenPair
+	var reused *model.Session
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var token model.Token
+		if err := model.ForUpdate(tx).Where("token = ?", hashToken(refreshToken)).First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return fmt.Errorf("查询刷新令牌失败：%v", err)
+		}
+		var session model.Session
+		if err := model.ForUpdate(tx).First(&session, "id = ?", token.SessionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return fmt.Errorf("查询会话失败：%v", err)
+		}
+		if session.RevokedAt != nil {
+			return ErrRefreshTokenInvalid
+		}
+		if token.UsedAt != nil {
+			reused = &session
+			return revokeSessionsTx(tx, session.UserID, []string{session.ID}, model.SessionRefreshReused)
+		}
+		now := time.Now()
+		if !token.ExpiresAt.After(now) {
+			return ErrRefreshTokenExpired
+		}
+
+		var user model.User
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return fmt.Errorf("查询用户失败：%v", err)
+		}
+		if err := tx.Model(&token).Update("used_at", now).Error; err != nil {
+			return fmt.Errorf("更新刷新令牌失败：%v", err)
+		}
+		var err error
+		pair, err = s.issue(tx, &user, &session, userAgent, ip, now, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused != nil {
+		forgetSessions(reused.ID)
+		log.Printf("用户 %d 的会话 %s 的刷新令牌被重复使用（IP %s），会话已注销", reused.UserID, reused.ID, ip)
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// IsActive 会话是否未注销且未过期，认证中间件对每个请求调用
+func (s *SessionService) IsActive(sessionID string, userID int) (bool, error) {
+	if checked, ok := activeSessions.Load(sessionID); ok && time.Since(checked.(time.Time)) < sessionCheckInterval {
+		return true, nil
+	}
+	var count int64
+	err := s.db.Model(&model.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		activeSessions.Delete(sessionID)
+		return false, nil
+	}
+	activeSessions.Store(sessionID, time.Now())
+	return true, nil
+}
+
+// Logout 注销访问令牌所属的会话，访问令牌过期后仍然可以用来登出
+func (s *SessionService) Logout(accessToken string) error {
+	claims := &model.Claims{}
+	_, err := jwt.NewParser(jwt.WithoutClaimsValidation()).ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.GlobalConfig.Auth.JWTSecret), nil
+	})
+	if err != nil {
+		return fmt.Errorf("解析令牌失败：%v", err)
+	}
+	if claims.SessionID == "" {
+		return fmt.Errorf("令牌缺少会话信息")
+	}
+	if err := revokeSessionsTx(s.db, claims.UserID, []string{claims.SessionID}, model.SessionLogout); err != nil {
+		return err
+	}
+	forgetSessions(claims.SessionID)
+	return nil
+}
+
+// ListActive 用户未注销且未过期的会话，按最近活动时间倒序
+func (s *SessionService) ListActive(userID int, currentID string) ([]model.Session, error) {
+	var sessions []model.Session
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询会话失败：%v", err)
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// Revoke 注销用户自己的某个会话
+func (s *SessionService) Revoke(userID int, sessionID string) error {
+	var count int64
+	err := s.db.Model(&model.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("查询会话失败：%v", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("会话不存在或已注销")
+	}
+	if err := revokeSessionsTx(s.db, userID, []string{sessionID}, model.SessionRevoked); err != nil {
+		return err
+	}
+	forgetSessions(sessionID)
+	return nil
+}
+
+// RevokeOthers 注销用户除 keepID 以外的全部会话，返回注销的会话数
+func (s *SessionService) RevokeOthers(userID int, keepID string, reason string) (int, error) {
+	var ids []string
+	err := s.db.Model(&model.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).Pluck("id", &ids).Error
+	if err != nil {
+		return 0, fmt.Errorf("查询会话失败：%v", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := revokeSessionsTx(s.db, userID, ids, reason); err != nil {
+		return 0, err
+	}
+	forgetSessions(ids...)
+	return len(ids), nil
+}
+
+// CleanupExpired 定时任务：删除过期的刷新令牌和会话
+// 已使用的刷新令牌要保留到过期，用于识别重复使用
+func (s *SessionService) CleanupExpired() error {
+	now := time.Now()
+	tokens := s.db.Where("expires_at <= ?", now).Delete(&model.Token{})
+	if tokens.Error != nil {
+		return fmt.Errorf("清理过期刷新令牌失败：%v", tokens.Error)
+	}
+	// 会话的过期时间就是最新刷新令牌的过期时间，会话过期时它的令牌都已删除
+	sessions := s.db.Where("expires_at <= ?", now).Delete(&model.Session{})
+	if sessions.Error != nil {
+		return fmt.Errorf("清理过期会话失败：%v", sessions.Error)
+	}
+	if tokens.RowsAffected > 0 || sessions.RowsAffected > 0 {
+		log.Printf("已清理 %d 个过期刷新令牌、%d 个过期会话", tokens.RowsAffected, sessions.RowsAffected)
+	}
+	return nil
+}
+
+// issue 签发访问令牌和新的刷新令牌，并更新会话的设备信息和过期时间
+func (s *SessionService) issue(tx *gorm.DB, user *model.User, session *model.Session,
+	userAgent string, ip string, now time.Time, create bool) (*model.TokenPair, error) {
+	auth := config.GlobalConfig.Auth
+	accessExpiresAt := now.Add(auth.TokenTTL)
+	refreshExpiresAt := now.Add(auth.RefreshTokenTTL)
+
+	claims := &model.Claims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Org:       user.Org,
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(accessExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(auth.JWTSecret))
+	if err != nil {
+		return nil, fmt.Errorf("生成JWT令牌失败：%v", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("生成刷新令牌失败：%v", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(raw)
+
+	session.UserAgent = truncate(userAgent, 255)
+	session.IP = truncate(ip, 64)
+	session.ExpiresAt = refreshExpiresAt
+	session.LastSeenAt = now
+	if create {
+		err = tx.Create(session).Error
+	} else {
+		err = tx.Model(session).Updates(map[string]any{
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"expires_at":   session.ExpiresAt,
+			"last_seen_at": session.LastSeenAt,
+		}).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("保存会话失败：%v", err)
+	}
+	err = tx.Create(&model.Token{
+		Token:     hashToken(refreshToken),
+		SessionID: session.ID,
+		UserID:    user.ID,
+		ExpiresAt: refreshExpiresAt,
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("保存刷新令牌失败：%v", err)
+	}
+
+	return &model.TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// revokeSessionsTx 注销会话，已注销的会话不受影响
+func revokeSessionsTx(tx *gorm.DB, userID int, ids []string, reason string) error {
+	err := tx.Model(&model.Session{}).
+		Where("id IN ? AND user_id = ? AND revoked_at IS NULL", ids, userID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+	if err != nil {
+		return fmt.Errorf("注销会话失败：%v", err)
+	}
+	return nil
+}
+
+// forgetSessions 会话注销提交后调用，使这些会话的访问令牌在本实例立即失效
+func forgetSessions(ids ...string) {
+	for _, id := range ids {
+		activeSessions.Delete(id)
+	}
+}
+
+// hashToken 数据库中只保存刷新令牌的 SHA-256
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"application/config"
+	"application/model"
+	"application/pkg/totp"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 二次验证没有通过，调用方应返回 428 让客户端提交验证码后重试；没有开启两步验证时无法通过，返回 403
+var (
+	ErrTwoFactorNotEnabled = errors.New("该操作需要两步验证，请先在账号设置中开启两步验证")
+	ErrStepUpRequired      = errors.New("该操作需要两步验证，请输入身份验证器中的验证码")
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute  // 登录挑战令牌的有效期
+	twoFactorSkew         = 1                // 允许前后各一个时间步（30 秒）的时钟误差
+	maxTwoFactorAttempts  = 5                // 连续输错这么多次后锁定
+	twoFactorLockout      = 15 * time.Minute // 锁定时长
+	recoveryCodeCount     = 10               // 每次生成的恢复码数量
+)
+
+// TwoFactorService 两步验证（TOTP）：开启和关闭、登录第二步、高风险操作前的二次验证
+// 密钥用 auth.twoFactorKey 加密保存；恢复码只保存哈希
+type TwoFactorService struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorService() *TwoFactorService {
+	return &TwoFactorService{db: model.GetDB()}
+}
+
+// Status 两步验证状态和当前会话的二次验证有效期
+func (s *TwoFactorService) Status(userID int, sessionID string) (*model.TwoFactorStatus, error) {
+	status := &model.TwoFactorStatus{}
+	var tf model.TwoFactor
+	err := s.db.Where("user_id = ? AND enabled_at IS NOT NULL", userID).First(&tf).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询两步验证失败：%v", err)
+	}
+	if err != nil {
+		return status, nil
+	}
+	status.Enabled = true
+	status.EnabledAt = tf.EnabledAt
+	var left int64
+	if err := s.db.Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&left).Error; err != nil {
+		return nil, fmt.Errorf("查询恢复码失败：%v", err)
+	}
+	status.RecoveryCodesLeft = int(left)
+	var session model.Session
+	if err := s.db.Select("id", "step_up_at").First(&session, "id = ? AND user_id = ?", sessionID, userID).Error; err != nil {
+		return nil, fmt.Errorf("查询会话失败：%v", err)
+	}
+	if session.StepUpAt != nil {
+		expiresAt := session.StepUpAt.Add(config.GlobalConfig.Auth.StepUpTTL)
+		if expiresAt.After(time.Now()) {
+			status.StepUpExpiresAt = &expiresAt
+		}
+	}
+	return status, nil
+}
+
+// Enabled 用户是否已开启两步验证
+func (s *TwoFactorService) Enabled(userID int) (bool, error) {
+	var count int64
+	err := s.db.Model(&model.TwoFactor{}).Where("user_id = ? AND enabled_at IS NOT NULL", userID).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("查询两步验证失败：%v", err)
+	}
+	return count > 0, nil
+}
+
+// Setup 生成新的密钥，用户用身份验证器扫码后调用 Enable 确认
+// 重复调用会替换尚未确认的密钥
+func (s *TwoFactorService) Setup(userID int) (*model.TwoFactorSetup, error) {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("查询用户失败：%v", err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealTwoFactorSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var existing model.TwoFactor
+		err := model.ForUpdate(tx).First(&existing, "user_id = ?", userID).Error
+		if err == nil && existing.EnabledAt != nil {
+			return fmt.Errorf("两步验证已开启，如需更换身份验证器请先关闭")
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("查询两步验证失败：%v", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.TwoFactor{}).Error; err != nil {
+			return fmt.Errorf("删除未确认的密钥失败：%v", err)
+		}
+		if err := tx.Create(&model.TwoFactor{UserID: userID, Secret: sealed}).Error; err != nil {
+			return fmt.Errorf("保存密钥失败：%v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(config.GlobalConfig.Auth.TwoFactorIssuer, user.Username, secret),
+	}, nil
+}
+
+// Enable 用身份验证器上的验证码确认密钥，开启两步验证并返回恢复码
+// 恢复码只在这里和重新生成时返回一次
+func (s *TwoFactorService) Enable(userID int, code string) ([]string, error) {
+	var codes []string
+	err := s.verify(userID, code, true, func(tx *gorm.DB, tf *model.TwoFactor) error {
+		if err := tx.Model(tf).Update("enabled_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("开启两步验证失败：%v", err)
+		}
+		var err error
+		codes, err = replaceRecoveryCodesTx(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("用户 %d 开启了两步验证", userID)
+	return codes, nil
+}
+
+// Disable 关闭两步验证，需要密码和验证码（或恢复码）
+func (s *TwoFactorService) Disable(userID int, password string, code string) error {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return fmt.Errorf("查询用户失败：%v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return fmt.Errorf("密码错误")
+	}
+	err := s.verify(userID, code, false, func(tx *gorm.DB, tf *model.TwoFactor) error {
+		if err := tx.Delete(tf).Error; err != nil {
+			return fmt.Errorf("关闭两步验证失败：%v", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("删除恢复码失败：%v", err)
+		}
+		// 关闭后已有的二次验证一并失效
+		if err := tx.Model(&model.Session{}).Where("user_id = ?", userID).Update("step_up_at", nil).Error; err != nil {
+			return fmt.Errorf("更新会话失败：%v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("用户 %d 关闭了两步验证", userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部失效
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	var codes []string
+	err := s.verify(userID, code, false, func(tx *gorm.DB, tf *model.TwoFactor) error {
+		var err error
+		codes, err = replaceRecoveryCodesTx(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// StepUp 在当前会话中完成二次验证，auth.stepUpTTL 内的高风险操作不再需要验证码，返回过期时间
+func (s *TwoFactorService) StepUp(userID int, sessionID string, code string) (time.Time, error) {
+	now := time.Now()
+	err := s.verify(userID, code, false, func(tx *gorm.DB, tf *model.TwoFactor) error {
+		result := tx.Model(&model.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+			Update("step_up_at", now)
+		if result.Error != nil {
+			return fmt.Errorf("更新会话失败：%v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("会话已注销")
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(config.GlobalConfig.Auth.StepUpTTL), nil
+}
+
+// CheckStepUp 当前会话是否在 auth.stepUpTTL 内完成过二次验证
+func (s *TwoFactorService) CheckStepUp(userID int, sessionID string) error {
+	var session model.Session
+	if err := s.db.Select("id", "step_up_at").First(&session, "id = ? AND user_id = ?", sessionID, userID).Error; err != nil {
+		return fmt.Errorf("查询会话失败：%v", err)
+	}
+	if session.StepUpAt != nil && time.Since(*session.StepUpAt) < config.GlobalConfig.Auth.StepUpTTL {
+		return nil
+	}
+	enabled, err := s.Enabled(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorNotEnabled
+	}
+	return ErrStepUpRequired
+}
+
+// Challenge 密码验证通过后签发挑战令牌，客户端带着它和验证码完成登录
+func (s *TwoFactorService) Challenge(user *model.User) (*model.TwoFactorChallenge, error) {
+	now := time.Now()
+	expiresAt := now.Add(twoFactorChallengeTTL)
+	claims := &model.TwoFactorClaims{
+		UserID:  user.ID,
+		Purpose: model.TwoFactorLoginPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.GlobalConfig.Auth.JWTSecret))
+	if err != nil {
+		return nil, fmt.Errorf("生成挑战令牌失败：%v", err)
+	}
+	return &model.TwoFactorChallenge{TwoFactorRequired: true, ChallengeToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// VerifyChallenge 校验挑战令牌和验证码（或恢复码），返回登录的用户
+func (s *TwoFactorService) VerifyChallenge(challengeToken string, code string) (*model.User, error) {
+	claims := &model.TwoFactorClaims{}
+	parsed, err := jwt.ParseWithClaims(challengeToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.GlobalConfig.Auth.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsed.Valid || claims.Purpose != model.TwoFactorLoginPurpose {
+		return nil, fmt.Errorf("登录已超时，请重新输入密码")
+	}
+	if err := s.verify(claims.UserID, code, false, nil); err != nil {
+		return nil, err
+	}
+	var user model.User
+	if err := s.db.First(&user, claims.UserID).Error; err != nil {
+		return nil, fmt.Errorf("查询用户失败：%v", err)
+	}
+	return &user, nil
+}
+
+// verify 校验验证码，通过后在同一事务中执行 then
+// enabling 为 true 时校验尚未确认的密钥，只接受验证码；否则要求已开启，也接受恢复码
+// 输错的次数随事务提交，连续输错 maxTwoFactorAttempts 次后锁定 twoFactorLockout
+func (s *TwoFactorService) verify(userID int, code string, enabling bool, then func(tx *gorm.DB, tf *model.TwoFactor) error) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return fmt.Errorf("请输入验证码")
+	}
+	var verifyErr error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var tf model.TwoFactor
+		if err := model.ForUpdate(tx).First(&tf, "user_id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				if enabling {
+					return fmt.Errorf("请先生成密钥")
+				}
+				return ErrTwoFactorNotEnabled
+			}
+			return fmt.Errorf("查询两步验证失败：%v", err)
+		}
+		if enabling && tf.EnabledAt != nil {
+			return fmt.Errorf("两步验证已开启")
+		}
+		if !enabling && tf.EnabledAt == nil {
+			return ErrTwoFactorNotEnabled
+		}
+		now := time.Now()
+		if tf.LockedUntil != nil && tf.LockedUntil.After(now) {
+			return fmt.Errorf("验证码错误次数过多，请在 %s 后重试", tf.LockedUntil.Format("15:04:05"))
+		}
+
+		ok, err := s.match(tx, &tf, code, !enabling, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			updates := map[string]any{"failed_attempts": tf.FailedAttempts + 1}
+			verifyErr = fmt.Errorf("验证码错误")
+			if tf.FailedAttempts+1 >= maxTwoFactorAttempts {
+				updates = map[string]any{"failed_attempts": 0, "locked_until": now.Add(twoFactorLockout)}
+				verifyErr = fmt.Errorf("验证码错误次数过多，请 %s 后重试", twoFactorLockout)
+				log.Printf("用户 %d 连续输错两步验证码，已锁定 %s", userID, twoFactorLockout)
+			}
+			if err := tx.Model(&tf).Updates(updates).Error; err != nil {
+				return fmt.Errorf("记录验证失败次数失败：%v", err)
+			}
+			return nil
+		}
+		err = tx.Model(&tf).Updates(map[string]any{"last_step": tf.LastStep, "failed_attempts": 0, "locked_until": nil}).Error
+		if err != nil {
+			return fmt.Errorf("更新两步验证失败：%v", err)
+		}
+		if then != nil {
+			return then(tx, &tf)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// match 6 位数字按 TOTP 校验，匹配的时间步必须晚于上次通过的时间步；其余按恢复码校验，恢复码用后作废
+func (s *TwoFactorService) match(tx *gorm.DB, tf *model.TwoFactor, code string, allowRecovery bool, now time.Time) (bool, error) {
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		secret, err := openTwoFactorSecret(tf.Secret)
+		if err != nil {
+			return false, err
+		}
+		step, ok := totp.Validate(secret, code, now, twoFactorSkew)
+		if !ok || step <= tf.LastStep {
+			return false, nil
+		}
+		tf.LastStep = step
+		return true, nil
+	}
+	if !allowRecovery {
+		return false, nil
+	}
+	result := tx.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", tf.UserID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, fmt.Errorf("校验恢复码失败：%v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	log.Printf("用户 %d 使用了一个恢复码", tf.UserID)
+	return true, nil
+}
+
+// replaceRecoveryCodesTx 生成新的恢复码替换旧的，格式为 xxxxx-xxxxx
+func replaceRecoveryCodesTx(tx *gorm.DB, userID int) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("删除旧恢复码失败：%v", err)
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]model.RecoveryCode, 0, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("生成恢复码失败：%v", err)
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw))[:10]
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		rows = append(rows, model.RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(code))})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, fmt.Errorf("保存恢复码失败：%v", err)
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode 忽略大小写、空格和连字符
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
+
+// twoFactorKey auth.twoFactorKey，加密 TOTP 密钥
+func twoFactorKey() sealingKey {
+	return sealingKey{
+		name:     "auth.twoFactorKey",
+		current:  config.GlobalConfig.Auth.TwoFactorKey,
+		previous: config.GlobalConfig.Auth.PreviousTwoFactorKey,
+	}
+}
+
+func sealTwoFactorSecret(secret string) (string, error) {
+	return twoFactorKey().seal([]byte(secret))
+}
+
+func openTwoFactorSecret(sealed string) (string, error) {
+	secret, _, err := twoFactorKey().open(sealed)
+	if err != nil {
+		return "", fmt.Errorf("解密两步验证密钥失败：%v", err)
+	}
+	return string(secret), nil
+}
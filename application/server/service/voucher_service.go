@@ -0,0 +1,356 @@
+package service
+
+import (
+	"application/model"
+	"application/pkg/fabric"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type VoucherService struct {
+	db     *gorm.DB
+	ledger fabric.LedgerClient
+}
+
+func NewVoucherService(ledger fabric.LedgerClient) *VoucherService {
+	return &VoucherService{db: model.GetDB(), ledger: ledger}
+}
+
+func toChainVoucher(v *model.MintVoucher) fabric.Voucher {
+	return fabric.Voucher{
+		ID:          v.ID,
+		CreatorID:   v.CreatorID,
+		Name:        v.Name,
+		Description: v.Description,
+		ImageName:   v.ImageName,
+		ImageHash:   v.ImageHash,
+		Price:       int(v.Price),
+		Signature:   v.Signature,
+	}
+}
+
+// 获取创作者的签名密钥，不存在则生成并把公钥登记到链上
+// 签名密钥由平台托管：私钥在服务端生成、用 fabric.walletKey 加密保存，创作者发布凭证时由平台代为签名，
+// 创作者本人不持有私钥，凭证签名只能证明平台确认过创作者的发布请求
+func (s *VoucherService) getOrCreateSignerKey(userID int) (*ecdsa.PrivateKey, error) {
+	var key model.SignerKey
+	err := s.db.Where("user_id = ?", userID).First(&key).Error
+	if err == nil {
+		return s.loadSignerKey(&key)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询签名密钥失败：%v", err)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败：%v", err)
+	}
+	privateDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("序列化签名私钥失败：%v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("序列化签名公钥失败：%v", err)
+	}
+	sealed, err := sealPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDER}))
+	if err != nil {
+		return nil, fmt.Errorf("加密签名私钥失败：%v", err)
+	}
+	key = model.SignerKey{
+		UserID:       userID,
+		PrivateKey:   sealed,
+		PublicKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}
+
+	// 公钥登记到链上，只有创作者组织可以登记
+	orgName, err := model.GetOrg(2)
+	if err != nil {
+		return nil, fmt.Errorf("获取组织失败：%s", err)
+	}
+	err = s.ledger.SetSignerKey(orgName, userID, key.PublicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("登记签名公钥失败：%s", fabric.ExtractErrorMessage(err))
+	}
+	if err := s.db.Create(&key).Error; err != nil {
+		return nil, fmt.Errorf("保存签名密钥失败：%v", err)
+	}
+	return privateKey, nil
+}
+
+// 解密签名私钥，加密保存之前遗留的明文 PEM 顺便加密回写
+func (s *VoucherService) loadSignerKey(key *model.SignerKey) (*ecdsa.PrivateKey, error) {
+	var keyPEM []byte
+	if strings.HasPrefix(key.PrivateKey, "-----BEGIN") {
+		keyPEM = []byte(key.PrivateKey)
+		sealed, err := sealPrivateKey(keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("加密签名私钥失败：%v", err)
+		}
+		if err := s.db.Model(&model.SignerKey{}).Where("user_id = ?", key.UserID).
+			Update("private_key", sealed).Error; err != nil {
+			return nil, fmt.Errorf("保存签名密钥失败：%v", err)
+		}
+	} else {
+		var err error
+		keyPEM, err = openPrivateKey(key.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("签名私钥格式错误")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// 创作者发布铸造凭证，此时不上链铸造
+func (s *VoucherService) CreateVoucher(creatorID int, name, description, imageName, imageHash string, price int64) (*model.MintVoucher, error) {
+	if price <= 0 {
+		return nil, errors.New("价格必须大于0")
+	}
+	privateKey, err := s.getOrCreateSignerKey(creatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &model.MintVoucher{
+		ID:          uuid.New().String(),
+		CreatorID:   creatorID,
+		Name:        name,
+		Description: description,
+		ImageName:   imageName,
+		ImageHash:   imageHash,
+		Price:       price,
+		Status:      model.VoucherOpen,
+	}
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, fabric.VoucherDigest(toChainVoucher(v)))
+	if err != nil {
+		return nil, fmt.Errorf("签名凭证失败：%v", err)
+	}
+	v.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	if err := s.db.Create(v).Error; err != nil {
+		return nil, fmt.Errorf("保存凭证失败：%v", err)
+	}
+	return v, nil
+}
+
+// 查询可兑换的凭证
+func (s *VoucherService) ListVouchers(page, pageSize int) ([]model.MintVoucher, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	var items []model.MintVoucher
+	var total int64
+	q := s.db.Model(&model.MintVoucher{}).Where("status = ?", model.VoucherOpen)
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("create_time DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// voucherAssetID 兑换铸造的 NFT ID 由凭证 ID 推导，提交结果不明时可以按 ID 查询链上是否已经铸造
+func voucherAssetID(voucherID string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte("voucher-asset:"+voucherID)).String()
+}
+
+func voucherTransferID(voucherID string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte("voucher-transfer:"+voucherID)).String()
+}
+
+// 锁定凭证、校验后标记为 PENDING，链上调用放在事务之外，避免提交期间一直持有行锁
+func (s *VoucherService) markPending(voucherID string, check func(v *model.MintVoucher) error, fields map[string]any) (*model.MintVoucher, error) {
+	var v model.MintVoucher
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := model.ForUpdate(tx).
+			Where("id = ?", voucherID).First(&v).Error; err != nil {
+			return err
+		}
+		if err := check(&v); err != nil {
+			return err
+		}
+		fields["status"] = model.VoucherPending
+		fields["update_time"] = time.Now()
+		return tx.Model(&model.MintVoucher{}).
+			Where("id = ? AND status = ?", v.ID, model.VoucherOpen).
+			Updates(fields).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// 链上操作确定失败时把凭证恢复为可兑换
+func (s *VoucherService) reopen(voucherID string) {
+	err := s.db.Model(&model.MintVoucher{}).
+		Where("id = ? AND status = ?", voucherID, model.VoucherPending).
+		Updates(map[string]any{
+			"status":      model.VoucherOpen,
+			"redeemer_id": nil,
+			"update_time": time.Now(),
+		}).Error
+	if err != nil {
+		log.Printf("恢复凭证 %s 状态失败：%v", voucherID, err)
+	}
+}
+
+// 买家兑换凭证：链上一笔交易内完成付款与铸造
+func (s *VoucherService) RedeemVoucher(buyerID int, voucherID string) (model.Asset, error) {
+	const org2 = 2
+
+	// 1) 锁定 & 校验，标记为兑换中
+	v, err := s.markPending(voucherID, func(v *model.MintVoucher) error {
+		if v.Status != model.VoucherOpen {
+			return errors.New("凭证已不可兑换")
+		}
+		if v.CreatorID == buyerID {
+			return errors.New("不能兑换自己的凭证")
+		}
+		return nil
+	}, map[string]any{"redeemer_id": buyerID})
+	if err != nil {
+		return model.Asset{}, err
+	}
+
+	// 2) 链上兑换，提交失败时按推导出的 NFT ID 确认是否其实已经成功
+	orgName, err := model.GetOrg(org2)
+	if err != nil {
+		s.reopen(v.ID)
+		return model.Asset{}, fmt.Errorf("获取组织失败：%s", err)
+	}
+	assetID := voucherAssetID(v.ID)
+	asset, err := s.ledger.RedeemVoucher(orgName, toChainVoucher(v), buyerID, assetID, voucherTransferID(v.ID), time.Now())
+	if err != nil {
+		minted, getErr := s.ledger.GetAsset(orgName, assetID)
+		if getErr != nil || minted.OwnerId != buyerID {
+			s.reopen(v.ID)
+			return model.Asset{}, fmt.Errorf("兑换凭证失败：%s", fabric.ExtractErrorMessage(err))
+		}
+		asset = minted
+	}
+
+	// 3) 标记已兑换
+	if err := s.markRedeemed(v.ID, asset.ID); err != nil {
+		return model.Asset{}, fmt.Errorf("链上已兑换，保存兑换记录失败：%v", err)
+	}
+	return asset, nil
+}
+
+func (s *VoucherService) markRedeemed(voucherID string, assetID string) error {
+	return s.db.Model(&model.MintVoucher{}).
+		Where("id = ? AND status = ?", voucherID, model.VoucherPending).
+		Updates(map[string]any{
+			"status":      model.VoucherRedeemed,
+			"asset_id":    assetID,
+			"update_time": time.Now(),
+		}).Error
+}
+
+// 创作者撤回未兑换的凭证，撤回记录写到链上，之后链码拒绝兑换该凭证
+func (s *VoucherService) CancelVoucher(creatorID int, voucherID string) error {
+	v, err := s.markPending(voucherID, func(v *model.MintVoucher) error {
+		if v.CreatorID != creatorID {
+			return errors.New("无权撤回该凭证")
+		}
+		if v.Status != model.VoucherOpen {
+			return errors.New("凭证已不可撤回")
+		}
+		return nil
+	}, map[string]any{})
+	if err != nil {
+		return err
+	}
+
+	if err := s.submitCancel(v); err != nil {
+		s.reopen(v.ID)
+		return err
+	}
+	return nil
+}
+
+// 在链上撤回撤回中的凭证并标记为已撤回
+func (s *VoucherService) submitCancel(v *model.MintVoucher) error {
+	orgName, err := model.GetOrg(2)
+	if err != nil {
+		return fmt.Errorf("获取组织失败：%s", err)
+	}
+	if err := s.ledger.CancelVoucher(orgName, toChainVoucher(v), time.Now()); err != nil {
+		// 上次提交结果不明但其实已经撤回时，按撤回成功处理
+		msg := fabric.ExtractErrorMessage(err)
+		if !strings.Contains(msg, "凭证已被撤回") {
+			return fmt.Errorf("撤回凭证失败：%s", msg)
+		}
+	}
+	return s.db.Model(&model.MintVoucher{}).
+		Where("id = ? AND status = ?", v.ID, model.VoucherPending).
+		Updates(map[string]any{
+			"status":      model.VoucherCancelled,
+			"update_time": time.Now(),
+		}).Error
+}
+
+// 兑换中或撤回中的凭证超过该时间后由 ResolvePending 按链上状态修正，需要长于一次链上提交的最长等待时间
+const pendingVoucherTimeout = 5 * time.Minute
+
+// 定时任务：修正中途中断的凭证（提交后进程退出或保存结果失败）
+// 兑换中的凭证按推导出的转账 ID 查询买家的链上转账，已付款说明已经铸造，标记为已兑换，否则恢复为可兑换；
+// 撤回中的凭证重新提交撤回，已经撤回过的按成功处理
+func (s *VoucherService) ResolvePending() error {
+	var vouchers []model.MintVoucher
+	if err := s.db.Where("status = ? AND update_time < ?", model.VoucherPending, time.Now().Add(-pendingVoucherTimeout)).
+		Find(&vouchers).Error; err != nil {
+		return fmt.Errorf("查询处理中的凭证失败：%v", err)
+	}
+	w := NewWalletService(s.ledger)
+	var errs []error
+	for i := range vouchers {
+		v := &vouchers[i]
+		var err error
+		if v.RedeemerID == nil {
+			err = s.submitCancel(v)
+		} else {
+			var transfers []model.Transfer
+			if transfers, err = w.getTransferBySenderIDFromChain(*v.RedeemerID, 2); err == nil {
+				redeemed := false
+				for _, t := range transfers {
+					if t.ID == voucherTransferID(v.ID) {
+						redeemed = true
+						break
+					}
+				}
+				if redeemed {
+					err = s.markRedeemed(v.ID, voucherAssetID(v.ID))
+				} else {
+					s.reopen(v.ID)
+				}
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("修正凭证 %s 失败：%v", v.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -3,17 +3,18 @@ package service
 import (
 	"application/model"
 	"application/pkg/fabric"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-type WalletService struct{}
+type WalletService struct {
+	ledger fabric.LedgerClient
+}
 
-func NewWalletService() *WalletService {
-	return &WalletService{}
+func NewWalletService(ledger fabric.LedgerClient) *WalletService {
+	return &WalletService{ledger: ledger}
 }
 
 func (s *WalletService) CreateAccount(id int, org int) error {
@@ -21,8 +22,7 @@ func (s *WalletService) CreateAccount(id int, org int) error {
 	if err != nil {
 		return fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	_, err = contract.SubmitTransaction("CreateAccount", fmt.Sprintf("%d", id))
+	err = s.ledger.CreateAccount(orgName, id)
 	if err != nil {
 		return fmt.Errorf("钱包开通失败：%s", fabric.ExtractErrorMessage(err))
 	}
@@ -30,44 +30,45 @@ func (s *WalletService) CreateAccount(id int, org int) error {
 }
 
 func (s *WalletService) GetBalance(id int, org int) (int, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetBalance(id)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getBalanceFromChain(id, org)
+}
+
+// getBalanceFromChain 直接查询链上
+func (s *WalletService) getBalanceFromChain(id int, org int) (int, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return 0, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	result, err := contract.EvaluateTransaction("GetBalance", fmt.Sprintf("%d", id))
+	balance, err := s.ledger.GetBalance(orgName, id)
 	if err != nil {
 		return 0, fmt.Errorf("获取余额失败：%s", fabric.ExtractErrorMessage(err))
 	}
-
-	var balance int
-	if err := json.Unmarshal(result, &balance); err != nil {
-		return 0, fmt.Errorf("解析余额失败：%v", err)
-	}
 	return balance, nil
 }
 
 // wallet_service.go
 func (s *WalletService) Transfer(senderId int, recipientId int, amount int, org int) (string, error) {
+	txid := uuid.New().String()
+	return txid, s.TransferWithID(txid, senderId, recipientId, amount, org)
+}
+
+// 使用指定的转账 ID 转账，链码对同一 ID 只执行一次，可用于失败重试
+func (s *WalletService) TransferWithID(txid string, senderId int, recipientId int, amount int, org int) error {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
-		return "", fmt.Errorf("获取组织失败：%s", err)
+		return fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-
-	txid := uuid.New().String()
-	_, err = contract.SubmitTransaction(
-		"Transfer",
-		txid,
-		fmt.Sprintf("%d", senderId),
-		fmt.Sprintf("%d", recipientId),
-		fmt.Sprintf("%d", amount),
-		time.Now().Format(time.RFC3339),
-	)
+	err = s.ledger.Transfer(orgName, txid, senderId, recipientId, amount, time.Now())
 	if err != nil {
-		return "", fmt.Errorf("转账失败：%s", fabric.ExtractErrorMessage(err))
+		return fmt.Errorf("转账失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	return txid, nil
+	return nil
 }
 
 func (s *WalletService) MintToken(accountID int, amount int, org int) error {
@@ -75,8 +76,7 @@ func (s *WalletService) MintToken(accountID int, amount int, org int) error {
 	if err != nil {
 		return fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	_, err = contract.SubmitTransaction("MintToken", fmt.Sprintf("%d", accountID), fmt.Sprintf("%d", amount))
+	err = s.ledger.MintToken(orgName, accountID, amount)
 	if err != nil {
 		return fmt.Errorf("铸币失败：%s", fabric.ExtractErrorMessage(err))
 	}
@@ -84,162 +84,156 @@ func (s *WalletService) MintToken(accountID int, amount int, org int) error {
 }
 
 func (s *WalletService) GetTransferBySenderID(senderId int, org int) ([]model.Transfer, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetTransfersBySender(senderId)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getTransferBySenderIDFromChain(senderId, org)
+}
+
+// getTransferBySenderIDFromChain 直接查询链上
+func (s *WalletService) getTransferBySenderIDFromChain(senderId int, org int) ([]model.Transfer, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return nil, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	results, err := contract.EvaluateTransaction("GetTransferBySenderID", fmt.Sprintf("%d", senderId))
+	transfers, err := s.ledger.GetTransfersBySender(orgName, senderId)
 	if err != nil {
 		return nil, fmt.Errorf("获取转账记录失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	if len(results) == 0 {
-		return nil, nil
-	}
-	var transfers []model.Transfer
-	if err := json.Unmarshal(results, &transfers); err != nil {
-		return nil, fmt.Errorf("解析转账记录失败：%v", err)
-	}
 	return transfers, nil
 }
 
 func (s *WalletService) GetTransferByRecipientID(recipientId int, org int) ([]model.Transfer, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetTransfersByRecipient(recipientId)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getTransferByRecipientIDFromChain(recipientId, org)
+}
+
+// getTransferByRecipientIDFromChain 直接查询链上
+func (s *WalletService) getTransferByRecipientIDFromChain(recipientId int, org int) ([]model.Transfer, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return nil, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	results, err := contract.EvaluateTransaction("GetTransferByRecipientID", fmt.Sprintf("%d", recipientId))
+	transfers, err := s.ledger.GetTransfersByRecipient(orgName, recipientId)
 	if err != nil {
 		return nil, fmt.Errorf("获取转账记录失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	if len(results) == 0 {
-		return nil, nil
-	}
-	var transfers []model.Transfer
-	if err := json.Unmarshal(results, &transfers); err != nil {
-		return nil, fmt.Errorf("解析转账记录失败：%v", err)
-	}
 	return transfers, nil
 }
 
-// 之前：func (s *WalletService) WithHoldAccount(accountID int, listingID string, amount int, org int) error
+// 返回预扣款 ID 和交易的业务 ID，链码以预扣款 ID 作为交易的业务 ID，两者相同
 func (s *WalletService) WithHoldAccount(accountID int, listingID string, amount int, org int) (string, string, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return "", "", fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-
 	holdID := uuid.New().String()
-	txid := uuid.New().String()
-
-	_, err = contract.SubmitTransaction(
-		"WithHoldAccount",
-		holdID, // 建议把 holdID 传进链码并由链码作为主键存档
-		fmt.Sprintf("%d", accountID),
-		listingID,
-		fmt.Sprintf("%d", amount),
-		time.Now().Format(time.RFC3339),
-		txid, // 可一起带上 txid；或由链码生成返回
-	)
+	err = s.ledger.WithHoldAccount(orgName, holdID, accountID, listingID, amount, time.Now())
 	if err != nil {
 		return "", "", fmt.Errorf("预扣款失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	return holdID, txid, nil
+	return holdID, holdID, nil
+}
+
+// 使用指定的预扣款 ID 冻结资金，提交结果不明时可以按 ID 查询链上是否已经冻结
+func (s *WalletService) WithHoldAccountWithID(holdID string, accountID int, listingID string, amount int, org int) error {
+	orgName, err := model.GetOrg(org)
+	if err != nil {
+		return fmt.Errorf("获取组织失败：%s", err)
+	}
+	err = s.ledger.WithHoldAccount(orgName, holdID, accountID, listingID, amount, time.Now())
+	if err != nil {
+		return fmt.Errorf("预扣款失败：%s", fabric.ExtractErrorMessage(err))
+	}
+	return nil
 }
 
 func (s *WalletService) GetWithHoldingByAccountID(accountID int, org int) ([]model.WithHolding, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetWithHoldingsByAccount(accountID)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getWithHoldingByAccountIDFromChain(accountID, org)
+}
+
+// getWithHoldingByAccountIDFromChain 直接查询链上
+func (s *WalletService) getWithHoldingByAccountIDFromChain(accountID int, org int) ([]model.WithHolding, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return nil, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	results, err := contract.EvaluateTransaction("GetWithHoldingByAccountID", fmt.Sprintf("%d", accountID))
+	withHoldings, err := s.ledger.GetWithHoldingsByAccount(orgName, accountID)
 	if err != nil {
 		return nil, fmt.Errorf("获取预扣款记录失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	if len(results) == 0 {
-		return nil, nil
-	}
-	var withHoldings []model.WithHolding
-	if err := json.Unmarshal(results, &withHoldings); err != nil {
-		return nil, fmt.Errorf("解析预扣款记录失败：%v", err)
-	}
 	return withHoldings, nil
 }
 
 func (s *WalletService) GetWithHoldingByListingID(listingID string, org int) ([]model.WithHolding, error) {
+	if rm := readModel(); rm != nil {
+		result, err := rm.GetWithHoldingsByListing(listingID)
+		if err == nil || !fallbackToChain() {
+			return result, err
+		}
+	}
+	return s.getWithHoldingByListingIDFromChain(listingID, org)
+}
+
+// getWithHoldingByListingIDFromChain 直接查询链上
+func (s *WalletService) getWithHoldingByListingIDFromChain(listingID string, org int) ([]model.WithHolding, error) {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return nil, fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	results, err := contract.EvaluateTransaction("GetWithHoldingByListingID", listingID)
+	withHoldings, err := s.ledger.GetWithHoldingsByListing(orgName, listingID)
 	if err != nil {
 		return nil, fmt.Errorf("获取预扣款记录失败：%s", fabric.ExtractErrorMessage(err))
 	}
-	if len(results) == 0 {
-		return nil, nil
-	}
-	var withHoldings []model.WithHolding
-	if err := json.Unmarshal(results, &withHoldings); err != nil {
-		return nil, fmt.Errorf("解析预扣款记录失败：%v", err)
-	}
 	return withHoldings, nil
 }
 
-func (s *WalletService) ClearWithHolding(listingID string, org int) error {
+func (s *WalletService) ReleaseHolding(listingID string, bidderID int, sellerID int, amount int, org int) (string, error) {
+	txid := uuid.New().String()
+	return txid, s.ReleaseHoldingWithID(txid, listingID, bidderID, sellerID, amount, org)
+}
+
+// 使用指定的 txid 把出价人的冻结资金释放给卖家，链码对同一 txid 只执行一次
+func (s *WalletService) ReleaseHoldingWithID(txid string, listingID string, bidderID int, sellerID int, amount int, org int) error {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
 		return fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	_, err = contract.SubmitTransaction("ClearWithHolding", listingID)
+	err = s.ledger.ReleaseHolding(orgName, txid, listingID, bidderID, sellerID, amount, time.Now())
 	if err != nil {
-		return fmt.Errorf("清除预扣款失败：%s", fabric.ExtractErrorMessage(err))
+		return fmt.Errorf("释放失败：%s", fabric.ExtractErrorMessage(err))
 	}
 	return nil
 }
 
-func (s *WalletService) ReleaseHolding(listingID string, sellerID int, amount int, org int) (string, error) {
-	orgName, err := model.GetOrg(org)
-	if err != nil {
-		return "", fmt.Errorf("获取组织失败：%s", err)
-	}
-	contract := fabric.GetContract(orgName)
+func (s *WalletService) RefundHolding(listingID string, bidderID int, amount int, org int) (string, error) {
 	txid := uuid.New().String()
-	_, err = contract.SubmitTransaction(
-		"ReleaseHolding", // 需要你链码提供该方法
-		listingID,
-		fmt.Sprintf("%d", sellerID),
-		fmt.Sprintf("%d", amount),
-		time.Now().Format(time.RFC3339),
-		txid,
-	)
-	if err != nil {
-		return "", fmt.Errorf("释放失败：%s", fabric.ExtractErrorMessage(err))
-	}
-	return txid, nil
+	return txid, s.RefundHoldingWithID(txid, listingID, bidderID, amount, org)
 }
 
-func (s *WalletService) RefundHolding(listingID string, bidderID int, amount int, org int) (string, error) {
+// 使用指定的 txid 退还冻结资金，链码对同一 txid 只执行一次
+func (s *WalletService) RefundHoldingWithID(txid string, listingID string, bidderID int, amount int, org int) error {
 	orgName, err := model.GetOrg(org)
 	if err != nil {
-		return "", fmt.Errorf("获取组织失败：%s", err)
+		return fmt.Errorf("获取组织失败：%s", err)
 	}
-	contract := fabric.GetContract(orgName)
-	txid := uuid.New().String()
-	_, err = contract.SubmitTransaction(
-		"RefundHolding",
-		listingID,
-		fmt.Sprintf("%d", bidderID),
-		fmt.Sprintf("%d", amount),
-		time.Now().Format(time.RFC3339),
-		txid,
-	)
-	if err != nil {
-		return "", fmt.Errorf("退款失败：%s", fabric.ExtractErrorMessage(err))
-	}
-	return txid, nil
+	err = s.ledger.RefundHolding(orgName, txid, listingID, bidderID, amount, time.Now())
+	if err != nil {
+		return fmt.Errorf("退款失败：%s", fabric.ExtractErrorMessage(err))
+	}
+	return nil
 }
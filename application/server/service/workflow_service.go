@@ -0,0 +1,544 @@
+package service
+
+import (
+	"application/model"
+	"application/pkg/fabric"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 结算流程的执行参数
+const (
+	workflowOrg          = 2                // 市场结算统一使用创作者组织
+	workflowLease        = 2 * time.Minute  // 执行租约，每一步之前续约，进程崩溃后租约过期，由后台任务接手
+	workflowMaxAttempts  = 10               // 连续失败超过该次数后标记为 FAILED，等待管理员处理
+	workflowRetryBackoff = 5 * time.Second  // 首次重试间隔，之后每次翻倍
+	workflowMaxBackoff   = 5 * time.Minute  // 最大重试间隔
+	workflowStuckAfter   = 10 * time.Minute // 超过该时间仍未结束的流程视为卡住
+)
+
+// 流程步骤
+// transferToken、transferAsset 可以补偿；releaseHolding 之后资金已经到卖家，只能向前重试
+const (
+	stepTransferToken = "transferToken"  // 买家直接转账给卖家（补偿：反向转账）
+	stepTransferAsset = "transferAsset"  // NFT 过户（补偿：过户回原持有人）
+	stepReleaseHold   = "releaseHolding" // 释放中标出价的冻结资金给卖家
+	stepRefundHold    = "refundHolding"  // 退还落选出价的冻结资金
+	stepFinalize      = "finalize"       // 更新数据库中的出价和挂牌状态
+)
+
+// 结算已经开始但没有在本次请求内完成，后台任务会继续重试
+var ErrWorkflowPending = errors.New("结算尚未完成，已转入后台自动重试")
+
+type WorkflowService struct {
+	db     *gorm.DB
+	ledger fabric.LedgerClient
+}
+
+func NewWorkflowService(ledger fabric.LedgerClient) *WorkflowService {
+	return &WorkflowService{db: model.GetDB(), ledger: ledger}
+}
+
+// 步骤是否可以补偿
+func isCompensable(name string) bool {
+	return name == stepTransferToken || name == stepTransferAsset
+}
+
+// 新建步骤，预先生成链上幂等 ID
+func newStep(name string) model.WorkflowStep {
+	return model.WorkflowStep{Name: name, TxID: uuid.New().String(), Status: model.StepPending}
+}
+
+// 挂牌上是否有未结束的结算流程，需要在锁住挂牌行的事务内调用
+func listingHasActiveWorkflowTx(tx *gorm.DB, listingID int) (bool, error) {
+	var cnt int64
+	if err := tx.Model(&model.Workflow{}).
+		Where("listing_id = ? AND status IN ?", listingID, model.WorkflowActiveStatuses).
+		Count(&cnt).Error; err != nil {
+		return false, fmt.Errorf("查询结算流程失败：%v", err)
+	}
+	return cnt > 0, nil
+}
+
+// 在业务事务内创建流程及全部步骤，并由当前调用方持有执行租约
+// 事务提交后调用方应立即用 wf.LeaseOwner 调用 runOwned 执行
+func (s *WorkflowService) createTx(tx *gorm.DB, wf *model.Workflow) error {
+	now := time.Now()
+	lease := now.Add(workflowLease)
+	wf.Status = model.WorkflowRunning
+	wf.NextRunAt = now
+	wf.LeaseUntil = &lease
+	wf.LeaseOwner = uuid.New().String()
+	for i := range wf.Steps {
+		wf.Steps[i].Seq = i + 1
+	}
+	if err := tx.Create(wf).Error; err != nil {
+		return fmt.Errorf("保存结算流程失败：%v", err)
+	}
+	return nil
+}
+
+// 执行当前调用方已持有租约的流程，返回业务结果
+func (s *WorkflowService) runOwned(id int, owner string) error {
+	wf, err := s.execute(id, owner)
+	if err != nil {
+		return err
+	}
+	return workflowOutcome(wf)
+}
+
+// 抢占流程的执行租约，返回租约持有人标识，租约被他人持有时返回空字符串
+func (s *WorkflowService) claim(id int) (string, error) {
+	now := time.Now()
+	owner := uuid.New().String()
+	res := s.db.Model(&model.Workflow{}).
+		Where("id = ? AND (lease_until IS NULL OR lease_until < ?)", id, now).
+		Updates(map[string]any{"lease_until": now.Add(workflowLease), "lease_owner": owner})
+	if res.Error != nil {
+		return "", fmt.Errorf("获取流程执行权失败：%v", res.Error)
+	}
+	if res.RowsAffected != 1 {
+		return "", nil
+	}
+	return owner, nil
+}
+
+// 续约，租约已过期并被他人抢占时返回 false
+func (s *WorkflowService) renew(id int, owner string) (bool, error) {
+	res := s.db.Model(&model.Workflow{}).
+		Where("id = ? AND lease_owner = ?", id, owner).
+		Update("lease_until", time.Now().Add(workflowLease))
+	if res.Error != nil {
+		return false, fmt.Errorf("续约流程执行权失败：%v", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// 释放租约，只释放自己持有的，租约已被他人抢占时不影响对方
+func (s *WorkflowService) release(id int, owner string) {
+	err := s.db.Model(&model.Workflow{}).
+		Where("id = ? AND lease_owner = ?", id, owner).
+		Updates(map[string]any{"lease_until": nil, "lease_owner": ""}).Error
+	if err != nil {
+		log.Printf("释放流程 %d 的执行权失败：%v", id, err)
+	}
+}
+
+// 抢占租约后执行流程，租约被他人持有时返回 ErrWorkflowPending
+func (s *WorkflowService) Run(id int) error {
+	owner, err := s.claim(id)
+	if err != nil {
+		return err
+	}
+	if owner == "" {
+		return ErrWorkflowPending
+	}
+	return s.runOwned(id, owner)
+}
+
+// 把流程结果转换为返回给调用方的错误
+func workflowOutcome(wf *model.Workflow) error {
+	switch wf.Status {
+	case model.WorkflowCompleted:
+		return nil
+	case model.WorkflowCompensated:
+		return fmt.Errorf("结算失败，已回滚：%s", wf.LastError)
+	default:
+		return fmt.Errorf("%w：%s", ErrWorkflowPending, wf.LastError)
+	}
+}
+
+// 推进流程直到完成、补偿完成或需要等待重试，结束后释放租约
+// 每一步之前续约，租约已被他人抢占时停止，由对方继续推进
+// 只有数据库错误才会作为 error 返回，步骤失败记录在流程上
+func (s *WorkflowService) execute(id int, owner string) (*model.Workflow, error) {
+	var wf model.Workflow
+	if err := s.db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("seq")
+	}).First(&wf, id).Error; err != nil {
+		return nil, fmt.Errorf("查询结算流程失败：%v", err)
+	}
+	defer s.release(id, owner)
+
+	for wf.Status == model.WorkflowRunning && !wf.NextRunAt.After(time.Now()) {
+		held, err := s.renew(id, owner)
+		if err != nil {
+			return nil, err
+		}
+		if !held {
+			log.Printf("流程 %d 的执行权已被其他执行者接手，停止执行", id)
+			break
+		}
+		if wf.Compensating {
+			err = s.compensateNext(&wf)
+		} else {
+			err = s.forwardNext(&wf)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &wf, nil
+}
+
+// 执行下一个未完成的步骤
+func (s *WorkflowService) forwardNext(wf *model.Workflow) error {
+	var step *model.WorkflowStep
+	for i := range wf.Steps {
+		if wf.Steps[i].Status == model.StepPending {
+			step = &wf.Steps[i]
+			break
+		}
+	}
+	if step == nil {
+		wf.Status = model.WorkflowCompleted
+		wf.LastError = ""
+		return s.saveWorkflow(wf)
+	}
+
+	runErr := s.runStep(wf, step)
+	if runErr == nil {
+		step.Status = model.StepDone
+		step.LastError = ""
+		return s.saveStep(step)
+	}
+	step.Attempts++
+	step.LastError = runErr.Error()
+	if err := s.saveStep(step); err != nil {
+		return err
+	}
+	if isCompensable(step.Name) {
+		// 可补偿阶段出错：回滚已完成的步骤，让调用方拿到明确的失败结果
+		wf.Compensating = true
+		wf.LastError = runErr.Error()
+		return s.saveWorkflow(wf)
+	}
+	// 已越过不可回滚点，只能向前重试
+	return s.scheduleRetry(wf, runErr)
+}
+
+// 按倒序补偿下一个可补偿的步骤，全部补偿完成后流程结束
+func (s *WorkflowService) compensateNext(wf *model.Workflow) error {
+	var step *model.WorkflowStep
+	for i := len(wf.Steps) - 1; i >= 0; i-- {
+		st := &wf.Steps[i]
+		// 执行过但结果未知的步骤也要补偿，补偿逻辑会先检查链上实际状态
+		if isCompensable(st.Name) && st.Status != model.StepCompensated &&
+			(st.Status == model.StepDone || st.Attempts > 0) {
+			step = st
+			break
+		}
+	}
+	if step == nil {
+		wf.Status = model.WorkflowCompensated
+		return s.saveWorkflow(wf)
+	}
+
+	if err := s.compensateStep(step); err != nil {
+		step.LastError = err.Error()
+		if e := s.saveStep(step); e != nil {
+			return e
+		}
+		return s.scheduleRetry(wf, fmt.Errorf("补偿失败：%v", err))
+	}
+	step.Status = model.StepCompensated
+	return s.saveStep(step)
+}
+
+// 记录失败并安排重试，超过最大次数后标记为 FAILED
+func (s *WorkflowService) scheduleRetry(wf *model.Workflow, cause error) error {
+	wf.Attempts++
+	delay := workflowRetryBackoff
+	for i := 1; i < wf.Attempts && delay < workflowMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > workflowMaxBackoff {
+		delay = workflowMaxBackoff
+	}
+	wf.LastError = cause.Error()
+	wf.NextRunAt = time.Now().Add(delay)
+	if wf.Attempts >= workflowMaxAttempts {
+		wf.Status = model.WorkflowFailed
+	}
+	return s.saveWorkflow(wf)
+}
+
+// 保存流程自身的字段（不含步骤），租约只由 claim、renew、release 修改
+func (s *WorkflowService) saveWorkflow(wf *model.Workflow) error {
+	if err := s.db.Omit(clause.Associations, "lease_until", "lease_owner").Save(wf).Error; err != nil {
+		return fmt.Errorf("更新结算流程失败：%v", err)
+	}
+	return nil
+}
+
+func (s *WorkflowService) saveStep(step *model.WorkflowStep) error {
+	if err := s.db.Save(step).Error; err != nil {
+		return fmt.Errorf("更新流程步骤失败：%v", err)
+	}
+	return nil
+}
+
+// 执行单个步骤，所有链上调用都是幂等的，崩溃后重复执行不会重复记账
+func (s *WorkflowService) runStep(wf *model.Workflow, step *model.WorkflowStep) error {
+	w := NewWalletService(s.ledger)
+	listingKey := fmt.Sprintf("%d", wf.ListingID)
+	switch step.Name {
+	case stepTransferToken:
+		return w.TransferWithID(step.TxID, step.FromID, step.ToID, int(step.Amount), workflowOrg)
+	case stepTransferAsset:
+		as := NewAssetService(s.db, s.ledger)
+		asset, err := as.getAssetByIDFromChain(step.AssetID, workflowOrg)
+		if err != nil {
+			return err
+		}
+		if asset.OwnerId == step.ToID {
+			// 上次执行已经上链，只是结果没来得及记录
+			return nil
+		}
+		return as.TransferAsset(step.AssetID, step.ToID, step.FromID, workflowOrg)
+	case stepReleaseHold:
+		bidderID := step.FromID
+		if bidderID == 0 {
+			// 旧版本规划的步骤没有记录出价人，从中标出价读取
+			var offer model.MarketOffer
+			if err := s.db.First(&offer, step.OfferID).Error; err != nil {
+				return err
+			}
+			bidderID = offer.BidderID
+		}
+		return w.ReleaseHoldingWithID(step.TxID, listingKey, bidderID, step.ToID, int(step.Amount), workflowOrg)
+	case stepRefundHold:
+		return w.RefundHoldingWithID(step.TxID, listingKey, step.ToID, int(step.Amount), workflowOrg)
+	case stepFinalize:
+		if wf.Type == model.WorkflowAcceptOffer {
+			return s.finalizeAcceptOffer(wf, step)
+		}
+		return s.finalizeBuyNow(wf, step)
+	}
+	return fmt.Errorf("未知的流程步骤：%s", step.Name)
+}
+
+// 补偿单个步骤，先检查链上实际状态，未生效的步骤直接视为已补偿
+func (s *WorkflowService) compensateStep(step *model.WorkflowStep) error {
+	w := NewWalletService(s.ledger)
+	switch step.Name {
+	case stepTransferToken:
+		transfers, err := w.getTransferBySenderIDFromChain(step.FromID, workflowOrg)
+		if err != nil {
+			return err
+		}
+		for _, t := range transfers {
+			if t.ID == step.TxID {
+				// 反向转账同样使用固定 ID，补偿重试时不会重复退款
+				return w.TransferWithID(step.TxID+"-c", step.ToID, step.FromID, int(step.Amount), workflowOrg)
+			}
+		}
+		return nil
+	case stepTransferAsset:
+		as := NewAssetService(s.db, s.ledger)
+		asset, err := as.getAssetByIDFromChain(step.AssetID, workflowOrg)
+		if err != nil {
+			return err
+		}
+		switch asset.OwnerId {
+		case step.FromID:
+			return nil
+		case step.ToID:
+			return as.TransferAsset(step.AssetID, step.FromID, step.ToID, workflowOrg)
+		default:
+			return fmt.Errorf("NFT %s 当前持有人为 %d，无法自动回滚", step.AssetID, asset.OwnerId)
+		}
+	}
+	return fmt.Errorf("步骤 %s 不支持补偿", step.Name)
+}
+
+// 接受出价的收尾：中标出价 ACCEPTED、其他出价 REJECTED、挂牌 SOLD
+func (s *WorkflowService) finalizeAcceptOffer(wf *model.Workflow, step *model.WorkflowStep) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var listing model.MarketListing
+		if err := model.ForUpdate(tx).
+			First(&listing, wf.ListingID).Error; err != nil {
+			return err
+		}
+		if listing.Status == model.ListingSold {
+			// 已经收尾过
+			return nil
+		}
+		now := time.Now()
+		for _, st := range wf.Steps {
+			switch st.Name {
+			case stepReleaseHold:
+				if err := tx.Model(&model.MarketOffer{}).
+					Where("id = ? AND status = ?", st.OfferID, model.OfferPending).
+					Updates(map[string]any{
+						"status":       model.OfferAccepted,
+						"payout_tx_id": st.TxID,
+						"update_time":  now,
+					}).Error; err != nil {
+					return err
+				}
+			case stepRefundHold:
+				if err := tx.Model(&model.MarketOffer{}).
+					Where("id = ? AND status = ?", st.OfferID, model.OfferPending).
+					Updates(map[string]any{
+						"status":       model.OfferRejected,
+						"is_escrowed":  false,
+						"refund_tx_id": st.TxID,
+						"update_time":  now,
+					}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		winnerID := step.OfferID
+		return tx.Model(&model.MarketListing{}).
+			Where("id = ?", listing.ID).
+			Updates(map[string]any{
+				"status":          model.ListingSold,
+				"winner_offer_id": &winnerID,
+				"update_time":     now,
+			}).Error
+	})
+}
+
+// 一口价的收尾：写成交记录并把挂牌标记为 SOLD
+func (s *WorkflowService) finalizeBuyNow(wf *model.Workflow, step *model.WorkflowStep) error {
+	var payoutTx string
+	for _, st := range wf.Steps {
+		if st.Name == stepTransferToken {
+			payoutTx = st.TxID
+		}
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var listing model.MarketListing
+		if err := model.ForUpdate(tx).
+			First(&listing, wf.ListingID).Error; err != nil {
+			return err
+		}
+		if listing.Status == model.ListingSold {
+			return nil
+		}
+		now := time.Now()
+		off := &model.MarketOffer{
+			ListingID:  listing.ID,
+			BidderID:   step.ToID,
+			BidderOrg:  workflowOrg,
+			OfferPrice: step.Amount,
+			Status:     model.OfferAccepted,
+			PayoutTxID: &payoutTx,
+			CreateTime: now,
+			UpdateTime: now,
+		}
+		if err := tx.Create(off).Error; err != nil {
+			return fmt.Errorf("保存成交记录失败：%v", err)
+		}
+		winnerID := off.ID
+		return tx.Model(&model.MarketListing{}).
+			Where("id = ?", listing.ID).
+			Updates(map[string]any{
+				"status":          model.ListingSold,
+				"winner_offer_id": &winnerID,
+				"update_time":     now,
+			}).Error
+	})
+}
+
+// 定时任务：继续执行到期的未完成流程（包括进程崩溃后租约过期的流程）
+func (s *WorkflowService) ResumePending() error {
+	now := time.Now()
+	var ids []int
+	if err := s.db.Model(&model.Workflow{}).
+		Where("status = ? AND next_run_at <= ? AND (lease_until IS NULL OR lease_until < ?)",
+			model.WorkflowRunning, now, now).
+		Order("id").Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("查询待执行流程失败：%v", err)
+	}
+	var errs []error
+	for _, id := range ids {
+		owner, err := s.claim(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if owner == "" {
+			continue
+		}
+		// 步骤失败已记录在流程上，这里只汇总数据库错误
+		if _, err := s.execute(id, owner); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 查询流程，stuck 为 true 时只返回失败或长时间未结束的流程
+func (s *WorkflowService) ListWorkflows(status string, stuck bool, page, pageSize int) ([]model.Workflow, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 10
+	}
+	var (
+		items []model.Workflow
+		total int64
+	)
+	q := s.db.Model(&model.Workflow{})
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if stuck {
+		q = q.Where("status = ? OR (status = ? AND (attempts > 0 OR create_time < ?))",
+			model.WorkflowFailed, model.WorkflowRunning, time.Now().Add(-workflowStuckAfter))
+	}
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// 查询流程及其全部步骤
+func (s *WorkflowService) GetWorkflow(id int) (*model.Workflow, error) {
+	var wf model.Workflow
+	if err := s.db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("seq")
+	}).First(&wf, id).Error; err != nil {
+		return nil, fmt.Errorf("查询结算流程失败：%v", err)
+	}
+	return &wf, nil
+}
+
+// 管理员手动重试：清零失败次数后立即执行一次
+func (s *WorkflowService) Retry(id int) (*model.Workflow, error) {
+	res := s.db.Model(&model.Workflow{}).
+		Where("id = ? AND status IN ?", id, model.WorkflowActiveStatuses).
+		Updates(map[string]any{
+			"status":      model.WorkflowRunning,
+			"attempts":    0,
+			"next_run_at": time.Now(),
+		})
+	if res.Error != nil {
+		return nil, fmt.Errorf("更新结算流程失败：%v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, errors.New("流程不存在或已结束")
+	}
+	runErr := s.Run(id)
+	wf, err := s.GetWorkflow(id)
+	if err != nil {
+		return nil, err
+	}
+	if errors.Is(runErr, ErrWorkflowPending) && wf.Status == model.WorkflowRunning {
+		return wf, runErr
+	}
+	return wf, nil
+}
@@ -47,6 +47,14 @@ func BadRequest(c *gin.Context, message string) {
 	Fail(c, http.StatusBadRequest, message)
 }
 
+// Forbidden 403错误响应
+func Forbidden(c *gin.Context, message string) {
+	if message == "" {
+		message = "没有权限"
+	}
+	Fail(c, http.StatusForbidden, message)
+}
+
 // ServerError 500错误响应
 func ServerError(c *gin.Context, message string) {
 	if message == "" {
@@ -1,4 +1,5 @@
 import axios from 'axios';
+import { attachTokenRefresh, isAuthRequest } from '../utils/session';
 
 // 本地开发可以选择 localhost:8888/api
 // 如果需要多机调试，将 localhost 改为你的 ip 地址
@@ -22,12 +23,8 @@ const instance = axios.create({
 // 请求拦截器添加认证信息
 instance.interceptors.request.use(
   (config) => {
-    // 检查是否为不需要认证的接口
-    const isAuthRequest = config.url?.includes('/account/login') || 
-                         config.url?.includes('/account/register');
-    
     // 如果不是认证相关接口，则添加token
-    if (!isAuthRequest) {
+    if (!isAuthRequest(config.url)) {
       const token = localStorage.getItem('userToken');
       if (token) {
         config.headers.Authorization = `Bearer ${token}`;
@@ -40,6 +37,9 @@ instance.interceptors.request.use(
   }
 );
 
+// 访问令牌过期时刷新后重试
+attachTokenRefresh(instance, '/account/refresh');
+
 // 响应拦截器处理错误
 instance.interceptors.response.use(
   (response) => {
@@ -64,6 +64,15 @@ const accountApi = {
     });
   },
 
+  /**
+   * 登录第二步，提交两步验证码或恢复码
+   * @param challengeToken 密码登录返回的挑战令牌
+   * @param code 身份验证器中的验证码或恢复码
+   */
+  loginTwoFactor: (challengeToken: string, code: string) => {
+    return instance.post('/account/login/2fa', { challengeToken, code });
+  },
+
   /**
    * 用户注册
    * @param username 用户名
@@ -80,6 +89,38 @@ const accountApi = {
     });
   },
 
+  /**
+   * 验证邮箱
+   * @param token 验证邮件链接中的令牌
+   */
+  verifyEmail: (token: string) => {
+    return instance.post('/account/email/verify', { token });
+  },
+
+  /**
+   * 重新发送验证邮件
+   */
+  sendVerificationEmail: () => {
+    return instance.post('/account/email/sendVerification');
+  },
+
+  /**
+   * 忘记密码，发送重置链接到邮箱
+   * @param email 注册时填写的邮箱
+   */
+  forgotPassword: (email: string) => {
+    return instance.post('/account/password/forgot', { email });
+  },
+
+  /**
+   * 用重置链接设置新密码
+   * @param token 重置邮件链接中的令牌
+   * @param password 新密码
+   */
+  resetPassword: (token: string, password: string) => {
+    return instance.post('/account/password/reset', { token, password });
+  },
+
   /**
    * 用户登出
    */
@@ -148,6 +189,56 @@ const accountApi = {
 
 };
 
+// 两步验证相关API
+const twoFactorApi = {
+  /**
+   * 两步验证状态
+   */
+  getStatus: () => {
+    return instance.get('/account/2fa');
+  },
+
+  /**
+   * 生成密钥，返回 secret 和 otpauth:// 地址
+   */
+  setup: () => {
+    return instance.post('/account/2fa/setup');
+  },
+
+  /**
+   * 用验证码确认并开启，返回恢复码
+   * @param code 身份验证器中的验证码
+   */
+  enable: (code: string) => {
+    return instance.post('/account/2fa/enable', { code });
+  },
+
+  /**
+   * 关闭两步验证
+   * @param password 登录密码
+   * @param code 验证码或恢复码
+   */
+  disable: (password: string, code: string) => {
+    return instance.post('/account/2fa/disable', { password, code });
+  },
+
+  /**
+   * 重新生成恢复码
+   * @param code 验证码或恢复码
+   */
+  regenerateRecoveryCodes: (code: string) => {
+    return instance.post('/account/2fa/recoveryCodes', { code });
+  },
+
+  /**
+   * 二次验证，铸币、修改组织和大额转账前调用
+   * @param code 验证码或恢复码
+   */
+  stepUp: (code: string) => {
+    return instance.post('/account/2fa/stepUp', { code });
+  }
+};
+
 // 资产相关API
 const assetApi = {
   /**
@@ -389,7 +480,7 @@ const auctionApi = {
 };
 
 // 导出所有API模块
-export { accountApi, assetApi, walletApi, chatApi, auctionApi, marketApi };
+export { accountApi, twoFactorApi, assetApi, walletApi, chatApi, auctionApi, marketApi };
 
 // 默认导出包含所有API的对象
 export default {
@@ -42,6 +42,7 @@ declare module 'vue' {
     ASelectOption: typeof import('ant-design-vue/es')['SelectOption']
     ASkeleton: typeof import('ant-design-vue/es')['Skeleton']
     ASkeletonImage: typeof import('ant-design-vue/es')['SkeletonImage']
+    ASpace: typeof import('ant-design-vue/es')['Space']
     ASpin: typeof import('ant-design-vue/es')['Spin']
     AssetCard: typeof import('./components/AssetCard.vue')['default']
     AssetNav: typeof import('./components/AssetNav.vue')['default']
@@ -52,6 +53,7 @@ declare module 'vue' {
     ATag: typeof import('ant-design-vue/es')['Tag']
     ATextarea: typeof import('ant-design-vue/es')['Textarea']
     ATooltip: typeof import('ant-design-vue/es')['Tooltip']
+    ATypographyParagraph: typeof import('ant-design-vue/es')['TypographyParagraph']
     ATypographyTitle: typeof import('ant-design-vue/es')['TypographyTitle']
     AUpload: typeof import('ant-design-vue/es')['Upload']
     AvatarUploader: typeof import('./components/AvatarUploader.vue')['default']
@@ -62,6 +64,7 @@ declare module 'vue' {
     ProfileEditor: typeof import('./components/ProfileEditor.vue')['default']
     RouterLink: typeof import('vue-router')['RouterLink']
     RouterView: typeof import('vue-router')['RouterView']
+    TwoFactorSettings: typeof import('./components/TwoFactorSettings.vue')['default']
     WalletNav: typeof import('./components/WalletNav.vue')['default']
   }
 }
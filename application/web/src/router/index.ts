@@ -11,6 +11,14 @@ const router = createRouter({
       path: '/register',
       component: () => import('../views/Register.vue'),
     },
+    {
+      path: '/verify-email',
+      component: () => import('../views/VerifyEmail.vue'),
+    },
+    {
+      path: '/reset-password',
+      component: () => import('../views/ResetPassword.vue'),
+    },
     {
       path: '/dashboard',
       component: () => import('../views/DashBoard.vue'),
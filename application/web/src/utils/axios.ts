@@ -1,5 +1,6 @@
 import axios from 'axios'
 import { backendURL } from '../api/index'
+import { attachTokenRefresh, isAuthRequest } from './session'
 
 // 创建axios实例
 const instance = axios.create({
@@ -10,11 +11,8 @@ const instance = axios.create({
 // 请求拦截器 - 自动添加token
 instance.interceptors.request.use(
   (config) => {
-    // 检查是否是登录或注册请求，这些请求不需要token
-    const isAuthRequest = config.url?.includes('/api/account/login') || 
-                         config.url?.includes('/api/account/register')
-    
-    if (!isAuthRequest) {
+    // 登录、注册和刷新请求不需要token
+    if (!isAuthRequest(config.url)) {
       // 从localStorage获取token
       const token = localStorage.getItem('userToken')
       
@@ -31,25 +29,7 @@ instance.interceptors.request.use(
   }
 )
 
-// 响应拦截器 - 处理401错误
-instance.interceptors.response.use(
-  (response) => {
-    return response
-  },
-  (error) => {
-    // 如果返回401未授权错误，清除token并跳转到登录页
-    if (error.response?.status === 401) {
-      localStorage.removeItem('userToken')
-      localStorage.removeItem('userInfo')
-      // 清除axios默认请求头
-      delete instance.defaults.headers.common['Authorization']
-      
-      // 跳转到登录页
-      window.location.href = '/login'
-    }
-    
-    return Promise.reject(error)
-  }
-)
+// 响应拦截器 - 处理401错误：刷新访问令牌后重试，刷新失败时清除登录状态并跳转到登录页
+attachTokenRefresh(instance, '/api/account/refresh')
 
 export default instance
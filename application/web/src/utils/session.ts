@@ -0,0 +1,68 @@
+import type { AxiosInstance } from 'axios';
+
+// 访问令牌有效期很短（默认 15 分钟），过期后用刷新令牌换发，刷新令牌每次换发都会轮换
+const accessTokenKey = 'userToken';
+const refreshTokenKey = 'refreshToken';
+
+// 保存登录或刷新返回的令牌
+export const saveTokens = (data: { token: string; refreshToken?: string }) => {
+  localStorage.setItem(accessTokenKey, data.token);
+  if (data.refreshToken) {
+    localStorage.setItem(refreshTokenKey, data.refreshToken);
+  }
+};
+
+// 清除本地的登录状态
+export const clearSession = () => {
+  localStorage.removeItem(accessTokenKey);
+  localStorage.removeItem(refreshTokenKey);
+  localStorage.removeItem('userInfo');
+};
+
+// 登录、注册和刷新接口不需要访问令牌，返回 401 时也不再刷新
+export const isAuthRequest = (url?: string) =>
+  !!url && ['/account/login', '/account/register', '/account/refresh'].some((path) => url.includes(path));
+
+// 正在进行的刷新，同时过期的多个请求共用一次刷新，避免轮换后的旧刷新令牌被当作重用
+let refreshing: Promise<string> | null = null;
+
+const refreshAccessToken = (client: AxiosInstance, refreshPath: string) => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem(refreshTokenKey);
+    const request = refreshToken
+      ? client.post(refreshPath, { refreshToken }).then((response) => {
+          const data = response.data.data;
+          saveTokens(data);
+          return data.token as string;
+        })
+      : Promise.reject(new Error('没有刷新令牌'));
+    refreshing = request.finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+};
+
+// 返回 401 时先用刷新令牌换发访问令牌再重试一次，刷新失败时清除登录状态并跳转到登录页
+// 需要在实例的其他响应拦截器之前注册，才能拿到原始的错误对象
+export const attachTokenRefresh = (client: AxiosInstance, refreshPath: string) => {
+  client.interceptors.response.use(
+    (response) => response,
+    async (error) => {
+      const config = error.config;
+      if (error.response?.status !== 401 || !config || config._retried || isAuthRequest(config.url)) {
+        return Promise.reject(error);
+      }
+      config._retried = true;
+      try {
+        const token = await refreshAccessToken(client, refreshPath);
+        config.headers.Authorization = `Bearer ${token}`;
+        return client(config);
+      } catch {
+        clearSession();
+        window.location.href = '/login';
+        return Promise.reject(error);
+      }
+    }
+  );
+};
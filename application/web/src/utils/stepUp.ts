@@ -0,0 +1,50 @@
+import { h, ref } from 'vue';
+import { Input, Modal, message } from 'ant-design-vue';
+import { twoFactorApi } from '../api';
+
+// 弹窗输入验证码完成二次验证，用户取消时返回 false
+const promptStepUp = () => {
+  const code = ref('');
+  return new Promise<boolean>((resolve) => {
+    Modal.confirm({
+      title: '两步验证',
+      content: () => h('div', [
+        h('p', '该操作需要验证身份，请输入身份验证器中的 6 位验证码，也可以输入恢复码'),
+        h(Input, {
+          value: code.value,
+          placeholder: '验证码',
+          'onUpdate:value': (value: string) => { code.value = value; }
+        })
+      ]),
+      okText: '验证',
+      cancelText: '取消',
+      onOk: async () => {
+        try {
+          await twoFactorApi.stepUp(code.value.trim());
+          resolve(true);
+        } catch (error: any) {
+          message.error(error?.message || '验证失败');
+          // 保持弹窗打开，重新输入
+          return Promise.reject(error);
+        }
+      },
+      onCancel: () => resolve(false)
+    });
+  });
+};
+
+// 执行需要二次验证的操作（铸币、修改组织、大额转账）
+// 后端返回 428 时提示输入验证码，验证通过后重试一次
+export const withStepUp = async <T>(action: () => Promise<T>): Promise<T> => {
+  try {
+    return await action();
+  } catch (error: any) {
+    if (error?.code !== 428) {
+      throw error;
+    }
+    if (!(await promptStepUp())) {
+      throw { code: 428, message: '已取消两步验证' };
+    }
+    return action();
+  }
+};
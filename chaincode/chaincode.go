@@ -1,9 +1,17 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
@@ -27,8 +35,19 @@ const (
 	ASSET_KEY1        = "asset1"
 	ASSET_KEY2        = "asset2"
 	ASSET_KEY3        = "asset3"
+	SIGNER_KEY        = "signer"
+	VOUCHER_KEY       = "voucher"
+	VOUCHER_CANCEL    = "voucherCancel"
+	SERIES_KEY        = "series"
+	SERIES_AUTHOR_KEY = "seriesAuthor"
+	SETTLEMENT_KEY    = "settlement"
 )
 
+// 单个限量系列允许的最大发行量
+// 拷贝在第一次转移时才写入，创建系列的开销与发行量无关；查询系列和作者的 NFT 时要逐个检查编号，不能太大
+// 后端不再重复校验上限，以链码为准
+const MAX_EDITION_SUPPLY = 1000
+
 // Account 账户信息
 type Account struct {
 	ID      int `json:"id"`
@@ -53,18 +72,96 @@ type WithHolding struct {
 	TimeStamp time.Time `json:"timeStamp"`
 }
 
+// 预扣款结算记录（释放或退款），以调用方传入的 txId 为主键，保证重复提交只生效一次
+type Settlement struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"` // RELEASE/REFUND
+	ListingID string    `json:"listingID"`
+	AccountID int       `json:"accountID"`
+	Amount    int       `json:"amount"`
+	TimeStamp time.Time `json:"timeStamp"`
+}
+
 // asset
 type Asset struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	ImageName     string    `json:"imageName"`
+	AuthorId      int       `json:"authorId"`
+	OwnerId       int       `json:"ownerId"`
+	Description   string    `json:"description"`
+	Rarity        string    `json:"rarity"`
+	ImageHash     string    `json:"imageHash,omitempty" metadata:",optional"`
+	SeriesID      string    `json:"seriesId,omitempty" metadata:",optional"`      // 限量系列ID，普通 NFT 为空
+	EditionNumber int       `json:"editionNumber,omitempty" metadata:",optional"` // 限量版编号，从 1 开始
+	EditionSupply int       `json:"editionSupply,omitempty" metadata:",optional"` // 限量版发行量
+	TimeStamp     time.Time `json:"timeStamp"`
+}
+
+// NFT 的历史版本
+type AssetVersion struct {
+	TxID      string    `json:"txId"`
+	TimeStamp time.Time `json:"timeStamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Asset     *Asset    `json:"asset,omitempty" metadata:",optional"`
+}
+
+// 限量系列：同一作品的共享元数据，每一份拷贝是一个带编号的 Asset
+type EditionSeries struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
 	ImageName   string    `json:"imageName"`
 	AuthorId    int       `json:"authorId"`
-	OwnerId     int       `json:"ownerId"`
 	Description string    `json:"description"`
-	Rarity      string    `json:"rarity"`
+	Supply      int       `json:"supply"`
 	TimeStamp   time.Time `json:"timeStamp"`
 }
 
+// 铸造凭证，创作者签名后挂出，买家兑换时才真正上链铸造
+type MintVoucher struct {
+	ID          string `json:"id"`
+	CreatorID   int    `json:"creatorId"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ImageName   string `json:"imageName"`
+	ImageHash   string `json:"imageHash"`
+	Price       int    `json:"price"`
+	Signature   string `json:"signature"`
+}
+
+// 已兑换的凭证记录，用于防止重复兑换
+type RedeemedVoucher struct {
+	ID        string    `json:"id"`
+	AssetID   string    `json:"assetId"`
+	BuyerID   int       `json:"buyerId"`
+	TimeStamp time.Time `json:"timeStamp"`
+}
+
+// 已撤回的凭证记录，撤回后不能再兑换
+type CancelledVoucher struct {
+	ID        string    `json:"id"`
+	CreatorID int       `json:"creatorId"`
+	TimeStamp time.Time `json:"timeStamp"`
+}
+
+// 账本审计发现的单条问题
+type AuditIssue struct {
+	Type   string `json:"type"`   // 问题类型
+	Key    string `json:"key"`    // 相关记录的业务主键
+	Detail string `json:"detail"` // 详细描述
+}
+
+// 账本审计报告
+type AuditReport struct {
+	AccountCount     int          `json:"accountCount"`     // 账户数
+	TotalBalance     int          `json:"totalBalance"`     // 账户余额合计
+	WithHoldingCount int          `json:"withHoldingCount"` // 预扣款记录数
+	TotalWithHeld    int          `json:"totalWithHeld"`    // 预扣款金额合计
+	AssetCount       int          `json:"assetCount"`       // NFT 数
+	Consistent       bool         `json:"consistent"`       // 是否没有发现问题
+	Issues           []AuditIssue `json:"issues"`           // 发现的问题
+}
+
 // QueryResult 分页查询结果
 type QueryResult struct {
 	Records             []interface{} `json:"records"`             // 记录列表
@@ -89,6 +186,98 @@ func (s *SmartContract) getClientIdentityMSPID(ctx contractapi.TransactionContex
 	return clientID.GetMSPID()
 }
 
+// 用户身份的 CN 前缀，后端在 Fabric CA 为每个用户登记的身份形如 user-<账户ID>.<随机后缀>
+const USER_IDENTITY_PREFIX = "user-"
+
+// 通用方法：从调用方身份（cid.GetID）推导账户 ID
+// 用户身份返回其账户 ID；服务身份和组织的 User1、Admin 等身份返回 false
+func (s *SmartContract) getCallerAccountID(ctx contractapi.TransactionContextInterface) (int, bool, error) {
+	clientID, err := cid.New(ctx.GetStub())
+	if err != nil {
+		return 0, false, fmt.Errorf("获取客户端身份信息失败：%v", err)
+	}
+	encoded, err := clientID.GetID()
+	if err != nil {
+		return 0, false, fmt.Errorf("获取客户端身份信息失败：%v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, false, fmt.Errorf("解析客户端身份失败：%v", err)
+	}
+	// 格式为 x509::<subject>::<issuer>
+	parts := strings.SplitN(string(decoded), "::", 3)
+	if len(parts) != 3 {
+		return 0, false, fmt.Errorf("无法识别的客户端身份")
+	}
+	for _, rdn := range strings.Split(parts[1], ",") {
+		cn, ok := strings.CutPrefix(rdn, "CN=")
+		if !ok {
+			continue
+		}
+		rest, ok := strings.CutPrefix(cn, USER_IDENTITY_PREFIX)
+		if !ok {
+			return 0, false, nil
+		}
+		idPart, _, _ := strings.Cut(rest, ".")
+		id, err := strconv.Atoi(idPart)
+		if err != nil {
+			return 0, false, fmt.Errorf("用户身份 %s 格式错误", cn)
+		}
+		return id, true, nil
+	}
+	return 0, false, nil
+}
+
+// 服务身份的 CA 属性，后端为每个组织登记的服务身份带有 role=service，组织共用的 User1、Admin 证书没有
+const (
+	SERVICE_ROLE_ATTRIBUTE = "role"
+	SERVICE_ROLE_VALUE     = "service"
+)
+
+// 通用方法：调用方是否为平台组织登记的服务身份
+// 证书必须带有 role=service 属性，且由三个组织之一的 MSP 签发
+func (s *SmartContract) isServiceIdentity(ctx contractapi.TransactionContextInterface) (bool, error) {
+	mspID, err := s.getClientIdentityMSPID(ctx)
+	if err != nil {
+		return false, err
+	}
+	if mspID != PLATFORM_ORG_MSPID && mspID != CREATOR_ORG_MSPID && mspID != FINANCE_ORG_MSPID {
+		return false, nil
+	}
+	if err := cid.AssertAttributeValue(ctx.GetStub(), SERVICE_ROLE_ATTRIBUTE, SERVICE_ROLE_VALUE); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// 通用方法：校验以 accountId 名义发起的操作
+// 只有证书对应该账户的用户身份可以调用，参数中的账户 ID 必须一致
+func (s *SmartContract) requireAccount(ctx contractapi.TransactionContextInterface, accountId int) error {
+	callerId, isUser, err := s.getCallerAccountID(ctx)
+	if err != nil {
+		return err
+	}
+	if !isUser {
+		return fmt.Errorf("只有账户 %d 的用户身份可以以该账户的名义操作", accountId)
+	}
+	if callerId != accountId {
+		return fmt.Errorf("调用方是账户 %d，不能以账户 %d 的名义操作", callerId, accountId)
+	}
+	return nil
+}
+
+// 通用方法：只允许服务身份调用，用于铸币、释放和退还预扣款等平台操作
+func (s *SmartContract) requireServiceIdentity(ctx contractapi.TransactionContextInterface) error {
+	ok, err := s.isServiceIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("只有带 %s=%s 属性的服务身份可以执行平台操作", SERVICE_ROLE_ATTRIBUTE, SERVICE_ROLE_VALUE)
+	}
+	return nil
+}
+
 // 通用方法：创建和获取复合键
 func (s *SmartContract) getCompositeKey(ctx contractapi.TransactionContextInterface, objectType string, attributes []string) (string, error) {
 	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
@@ -136,6 +325,9 @@ func (s *SmartContract) Hello(ctx contractapi.TransactionContextInterface) (stri
 
 // 创建账户信息
 func (s *SmartContract) CreateAccount(ctx contractapi.TransactionContextInterface, id int) error {
+	if err := s.requireAccount(ctx, id); err != nil {
+		return err
+	}
 	// 创建复合键
 	key, err := s.getCompositeKey(ctx, ACCOUNT_KEY, []string{fmt.Sprintf("%d", id)})
 	if err != nil {
@@ -171,6 +363,9 @@ func (s *SmartContract) GetBalance(ctx contractapi.TransactionContextInterface,
 
 // 转账
 func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, id string, senderId int, recipientId int, amount int, timeStamp time.Time) error {
+	if err := s.requireAccount(ctx, senderId); err != nil {
+		return err
+	}
 	// 转账金额检查
 	if amount <= 0 {
 		return fmt.Errorf("转账金额必须大于 0")
@@ -179,6 +374,18 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, id
 	if senderId == recipientId {
 		return fmt.Errorf("发送方和接收方不能是同一个账户")
 	}
+	// 同一个转账 ID 只生效一次，后端重试时可以放心重复提交
+	senderRecordKey, err := s.getCompositeKey(ctx, SENDER_KEY, []string{fmt.Sprintf("%d", senderId), id})
+	if err != nil {
+		return fmt.Errorf("创建复合键失败：%v", err)
+	}
+	existing, err := ctx.GetStub().GetState(senderRecordKey)
+	if err != nil {
+		return fmt.Errorf("读取状态失败：%v", err)
+	}
+	if existing != nil {
+		return nil
+	}
 	var senderAccount Account
 	key1, err := s.getCompositeKey(ctx, ACCOUNT_KEY, []string{fmt.Sprintf("%d", senderId)})
 	if err != nil {
@@ -253,6 +460,9 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, id
 
 // 铸币，暂时不存记录
 func (s *SmartContract) MintToken(ctx contractapi.TransactionContextInterface, accountID int, amount int) error {
+	if err := s.requireServiceIdentity(ctx); err != nil {
+		return err
+	}
 	if amount <= 0 {
 		return fmt.Errorf("铸币金额必须大于 0")
 	}
@@ -323,6 +533,9 @@ func (s *SmartContract) GetTransferByRecipientID(ctx contractapi.TransactionCont
 
 // 预扣款一定金额
 func (s *SmartContract) WithHoldAccount(ctx contractapi.TransactionContextInterface, id string, accountId int, listingID string, amount int, timeStamp time.Time) error {
+	if err := s.requireAccount(ctx, accountId); err != nil {
+		return err
+	}
 	// 检查 ammount 是否大于 0
 	if amount <= 0 {
 		return fmt.Errorf("预扣款金额必须大于 0")
@@ -419,6 +632,9 @@ func (s *SmartContract) GetWithHoldingByListingID(ctx contractapi.TransactionCon
 
 // 清除所有预扣款
 func (s *SmartContract) ClearWithHolding(ctx contractapi.TransactionContextInterface, listingID string) error {
+	if err := s.requireServiceIdentity(ctx); err != nil {
+		return err
+	}
 	// 查询该商品的扣款记录
 	withHoldings, err := s.GetWithHoldingByListingID(ctx, listingID)
 	if err != nil {
@@ -471,6 +687,13 @@ func (s *SmartContract) ClearWithHolding(ctx contractapi.TransactionContextInter
 // 创建 NFT
 func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, id string, imageName string,
 	name string, authorId int, ownerId int, description string, timeStamp time.Time) (Asset, error) {
+	if err := s.requireAccount(ctx, authorId); err != nil {
+		return Asset{}, err
+	}
+	// 新建的 NFT 归作者所有，转给他人只能通过 TransferAsset
+	if ownerId != authorId {
+		return Asset{}, fmt.Errorf("新建的 NFT 必须由作者 %d 持有，不能直接发给账户 %d", authorId, ownerId)
+	}
 	asset := Asset{
 		ID:          id,
 		ImageName:   imageName,
@@ -508,17 +731,30 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 	return asset, nil
 }
 
-// 根据ID查询某个NFT
+// 根据ID查询某个NFT，还没有转移过的限量版拷贝由系列生成
 func (s *SmartContract) GetAssetByID(ctx contractapi.TransactionContextInterface, id string) (Asset, error) {
-	var asset Asset
 	key, err := s.getCompositeKey(ctx, ASSET_KEY1, []string{id})
 	if err != nil {
 		return Asset{}, fmt.Errorf("创建复合键失败：%v", err)
 	}
-	err = s.getState(ctx, key, &asset)
+	bytes, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return Asset{}, fmt.Errorf("查询 NFT 失败：%v", err)
 	}
+	if bytes == nil {
+		asset, ok, err := s.unmintedEdition(ctx, id)
+		if err != nil {
+			return Asset{}, err
+		}
+		if !ok {
+			return Asset{}, fmt.Errorf("查询 NFT 失败：键 %s 不存在", key)
+		}
+		return asset, nil
+	}
+	var asset Asset
+	if err := json.Unmarshal(bytes, &asset); err != nil {
+		return Asset{}, fmt.Errorf("解析数据失败：%v", err)
+	}
 	return asset, nil
 }
 
@@ -541,7 +777,11 @@ func (s *SmartContract) GetAssetByAuthorID(ctx contractapi.TransactionContextInt
 		}
 		assets = append(assets, asset)
 	}
-	return assets, nil
+	unminted, err := s.unmintedEditionsByAuthor(ctx, authorId)
+	if err != nil {
+		return nil, err
+	}
+	return append(assets, unminted...), nil
 }
 
 // 根据OwnerId查询某个NFT
@@ -563,21 +803,29 @@ func (s *SmartContract) GetAssetByOwnerID(ctx contractapi.TransactionContextInte
 		}
 		assets = append(assets, asset)
 	}
-	return assets, nil
+	// 还没有转移过的限量版拷贝属于作者
+	unminted, err := s.unmintedEditionsByAuthor(ctx, ownerId)
+	if err != nil {
+		return nil, err
+	}
+	return append(assets, unminted...), nil
 }
 
 // 转移 NFT 的所有权
 func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface, id string, newOwnerId int, userId int, timeStamp time.Time) error {
-	var asset Asset
+	if err := s.requireAccount(ctx, userId); err != nil {
+		return err
+	}
+	// 第一次转移的限量版拷贝没有记录，删除旧记录不会出错，之后写入三份记录
+	asset, err := s.GetAssetByID(ctx, id)
+	if err != nil {
+		return err
+	}
 	//三份记录都需要修改
 	key1, err := s.getCompositeKey(ctx, ASSET_KEY1, []string{id})
 	if err != nil {
 		return fmt.Errorf("创建复合键失败：%v", err)
 	}
-	err = s.getState(ctx, key1, &asset)
-	if err != nil {
-		return fmt.Errorf("查询 NFT 失败：%v", err)
-	}
 	// 确保转移请求是所有者发起的
 	if asset.OwnerId != userId {
 		return fmt.Errorf("只有 NFT 的所有者可以转移所有权")
@@ -634,8 +882,48 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 	return nil
 }
 
-// 卖家接受出价 -> 释放冻结资金到卖家
-func (s *SmartContract) ReleaseHolding(ctx contractapi.TransactionContextInterface, listingID string, sellerID int, amount int, timeStamp time.Time) error {
+// 查询结算记录是否存在
+func (s *SmartContract) isSettled(ctx contractapi.TransactionContextInterface, txId string) (bool, error) {
+	key, err := s.getCompositeKey(ctx, SETTLEMENT_KEY, []string{txId})
+	if err != nil {
+		return false, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	bytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("读取状态失败：%v", err)
+	}
+	return bytes != nil, nil
+}
+
+// 保存结算记录
+func (s *SmartContract) putSettlement(ctx contractapi.TransactionContextInterface, settlement Settlement) error {
+	key, err := s.getCompositeKey(ctx, SETTLEMENT_KEY, []string{settlement.ID})
+	if err != nil {
+		return fmt.Errorf("创建复合键失败：%v", err)
+	}
+	if err := s.putState(ctx, key, settlement); err != nil {
+		return fmt.Errorf("保存结算记录失败：%v", err)
+	}
+	return nil
+}
+
+// 卖家接受出价 -> 把赢家 bidderID 的冻结资金释放到卖家
+// txId 由后端生成，同一个 txId 重复提交时直接返回成功
+func (s *SmartContract) ReleaseHolding(ctx contractapi.TransactionContextInterface, listingID string, sellerID int, amount int, timeStamp time.Time, txId string, bidderID int) error {
+	if err := s.requireServiceIdentity(ctx); err != nil {
+		return err
+	}
+	settled, err := s.isSettled(ctx, txId)
+	if err != nil {
+		return err
+	}
+	if settled {
+		return nil
+	}
+	// 先删除赢家的冻结记录，冻结已经释放或退还时不能再给卖家加钱
+	if err := s.takeHoldings(ctx, listingID, bidderID, amount); err != nil {
+		return err
+	}
 	// 给卖家加钱
 	var seller Account
 	sellerKey, _ := s.getCompositeKey(ctx, ACCOUNT_KEY, []string{fmt.Sprintf("%d", sellerID)})
@@ -644,23 +932,33 @@ func (s *SmartContract) ReleaseHolding(ctx contractapi.TransactionContextInterfa
 	if err := s.putState(ctx, sellerKey, seller); err != nil {
 		return fmt.Errorf("更新卖家账户失败：%v", err)
 	}
+	return s.putSettlement(ctx, Settlement{
+		ID:        txId,
+		Type:      "RELEASE",
+		ListingID: listingID,
+		AccountID: sellerID,
+		Amount:    amount,
+		TimeStamp: timeStamp,
+	})
+}
 
-	// 删除 listing 下的冻结记录
-	withHoldings, err := s.GetWithHoldingByListingID(ctx, listingID)
+// 买家退款 -> 把冻结金额退回买家
+// txId 由后端生成，同一个 txId 重复提交时直接返回成功
+func (s *SmartContract) RefundHolding(ctx contractapi.TransactionContextInterface, listingID string, bidderID int, amount int, timeStamp time.Time, txId string) error {
+	if err := s.requireServiceIdentity(ctx); err != nil {
+		return err
+	}
+	settled, err := s.isSettled(ctx, txId)
 	if err != nil {
 		return err
 	}
-	for _, w := range withHoldings {
-		key1, _ := s.getCompositeKey(ctx, WITH_HOLDING_KEY1, []string{fmt.Sprintf("%d", w.AccountID), w.ID})
-		_ = ctx.GetStub().DelState(key1)
-		key2, _ := s.getCompositeKey(ctx, WITH_HOLDING_KEY2, []string{w.ListingID, w.ID})
-		_ = ctx.GetStub().DelState(key2)
+	if settled {
+		return nil
+	}
+	// 先删除冻结记录，冻结已经释放或退还时不能再退款
+	if err := s.takeHoldings(ctx, listingID, bidderID, amount); err != nil {
+		return err
 	}
-	return nil
-}
-
-// 买家退款 -> 把冻结金额退回买家
-func (s *SmartContract) RefundHolding(ctx contractapi.TransactionContextInterface, listingID string, bidderID int, amount int, timeStamp time.Time) error {
 	// 给买家退钱
 	var buyer Account
 	buyerKey, _ := s.getCompositeKey(ctx, ACCOUNT_KEY, []string{fmt.Sprintf("%d", bidderID)})
@@ -669,22 +967,712 @@ func (s *SmartContract) RefundHolding(ctx contractapi.TransactionContextInterfac
 	if err := s.putState(ctx, buyerKey, buyer); err != nil {
 		return fmt.Errorf("更新买家账户失败：%v", err)
 	}
+	return s.putSettlement(ctx, Settlement{
+		ID:        txId,
+		Type:      "REFUND",
+		ListingID: listingID,
+		AccountID: bidderID,
+		Amount:    amount,
+		TimeStamp: timeStamp,
+	})
+}
 
-	// 删除冻结记录
+// 删除账户在 listingID 下的全部冻结记录，没有冻结或者冻结总额与 amount 不一致时报错且不修改状态
+func (s *SmartContract) takeHoldings(ctx contractapi.TransactionContextInterface, listingID string, accountID int, amount int) error {
 	withHoldings, err := s.GetWithHoldingByListingID(ctx, listingID)
 	if err != nil {
 		return err
 	}
+	var held []WithHolding
+	total := 0
 	for _, w := range withHoldings {
-		if w.AccountID == bidderID {
-			key1, _ := s.getCompositeKey(ctx, WITH_HOLDING_KEY1, []string{fmt.Sprintf("%d", w.AccountID), w.ID})
-			_ = ctx.GetStub().DelState(key1)
-			key2, _ := s.getCompositeKey(ctx, WITH_HOLDING_KEY2, []string{w.ListingID, w.ID})
-			_ = ctx.GetStub().DelState(key2)
+		if w.AccountID == accountID {
+			held = append(held, w)
+			total += w.Amount
 		}
 	}
+	if len(held) == 0 {
+		return fmt.Errorf("账户 %d 在 %s 下没有冻结资金，可能已经释放或退还", accountID, listingID)
+	}
+	if total != amount {
+		return fmt.Errorf("账户 %d 在 %s 下冻结了 %d，与结算金额 %d 不一致", accountID, listingID, total, amount)
+	}
+	for _, w := range held {
+		key1, _ := s.getCompositeKey(ctx, WITH_HOLDING_KEY1, []string{fmt.Sprintf("%d", w.AccountID), w.ID})
+		_ = ctx.GetStub().DelState(key1)
+		key2, _ := s.getCompositeKey(ctx, WITH_HOLDING_KEY2, []string{w.ListingID, w.ID})
+		_ = ctx.GetStub().DelState(key2)
+	}
 	return nil
 }
+
+// 凭证签名摘要，字段顺序需要与后端保持一致
+func voucherDigest(v MintVoucher) []byte {
+	payload := fmt.Sprintf("%s|%d|%s|%s|%s|%s|%d", v.ID, v.CreatorID, v.Name, v.Description, v.ImageName, v.ImageHash, v.Price)
+	digest := sha256.Sum256([]byte(payload))
+	return digest[:]
+}
+
+// 登记创作者的凭证签名公钥（PEM 格式），只允许创作者组织调用
+func (s *SmartContract) SetSignerKey(ctx contractapi.TransactionContextInterface, accountId int, publicKeyPEM string) error {
+	mspID, err := s.getClientIdentityMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID != CREATOR_ORG_MSPID {
+		return fmt.Errorf("只有创作者组织可以登记签名公钥")
+	}
+	if err := s.requireAccount(ctx, accountId); err != nil {
+		return err
+	}
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return fmt.Errorf("公钥格式错误")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析公钥失败：%v", err)
+	}
+	if _, ok := pub.(*ecdsa.PublicKey); !ok {
+		return fmt.Errorf("只支持 ECDSA 公钥")
+	}
+	key, err := s.getCompositeKey(ctx, SIGNER_KEY, []string{fmt.Sprintf("%d", accountId)})
+	if err != nil {
+		return fmt.Errorf("创建复合键失败：%v", err)
+	}
+	return s.putState(ctx, key, publicKeyPEM)
+}
+
+// 查询创作者的凭证签名公钥
+func (s *SmartContract) GetSignerKey(ctx contractapi.TransactionContextInterface, accountId int) (string, error) {
+	key, err := s.getCompositeKey(ctx, SIGNER_KEY, []string{fmt.Sprintf("%d", accountId)})
+	if err != nil {
+		return "", fmt.Errorf("创建复合键失败：%v", err)
+	}
+	var publicKeyPEM string
+	err = s.getState(ctx, key, &publicKeyPEM)
+	if err != nil {
+		return "", fmt.Errorf("查询签名公钥失败：%v", err)
+	}
+	return publicKeyPEM, nil
+}
+
+// 校验凭证签名
+func (s *SmartContract) verifyVoucher(ctx contractapi.TransactionContextInterface, voucher MintVoucher) error {
+	publicKeyPEM, err := s.GetSignerKey(ctx, voucher.CreatorID)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return fmt.Errorf("公钥格式错误")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析公钥失败：%v", err)
+	}
+	ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("只支持 ECDSA 公钥")
+	}
+	signature, err := base64.StdEncoding.DecodeString(voucher.Signature)
+	if err != nil {
+		return fmt.Errorf("解析签名失败：%v", err)
+	}
+	if !ecdsa.VerifyASN1(ecdsaPub, voucherDigest(voucher), signature) {
+		return fmt.Errorf("凭证签名校验失败")
+	}
+	return nil
+}
+
+// 查询凭证是否已经兑换
+func (s *SmartContract) IsVoucherRedeemed(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	key, err := s.getCompositeKey(ctx, VOUCHER_KEY, []string{id})
+	if err != nil {
+		return false, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	bytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("读取状态失败：%v", err)
+	}
+	return bytes != nil, nil
+}
+
+// 查询凭证是否已经撤回
+func (s *SmartContract) IsVoucherCancelled(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	key, err := s.getCompositeKey(ctx, VOUCHER_CANCEL, []string{id})
+	if err != nil {
+		return false, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	bytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("读取状态失败：%v", err)
+	}
+	return bytes != nil, nil
+}
+
+// 撤回铸造凭证：只有签名的创作者可以撤回，已兑换的凭证不能撤回
+// 凭证签名在链下完成，撤回记录上链后链码拒绝兑换，避免创作者撤回后旧凭证仍被兑换
+func (s *SmartContract) CancelVoucher(ctx contractapi.TransactionContextInterface, voucher MintVoucher, timeStamp time.Time) error {
+	if err := s.requireAccount(ctx, voucher.CreatorID); err != nil {
+		return err
+	}
+	if err := s.verifyVoucher(ctx, voucher); err != nil {
+		return err
+	}
+	redeemed, err := s.IsVoucherRedeemed(ctx, voucher.ID)
+	if err != nil {
+		return err
+	}
+	if redeemed {
+		return fmt.Errorf("凭证已被兑换")
+	}
+	cancelled, err := s.IsVoucherCancelled(ctx, voucher.ID)
+	if err != nil {
+		return err
+	}
+	if cancelled {
+		return fmt.Errorf("凭证已被撤回")
+	}
+	key, err := s.getCompositeKey(ctx, VOUCHER_CANCEL, []string{voucher.ID})
+	if err != nil {
+		return fmt.Errorf("创建复合键失败：%v", err)
+	}
+	return s.putState(ctx, key, CancelledVoucher{
+		ID:        voucher.ID,
+		CreatorID: voucher.CreatorID,
+		TimeStamp: timeStamp,
+	})
+}
+
+// 兑换铸造凭证：校验签名后在同一笔交易内完成付款和铸造
+func (s *SmartContract) RedeemVoucher(ctx contractapi.TransactionContextInterface, voucher MintVoucher, buyerId int,
+	assetId string, transferId string, timeStamp time.Time) (Asset, error) {
+	if err := s.requireAccount(ctx, buyerId); err != nil {
+		return Asset{}, err
+	}
+	if voucher.Price <= 0 {
+		return Asset{}, fmt.Errorf("凭证价格必须大于 0")
+	}
+	if voucher.CreatorID == buyerId {
+		return Asset{}, fmt.Errorf("不能兑换自己的凭证")
+	}
+	redeemed, err := s.IsVoucherRedeemed(ctx, voucher.ID)
+	if err != nil {
+		return Asset{}, err
+	}
+	if redeemed {
+		return Asset{}, fmt.Errorf("凭证已被兑换")
+	}
+	cancelled, err := s.IsVoucherCancelled(ctx, voucher.ID)
+	if err != nil {
+		return Asset{}, err
+	}
+	if cancelled {
+		return Asset{}, fmt.Errorf("凭证已被撤回")
+	}
+	if err := s.verifyVoucher(ctx, voucher); err != nil {
+		return Asset{}, err
+	}
+	// 检查资产 ID 是否已被占用
+	key1, err := s.getCompositeKey(ctx, ASSET_KEY1, []string{assetId})
+	if err != nil {
+		return Asset{}, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	var existing Asset
+	if err := s.getState(ctx, key1, &existing); err == nil {
+		return Asset{}, fmt.Errorf("NFT %s 已存在", assetId)
+	}
+	// 买家付款给创作者
+	if err := s.Transfer(ctx, transferId, buyerId, voucher.CreatorID, voucher.Price, timeStamp); err != nil {
+		return Asset{}, err
+	}
+	// 铸造 NFT，作者是创作者，所有者直接是买家
+	asset := Asset{
+		ID:          assetId,
+		ImageName:   voucher.ImageName,
+		Name:        voucher.Name,
+		AuthorId:    voucher.CreatorID,
+		OwnerId:     buyerId,
+		Description: voucher.Description,
+		ImageHash:   voucher.ImageHash,
+		TimeStamp:   timeStamp,
+	}
+	if err := s.putAsset(ctx, asset); err != nil {
+		return Asset{}, err
+	}
+	// 记录兑换，防止重放
+	key, err := s.getCompositeKey(ctx, VOUCHER_KEY, []string{voucher.ID})
+	if err != nil {
+		return Asset{}, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	err = s.putState(ctx, key, RedeemedVoucher{
+		ID:        voucher.ID,
+		AssetID:   assetId,
+		BuyerID:   buyerId,
+		TimeStamp: timeStamp,
+	})
+	if err != nil {
+		return Asset{}, fmt.Errorf("保存兑换记录失败：%v", err)
+	}
+	return asset, nil
+}
+
+// 写入 NFT 的三份记录（ID、AuthorId、OwnerId 三个索引）
+func (s *SmartContract) putAsset(ctx contractapi.TransactionContextInterface, asset Asset) error {
+	key1, err := s.getCompositeKey(ctx, ASSET_KEY1, []string{asset.ID})
+	if err != nil {
+		return fmt.Errorf("创建复合键失败：%v", err)
+	}
+	key2, err := s.getCompositeKey(ctx, ASSET_KEY2, []string{fmt.Sprintf("%d", asset.AuthorId), asset.ID})
+	if err != nil {
+		return fmt.Errorf("创建复合键失败：%v", err)
+	}
+	key3, err := s.getCompositeKey(ctx, ASSET_KEY3, []string{fmt.Sprintf("%d", asset.OwnerId), asset.ID})
+	if err != nil {
+		return fmt.Errorf("创建复合键失败：%v", err)
+	}
+	for _, key := range []string{key1, key2, key3} {
+		if err := s.putState(ctx, key, asset); err != nil {
+			return fmt.Errorf("保存 NFT 失败：%v", err)
+		}
+	}
+	return nil
+}
+
+// 限量版拷贝的资产 ID，形如 <系列ID>_<编号>
+func editionAssetID(seriesId string, editionNumber int) string {
+	return fmt.Sprintf("%s_%d", seriesId, editionNumber)
+}
+
+// 创建限量系列，全部编号的拷贝属于作者
+// 只保存系列和作者索引，拷贝在第一次转移时才写入三份记录，之前由系列生成
+func (s *SmartContract) CreateEditionSeries(ctx contractapi.TransactionContextInterface, id string, imageName string,
+	name string, authorId int, description string, supply int, timeStamp time.Time) (EditionSeries, error) {
+	if err := s.requireAccount(ctx, authorId); err != nil {
+		return EditionSeries{}, err
+	}
+	if supply <= 0 || supply > MAX_EDITION_SUPPLY {
+		return EditionSeries{}, fmt.Errorf("发行量必须在 1 到 %d 之间", MAX_EDITION_SUPPLY)
+	}
+	key, err := s.getCompositeKey(ctx, SERIES_KEY, []string{id})
+	if err != nil {
+		return EditionSeries{}, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	var existing EditionSeries
+	if err := s.getState(ctx, key, &existing); err == nil {
+		return EditionSeries{}, fmt.Errorf("限量系列已存在")
+	}
+	series := EditionSeries{
+		ID:          id,
+		Name:        name,
+		ImageName:   imageName,
+		AuthorId:    authorId,
+		Description: description,
+		Supply:      supply,
+		TimeStamp:   timeStamp,
+	}
+	if err := s.putState(ctx, key, series); err != nil {
+		return EditionSeries{}, fmt.Errorf("保存限量系列失败：%v", err)
+	}
+	authorKey, err := s.getCompositeKey(ctx, SERIES_AUTHOR_KEY, []string{fmt.Sprintf("%d", authorId), id})
+	if err != nil {
+		return EditionSeries{}, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	if err := s.putState(ctx, authorKey, series); err != nil {
+		return EditionSeries{}, fmt.Errorf("保存限量系列失败：%v", err)
+	}
+	return series, nil
+}
+
+// 系列中编号为 n 的拷贝的初始状态
+func (series EditionSeries) edition(n int) Asset {
+	return Asset{
+		ID:            editionAssetID(series.ID, n),
+		ImageName:     series.ImageName,
+		Name:          series.Name,
+		AuthorId:      series.AuthorId,
+		OwnerId:       series.AuthorId,
+		Description:   series.Description,
+		SeriesID:      series.ID,
+		EditionNumber: n,
+		EditionSupply: series.Supply,
+		TimeStamp:     series.TimeStamp,
+	}
+}
+
+// 没有记录的 ID 如果是某个系列的合法编号，返回该拷贝的初始状态
+func (s *SmartContract) unmintedEdition(ctx contractapi.TransactionContextInterface, id string) (Asset, bool, error) {
+	i := strings.LastIndex(id, "_")
+	if i < 0 {
+		return Asset{}, false, nil
+	}
+	n, err := strconv.Atoi(id[i+1:])
+	if err != nil || n <= 0 {
+		return Asset{}, false, nil
+	}
+	key, err := s.getCompositeKey(ctx, SERIES_KEY, []string{id[:i]})
+	if err != nil {
+		return Asset{}, false, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	bytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return Asset{}, false, fmt.Errorf("查询限量系列失败：%v", err)
+	}
+	if bytes == nil {
+		return Asset{}, false, nil
+	}
+	var series EditionSeries
+	if err := json.Unmarshal(bytes, &series); err != nil {
+		return Asset{}, false, fmt.Errorf("解析数据失败：%v", err)
+	}
+	if n > series.Supply {
+		return Asset{}, false, nil
+	}
+	return series.edition(n), true, nil
+}
+
+// 作者所有系列中还没有转移过的拷贝
+func (s *SmartContract) unmintedEditionsByAuthor(ctx contractapi.TransactionContextInterface, authorId int) ([]Asset, error) {
+	results, err := ctx.GetStub().GetStateByPartialCompositeKey(SERIES_AUTHOR_KEY, []string{fmt.Sprintf("%d", authorId)})
+	if err != nil {
+		return nil, fmt.Errorf("查询限量系列失败：%v", err)
+	}
+	defer results.Close()
+	var assets []Asset
+	for results.HasNext() {
+		result, err := results.Next()
+		if err != nil {
+			return nil, fmt.Errorf("查询限量系列失败：%v", err)
+		}
+		var series EditionSeries
+		if err := json.Unmarshal(result.Value, &series); err != nil {
+			return nil, fmt.Errorf("解析数据失败：%v", err)
+		}
+		for n := 1; n <= series.Supply; n++ {
+			key, err := s.getCompositeKey(ctx, ASSET_KEY1, []string{editionAssetID(series.ID, n)})
+			if err != nil {
+				return nil, fmt.Errorf("创建复合键失败：%v", err)
+			}
+			bytes, err := ctx.GetStub().GetState(key)
+			if err != nil {
+				return nil, fmt.Errorf("查询 NFT 失败：%v", err)
+			}
+			if bytes == nil {
+				assets = append(assets, series.edition(n))
+			}
+		}
+	}
+	return assets, nil
+}
+
+// 查询限量系列的共享元数据
+func (s *SmartContract) GetEditionSeries(ctx contractapi.TransactionContextInterface, id string) (EditionSeries, error) {
+	var series EditionSeries
+	key, err := s.getCompositeKey(ctx, SERIES_KEY, []string{id})
+	if err != nil {
+		return EditionSeries{}, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	err = s.getState(ctx, key, &series)
+	if err != nil {
+		return EditionSeries{}, fmt.Errorf("查询限量系列失败：%v", err)
+	}
+	return series, nil
+}
+
+// 查询限量系列下所有编号的拷贝及其所有者
+func (s *SmartContract) GetEditionsBySeriesID(ctx contractapi.TransactionContextInterface, id string) ([]Asset, error) {
+	series, err := s.GetEditionSeries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	assets := make([]Asset, 0, series.Supply)
+	for n := 1; n <= series.Supply; n++ {
+		asset, err := s.GetAssetByID(ctx, editionAssetID(id, n))
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, nil
+}
+
+// 审计时读取某个前缀下的全部记录，返回 复合键 -> 原始值
+func (s *SmartContract) scanAll(ctx contractapi.TransactionContextInterface, objectType string) (map[string][]byte, error) {
+	results, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("查询 %s 记录失败：%v", objectType, err)
+	}
+	defer results.Close()
+	records := make(map[string][]byte)
+	for results.HasNext() {
+		result, err := results.Next()
+		if err != nil {
+			return nil, fmt.Errorf("查询 %s 记录失败：%v", objectType, err)
+		}
+		records[result.Key] = result.Value
+	}
+	return records, nil
+}
+
+// AuditLedger 只读审计：检查账户、预扣款两份索引、NFT 三份索引是否一致
+func (s *SmartContract) AuditLedger(ctx contractapi.TransactionContextInterface) (AuditReport, error) {
+	report := AuditReport{Issues: []AuditIssue{}}
+	addIssue := func(issueType, key, format string, args ...interface{}) {
+		report.Issues = append(report.Issues, AuditIssue{Type: issueType, Key: key, Detail: fmt.Sprintf(format, args...)})
+	}
+	stub := ctx.GetStub()
+
+	// 1) 账户
+	accounts, err := s.scanAll(ctx, ACCOUNT_KEY)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	accountIDs := make(map[int]bool)
+	for key, value := range accounts {
+		_, attrs, err := stub.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 1 {
+			addIssue("ACCOUNT_KEY", key, "账户复合键格式错误")
+			continue
+		}
+		var account Account
+		if err := json.Unmarshal(value, &account); err != nil {
+			addIssue("ACCOUNT_DATA", attrs[0], "账户数据无法解析：%v", err)
+			continue
+		}
+		if fmt.Sprintf("%d", account.ID) != attrs[0] {
+			addIssue("ACCOUNT_KEY", attrs[0], "键中的账户 %s 与记录中的账户 %d 不一致", attrs[0], account.ID)
+		}
+		if account.Balance < 0 {
+			addIssue("ACCOUNT_BALANCE", attrs[0], "账户余额为负数：%d", account.Balance)
+		}
+		accountIDs[account.ID] = true
+		report.AccountCount++
+		report.TotalBalance += account.Balance
+	}
+
+	// 2) 预扣款：withHolding1（按账户）与 withHolding2（按商品）必须一一对应
+	byAccount, err := s.scanAll(ctx, WITH_HOLDING_KEY1)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	byListing, err := s.scanAll(ctx, WITH_HOLDING_KEY2)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	holdings1 := make(map[string][]byte)
+	for key, value := range byAccount {
+		_, attrs, err := stub.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 2 {
+			addIssue("WITHHOLDING_KEY", key, "%s 复合键格式错误", WITH_HOLDING_KEY1)
+			continue
+		}
+		var w WithHolding
+		if err := json.Unmarshal(value, &w); err != nil {
+			addIssue("WITHHOLDING_DATA", attrs[1], "%s 数据无法解析：%v", WITH_HOLDING_KEY1, err)
+			continue
+		}
+		if fmt.Sprintf("%d", w.AccountID) != attrs[0] || w.ID != attrs[1] {
+			addIssue("WITHHOLDING_KEY", attrs[1], "%s 键与记录内容不一致", WITH_HOLDING_KEY1)
+		}
+		if !accountIDs[w.AccountID] {
+			addIssue("WITHHOLDING_ACCOUNT", w.ID, "预扣款对应的账户 %d 不存在", w.AccountID)
+		}
+		if w.Amount <= 0 {
+			addIssue("WITHHOLDING_AMOUNT", w.ID, "预扣款金额非法：%d", w.Amount)
+		}
+		holdings1[w.ID] = value
+		report.WithHoldingCount++
+		report.TotalWithHeld += w.Amount
+	}
+	holdings2 := make(map[string][]byte)
+	for key, value := range byListing {
+		_, attrs, err := stub.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 2 {
+			addIssue("WITHHOLDING_KEY", key, "%s 复合键格式错误", WITH_HOLDING_KEY2)
+			continue
+		}
+		var w WithHolding
+		if err := json.Unmarshal(value, &w); err != nil {
+			addIssue("WITHHOLDING_DATA", attrs[1], "%s 数据无法解析：%v", WITH_HOLDING_KEY2, err)
+			continue
+		}
+		if w.ListingID != attrs[0] || w.ID != attrs[1] {
+			addIssue("WITHHOLDING_KEY", attrs[1], "%s 键与记录内容不一致", WITH_HOLDING_KEY2)
+		}
+		holdings2[w.ID] = value
+	}
+	for id, value := range holdings1 {
+		other, ok := holdings2[id]
+		if !ok {
+			addIssue("WITHHOLDING_MISSING", id, "预扣款只存在于 %s，缺少 %s 副本", WITH_HOLDING_KEY1, WITH_HOLDING_KEY2)
+			continue
+		}
+		if string(value) != string(other) {
+			addIssue("WITHHOLDING_MISMATCH", id, "预扣款两份副本内容不一致")
+		}
+	}
+	for id := range holdings2 {
+		if _, ok := holdings1[id]; !ok {
+			addIssue("WITHHOLDING_MISSING", id, "预扣款只存在于 %s，缺少 %s 副本", WITH_HOLDING_KEY2, WITH_HOLDING_KEY1)
+		}
+	}
+
+	// 3) NFT：asset1（按ID）为准，asset2（按作者）、asset3（按所有者）必须与之一致
+	assets1, err := s.scanAll(ctx, ASSET_KEY1)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	assets2, err := s.scanAll(ctx, ASSET_KEY2)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	assets3, err := s.scanAll(ctx, ASSET_KEY3)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	primary := make(map[string]Asset)
+	for key, value := range assets1 {
+		_, attrs, err := stub.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 1 {
+			addIssue("ASSET_KEY", key, "%s 复合键格式错误", ASSET_KEY1)
+			continue
+		}
+		var asset Asset
+		if err := json.Unmarshal(value, &asset); err != nil {
+			addIssue("ASSET_DATA", attrs[0], "%s 数据无法解析：%v", ASSET_KEY1, err)
+			continue
+		}
+		if asset.ID != attrs[0] {
+			addIssue("ASSET_KEY", attrs[0], "%s 键与记录中的 ID %s 不一致", ASSET_KEY1, asset.ID)
+		}
+		primary[asset.ID] = asset
+		report.AssetCount++
+
+		key2, err := s.getCompositeKey(ctx, ASSET_KEY2, []string{fmt.Sprintf("%d", asset.AuthorId), asset.ID})
+		if err != nil {
+			return AuditReport{}, err
+		}
+		if copy2, ok := assets2[key2]; !ok {
+			addIssue("ASSET_MISSING", asset.ID, "缺少 %s 副本（作者 %d）", ASSET_KEY2, asset.AuthorId)
+		} else if string(copy2) != string(value) {
+			addIssue("ASSET_MISMATCH", asset.ID, "%s 副本与 %s 不一致", ASSET_KEY2, ASSET_KEY1)
+		}
+		key3, err := s.getCompositeKey(ctx, ASSET_KEY3, []string{fmt.Sprintf("%d", asset.OwnerId), asset.ID})
+		if err != nil {
+			return AuditReport{}, err
+		}
+		if copy3, ok := assets3[key3]; !ok {
+			addIssue("ASSET_MISSING", asset.ID, "缺少 %s 副本（所有者 %d）", ASSET_KEY3, asset.OwnerId)
+		} else if string(copy3) != string(value) {
+			addIssue("ASSET_MISMATCH", asset.ID, "%s 副本与 %s 不一致", ASSET_KEY3, ASSET_KEY1)
+		}
+	}
+	// 找出多余的副本，例如转移所有权后没删掉的旧 asset3
+	for _, index := range []struct {
+		objectType string
+		records    map[string][]byte
+		holder     func(Asset) int
+	}{
+		{ASSET_KEY2, assets2, func(a Asset) int { return a.AuthorId }},
+		{ASSET_KEY3, assets3, func(a Asset) int { return a.OwnerId }},
+	} {
+		for key := range index.records {
+			_, attrs, err := stub.SplitCompositeKey(key)
+			if err != nil || len(attrs) != 2 {
+				addIssue("ASSET_KEY", key, "%s 复合键格式错误", index.objectType)
+				continue
+			}
+			asset, ok := primary[attrs[1]]
+			if !ok {
+				addIssue("ASSET_ORPHAN", attrs[1], "%s 副本没有对应的 %s 主记录", index.objectType, ASSET_KEY1)
+				continue
+			}
+			if fmt.Sprintf("%d", index.holder(asset)) != attrs[0] {
+				addIssue("ASSET_ORPHAN", attrs[1], "%s 中存在过期副本（账户 %s）", index.objectType, attrs[0])
+			}
+		}
+	}
+
+	// map 遍历顺序不固定，排序后输出保证结果稳定
+	sort.Slice(report.Issues, func(i, j int) bool {
+		if report.Issues[i].Type != report.Issues[j].Type {
+			return report.Issues[i].Type < report.Issues[j].Type
+		}
+		return report.Issues[i].Key < report.Issues[j].Key
+	})
+	report.Consistent = len(report.Issues) == 0
+	return report, nil
+}
+
+// 修改 NFT 的名称和描述，只允许作者在仍持有该 NFT 时修改
+func (s *SmartContract) UpdateAssetMetadata(ctx contractapi.TransactionContextInterface, id string, name string,
+	description string, userId int) (Asset, error) {
+	if err := s.requireAccount(ctx, userId); err != nil {
+		return Asset{}, err
+	}
+	asset, err := s.GetAssetByID(ctx, id)
+	if err != nil {
+		return Asset{}, err
+	}
+	if asset.AuthorId != userId {
+		return Asset{}, fmt.Errorf("只有 NFT 的作者可以修改元数据")
+	}
+	if asset.OwnerId != userId {
+		return Asset{}, fmt.Errorf("NFT 已转移，作者不能再修改元数据")
+	}
+	if asset.SeriesID != "" {
+		return Asset{}, fmt.Errorf("限量版拷贝共享系列元数据，不能单独修改")
+	}
+	if name == "" {
+		return Asset{}, fmt.Errorf("名称不能为空")
+	}
+	asset.Name = name
+	asset.Description = description
+	// 三份记录的键都不变，直接覆盖写入即可保持一致
+	if err := s.putAsset(ctx, asset); err != nil {
+		return Asset{}, err
+	}
+	return asset, nil
+}
+
+// 查询 NFT 的历史版本（按主记录 asset1 的修改历史），最新的在前
+func (s *SmartContract) GetAssetHistory(ctx contractapi.TransactionContextInterface, id string) ([]AssetVersion, error) {
+	key, err := s.getCompositeKey(ctx, ASSET_KEY1, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("创建复合键失败：%v", err)
+	}
+	results, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("查询 NFT 历史失败：%v", err)
+	}
+	defer results.Close()
+
+	var versions []AssetVersion
+	for results.HasNext() {
+		result, err := results.Next()
+		if err != nil {
+			return nil, fmt.Errorf("查询 NFT 历史失败：%v", err)
+		}
+		version := AssetVersion{
+			TxID:     result.TxId,
+			IsDelete: result.IsDelete,
+		}
+		if result.Timestamp != nil {
+			version.TimeStamp = result.Timestamp.AsTime()
+		}
+		if !result.IsDelete && result.Value != nil {
+			var asset Asset
+			if err := json.Unmarshal(result.Value, &asset); err != nil {
+				return nil, fmt.Errorf("解析数据失败：%v", err)
+			}
+			version.Asset = &asset
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
 func main() {
 	chaincode, err := contractapi.NewChaincode(&SmartContract{})
 	if err != nil {
@@ -123,6 +123,27 @@ handle_error() {
     exit $exit_code
 }
 
+# 准备 Fabric CA 引导管理员的密码
+# 依次使用环境变量 ORGn_CA_ADMIN_PASSWORD、ORGn_CA_ADMIN_PASSWORD_FILE 指定的文件，都没有时随机生成
+# 密码写入 data/ca-secrets/orgN，后端通过 APP_FABRIC_ORGN_CA_REGISTRAR_SECRET_FILE 读取
+prepare_ca_secrets() {
+    mkdir -p data/ca-secrets
+    chmod 700 data/ca-secrets
+    for n in 1 2 3; do
+        local var="ORG${n}_CA_ADMIN_PASSWORD"
+        local file_var="${var}_FILE"
+        local password="${!var:-}"
+        if [ -z "$password" ] && [ -n "${!file_var:-}" ]; then
+            password=$(tr -d '\r\n' < "${!file_var}")
+        fi
+        if [ -z "$password" ]; then
+            password=$(head -c 16 /dev/urandom | od -An -tx1 | tr -d ' \n')
+        fi
+        (umask 077 && printf '%s' "$password" > "data/ca-secrets/org${n}")
+        export "$var=$password"
+    done
+}
+
 # 健康检查函数
 check_prerequisites() {
     local prerequisites=("docker" "docker-compose")
@@ -284,6 +305,7 @@ main() {
 
     # 启动所有节点
     show_progress 8 "启动所有节点" $start_time
+    execute_with_timer "准备CA管理员密码" "prepare_ca_secrets"
     execute_with_timer "启动节点" "docker-compose up -d"
     wait_for_completion "等待节点启动（${NETWORK_STARTUP_WAIT}秒）" $NETWORK_STARTUP_WAIT
 